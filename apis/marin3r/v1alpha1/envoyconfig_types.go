@@ -17,9 +17,12 @@ limitations under the License.
 package v1alpha1
 
 import (
-	reconcilerutil "github.com/3scale-ops/basereconciler/util"
+	"time"
+
 	"github.com/3scale-ops/marin3r/pkg/envoy"
+	defaults "github.com/3scale-ops/marin3r/pkg/envoy/container/defaults"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"github.com/robfig/cron/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -38,6 +41,10 @@ const (
 	// tainted
 	RollbackFailedCondition string = "RollbackFailed"
 
+	// FleetInSyncCondition indicates that all the Envoy clients subscribed
+	// to the nodeID have acknowledged the published version of the resources
+	FleetInSyncCondition string = "FleetInSync"
+
 	/* State */
 
 	//InSyncState indicates that a EnvoyConfig object has its resources spec
@@ -51,6 +58,152 @@ const (
 	// RollbackFailedState indicates that there is no untainted revision that
 	// can be pusblished in the xds server cache
 	RollbackFailedState string = "RollbackFailed"
+
+	// RolloutState indicates that a EnvoyConfig object is progressively rolling
+	// out the desired version of the resources spec to its Envoy clients
+	RolloutState string = "Rollout"
+
+	// PinnedState indicates that a EnvoyConfig object is publishing the
+	// version of the resources spec pinned in the spec
+	PinnedState string = "Pinned"
+
+	// SuspendedState indicates that a EnvoyConfig object is holding the
+	// publication of the desired version of the resources spec because
+	// it is suspended
+	SuspendedState string = "Suspended"
+
+	// PendingApprovalState indicates that a EnvoyConfig object is holding
+	// the publication of the desired version of the resources spec until
+	// it gets approved
+	PendingApprovalState string = "PendingApproval"
+
+	// OutsidePublishWindowState indicates that a EnvoyConfig object is
+	// holding the publication of the desired version of the resources spec
+	// until one of its publish windows opens
+	OutsidePublishWindowState string = "OutsidePublishWindow"
+
+	/* Annotations */
+
+	// ApprovedVersionAnnotation is an annotation that, when added to an EnvoyConfig
+	// that requires approval, approves the publication of the revision whose version
+	// matches the value of the annotation
+	ApprovedVersionAnnotation string = "marin3r.3scale.net/approved-version"
+
+	/* Defaults */
+
+	// DefaultRevisionHistoryLimit is the default maximum number of
+	// EnvoyConfigRevisions kept for an EnvoyConfig
+	DefaultRevisionHistoryLimit int32 = 10
+)
+
+const (
+	// DefaultFailurePolicyNACKsPerPod is the default number of NACKs an Envoy
+	// client needs to send for a version to be considered as failing
+	DefaultFailurePolicyNACKsPerPod int32 = 5
+
+	// DefaultFailurePolicyPodsPercentage is the default percentage of the
+	// Envoy clients that need to be failing for a revision to be tainted
+	DefaultFailurePolicyPodsPercentage int32 = 100
+)
+
+// HealthAnalysis configures the analysis of the stats of the Envoy clients after a revision
+// is published. The stats are periodically retrieved from the admin API of the Pods subscribed
+// to the nodeID during the bake time, and the revision is tainted if the increase of any of
+// them exceeds its threshold.
+type HealthAnalysis struct {
+	// Thresholds is the list of stats to analyze
+	// +kubebuilder:validation:MinItems=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Thresholds []StatThreshold `json:"thresholds"`
+	// BakeTime is the time the stats are analyzed after the revision is published.
+	// Defaults to 5m.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	BakeTime *metav1.Duration `json:"bakeTime,omitempty"`
+	// AdminPort is the port of the admin API of the Envoy clients. Defaults to 9901.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	AdminPort *uint32 `json:"adminPort,omitempty"`
+}
+
+// StatThreshold is the maximum increase allowed for an Envoy stat
+type StatThreshold struct {
+	// Stat is the name of the Envoy counters to analyze. The "*" wildcard matches
+	// any sequence of characters, for example "cluster.*.upstream_rq_5xx".
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Stat string `json:"stat"`
+	// MaxIncrease is the maximum increase of the matching counters during the bake
+	// time, summed across all the Envoy clients
+	// +kubebuilder:validation:Minimum=0
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MaxIncrease int64 `json:"maxIncrease"`
+}
+
+// GetBakeTime returns the time the stats are analyzed after the revision is published
+func (analysis *HealthAnalysis) GetBakeTime() time.Duration {
+	if analysis.BakeTime == nil {
+		return DefaultHealthAnalysisBakeTime
+	}
+	return analysis.BakeTime.Duration
+}
+
+// GetAdminPort returns the port of the admin API of the Envoy clients
+func (analysis *HealthAnalysis) GetAdminPort() uint32 {
+	if analysis.AdminPort == nil {
+		return DefaultHealthAnalysisAdminPort
+	}
+	return *analysis.AdminPort
+}
+
+// RevisionStorage determines where the resources of an EnvoyConfigRevision are stored
+type RevisionStorage string
+
+const (
+	// RevisionStorageInline stores the resources in the spec of the EnvoyConfigRevision
+	RevisionStorageInline RevisionStorage = "Inline"
+
+	// RevisionStorageConfigMap stores the resources compressed
+	// and sharded into ConfigMaps owned by the EnvoyConfigRevision
+	RevisionStorageConfigMap RevisionStorage = "ConfigMap"
+
+	// RevisionStorageSecret stores the resources compressed
+	// and sharded into Secrets owned by the EnvoyConfigRevision
+	RevisionStorageSecret RevisionStorage = "Secret"
+)
+
+// DeletionPolicy determines what happens with the resources published
+// for the nodeID of an EnvoyConfig when the EnvoyConfig is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyClear clears the resources published for the nodeID
+	// from the discovery service when the EnvoyConfig is deleted
+	DeletionPolicyClear DeletionPolicy = "Clear"
+
+	// DeletionPolicyRetain keeps serving the last resources published for the
+	// nodeID when the EnvoyConfig is deleted, until a new EnvoyConfig for the
+	// same nodeID publishes its resources or the retain TTL expires
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+const (
+	// DefaultHealthAnalysisBakeTime is the default time the stats of the
+	// Envoy clients are analyzed after a revision is published
+	DefaultHealthAnalysisBakeTime time.Duration = 5 * time.Minute
+
+	// DefaultHealthAnalysisAdminPort is the default port of
+	// the admin API of the Envoy clients
+	DefaultHealthAnalysisAdminPort uint32 = defaults.EnvoyAdminPort
+)
+
+const (
+	// DefaultRetryInitialCooldown is the default time to wait
+	// before the first retry of a tainted revision
+	DefaultRetryInitialCooldown time.Duration = time.Minute
+
+	// DefaultRetryMaxCooldown is the default maximum time to
+	// wait before a retry of a tainted revision
+	DefaultRetryMaxCooldown time.Duration = time.Hour
 )
 
 // EnvoyConfigSpec defines the desired state of EnvoyConfig
@@ -60,6 +213,12 @@ type EnvoyConfigSpec struct {
 	// +kubebuilder:validation:Pattern:[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	NodeID string `json:"nodeID"`
+	// NodeIDs is a list of additional nodeIDs the published resources are served to. All of them are
+	// served the same snapshot, so sets of Envoy clients that only differ in their nodeID can share
+	// a single EnvoyConfig. Revisions are still identified by spec.nodeID.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	NodeIDs []string `json:"nodeIDs,omitempty"`
 	// Serialization specicifies the serialization format used to describe the resources. "json" and "yaml"
 	// are supported. "json" is used if unset.
 	// +kubebuilder:validation:Enum=json;yaml
@@ -80,6 +239,286 @@ type EnvoyConfigSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
 	Resources []Resource `json:"resources,omitempty"`
+	// Includes is a list of names of EnvoyResourceLibraries, in the namespace of the EnvoyConfig, whose
+	// resources are merged into the resources of the EnvoyConfig. Resources of the same type and name
+	// declared in more than one place are an error. The templates in the resources of the libraries
+	// are rendered with the parameters of the EnvoyConfig. Changes in the included libraries produce
+	// new EnvoyConfigRevisions.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Includes []string `json:"includes,omitempty"`
+	// Parameters are values that can be referenced by name from Go template expressions in the string
+	// fields of the values of the resources, like in "{{ .upstream_host }}". The templates are rendered
+	// before calculating the version of the resources, so a change in the value of a parameter produces
+	// a new EnvoyConfigRevision holding the rendered resources. Templates are not rendered if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Rollout configures the progressive rollout of new versions of the resources. If
+	// unset, new versions are published to all the Envoy clients of the nodeID at once.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Rollout *RolloutPolicy `json:"rollout,omitempty"`
+	// RevisionHistoryLimit is the maximum number of EnvoyConfigRevisions to keep. The
+	// published and the pinned revisions are never deleted. Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// RevisionHistoryMaxAge is the maximum time an EnvoyConfigRevision is kept since it
+	// was last published, or created if it has never been published. The published and
+	// the pinned revisions are never deleted. Revisions are not deleted by age if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RevisionHistoryMaxAge *metav1.Duration `json:"revisionHistoryMaxAge,omitempty"`
+	// RevisionStorage determines where the resources of new EnvoyConfigRevisions are stored.
+	// With "Inline" they are copied to the spec of the EnvoyConfigRevision. With "ConfigMap"
+	// or "Secret" they are compressed and sharded into immutable ConfigMaps or Secrets owned
+	// by the EnvoyConfigRevision, so large configs don't exceed the size limit of a single
+	// object. Existing revisions are not migrated when changed. Defaults to "Inline".
+	// +kubebuilder:validation:Enum=Inline;ConfigMap;Secret
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RevisionStorage *RevisionStorage `json:"revisionStorage,omitempty"`
+	// PinnedVersion is the version of an existing EnvoyConfigRevision that is published
+	// instead of the version of the resources in the spec, for example to perform a manual
+	// rollback. The pinned version is ignored if there is no untainted EnvoyConfigRevision
+	// for it.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	PinnedVersion *string `json:"pinnedVersion,omitempty"`
+	// RetryPolicy configures the automatic retry of the revision for the resources in the
+	// spec when it gets tainted. Tainted revisions are not retried if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// FailurePolicy determines when a revision is considered to be failing, based on the
+	// NACKs received from the Envoy clients. Failing revisions get tainted and rolled back.
+	// By default a revision is tainted when all the clients have rejected it 5 times.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+	// HealthAnalysis configures the analysis of the stats of the Envoy clients after a
+	// revision is published. Revisions whose stats exceed the thresholds get tainted and
+	// rolled back. Published revisions are not analyzed if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	HealthAnalysis *HealthAnalysis `json:"healthAnalysis,omitempty"`
+	// DeletionPolicy determines what happens with the resources published for the nodeID
+	// when the EnvoyConfig is deleted. With "Clear" they are removed from the discovery
+	// service, so the Envoy clients lose their configuration. With "Retain" the last
+	// published resources keep being served until a new EnvoyConfig for the same nodeID
+	// publishes its resources or the RetainTTL expires. Defaults to "Clear".
+	// +kubebuilder:validation:Enum=Clear;Retain
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// RetainTTL is the maximum time the resources are retained after the EnvoyConfig is
+	// deleted with the "Retain" deletion policy. They are retained until a new EnvoyConfig
+	// for the same nodeID publishes its resources if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RetainTTL *metav1.Duration `json:"retainTTL,omitempty"`
+	// Suspend holds the publication of new versions of the resources. EnvoyConfigRevisions
+	// keep being created for the changes in the spec, but the currently published version
+	// is served until the EnvoyConfig is resumed. Rollbacks and pinned versions are still
+	// published. Defaults to false.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+	// RequireApproval holds the publication of new versions of the resources until they are
+	// approved by setting the "marin3r.3scale.net/approved-version" annotation of the
+	// EnvoyConfig to the version of the revision. Rollbacks and pinned versions don't
+	// require approval. Defaults to false.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RequireApproval *bool `json:"requireApproval,omitempty"`
+	// PublishWindows are the recurring periods of time during which new versions of the
+	// resources can be published. The publication of new versions is held while all the
+	// windows are closed. Rollbacks and pinned versions are published at any time. New
+	// versions can be published at any time if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	PublishWindows []PublishWindow `json:"publishWindows,omitempty"`
+}
+
+// Parameter is a named value that can be referenced from the templates in the values of the resources
+type Parameter struct {
+	// Name of the parameter, used to reference it from the templates
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_][a-zA-Z0-9_]*$`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Name string `json:"name"`
+	// Value is the literal value of the parameter
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Value *string `json:"value,omitempty"`
+	// ValueFrom is the source the value of the parameter is read from
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	ValueFrom *ParameterSource `json:"valueFrom,omitempty"`
+}
+
+// ParameterSource is the source of the value of a parameter
+type ParameterSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the EnvoyConfig
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef"`
+}
+
+// FailurePolicy determines when a revision is considered to be failing
+type FailurePolicy struct {
+	// NACKsPerPod is the number of NACKs an Envoy client needs to send for a
+	// version to be considered as failing in that client. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	NACKsPerPod *int32 `json:"nacksPerPod,omitempty"`
+	// PodsPercentage is the percentage of the Envoy clients that need to be failing
+	// for the revision to be tainted. Defaults to 100.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	PodsPercentage *int32 `json:"podsPercentage,omitempty"`
+	// EvaluationWindow is the period of time in which the NACKs are taken into
+	// account. NACKs older than this are ignored. All NACKs are taken into
+	// account if unset.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	EvaluationWindow *metav1.Duration `json:"evaluationWindow,omitempty"`
+}
+
+// GetNACKsPerPod returns the number of NACKs an Envoy client needs to send for
+// a version to be considered as failing in that client
+func (policy *FailurePolicy) GetNACKsPerPod() int64 {
+	if policy == nil || policy.NACKsPerPod == nil {
+		return int64(DefaultFailurePolicyNACKsPerPod)
+	}
+	return int64(*policy.NACKsPerPod)
+}
+
+// GetPodsRatio returns the ratio, between 0 and 1, of the Envoy clients
+// that need to be failing for the revision to be tainted
+func (policy *FailurePolicy) GetPodsRatio() float64 {
+	if policy == nil || policy.PodsPercentage == nil {
+		return float64(DefaultFailurePolicyPodsPercentage) / 100
+	}
+	return float64(*policy.PodsPercentage) / 100
+}
+
+// GetEvaluationWindow returns the period of time in which the NACKs are
+// taken into account. Zero means that all NACKs are taken into account.
+func (policy *FailurePolicy) GetEvaluationWindow() time.Duration {
+	if policy == nil || policy.EvaluationWindow == nil {
+		return 0
+	}
+	return policy.EvaluationWindow.Duration
+}
+
+// RetryPolicy configures the automatic retry of tainted revisions. The taint is cleared
+// after a cooldown that doubles with each attempt, starting at the initial cooldown and
+// up to the max cooldown.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a tainted revision is retried
+	// +kubebuilder:validation:Minimum=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	MaxAttempts int32 `json:"maxAttempts"`
+	// InitialCooldown is the time to wait before the first retry. Defaults to 1m.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	InitialCooldown *metav1.Duration `json:"initialCooldown,omitempty"`
+	// MaxCooldown is the maximum time to wait before a retry. Defaults to 1h.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	MaxCooldown *metav1.Duration `json:"maxCooldown,omitempty"`
+}
+
+// GetCooldown returns the time to wait before retrying a tainted
+// revision that has already been retried the given number of times
+func (policy *RetryPolicy) GetCooldown(attempts int32) time.Duration {
+	cooldown := DefaultRetryInitialCooldown
+	if policy.InitialCooldown != nil {
+		cooldown = policy.InitialCooldown.Duration
+	}
+	max := DefaultRetryMaxCooldown
+	if policy.MaxCooldown != nil {
+		max = policy.MaxCooldown.Duration
+	}
+
+	for i := int32(0); i < attempts && cooldown < max; i++ {
+		cooldown *= 2
+	}
+	if cooldown > max {
+		return max
+	}
+	return cooldown
+}
+
+// PublishWindow is a recurring period of time during which new versions can be published
+type PublishWindow struct {
+	// Schedule is a cron expression in the standard 5 field format that determines when
+	// the window opens, for example "0 9 * * 1-5". Schedules are evaluated in UTC unless
+	// prefixed with a "CRON_TZ=<timezone>" specification.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Schedule string `json:"schedule"`
+	// Duration is the time the window stays open
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Duration metav1.Duration `json:"duration"`
+}
+
+// IsOpen returns true if the window is open at the given time
+func (window *PublishWindow) IsOpen(now time.Time) (bool, error) {
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return false, err
+	}
+	// schedules without a timezone are evaluated in the timezone of the time passed to Next
+	return !schedule.Next(now.UTC().Add(-window.Duration.Duration)).After(now), nil
+}
+
+// NextOpening returns the first time the window opens after the given time
+func (window *PublishWindow) NextOpening(now time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(now.UTC()), nil
+}
+
+// RolloutPolicy configures the steps of a progressive rollout. Each new version is
+// first served to the percentage of the Envoy clients of the first step, and it is
+// promoted to the next step once all the selected clients have acknowledged it and
+// the bake time of the step has elapsed. The new version is published to all the
+// Envoy clients after the last step.
+type RolloutPolicy struct {
+	// Steps is the list of steps of the rollout. Percentages must be increasing.
+	// +kubebuilder:validation:MinItems=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Steps []RolloutStep `json:"steps"`
+}
+
+// RolloutStep is a step of a progressive rollout
+type RolloutStep struct {
+	// Percentage of the Envoy clients, identified by the "pod_name"
+	// node metadata, that receive the new version in this step
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Percentage int32 `json:"percentage"`
+	// BakeTime is the time the step needs to run after all the selected Envoy
+	// clients have acknowledged the new version before promoting to the next step
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	BakeTime *metav1.Duration `json:"bakeTime,omitempty"`
+}
+
+// GetBakeTime returns the bake time of the step
+func (step *RolloutStep) GetBakeTime() time.Duration {
+	if step.BakeTime == nil {
+		return 0
+	}
+	return step.BakeTime.Duration
 }
 
 // EnvoyConfigStatus defines the observed state of EnvoyConfig
@@ -101,6 +540,15 @@ type EnvoyConfigStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// +optional
 	DesiredVersion *string `json:"desiredVersion,omitempty"`
+	// PendingVersion is the version of the revision that is waiting to be published
+	// because the EnvoyConfig is suspended or the version has not been approved
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	PendingVersion *string `json:"pendingVersion,omitempty"`
+	// NextPublishWindow is the time at which the next publish window opens
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	NextPublishWindow *metav1.Time `json:"nextPublishWindow,omitempty"`
 	// Conditions represent the latest available observations of an object's state
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// +optional
@@ -110,6 +558,130 @@ type EnvoyConfigStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// +optional
 	ConfigRevisions []ConfigRevisionRef `json:"revisions,omitempty"`
+	// Rollout holds the progress of the rollout of the desired version, if any
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+	// Fleet holds the versions acknowledged by the Envoy
+	// clients subscribed to the nodeID
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Fleet *FleetStatus `json:"fleet,omitempty"`
+	// Diff holds the differences between the resources of the published
+	// version and the resources of the desired version, when they differ
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Diff *ConfigDiff `json:"diff,omitempty"`
+}
+
+// ConfigDiff holds the differences between the resources of the published revision and the
+// resources of the desired revision. Resources are matched by type and name: added resources are
+// the ones only present in the desired revision and removed resources are the ones only present
+// in the published revision.
+type ConfigDiff struct {
+	// PublishedVersion is the version of the published revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	PublishedVersion string `json:"publishedVersion"`
+	// DesiredVersion is the version of the desired revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	DesiredVersion string `json:"desiredVersion"`
+	// Added is the list of resources only present in the desired revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Added []ResourceDiff `json:"added,omitempty"`
+	// Removed is the list of resources only present in the published revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Removed []ResourceDiff `json:"removed,omitempty"`
+	// Modified is the list of resources present in both revisions with different values
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Modified []ResourceDiff `json:"modified,omitempty"`
+	// ConfigMapRef is a reference to the ConfigMap that holds the diff when it is too large
+	// to be stored in the status, in which case the lists of resources are left empty
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty"`
+}
+
+// ResourceDiff identifies a resource that differs between two revisions
+type ResourceDiff struct {
+	// Type is the resource type
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Type envoy.Type `json:"type"`
+	// Name is the name of the resource
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Name string `json:"name"`
+	// Paths are the JSON field paths of the values that differ, only set for modified resources
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+// FleetStatus holds the versions acknowledged by the Envoy clients subscribed to a nodeID
+type FleetStatus struct {
+	// SubscribedPods is the list of Pods subscribed to the nodeID
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	SubscribedPods []string `json:"subscribedPods,omitempty"`
+	// ResourceTypes holds, for each resource type the Pods are subscribed
+	// to, how many of them have acknowledged the published version
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	ResourceTypes []ResourceTypeFleetStatus `json:"resourceTypes,omitempty"`
+	// NodeIDs holds the status of the Envoy clients of each nodeID
+	// when the resources are published to more than one
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	NodeIDs []NodeIDFleetStatus `json:"nodeIDs,omitempty"`
+}
+
+// NodeIDFleetStatus holds the versions acknowledged by the Envoy
+// clients subscribed to one of the nodeIDs of the EnvoyConfig
+type NodeIDFleetStatus struct {
+	// NodeID is the nodeID the Envoy clients are subscribed to
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	NodeID string `json:"nodeID"`
+	// SubscribedPods is the list of Pods subscribed to the nodeID
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	SubscribedPods []string `json:"subscribedPods,omitempty"`
+	// ResourceTypes holds, for each resource type the Pods are subscribed
+	// to, how many of them have acknowledged the published version
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	ResourceTypes []ResourceTypeFleetStatus `json:"resourceTypes,omitempty"`
+}
+
+// ResourceTypeFleetStatus holds how many of the Envoy clients subscribed to a resource
+// type have acknowledged the published version of the resources of that type
+type ResourceTypeFleetStatus struct {
+	// Type is the resource type
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Type envoy.Type `json:"type"`
+	// Version is the published version of the resources of this type
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Version string `json:"version"`
+	// Subscribed is the number of Pods subscribed to the resource type
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Subscribed int32 `json:"subscribed"`
+	// InSync is the number of subscribed Pods that have
+	// acknowledged the published version
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	InSync int32 `json:"inSync"`
+}
+
+// RolloutStatus holds the progress of a rollout
+type RolloutStatus struct {
+	// Version is the version being rolled out
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Version string `json:"version"`
+	// Step is the index of the current step of the rollout
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Step int32 `json:"step"`
+	// Percentage of the Envoy clients that are served the version being rolled out
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Percentage int32 `json:"percentage"`
 }
 
 // ConfigRevisionRef holds a reference to EnvoyConfigRevision object
@@ -136,6 +708,7 @@ type ConfigRevisionRef struct {
 // +kubebuilder:printcolumn:JSONPath=".status.desiredVersion",name=Desired Version,type=string
 // +kubebuilder:printcolumn:JSONPath=".status.publishedVersion",name=Published Version,type=string
 // +kubebuilder:printcolumn:JSONPath=".status.cacheState",name=Cache State,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type==\"FleetInSync\")].status",name=Fleet In Sync,type=string
 // +operator-sdk:csv:customresourcedefinitions:displayName="EnvoyConfig"
 // +operator-sdk:csv:customresourcedefinitions:resources={{EnvoyConfigRevision,v1alpha1}}
 type EnvoyConfig struct {
@@ -154,6 +727,26 @@ func (ec *EnvoyConfig) GetEnvoyAPIVersion() envoy.APIVersion {
 	return envoy.APIVersion(*ec.Spec.EnvoyAPI)
 }
 
+// GetNodeIDs returns spec.nodeID followed by the additional nodeIDs
+// in spec.nodeIDs, without duplicates
+func (ec *EnvoyConfig) GetNodeIDs() []string {
+	return uniqueNodeIDs(ec.Spec.NodeID, ec.Spec.NodeIDs)
+}
+
+// GetLiteralParameters returns the values of the parameters, indexed by name. It returns
+// false if the value of any of the parameters is read from a ConfigMap, as those are only
+// known once read from the Kubernetes API.
+func (ec *EnvoyConfig) GetLiteralParameters() (map[string]string, bool) {
+	values := make(map[string]string, len(ec.Spec.Parameters))
+	for _, param := range ec.Spec.Parameters {
+		if param.Value == nil {
+			return nil, false
+		}
+		values[param.Name] = *param.Value
+	}
+	return values, true
+}
+
 // GetSerialization returns the encoding of the envoy resources.
 func (ec *EnvoyConfig) GetSerialization() envoy_serializer.Serialization {
 	if ec.Spec.Serialization == nil {
@@ -162,10 +755,92 @@ func (ec *EnvoyConfig) GetSerialization() envoy_serializer.Serialization {
 	return envoy_serializer.Serialization(*ec.Spec.Serialization)
 }
 
+// GetRevisionHistoryLimit returns the maximum number of EnvoyConfigRevisions to keep
+func (ec *EnvoyConfig) GetRevisionHistoryLimit() int {
+	if ec.Spec.RevisionHistoryLimit == nil {
+		return int(DefaultRevisionHistoryLimit)
+	}
+	return int(*ec.Spec.RevisionHistoryLimit)
+}
+
+// GetRevisionHistoryMaxAge returns the maximum age of the EnvoyConfigRevisions
+// to keep. Zero is returned if revisions are not deleted by age.
+func (ec *EnvoyConfig) GetRevisionHistoryMaxAge() time.Duration {
+	if ec.Spec.RevisionHistoryMaxAge == nil {
+		return 0
+	}
+	return ec.Spec.RevisionHistoryMaxAge.Duration
+}
+
+// GetRevisionStorage returns where the resources of new EnvoyConfigRevisions are stored
+func (ec *EnvoyConfig) GetRevisionStorage() RevisionStorage {
+	if ec.Spec.RevisionStorage == nil {
+		return RevisionStorageInline
+	}
+	return *ec.Spec.RevisionStorage
+}
+
+// IsSuspended returns true if the publication of new versions is suspended
+func (ec *EnvoyConfig) IsSuspended() bool {
+	return ec.Spec.Suspend != nil && *ec.Spec.Suspend
+}
+
+// IsApproved returns true if the given version can be published, either because
+// the EnvoyConfig does not require approval or because the version is approved
+func (ec *EnvoyConfig) IsApproved(version string) bool {
+	if ec.Spec.RequireApproval == nil || !*ec.Spec.RequireApproval {
+		return true
+	}
+	return ec.GetAnnotations()[ApprovedVersionAnnotation] == version
+}
+
+// IsPublishWindowOpen returns true if new versions can be published at the given time,
+// either because the EnvoyConfig has no publish windows or because one of them is open
+func (ec *EnvoyConfig) IsPublishWindowOpen(now time.Time) (bool, error) {
+	if len(ec.Spec.PublishWindows) == 0 {
+		return true, nil
+	}
+	for _, window := range ec.Spec.PublishWindows {
+		open, err := window.IsOpen(now)
+		if err != nil {
+			return false, err
+		}
+		if open {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetNextPublishWindow returns the first time one of the publish windows opens after
+// the given time. The zero time is returned if the EnvoyConfig has no publish windows.
+func (ec *EnvoyConfig) GetNextPublishWindow(now time.Time) (time.Time, error) {
+	next := time.Time{}
+	for _, window := range ec.Spec.PublishWindows {
+		opening, err := window.NextOpening(now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if next.IsZero() || opening.Before(next) {
+			next = opening
+		}
+	}
+	return next, nil
+}
+
 // GetEnvoyResourcesVersion returns the hash of the resources in the spec which
-// univoquely identifies the version of the resources.
+// univoquely identifies the version of the resources. The hash is calculated over the
+// canonical representation of the resources, so reordering the resources or changing
+// the formatting of their values doesn't produce a new version.
 func (ec *EnvoyConfig) GetEnvoyResourcesVersion() string {
-	return reconcilerutil.Hash(ec.Spec.Resources)
+	return hashResources(CanonicalResources(ec.Spec.Resources, ec.GetEnvoyAPIVersion()))
+}
+
+// GetLegacyEnvoyResourcesVersion returns the hash of the resources in the spec as they
+// are written, which is how versions were calculated before canonical hashing. It is only
+// used to match the revisions created by previous releases.
+func (ec *EnvoyConfig) GetLegacyEnvoyResourcesVersion() string {
+	return hashResources(ec.Spec.Resources)
 }
 
 // +kubebuilder:object:root=true
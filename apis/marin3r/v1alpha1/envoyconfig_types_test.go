@@ -19,12 +19,15 @@ package v1alpha1
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	reconcilerutil "github.com/3scale-ops/basereconciler/util"
 	"github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -96,6 +99,251 @@ func TestEnvoyConfig_GetSerialization(t *testing.T) {
 	}
 }
 
+func TestEnvoyConfig_GetRevisionHistoryLimit(t *testing.T) {
+	cases := []struct {
+		testName                   string
+		envoyConfigRevisionFactory func() *EnvoyConfig
+		expectedResult             int
+	}{
+		{"With default",
+			func() *EnvoyConfig {
+				return &EnvoyConfig{}
+			},
+			10,
+		},
+		{"With explicitly set value",
+			func() *EnvoyConfig {
+				return &EnvoyConfig{
+					Spec: EnvoyConfigSpec{
+						RevisionHistoryLimit: pointer.New(int32(3)),
+					},
+				}
+			},
+			3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.testName, func(subT *testing.T) {
+			receivedResult := tc.envoyConfigRevisionFactory().GetRevisionHistoryLimit()
+			if receivedResult != tc.expectedResult {
+				subT.Errorf("Expected result differs: Expected: %v, Received: %v", tc.expectedResult, receivedResult)
+			}
+		})
+	}
+}
+
+func TestEnvoyConfig_GetNodeIDs(t *testing.T) {
+	cases := []struct {
+		testName       string
+		spec           EnvoyConfigSpec
+		expectedResult []string
+	}{
+		{"Only spec.nodeID", EnvoyConfigSpec{NodeID: "node"}, []string{"node"}},
+		{"With additional nodeIDs", EnvoyConfigSpec{NodeID: "node", NodeIDs: []string{"a", "b"}}, []string{"node", "a", "b"}},
+		{"Skips empty and repeated nodeIDs", EnvoyConfigSpec{NodeID: "node", NodeIDs: []string{"a", "", "node", "a"}}, []string{"node", "a"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.testName, func(subT *testing.T) {
+			ec := &EnvoyConfig{Spec: tc.spec}
+			if receivedResult := ec.GetNodeIDs(); !reflect.DeepEqual(receivedResult, tc.expectedResult) {
+				subT.Errorf("Expected result differs: Expected: %v, Received: %v", tc.expectedResult, receivedResult)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_GetCooldown(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		attempts int32
+		want     time.Duration
+	}{
+		{
+			name:     "Defaults, first attempt",
+			policy:   &RetryPolicy{MaxAttempts: 5},
+			attempts: 0,
+			want:     time.Minute,
+		},
+		{
+			name:     "Defaults, doubles with each attempt",
+			policy:   &RetryPolicy{MaxAttempts: 5},
+			attempts: 3,
+			want:     8 * time.Minute,
+		},
+		{
+			name:     "Defaults, capped to the max cooldown",
+			policy:   &RetryPolicy{MaxAttempts: 10},
+			attempts: 9,
+			want:     time.Hour,
+		},
+		{
+			name: "Explicitly set values",
+			policy: &RetryPolicy{
+				MaxAttempts:     5,
+				InitialCooldown: &metav1.Duration{Duration: 10 * time.Second},
+				MaxCooldown:     &metav1.Duration{Duration: 30 * time.Second},
+			},
+			attempts: 1,
+			want:     20 * time.Second,
+		},
+		{
+			name: "Initial cooldown greater than max cooldown",
+			policy: &RetryPolicy{
+				MaxAttempts:     5,
+				InitialCooldown: &metav1.Duration{Duration: 2 * time.Hour},
+			},
+			attempts: 0,
+			want:     time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.GetCooldown(tt.attempts); got != tt.want {
+				t.Errorf("RetryPolicy.GetCooldown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishWindow_IsOpen(t *testing.T) {
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		window  *PublishWindow
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "Window is open",
+			window: &PublishWindow{Schedule: "0 11 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			want:   true,
+		},
+		{
+			name:   "Window opens at the given time",
+			window: &PublishWindow{Schedule: "0 12 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			want:   true,
+		},
+		{
+			name:   "Window has already closed",
+			window: &PublishWindow{Schedule: "0 11 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			want:   false,
+		},
+		{
+			name:   "Window is evaluated in the given timezone",
+			window: &PublishWindow{Schedule: "CRON_TZ=Europe/Madrid 0 12 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			want:   false,
+		},
+		{
+			name:    "Invalid schedule",
+			window:  &PublishWindow{Schedule: "0 12 * *", Duration: metav1.Duration{Duration: time.Hour}},
+			want:    false,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.window.IsOpen(now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PublishWindow.IsOpen() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PublishWindow.IsOpen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvoyConfig_GetNextPublishWindow(t *testing.T) {
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		windows []PublishWindow
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "Returns the earliest opening",
+			windows: []PublishWindow{
+				{Schedule: "0 9 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Schedule: "0 18 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			want: time.Date(2023, 1, 2, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "Returns the zero time without publish windows",
+			windows: nil,
+			want:    time.Time{},
+		},
+		{
+			name:    "Invalid schedule",
+			windows: []PublishWindow{{Schedule: "invalid"}},
+			want:    time.Time{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &EnvoyConfig{Spec: EnvoyConfigSpec{PublishWindows: tt.windows}}
+			got, err := ec.GetNextPublishWindow(now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EnvoyConfig.GetNextPublishWindow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("EnvoyConfig.GetNextPublishWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailurePolicy_Getters(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     *FailurePolicy
+		wantNACKs  int64
+		wantRatio  float64
+		wantWindow time.Duration
+	}{
+		{
+			name:       "Defaults for nil policy",
+			policy:     nil,
+			wantNACKs:  5,
+			wantRatio:  1,
+			wantWindow: 0,
+		},
+		{
+			name: "Explicitly set values",
+			policy: &FailurePolicy{
+				NACKsPerPod:      pointer.New(int32(1)),
+				PodsPercentage:   pointer.New(int32(20)),
+				EvaluationWindow: &metav1.Duration{Duration: time.Minute},
+			},
+			wantNACKs:  1,
+			wantRatio:  0.2,
+			wantWindow: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.GetNACKsPerPod(); got != tt.wantNACKs {
+				t.Errorf("FailurePolicy.GetNACKsPerPod() = %v, want %v", got, tt.wantNACKs)
+			}
+			if got := tt.policy.GetPodsRatio(); got != tt.wantRatio {
+				t.Errorf("FailurePolicy.GetPodsRatio() = %v, want %v", got, tt.wantRatio)
+			}
+			if got := tt.policy.GetEvaluationWindow(); got != tt.wantWindow {
+				t.Errorf("FailurePolicy.GetEvaluationWindow() = %v, want %v", got, tt.wantWindow)
+			}
+		})
+	}
+}
+
 func TestEnvoyConfig_GetEnvoyResourcesVersion(t *testing.T) {
 	cases := []struct {
 		testName                   string
@@ -112,6 +360,16 @@ func TestEnvoyConfig_GetEnvoyResourcesVersion(t *testing.T) {
 			},
 			reconcilerutil.Hash([]Resource{}),
 		},
+		{"Keeps the versions calculated by previous releases",
+			func() *EnvoyConfig {
+				return &EnvoyConfig{
+					Spec: EnvoyConfigSpec{
+						Resources: []Resource{{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "a"}`)}},
+					},
+				}
+			},
+			"67fd7c6548",
+		},
 	}
 
 	for _, tc := range cases {
@@ -124,6 +382,107 @@ func TestEnvoyConfig_GetEnvoyResourcesVersion(t *testing.T) {
 	}
 }
 
+func TestEnvoyConfig_GetLegacyEnvoyResourcesVersion(t *testing.T) {
+	blueprint := TlsValidationContext
+	tests := []struct {
+		name      string
+		resources []Resource
+		want      string
+	}{
+		{
+			name:      "Keeps the versions calculated by previous releases",
+			resources: []Resource{{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "a"}`)}},
+			want:      "6cc5dcf9b9",
+		},
+		{
+			name: "Keeps the versions of generated resources calculated by previous releases",
+			resources: []Resource{
+				{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "a"}`)},
+				{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("cert"), Blueprint: &blueprint},
+				{Type: envoy.Endpoint, GenerateFromEndpointSlices: &GenerateFromEndpointSlices{
+					Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"app": "a"}},
+					ClusterName: "a",
+					TargetPort:  "http",
+				}},
+			},
+			want: "657b4449dc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &EnvoyConfig{Spec: EnvoyConfigSpec{Resources: tt.resources}}
+			if got := ec.GetLegacyEnvoyResourcesVersion(); got != tt.want {
+				t.Errorf("EnvoyConfig.GetLegacyEnvoyResourcesVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvoyConfig_GetEnvoyResourcesVersion_Canonical(t *testing.T) {
+	version := func(resources ...Resource) string {
+		return (&EnvoyConfig{Spec: EnvoyConfigSpec{Resources: resources}}).GetEnvoyResourcesVersion()
+	}
+	cluster := func(value string) Resource {
+		return Resource{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(value)}
+	}
+	secret := Resource{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("cert")}
+
+	base := version(cluster(`{"name": "a", "connect_timeout": "1s"}`), cluster(`{"name": "b"}`), secret)
+
+	tests := []struct {
+		name      string
+		resources []Resource
+		wantSame  bool
+	}{
+		{
+			name:      "Reordering the resources keeps the version",
+			resources: []Resource{secret, cluster(`{"name": "b"}`), cluster(`{"name": "a", "connect_timeout": "1s"}`)},
+			wantSame:  true,
+		},
+		{
+			name:      "Reformatting the values keeps the version",
+			resources: []Resource{cluster(`{"connectTimeout":"1s","name":"a"}`), cluster("{\n  \"name\": \"b\"\n}"), secret},
+			wantSame:  true,
+		},
+		{
+			name:      "Changing a value changes the version",
+			resources: []Resource{cluster(`{"name": "a", "connect_timeout": "2s"}`), cluster(`{"name": "b"}`), secret},
+			wantSame:  false,
+		},
+		{
+			name: "Reading a value from a ConfigMap changes the version",
+			resources: []Resource{
+				cluster(`{"name": "a", "connect_timeout": "1s"}`),
+				{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "b"}`), ValueFrom: &ResourceValueSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cm"}, Key: "b"}}},
+				secret,
+			},
+			wantSame: false,
+		},
+		{
+			name: "Generating a value from a ConfigMap changes the version",
+			resources: []Resource{
+				cluster(`{"name": "a", "connect_timeout": "1s"}`),
+				cluster(`{"name": "b"}`),
+				{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("cert"), GenerateFromConfigMap: &GenerateFromConfigMap{Name: "cm"}},
+			},
+			wantSame: false,
+		},
+		{
+			name:      "Removing a resource changes the version",
+			resources: []Resource{cluster(`{"name": "a", "connect_timeout": "1s"}`), cluster(`{"name": "b"}`)},
+			wantSame:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := version(tt.resources...); (got == base) != tt.wantSame {
+				t.Errorf("EnvoyConfig.GetEnvoyResourcesVersion() = %v, base version %v, want same %v", got, base, tt.wantSame)
+			}
+		})
+	}
+}
+
 func TestEnvoySecretResource_Validate(t *testing.T) {
 	type fields struct {
 		Name string
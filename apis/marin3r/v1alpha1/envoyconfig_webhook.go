@@ -17,27 +17,69 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
+	envoy_resources_v3 "github.com/3scale-ops/marin3r/pkg/envoy/resources/v3"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"github.com/robfig/cron/v3"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // log is for logging in this package.
 var validationlog = logf.Log.WithName("v1alpha1 validation")
 
 func (r *EnvoyConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// the validating webhook is registered beforehand so it can return warnings. The
+	// builder doesn't register a webhook for a path that is already registered.
+	hook := admission.ValidatingWebhookFor(r)
+	hook.Handler = &warningsHandler{Handler: hook.Handler}
+	mgr.GetWebhookServer().Register(EnvoyConfigValidatingWebhookPath, hook)
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
 }
 
+// EnvoyConfigValidatingWebhookPath is the path the EnvoyConfig validating webhook is served at
+const EnvoyConfigValidatingWebhookPath string = "/validate-marin3r-3scale-net-v1alpha1-envoyconfig"
+
+// warningsHandler wraps the validating webhook handler to add the
+// EnvoyConfig warnings to the responses of the allowed requests
+type warningsHandler struct {
+	admission.Handler
+}
+
+// Handle implements admission.Handler
+func (h *warningsHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	rsp := h.Handler.Handle(ctx, req)
+	if !rsp.Allowed || req.Object.Raw == nil {
+		return rsp
+	}
+
+	ec := &EnvoyConfig{}
+	if err := json.Unmarshal(req.Object.Raw, ec); err != nil {
+		return rsp
+	}
+	return rsp.WithWarnings(ec.Warnings()...)
+}
+
+// InjectDecoder implements admission.DecoderInjector so the
+// decoder gets injected into the wrapped handler
+func (h *warningsHandler) InjectDecoder(d *admission.Decoder) error {
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
 //+kubebuilder:webhook:path=/validate-marin3r-3scale-net-v1alpha1-envoyconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=marin3r.3scale.net,resources=envoyconfigs,verbs=create;update,versions=v1alpha1,name=envoyconfig.marin3r.3scale.net-v1alpha1,admissionReviewVersions=v1
 
 var _ webhook.Validator = &EnvoyConfig{}
@@ -65,29 +107,345 @@ func (r *EnvoyConfig) ValidateDelete() error { return nil }
 
 // Validates the EnvoyConfig resource
 func (r *EnvoyConfig) Validate() error {
-	if (r.Spec.EnvoyResources == nil && r.Spec.Resources == nil) || (r.Spec.EnvoyResources != nil && r.Spec.Resources != nil) {
+	// an EnvoyConfig can get all its resources from the included libraries
+	if (r.Spec.EnvoyResources == nil && r.Spec.Resources == nil && len(r.Spec.Includes) == 0) || (r.Spec.EnvoyResources != nil && r.Spec.Resources != nil) {
 		return fmt.Errorf("one and only one of 'spec.EnvoyResources', 'spec.Resources' must be set")
 	}
 
 	if r.Spec.EnvoyResources != nil {
+		if len(r.Spec.Parameters) > 0 {
+			return fmt.Errorf("'spec.parameters' can only be used along with 'spec.resources'")
+		}
+		if len(r.Spec.Includes) > 0 {
+			return fmt.Errorf("'spec.includes' can only be used along with 'spec.resources'")
+		}
 		if err := r.ValidateEnvoyResources(); err != nil {
 			return err
 		}
 
 	} else {
-		if err := r.ValidateResources(); err != nil {
+		if len(r.Spec.Parameters) > 0 {
+			if err := r.ValidateParameters(); err != nil {
+				return err
+			}
+		}
+		if len(r.Spec.Includes) > 0 {
+			if err := r.ValidateIncludes(); err != nil {
+				return err
+			}
+		}
+		if err := r.ValidateValuesFrom(); err != nil {
 			return err
 		}
+		rendered, literal, err := r.renderForValidation()
+		if err != nil {
+			return err
+		}
+		// the values of the parameters read from ConfigMaps are only known by the
+		// controller, so only the syntax of the templates can be validated
+		if literal {
+			if err := rendered.ValidateResources(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.Spec.Rollout != nil {
+		if err := r.ValidateRollout(); err != nil {
+			return err
+		}
+	}
+
+	if r.Spec.RevisionHistoryLimit != nil && *r.Spec.RevisionHistoryLimit < 1 {
+		return fmt.Errorf("'spec.revisionHistoryLimit' must be greater than 0")
+	}
+
+	if r.Spec.RevisionHistoryMaxAge != nil && r.Spec.RevisionHistoryMaxAge.Duration < 0 {
+		return fmt.Errorf("'spec.revisionHistoryMaxAge' cannot be negative")
+	}
+
+	if r.Spec.RetryPolicy != nil {
+		if err := r.ValidateRetryPolicy(); err != nil {
+			return err
+		}
+	}
+
+	if r.Spec.FailurePolicy != nil {
+		if err := r.ValidateFailurePolicy(); err != nil {
+			return err
+		}
+	}
+
+	if r.Spec.HealthAnalysis != nil {
+		if err := r.ValidateHealthAnalysis(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Spec.PublishWindows) > 0 {
+		if err := r.ValidatePublishWindows(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validates the parameters
+func (r *EnvoyConfig) ValidateParameters() error {
+	errList := []error{}
+	names := map[string]bool{}
+
+	for idx, param := range r.Spec.Parameters {
+		if param.Name == "" {
+			errList = append(errList, fmt.Errorf("'spec.parameters[%d].name' cannot be empty", idx))
+		} else if names[param.Name] {
+			errList = append(errList, fmt.Errorf("'spec.parameters[%d].name' is duplicated", idx))
+		}
+		names[param.Name] = true
+
+		if (param.Value == nil) == (param.ValueFrom == nil) {
+			errList = append(errList, fmt.Errorf("one and only one of 'spec.parameters[%d].value', 'spec.parameters[%d].valueFrom' must be set", idx, idx))
+		} else if param.ValueFrom != nil && (param.ValueFrom.ConfigMapKeyRef == nil ||
+			param.ValueFrom.ConfigMapKeyRef.Name == "" || param.ValueFrom.ConfigMapKeyRef.Key == "") {
+			errList = append(errList, fmt.Errorf("'spec.parameters[%d].valueFrom.configMapKeyRef' must set the name and the key of a ConfigMap", idx))
+		}
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the included libraries
+func (r *EnvoyConfig) ValidateIncludes() error {
+	errList := []error{}
+	names := map[string]bool{}
+
+	for idx, name := range r.Spec.Includes {
+		if name == "" {
+			errList = append(errList, fmt.Errorf("'spec.includes[%d]' cannot be empty", idx))
+		} else if names[name] {
+			errList = append(errList, fmt.Errorf("'spec.includes[%d]' is duplicated", idx))
+		}
+		names[name] = true
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the sources of the resources that read their value from ConfigMaps or Secrets
+func (r *EnvoyConfig) ValidateValuesFrom() error {
+	errList := []error{}
+
+	for idx, res := range r.Spec.Resources {
+		if res.ValueFrom == nil {
+			continue
+		}
+		if res.Value != nil {
+			errList = append(errList, fmt.Errorf("only one of 'spec.resources[%d].value', 'spec.resources[%d].valueFrom' allowed", idx, idx))
+		}
+		cm, secret := res.ValueFrom.ConfigMapKeyRef, res.ValueFrom.SecretKeyRef
+		switch {
+		case (cm == nil) == (secret == nil):
+			errList = append(errList, fmt.Errorf("one and only one of 'spec.resources[%d].valueFrom.configMapKeyRef', 'spec.resources[%d].valueFrom.secretKeyRef' must be set", idx, idx))
+		case cm != nil && (cm.Name == "" || cm.Key == ""):
+			errList = append(errList, fmt.Errorf("'spec.resources[%d].valueFrom.configMapKeyRef' must set the name and the key of a ConfigMap", idx))
+		case secret != nil && (secret.Name == "" || secret.Key == ""):
+			errList = append(errList, fmt.Errorf("'spec.resources[%d].valueFrom.secretKeyRef' must set the name and the key of a Secret", idx))
+		case secret != nil && r.GetRevisionStorage() != RevisionStorageSecret:
+			// the content is recorded in the revisions, which must not hold it in plain text
+			errList = append(errList, fmt.Errorf("'spec.resources[%d].valueFrom.secretKeyRef' requires 'spec.revisionStorage' to be Secret", idx))
+		}
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// hasValueFrom returns true if any of the resources
+// reads its value from a ConfigMap or a Secret
+func (r *EnvoyConfig) hasValueFrom() bool {
+	for _, res := range r.Spec.Resources {
+		if res.ValueFrom != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// renderForValidation returns a copy of the EnvoyConfig with the templates in the values of its
+// resources rendered with the literal values of the parameters. If the value of any parameter is
+// read from a ConfigMap, the templates are rendered with empty values to check their syntax and
+// false is returned, as the rendered resources are not the ones the controller would produce.
+func (r *EnvoyConfig) renderForValidation() (*EnvoyConfig, bool, error) {
+	if len(r.Spec.Parameters) == 0 {
+		return r, true, nil
+	}
+
+	values, literal := r.GetLiteralParameters()
+	if !literal {
+		values = map[string]string{}
+		for _, param := range r.Spec.Parameters {
+			values[param.Name] = ""
+		}
+	}
+
+	resources, err := RenderResources(r.Spec.Resources, values)
+	if err != nil {
+		return nil, false, err
+	}
+	rendered := r.DeepCopy()
+	rendered.Spec.Resources = resources
+	return rendered, literal, nil
+}
+
+// Validates the rollout policy
+func (r *EnvoyConfig) ValidateRollout() error {
+	errList := []error{}
+
+	if len(r.Spec.Rollout.Steps) == 0 {
+		errList = append(errList, fmt.Errorf("'spec.rollout.steps' cannot be empty"))
+	}
+
+	for idx, step := range r.Spec.Rollout.Steps {
+		if step.Percentage < 1 || step.Percentage > 100 {
+			errList = append(errList, fmt.Errorf("'spec.rollout.steps[%d].percentage' must be between 1 and 100", idx))
+		}
+		if idx > 0 && step.Percentage <= r.Spec.Rollout.Steps[idx-1].Percentage {
+			errList = append(errList, fmt.Errorf("'spec.rollout.steps[%d].percentage' must be greater than the percentage of the previous step", idx))
+		}
+		if step.BakeTime != nil && step.BakeTime.Duration < 0 {
+			errList = append(errList, fmt.Errorf("'spec.rollout.steps[%d].bakeTime' cannot be negative", idx))
+		}
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the retry policy
+func (r *EnvoyConfig) ValidateRetryPolicy() error {
+	errList := []error{}
+	policy := r.Spec.RetryPolicy
+
+	if policy.MaxAttempts < 1 {
+		errList = append(errList, fmt.Errorf("'spec.retryPolicy.maxAttempts' must be greater than 0"))
+	}
+	if policy.InitialCooldown != nil && policy.InitialCooldown.Duration < 0 {
+		errList = append(errList, fmt.Errorf("'spec.retryPolicy.initialCooldown' cannot be negative"))
+	}
+	if policy.MaxCooldown != nil && policy.MaxCooldown.Duration < 0 {
+		errList = append(errList, fmt.Errorf("'spec.retryPolicy.maxCooldown' cannot be negative"))
 	}
 
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the failure policy
+func (r *EnvoyConfig) ValidateFailurePolicy() error {
+	errList := []error{}
+	policy := r.Spec.FailurePolicy
+
+	if policy.NACKsPerPod != nil && (*policy.NACKsPerPod < 1 || *policy.NACKsPerPod > 100) {
+		errList = append(errList, fmt.Errorf("'spec.failurePolicy.nacksPerPod' must be between 1 and 100"))
+	}
+	if policy.PodsPercentage != nil && (*policy.PodsPercentage < 1 || *policy.PodsPercentage > 100) {
+		errList = append(errList, fmt.Errorf("'spec.failurePolicy.podsPercentage' must be between 1 and 100"))
+	}
+	if policy.EvaluationWindow != nil && policy.EvaluationWindow.Duration < 0 {
+		errList = append(errList, fmt.Errorf("'spec.failurePolicy.evaluationWindow' cannot be negative"))
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the health analysis
+func (r *EnvoyConfig) ValidateHealthAnalysis() error {
+	errList := []error{}
+	analysis := r.Spec.HealthAnalysis
+
+	if len(analysis.Thresholds) == 0 {
+		errList = append(errList, fmt.Errorf("'spec.healthAnalysis.thresholds' cannot be empty"))
+	}
+	for idx, threshold := range analysis.Thresholds {
+		if threshold.Stat == "" {
+			errList = append(errList, fmt.Errorf("'spec.healthAnalysis.thresholds[%d].stat' cannot be empty", idx))
+		}
+		if threshold.MaxIncrease < 0 {
+			errList = append(errList, fmt.Errorf("'spec.healthAnalysis.thresholds[%d].maxIncrease' cannot be negative", idx))
+		}
+	}
+	if analysis.BakeTime != nil && analysis.BakeTime.Duration <= 0 {
+		errList = append(errList, fmt.Errorf("'spec.healthAnalysis.bakeTime' must be greater than 0"))
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// Validates the publish windows
+func (r *EnvoyConfig) ValidatePublishWindows() error {
+	errList := []error{}
+
+	for idx, window := range r.Spec.PublishWindows {
+		if _, err := cron.ParseStandard(window.Schedule); err != nil {
+			errList = append(errList, fmt.Errorf("'spec.publishWindows[%d].schedule' is not a valid cron expression: %w", idx, err))
+		}
+		if window.Duration.Duration <= 0 {
+			errList = append(errList, fmt.Errorf("'spec.publishWindows[%d].duration' must be greater than 0", idx))
+		}
+	}
+
+	if len(errList) > 0 {
+		return NewMultiError(errList)
+	}
 	return nil
 }
 
 // Validate Envoy Resources against schema
 func (r *EnvoyConfig) ValidateResources() error {
+	if err := ValidateResourcesSchema(r.Spec.Resources, r.GetEnvoyAPIVersion()); err != nil {
+		return err
+	}
+	// the values read from ConfigMaps or Secrets are only known by the controller, and
+	// the resources they declare are likely referenced by the rest of the resources
+	if r.hasValueFrom() {
+		return nil
+	}
+
+	if errs, _ := r.ValidateResourceSemantics(); len(errs) > 0 {
+		errList := []error{}
+		for _, err := range errs {
+			errList = append(errList, err)
+		}
+		return NewMultiError(errList)
+	}
+	return nil
+}
+
+// ValidateResourcesSchema validates each one of the resources against the schema of its type,
+// without the semantic validation rules that apply to the whole set of resources
+func ValidateResourcesSchema(resources []Resource, version envoy.APIVersion) error {
 	errList := []error{}
 
-	for _, res := range r.Spec.Resources {
+	for idx, res := range resources {
 
 		switch res.Type {
 
@@ -95,22 +453,26 @@ func (r *EnvoyConfig) ValidateResources() error {
 			if res.GenerateFromTlsSecret == nil {
 				errList = append(errList, fmt.Errorf("'generateFromTlsSecret' cannot be empty for type '%s'", envoy.Secret))
 			}
-			if res.Value != nil {
-				errList = append(errList, fmt.Errorf("'value' cannot be used for type '%s'", envoy.Secret))
+			if res.Value != nil || res.ValueFrom != nil {
+				errList = append(errList, fmt.Errorf("'value', 'valueFrom' cannot be used for type '%s'", envoy.Secret))
 			}
 			if res.GenerateFromEndpointSlices != nil {
 				errList = append(errList, fmt.Errorf("'generateFromEndpointSlice' can only be used type '%s'", envoy.Endpoint))
 			}
+			if res.GenerateFromConfigMap != nil {
+				errList = append(errList, fmt.Errorf("'generateFromConfigMap' can only be used type '%s'", envoy.Runtime))
+			}
 
 		case envoy.Endpoint:
-			if res.GenerateFromEndpointSlices != nil && res.Value != nil {
-				errList = append(errList, fmt.Errorf("only one of 'generateFromEndpointSlice', 'value' allowed for type '%s'", envoy.Secret))
+			if res.GenerateFromEndpointSlices != nil && (res.Value != nil || res.ValueFrom != nil) {
+				errList = append(errList, fmt.Errorf("only one of 'generateFromEndpointSlice', 'value', 'valueFrom' allowed for type '%s'", envoy.Secret))
 			}
-			if res.GenerateFromEndpointSlices == nil && res.Value == nil {
-				errList = append(errList, fmt.Errorf("one of 'generateFromEndpointSlice', 'value' must be set for type '%s'", envoy.Secret))
+			if res.GenerateFromEndpointSlices == nil && res.Value == nil && res.ValueFrom == nil {
+				errList = append(errList, fmt.Errorf("one of 'generateFromEndpointSlice', 'value', 'valueFrom' must be set for type '%s'", envoy.Secret))
 			}
 			if res.Value != nil {
-				if err := envoy_resources.Validate(string(res.Value.Raw), envoy_serializer.JSON, r.GetEnvoyAPIVersion(), envoy.Type(res.Type)); err != nil {
+				if err := envoy_resources.Validate(string(res.Value.Raw), envoy_serializer.JSON, version, envoy.Type(res.Type),
+					field.NewPath("spec", "resources").Index(idx).Child("value")); err != nil {
 					errList = append(errList, err)
 				}
 			}
@@ -120,6 +482,38 @@ func (r *EnvoyConfig) ValidateResources() error {
 			if res.Blueprint != nil {
 				errList = append(errList, fmt.Errorf("'blueprint' can only be used type '%s'", envoy.Secret))
 			}
+			if res.GenerateFromConfigMap != nil {
+				errList = append(errList, fmt.Errorf("'generateFromConfigMap' can only be used type '%s'", envoy.Runtime))
+			}
+
+		case envoy.Runtime:
+			if res.GenerateFromConfigMap != nil && (res.Value != nil || res.ValueFrom != nil) {
+				errList = append(errList, fmt.Errorf("only one of 'generateFromConfigMap', 'value', 'valueFrom' allowed for type '%s'", envoy.Runtime))
+			}
+			if res.GenerateFromConfigMap == nil && res.Value == nil && res.ValueFrom == nil {
+				errList = append(errList, fmt.Errorf("one of 'generateFromConfigMap', 'value', 'valueFrom' must be set for type '%s'", envoy.Runtime))
+			}
+			if res.GenerateFromConfigMap != nil && res.GenerateFromConfigMap.Name == "" {
+				errList = append(errList, fmt.Errorf("'generateFromConfigMap.name' cannot be empty"))
+			}
+			if res.GenerateFromConfigMap != nil && res.GenerateFromConfigMap.LayerName != nil && *res.GenerateFromConfigMap.LayerName == "" {
+				errList = append(errList, fmt.Errorf("'generateFromConfigMap.layerName' cannot be empty"))
+			}
+			if res.Value != nil {
+				if err := envoy_resources.Validate(string(res.Value.Raw), envoy_serializer.JSON, version, envoy.Type(res.Type),
+					field.NewPath("spec", "resources").Index(idx).Child("value")); err != nil {
+					errList = append(errList, err)
+				}
+			}
+			if res.GenerateFromEndpointSlices != nil {
+				errList = append(errList, fmt.Errorf("'generateFromEndpointSlice' can only be used type '%s'", envoy.Endpoint))
+			}
+			if res.GenerateFromTlsSecret != nil {
+				errList = append(errList, fmt.Errorf("'generateFromTlsSecret' can only be used type '%s'", envoy.Secret))
+			}
+			if res.Blueprint != nil {
+				errList = append(errList, fmt.Errorf("'blueprint' can only be used type '%s'", envoy.Secret))
+			}
 
 		default:
 			if res.GenerateFromEndpointSlices != nil {
@@ -131,12 +525,16 @@ func (r *EnvoyConfig) ValidateResources() error {
 			if res.Blueprint != nil {
 				errList = append(errList, fmt.Errorf("'blueprint' cannot be empty for type '%s'", envoy.Secret))
 			}
+			if res.GenerateFromConfigMap != nil {
+				errList = append(errList, fmt.Errorf("'generateFromConfigMap' can only be used type '%s'", envoy.Runtime))
+			}
 			if res.Value != nil {
-				if err := envoy_resources.Validate(string(res.Value.Raw), envoy_serializer.JSON, r.GetEnvoyAPIVersion(), envoy.Type(res.Type)); err != nil {
+				if err := envoy_resources.Validate(string(res.Value.Raw), envoy_serializer.JSON, version, envoy.Type(res.Type),
+					field.NewPath("spec", "resources").Index(idx).Child("value")); err != nil {
 					errList = append(errList, err)
 				}
-			} else {
-				errList = append(errList, fmt.Errorf("'value' cannot be empty for type '%s'", res.Type))
+			} else if res.ValueFrom == nil {
+				errList = append(errList, fmt.Errorf("one of 'value', 'valueFrom' must be set for type '%s'", res.Type))
 			}
 		}
 
@@ -148,42 +546,132 @@ func (r *EnvoyConfig) ValidateResources() error {
 	return nil
 }
 
+// ValidateResourceSemantics runs the semantic validation rules over the whole set of resources,
+// returning the errors that make the EnvoyConfig invalid and warnings about likely problems. The
+// resources referenced by name by other resources, like the endpoints of EDS clusters or the
+// routes of RDS listeners, can also be declared in the included libraries or in the fragments
+// of the nodeID, so missing references are only reported as warnings.
+func (r *EnvoyConfig) ValidateResourceSemantics() (field.ErrorList, []string) {
+	decoder := envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, r.GetEnvoyAPIVersion())
+	generator := envoy_resources.NewGenerator(r.GetEnvoyAPIVersion())
+	resources := []envoy_resources_v3.DeclaredResource{}
+
+	for idx, res := range r.Spec.Resources {
+		rType := envoy.Type(res.Type)
+		path := field.NewPath("spec", "resources").Index(idx)
+		switch {
+		case rType == envoy.Endpoint && res.GenerateFromEndpointSlices != nil:
+			// the endpoints are discovered at runtime, only the name is known
+			resources = append(resources, envoy_resources_v3.DeclaredResource{
+				Type:     rType,
+				Path:     path.Child("generateFromEndpointSlices"),
+				Resource: generator.NewClusterLoadAssignment(res.GenerateFromEndpointSlices.ClusterName),
+			})
+		case rType == envoy.Runtime && res.GenerateFromConfigMap != nil:
+			// the values are read from the ConfigMap at runtime, only the name is known
+			resources = append(resources, envoy_resources_v3.DeclaredResource{
+				Type:     rType,
+				Path:     path.Child("generateFromConfigMap"),
+				Resource: generator.NewRuntime(res.GenerateFromConfigMap.GetLayerName(), nil),
+			})
+		case res.Value != nil:
+			resource := generator.New(rType)
+			if err := decoder.Unmarshal(string(res.Value.Raw), resource); err != nil {
+				// errors decoding the resources are reported by ValidateResources
+				continue
+			}
+			resources = append(resources, envoy_resources_v3.DeclaredResource{
+				Type:     rType,
+				Path:     path.Child("value"),
+				Resource: resource,
+			})
+		}
+	}
+
+	return envoy_resources_v3.ValidateRules(resources, envoyConfigRules...)
+}
+
+// envoyConfigRules are the rules run over the resources of the EnvoyConfigs. The libraries
+// and the fragments, which can be created at any time, are merged by the controller, so the
+// references between the resources are checked over the whole set when the snapshot is built.
+var envoyConfigRules = []envoy_resources_v3.Rule{
+	envoy_resources_v3.RuleFunc(envoy_resources_v3.UniqueNames),
+	envoy_resources_v3.RuleFunc(envoy_resources_v3.UniqueListenerAddresses),
+	envoy_resources_v3.RuleFunc(envoy_resources_v3.RouteClustersExist),
+	envoy_resources_v3.AsWarnings(envoy_resources_v3.RuleFunc(envoy_resources_v3.EDSEndpointsExist)),
+	envoy_resources_v3.AsWarnings(envoy_resources_v3.RuleFunc(envoy_resources_v3.RDSRoutesExist)),
+}
+
+// Warnings returns the likely problems found in the EnvoyConfig that
+// are not considered errors, so they don't cause its rejection
+func (r *EnvoyConfig) Warnings() []string {
+	warnings := []string{}
+	if r.Spec.Resources != nil && !r.hasValueFrom() {
+		if rendered, literal, err := r.renderForValidation(); err == nil && literal {
+			_, warnings = rendered.ValidateResourceSemantics()
+		}
+	}
+
+	if data, err := json.Marshal(r); err == nil && len(data) > envoyConfigSizeWarningThreshold {
+		msg := fmt.Sprintf("the EnvoyConfig is %dKiB, close to the size limit of the objects stored in the Kubernetes API", len(data)/1024)
+		if r.GetRevisionStorage() == RevisionStorageInline {
+			msg += ", consider setting spec.revisionStorage to ConfigMap or Secret so revisions don't hold a copy of the resources"
+		}
+		warnings = append(warnings, msg)
+	}
+
+	if len(warnings) == 0 {
+		return nil
+	}
+	return warnings
+}
+
+// envoyConfigSizeWarningThreshold is the size, in bytes, of the serialized EnvoyConfig above
+// which a warning is returned, as objects are limited to about 1.5MiB by the Kubernetes API
+const envoyConfigSizeWarningThreshold int = 1024 * 1024
+
 // Validate EnvoyResources against schema
 func (r *EnvoyConfig) ValidateEnvoyResources() error {
 	errList := []error{}
 
-	for _, endpoint := range r.Spec.EnvoyResources.Endpoints {
-		if err := envoy_resources.Validate(endpoint.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Endpoint); err != nil {
+	for idx, endpoint := range r.Spec.EnvoyResources.Endpoints {
+		if err := envoy_resources.Validate(endpoint.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Endpoint,
+			field.NewPath("spec", "envoyResources", "endpoints").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
 
-	for _, cluster := range r.Spec.EnvoyResources.Clusters {
-		if err := envoy_resources.Validate(cluster.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Cluster); err != nil {
+	for idx, cluster := range r.Spec.EnvoyResources.Clusters {
+		if err := envoy_resources.Validate(cluster.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Cluster,
+			field.NewPath("spec", "envoyResources", "clusters").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
 
-	for _, route := range r.Spec.EnvoyResources.Routes {
-		if err := envoy_resources.Validate(route.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Route); err != nil {
+	for idx, route := range r.Spec.EnvoyResources.Routes {
+		if err := envoy_resources.Validate(route.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Route,
+			field.NewPath("spec", "envoyResources", "routes").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
 
-	for _, route := range r.Spec.EnvoyResources.ScopedRoutes {
-		if err := envoy_resources.Validate(route.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.ScopedRoute); err != nil {
+	for idx, route := range r.Spec.EnvoyResources.ScopedRoutes {
+		if err := envoy_resources.Validate(route.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.ScopedRoute,
+			field.NewPath("spec", "envoyResources", "scopedRoutes").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
 
-	for _, listener := range r.Spec.EnvoyResources.Listeners {
-		if err := envoy_resources.Validate(listener.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Listener); err != nil {
+	for idx, listener := range r.Spec.EnvoyResources.Listeners {
+		if err := envoy_resources.Validate(listener.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Listener,
+			field.NewPath("spec", "envoyResources", "listeners").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
 
-	for _, runtime := range r.Spec.EnvoyResources.Runtimes {
-		if err := envoy_resources.Validate(runtime.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Runtime); err != nil {
+	for idx, runtime := range r.Spec.EnvoyResources.Runtimes {
+		if err := envoy_resources.Validate(runtime.Value, r.GetSerialization(), r.GetEnvoyAPIVersion(), envoy.Runtime,
+			field.NewPath("spec", "envoyResources", "runtimes").Index(idx).Child("value")); err != nil {
 			errList = append(errList, err)
 		}
 	}
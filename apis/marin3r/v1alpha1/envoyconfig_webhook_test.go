@@ -17,13 +17,22 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func TestEnvoyConfig_ValidateResources(t *testing.T) {
@@ -231,6 +240,145 @@ func TestEnvoyConfig_ValidateResources(t *testing.T) {
 				},
 			}, wantErr: true,
 		},
+		{
+			name: "Succeeds: runtime generated from a ConfigMap",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type:                  "runtime",
+						GenerateFromConfigMap: &GenerateFromConfigMap{Name: "flags", LayerName: pointer.New("flags")},
+					}},
+				},
+			}, wantErr: false,
+		},
+		{
+			name: "Fails: generateFromConfigMap can only be used for runtimes",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type:                  "cluster",
+						GenerateFromConfigMap: &GenerateFromConfigMap{Name: "flags"},
+					}},
+				},
+			}, wantErr: true,
+		},
+		{
+			name: "Fails: one of value/generateFromConfigMap for runtime",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type:                  "runtime",
+						GenerateFromConfigMap: &GenerateFromConfigMap{Name: "flags"},
+						Value:                 &runtime.RawExtension{Raw: []byte(`{"name": "runtime"}`)},
+					}},
+				},
+			}, wantErr: true,
+		},
+		{
+			name: "Fails: generateFromConfigMap without a name",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type:                  "runtime",
+						GenerateFromConfigMap: &GenerateFromConfigMap{},
+					}},
+				},
+			}, wantErr: true,
+		},
+		{
+			name: "Fails: runtime generated from a ConfigMap with a duplicate layer name",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{
+						{Type: "runtime", GenerateFromConfigMap: &GenerateFromConfigMap{Name: "flags"}},
+						{Type: "runtime", Value: &runtime.RawExtension{Raw: []byte(`{"name": "runtime"}`)}},
+					},
+				},
+			}, wantErr: true,
+		},
+		{
+			name: "Succeeds: cluster references an endpoint that could be declared in a fragment",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name": "cluster", "type": "EDS"}`),
+						},
+					}},
+				},
+			}, wantErr: false,
+		},
+		{
+			name: "Succeeds: cluster references a discovered endpoint",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{
+						{
+							Type: "cluster",
+							Value: &runtime.RawExtension{
+								Raw: []byte(`{"name": "cluster", "type": "EDS"}`),
+							},
+						},
+						{
+							Type: "endpoint",
+							GenerateFromEndpointSlices: &GenerateFromEndpointSlices{
+								Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"label": "value"}},
+								ClusterName: "cluster",
+								TargetPort:  "port",
+							},
+						},
+					},
+				},
+			}, wantErr: false,
+		},
+		{
+			name: "Succeeds: listener references a route that could be declared in a fragment",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "listener",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"listener","address":{"socket_address":{"address":"0.0.0.0","port_value":8080}},"filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{"@type":"type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager","stat_prefix":"http","rds":{"route_config_name":"route","config_source":{"ads":{},"resource_api_version":"V3"}},"http_filters":[{"name":"envoy.filters.http.router","typed_config":{"@type":"type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"}}]}}]}]}`),
+						},
+					}},
+				},
+			}, wantErr: false,
+		},
+		{
+			name: "Fails: cluster fails validation rules",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"cluster","connect_timeout":"-1s"}`),
+						},
+					}},
+				},
+			}, wantErr: true,
+		},
+		{
+			name: "Fails: duplicate resource names",
+			r: &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{
+						{Type: "cluster", Value: &runtime.RawExtension{Raw: []byte(`{"name": "cluster"}`)}},
+						{Type: "cluster", Value: &runtime.RawExtension{Raw: []byte(`{"name": "cluster"}`)}},
+					},
+				},
+			}, wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -373,6 +521,405 @@ func TestEnvoyConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok, rollout with increasing percentages",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					Rollout: &RolloutPolicy{Steps: []RolloutStep{
+						{Percentage: 10, BakeTime: &metav1.Duration{Duration: time.Minute}},
+						{Percentage: 50},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, rollout percentages must increase",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					Rollout: &RolloutPolicy{Steps: []RolloutStep{
+						{Percentage: 50},
+						{Percentage: 10},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, revisionHistoryLimit must be positive",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:               "test",
+					Resources:            []Resource{},
+					RevisionHistoryLimit: pointer.New(int32(0)),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, retry policy",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					RetryPolicy: &RetryPolicy{
+						MaxAttempts:     3,
+						InitialCooldown: &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, retry policy without attempts",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:      "test",
+					Resources:   []Resource{},
+					RetryPolicy: &RetryPolicy{MaxAttempts: 0},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, failure policy",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					FailurePolicy: &FailurePolicy{
+						NACKsPerPod:      pointer.New(int32(1)),
+						PodsPercentage:   pointer.New(int32(20)),
+						EvaluationWindow: &metav1.Duration{Duration: 5 * time.Minute},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, failure policy percentage out of range",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:        "test",
+					Resources:     []Resource{},
+					FailurePolicy: &FailurePolicy{PodsPercentage: pointer.New(int32(0))},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, health analysis",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					HealthAnalysis: &HealthAnalysis{
+						Thresholds: []StatThreshold{{Stat: "cluster.*.upstream_rq_5xx", MaxIncrease: 10}},
+						BakeTime:   &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, health analysis without thresholds",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:         "test",
+					Resources:      []Resource{},
+					HealthAnalysis: &HealthAnalysis{},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, publish windows",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					PublishWindows: []PublishWindow{
+						{Schedule: "0 9 * * 1-5", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+						{Schedule: "CRON_TZ=Europe/Madrid 0 22 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, publish window with invalid schedule",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:         "test",
+					Resources:      []Resource{},
+					PublishWindows: []PublishWindow{{Schedule: "0 9 * *", Duration: metav1.Duration{Duration: time.Hour}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, publish window without duration",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:         "test",
+					Resources:      []Resource{},
+					PublishWindows: []PublishWindow{{Schedule: "0 9 * * *"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, resources rendered with literal parameters",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"{{ .name }}","type":"STRICT_DNS","connect_timeout":"{{ .timeout }}","load_assignment":{"cluster_name":"{{ .name }}"}}`),
+						},
+					}},
+					Parameters: []Parameter{
+						{Name: "name", Value: pointer.New("cluster1")},
+						{Name: "timeout", Value: pointer.New("2s")},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, resources rendered with literal parameters are not valid",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"cluster1","connect_timeout":"{{ .timeout }}"}`),
+						},
+					}},
+					Parameters: []Parameter{{Name: "timeout", Value: pointer.New("two seconds")}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, only the syntax of the templates is validated with parameters from ConfigMaps",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"cluster1","connect_timeout":"{{ .timeout }}"}`),
+						},
+					}},
+					Parameters: []Parameter{{Name: "timeout", ValueFrom: &ParameterSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cm"}, Key: "timeout"},
+					}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, templates reference an unknown parameter",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						Value: &runtime.RawExtension{
+							Raw: []byte(`{"name":"cluster1","connect_timeout":"{{ .unknown }}"}`),
+						},
+					}},
+					Parameters: []Parameter{{Name: "timeout", ValueFrom: &ParameterSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cm"}, Key: "timeout"},
+					}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, parameter with both a value and a source",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					Parameters: []Parameter{{Name: "timeout", Value: pointer.New("2s"), ValueFrom: &ParameterSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cm"}, Key: "timeout"},
+					}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, duplicated parameters",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:     "test",
+					Resources:  []Resource{},
+					Parameters: []Parameter{{Name: "timeout", Value: pointer.New("2s")}, {Name: "timeout", Value: pointer.New("1s")}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, resources only from included libraries",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:   "test",
+					Includes: []string{"auth", "telemetry"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, duplicated includes",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:   "test",
+					Includes: []string{"auth", "auth"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, includes along with EnvoyResources",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:         "test",
+					EnvoyResources: &EnvoyResources{},
+					Includes:       []string{"auth"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok, listener references a route declared in an included library",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:   "test",
+					Includes: []string{"team-routes"},
+					Resources: []Resource{{
+						Type:  "listener",
+						Value: &runtime.RawExtension{Raw: []byte(testRDSListener("team_routes"))},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Ok, listener references a route declared in a fragment",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "gateway",
+					Resources: []Resource{{
+						Type:  "listener",
+						Value: &runtime.RawExtension{Raw: []byte(testRDSListener("team_routes"))},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Ok, listener references a route read from a ConfigMap",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{
+						{
+							Type: "listener",
+							Value: &runtime.RawExtension{Raw: []byte(`{"name":"listener","address":{"socket_address":{"address":"0.0.0.0","port_value":8080}},` +
+								`"filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{` +
+								`"@type":"type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",` +
+								`"stat_prefix":"http","rds":{"route_config_name":"routes","config_source":{"ads":{}}},` +
+								`"http_filters":[{"name":"envoy.filters.http.router","typed_config":{"@type":"type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"}}]}}]}]}`)},
+						},
+						{
+							Type: "route",
+							ValueFrom: &ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "routes"}, Key: "routes.yaml"}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fail, resource with both a value and a source",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type:  "cluster",
+						Value: &runtime.RawExtension{Raw: []byte(`{"name":"cluster1"}`)},
+						ValueFrom: &ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster1"}},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, resource source with both a ConfigMap and a Secret",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						ValueFrom: &ResourceValueSource{
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster1"},
+							SecretKeyRef:    &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster1"},
+						},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, resource source without a key",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "cluster",
+						ValueFrom: &ResourceValueSource{
+							SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}},
+						},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, secret resources cannot read their value from a ConfigMap",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID: "test",
+					Resources: []Resource{{
+						Type: "secret",
+						ValueFrom: &ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "secrets"}, Key: "secret"}},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Fail, rollout without steps",
+			fields: fields{
+				Spec: EnvoyConfigSpec{
+					NodeID:    "test",
+					Resources: []Resource{},
+					Rollout:   &RolloutPolicy{},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -388,3 +935,160 @@ func TestEnvoyConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvoyConfig_Warnings(t *testing.T) {
+	r := &EnvoyConfig{
+		Spec: EnvoyConfigSpec{
+			NodeID: "test",
+			Resources: []Resource{{
+				Type:  "route",
+				Value: &runtime.RawExtension{Raw: []byte(`{"name":"route","virtual_hosts":[{"name":"vh","domains":["*"],"routes":[{"match":{"prefix":"/"},"route":{"cluster":"missing"}}]}]}`)},
+			}},
+		},
+	}
+
+	if err := r.ValidateResources(); err != nil {
+		t.Errorf("EnvoyConfig.ValidateResources() error = %v", err)
+	}
+	want := []string{`spec.resources[0].value: route configuration "route" references cluster "missing", which is not declared`}
+	if diff := deep.Equal(r.Warnings(), want); len(diff) > 0 {
+		t.Errorf("EnvoyConfig.Warnings() = %v", diff)
+	}
+}
+
+func TestEnvoyConfig_Warnings_Includes(t *testing.T) {
+	r := &EnvoyConfig{
+		Spec: EnvoyConfigSpec{
+			NodeID:   "test",
+			Includes: []string{"team-routes"},
+			Resources: []Resource{{
+				Type:  "listener",
+				Value: &runtime.RawExtension{Raw: []byte(testRDSListener("team_routes"))},
+			}},
+		},
+	}
+
+	if err := r.Validate(); err != nil {
+		t.Errorf("EnvoyConfig.Validate() error = %v", err)
+	}
+	want := []string{`spec.resources[0].value: Not found: "route \"team_routes\""`}
+	if diff := deep.Equal(r.Warnings(), want); len(diff) > 0 {
+		t.Errorf("EnvoyConfig.Warnings() = %v", diff)
+	}
+}
+
+// testRDSListener returns a listener that reads its routes from the given route configuration
+func testRDSListener(route string) string {
+	return `{"name":"listener","address":{"socket_address":{"address":"0.0.0.0","port_value":8080}},` +
+		`"filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager","typed_config":{` +
+		`"@type":"type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",` +
+		`"stat_prefix":"http","rds":{"route_config_name":"` + route + `","config_source":{"ads":{}}},` +
+		`"http_filters":[{"name":"envoy.filters.http.router","typed_config":{"@type":"type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"}}]}}]}]}`
+}
+
+func TestEnvoyConfig_ValidateValuesFrom_SecretKeyRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage *RevisionStorage
+		wantErr bool
+	}{
+		{"Fails with the default revision storage", nil, true},
+		{"Fails with revisions stored in ConfigMaps", pointer.New(RevisionStorageConfigMap), true},
+		{"Ok with revisions stored in Secrets", pointer.New(RevisionStorageSecret), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &EnvoyConfig{
+				Spec: EnvoyConfigSpec{
+					NodeID:          "test",
+					RevisionStorage: tt.storage,
+					Resources: []Resource{{
+						Type: "cluster",
+						ValueFrom: &ResourceValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster"}},
+					}},
+				},
+			}
+			if err := r.ValidateValuesFrom(); (err != nil) != tt.wantErr {
+				t.Errorf("EnvoyConfig.ValidateValuesFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvoyConfig_Warnings_Size(t *testing.T) {
+	resources := []Resource{}
+	for i := 0; i < 20000; i++ {
+		resources = append(resources, Resource{
+			Type:  "cluster",
+			Value: &runtime.RawExtension{Raw: []byte(fmt.Sprintf(`{"name":"cluster-%d","connect_timeout":"1s"}`, i))},
+		})
+	}
+
+	tests := []struct {
+		name    string
+		storage *RevisionStorage
+		want    int
+	}{
+		{"Warns about the size and suggests a revision storage", nil, 1},
+		{"Warns about the size", pointer.New(RevisionStorageConfigMap), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &EnvoyConfig{Spec: EnvoyConfigSpec{NodeID: "test", Resources: resources, RevisionStorage: tt.storage}}
+			got := r.Warnings()
+			if len(got) != tt.want {
+				t.Fatalf("EnvoyConfig.Warnings() = %v, want %v warnings", got, tt.want)
+			}
+			if suggests := strings.Contains(got[0], "spec.revisionStorage"); suggests != (tt.storage == nil) {
+				t.Errorf("EnvoyConfig.Warnings() = %v", got)
+			}
+		})
+	}
+}
+
+// testHandler is an admission handler that always returns the same response
+type testHandler struct {
+	rsp admission.Response
+}
+
+func (h testHandler) Handle(context.Context, admission.Request) admission.Response { return h.rsp }
+
+func Test_warningsHandler_Handle(t *testing.T) {
+	ec := &EnvoyConfig{
+		Spec: EnvoyConfigSpec{
+			NodeID: "test",
+			Resources: []Resource{{
+				Type:  "route",
+				Value: &runtime.RawExtension{Raw: []byte(`{"name":"route","virtual_hosts":[{"name":"vh","domains":["*"],"routes":[{"match":{"prefix":"/"},"route":{"cluster":"missing"}}]}]}`)},
+			}},
+		},
+	}
+	raw, _ := json.Marshal(ec)
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Object: runtime.RawExtension{Raw: raw}}}
+
+	tests := []struct {
+		name         string
+		rsp          admission.Response
+		wantWarnings int
+	}{
+		{
+			name:         "Adds warnings to allowed requests",
+			rsp:          admission.Allowed(""),
+			wantWarnings: 1,
+		},
+		{
+			name:         "Does not add warnings to denied requests",
+			rsp:          admission.Denied("error"),
+			wantWarnings: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &warningsHandler{Handler: testHandler{rsp: tt.rsp}}
+			if got := h.Handle(context.TODO(), req); len(got.Warnings) != tt.wantWarnings {
+				t.Errorf("warningsHandler.Handle() warnings = %v, want %v", got.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
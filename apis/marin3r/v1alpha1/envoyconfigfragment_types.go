@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	/* Labels */
+
+	// FragmentNodeIDLabel is the label that holds the nodeID of the
+	// EnvoyConfig an EnvoyConfigFragment is aggregated into
+	FragmentNodeIDLabel string = "marin3r.3scale.net/node-id"
+
+	/* Conditions */
+
+	// FragmentAcceptedCondition indicates whether the resources of the EnvoyConfigFragment
+	// have been aggregated into the resources of the EnvoyConfig of its nodeID
+	FragmentAcceptedCondition string = "Accepted"
+
+	/* Reasons */
+
+	// FragmentAggregatedReason is the reason of accepted EnvoyConfigFragments
+	FragmentAggregatedReason string = "Aggregated"
+
+	// FragmentInvalidResourcesReason is the reason of the EnvoyConfigFragments
+	// rejected because their resources are not valid
+	FragmentInvalidResourcesReason string = "InvalidResources"
+
+	// FragmentResourceCollisionReason is the reason of the EnvoyConfigFragments rejected
+	// because they declare a resource that has already been declared elsewhere
+	FragmentResourceCollisionReason string = "ResourceCollision"
+)
+
+// EnvoyConfigFragmentSpec defines the desired state of EnvoyConfigFragment
+type EnvoyConfigFragmentSpec struct {
+	// Resources holds the resources aggregated into the EnvoyConfig of the nodeID
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	Resources []Resource `json:"resources,omitempty"`
+}
+
+// EnvoyConfigFragmentStatus defines the observed state of EnvoyConfigFragment
+type EnvoyConfigFragmentStatus struct {
+	// Conditions represent the latest available observations of an object's state
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EnvoyConfigFragment holds part of the resources of a nodeID, so the configuration of a nodeID
+// can be split across several objects owned by different teams. The resources of the fragments
+// labelled with "marin3r.3scale.net/node-id: <nodeID>" are aggregated into the resources of the
+// EnvoyConfig for that nodeID in the same namespace. Fragments with invalid resources are left
+// out and the errors are reported in their status, without blocking the rest of the fragments.
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=envoyconfigfragments,scope=Namespaced,shortName=ecf
+// +kubebuilder:printcolumn:JSONPath=".metadata.labels.marin3r\\.3scale\\.net/node-id",name=Node ID,type=string
+// +kubebuilder:printcolumn:JSONPath=".status.conditions[?(@.type==\"Accepted\")].status",name=Accepted,type=string
+// +operator-sdk:csv:customresourcedefinitions:displayName="EnvoyConfigFragment"
+type EnvoyConfigFragment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EnvoyConfigFragmentSpec   `json:"spec,omitempty"`
+	Status EnvoyConfigFragmentStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// EnvoyConfigFragmentList contains a list of EnvoyConfigFragment
+type EnvoyConfigFragmentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EnvoyConfigFragment `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EnvoyConfigFragment{}, &EnvoyConfigFragmentList{})
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	"github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -37,6 +39,17 @@ const (
 	// problems have been observed with this revision and should not be published
 	RevisionTaintedCondition string = "RevisionTainted"
 
+	/* Annotations */
+
+	// ClearTaintAnnotation is an annotation that, when added to an EnvoyConfigRevision,
+	// clears its RevisionTainted condition and the NACKs received for it, so the revision
+	// can be published again. The annotation is removed once the taint is cleared.
+	ClearTaintAnnotation string = "marin3r.3scale.net/clear-taint"
+
+	// ClearTaintRetryValue is the value of the ClearTaintAnnotation when the taint
+	// is cleared by the retry policy of the EnvoyConfig
+	ClearTaintRetryValue string = "retry"
+
 	/* Finalizers */
 
 	// EnvoyConfigRevisionFinalizer is the finalizer for EnvoyConfig objects
@@ -50,6 +63,11 @@ type EnvoyConfigRevisionSpec struct {
 	// +kubebuilder:validation:Pattern:[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	NodeID string `json:"nodeID"`
+	// NodeIDs is a list of additional nodeIDs the resources are served
+	// to when published. It is kept in sync with the EnvoyConfig.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	NodeIDs []string `json:"nodeIDs,omitempty"`
 	// Version is a hash of the EnvoyResources field
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Version string `json:"version"`
@@ -72,6 +90,48 @@ type EnvoyConfigRevisionSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
 	Resources []Resource `json:"resources,omitempty"`
+	// ResourcesFrom references the objects that hold the resources of the revision when
+	// they are not stored in the spec. The resources field is empty in that case.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	ResourcesFrom *ResourcesSource `json:"resourcesFrom,omitempty"`
+	// FailurePolicy determines when the revision is considered to be failing. It
+	// is kept in sync with the failure policy of the EnvoyConfig that owns the revision.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+	// HealthAnalysis configures the analysis of the stats of the Envoy clients after the
+	// revision is published. It is kept in sync with the health analysis of the EnvoyConfig
+	// that owns the revision.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	HealthAnalysis *HealthAnalysis `json:"healthAnalysis,omitempty"`
+	// DeletionPolicy determines what happens with the resources of the revision when it
+	// is deleted while published. It is kept in sync with the deletion policy of the
+	// EnvoyConfig that owns the revision.
+	// +kubebuilder:validation:Enum=Clear;Retain
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// RetainTTL is the maximum time the resources are retained with the "Retain" deletion
+	// policy. It is kept in sync with the retain TTL of the EnvoyConfig that owns the revision.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	RetainTTL *metav1.Duration `json:"retainTTL,omitempty"`
+}
+
+// ResourcesSource references the objects that hold the resources of a revision. The resources
+// are serialized to JSON, compressed with gzip and split into shards, one per object.
+type ResourcesSource struct {
+	// Kind is the kind of the objects, either ConfigMap or Secret
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Kind RevisionStorage `json:"kind"`
+	// Shards is the ordered list of the names of the objects. Concatenating
+	// their data in this order gives the compressed resources.
+	// +kubebuilder:validation:MinItems=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Shards []string `json:"shards"`
 }
 
 // EnvoyConfigRevisionStatus defines the observed state of EnvoyConfigRevision
@@ -96,6 +156,28 @@ type EnvoyConfigRevisionStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// +optional
 	Tainted *bool `json:"tainted,omitempty"`
+	// TaintRetries is the number of times the RevisionTainted condition has been cleared
+	// by the retry policy of the EnvoyConfig. It is reset when the taint is manually cleared.
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	TaintRetries int32 `json:"taintRetries,omitempty"`
+	// LastNACKs holds the error detail of the latest NACK reported by each one
+	// of the Envoy clients that rejected the resources of this revision. Only
+	// the 20 most recent ones are kept.
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	LastNACKs []NACKReport `json:"lastNACKs,omitempty"`
+	// PublishedNodeIDs is the list of additional nodeIDs the resources of this
+	// revision have been written to in the xDS server cache, so they can be
+	// cleared once removed from spec.nodeIDs
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	PublishedNodeIDs []string `json:"publishedNodeIDs,omitempty"`
+	// Rollout holds the progress of the rollout of this revision when it is
+	// being progressively rolled out to the Envoy clients
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Rollout *RevisionRolloutStatus `json:"rollout,omitempty"`
 	// Conditions represent the latest available observations of an object's state
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	// +optional
@@ -131,6 +213,55 @@ type VersionTracker struct {
 	ExtensionConfigs string `json:"extensionConfigs,omitempty"`
 }
 
+// NACKReport holds the error detail of a NACK sent by an
+// Envoy client
+type NACKReport struct {
+	// PodName is the name of the Pod that rejected the resources
+	PodName string `json:"podName"`
+	// NodeID is the nodeID of the Pod. It is only set when the
+	// resources are published to more than one nodeID.
+	// +optional
+	NodeID string `json:"nodeID,omitempty"`
+	// ResourceType is the type of the rejected resources
+	ResourceType envoy.Type `json:"resourceType"`
+	// Version is the version of the rejected resources
+	Version string `json:"version"`
+	// Message is the error detail reported by the Envoy client
+	Message string `json:"message"`
+}
+
+// RevisionRolloutStatus holds the progress of the rollout of a revision
+type RevisionRolloutStatus struct {
+	// Step is the index of the current step of the rollout
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Step int32 `json:"step"`
+	// Percentage of the Envoy clients that are served this revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Percentage int32 `json:"percentage"`
+	// StepStartedAt is the time the current step of the rollout started
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	StepStartedAt metav1.Time `json:"stepStartedAt"`
+	// SelectedPods is the number of Envoy clients selected
+	// to receive this revision in the current step
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	SelectedPods *int32 `json:"selectedPods,omitempty"`
+	// PodsInSync is the number of selected Envoy clients
+	// that have acknowledged this revision
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	PodsInSync *int32 `json:"podsInSync,omitempty"`
+}
+
+// IsStepComplete returns true if all the Envoy clients selected in the current
+// step have acknowledged the revision and the given bake time has elapsed
+func (status *RevisionRolloutStatus) IsStepComplete(bakeTime time.Duration, now time.Time) bool {
+	if status.SelectedPods == nil || status.PodsInSync == nil || *status.PodsInSync < *status.SelectedPods {
+		return false
+	}
+	return !now.Before(status.StepStartedAt.Add(bakeTime))
+}
+
 // +kubebuilder:object:root=true
 
 // EnvoyConfigRevision is an internal resource that stores a specific version of an EnvoyConfig
@@ -162,6 +293,12 @@ func (ecr *EnvoyConfigRevision) GetEnvoyAPIVersion() envoy.APIVersion {
 	return envoy.APIVersion(*ecr.Spec.EnvoyAPI)
 }
 
+// GetNodeIDs returns spec.nodeID followed by the additional nodeIDs
+// in spec.nodeIDs, without duplicates
+func (ecr *EnvoyConfigRevision) GetNodeIDs() []string {
+	return uniqueNodeIDs(ecr.Spec.NodeID, ecr.Spec.NodeIDs)
+}
+
 // GetSerialization returns the encoding of the envoy resources.
 func (ecr *EnvoyConfigRevision) GetSerialization() envoy_serializer.Serialization {
 	if ecr.Spec.Serialization == nil {
@@ -170,6 +307,38 @@ func (ecr *EnvoyConfigRevision) GetSerialization() envoy_serializer.Serializatio
 	return envoy_serializer.Serialization(*ecr.Spec.Serialization)
 }
 
+// GetDeletionPolicy returns the deletion policy of the revision,
+// which defaults to DeletionPolicyClear
+func (ecr *EnvoyConfigRevision) GetDeletionPolicy() DeletionPolicy {
+	if ecr.Spec.DeletionPolicy == nil {
+		return DeletionPolicyClear
+	}
+	return *ecr.Spec.DeletionPolicy
+}
+
+// GetRetainTTL returns the maximum time the resources of the revision are
+// retained with the "Retain" deletion policy. Zero means no limit.
+func (ecr *EnvoyConfigRevision) GetRetainTTL() time.Duration {
+	if ecr.Spec.RetainTTL == nil {
+		return 0
+	}
+	return ecr.Spec.RetainTTL.Duration
+}
+
+// uniqueNodeIDs returns the nodeID followed by the
+// additional ones, skipping the empty and repeated ones
+func uniqueNodeIDs(nodeID string, additional []string) []string {
+	list := []string{nodeID}
+	seen := map[string]bool{nodeID: true}
+	for _, id := range additional {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			list = append(list, id)
+		}
+	}
+	return list
+}
+
 // +kubebuilder:object:root=true
 
 // EnvoyConfigRevisionList contains a list of EnvoyConfigRevision
@@ -0,0 +1,31 @@
+// Package v1alpha1 holds a frozen copy of the v1alpha1 Resource type as it was first
+// released. The versions of the resources are hashes of their printed representation,
+// which includes the name of the package and of every field, so these types are used
+// to calculate the versions and must not be modified: any change to them changes the
+// version of every EnvoyConfig and triggers the publication of a new revision on upgrade.
+package v1alpha1
+
+import (
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Blueprint is the first released v1alpha1.Blueprint
+type Blueprint string
+
+// Resource is the first released v1alpha1.Resource
+type Resource struct {
+	Type                       envoy.Type                  `json:"type"`
+	Value                      *runtime.RawExtension       `json:"value,omitempty"`
+	GenerateFromTlsSecret      *string                     `json:"generateFromTlsSecret,omitempty"`
+	GenerateFromEndpointSlices *GenerateFromEndpointSlices `json:"generateFromEndpointSlices,omitempty"`
+	Blueprint                  *Blueprint                  `json:"blueprint,omitempty"`
+}
+
+// GenerateFromEndpointSlices is the first released v1alpha1.GenerateFromEndpointSlices
+type GenerateFromEndpointSlices struct {
+	Selector    *metav1.LabelSelector `json:"selector"`
+	ClusterName string                `json:"clusterName"`
+	TargetPort  string                `json:"targetPort"`
+}
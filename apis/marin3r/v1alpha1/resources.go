@@ -1,15 +1,27 @@
 package v1alpha1
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"text/template"
 
+	legacy "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1/internal/legacy/v1alpha1"
 	"github.com/3scale-ops/marin3r/pkg/envoy"
+	defaults "github.com/3scale-ops/marin3r/pkg/envoy/container/defaults"
+	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/davecgh/go-spew/spew"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"sigs.k8s.io/yaml"
 )
 
@@ -39,6 +51,13 @@ type Resource struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
 	Value *runtime.RawExtension `json:"value,omitempty"`
+	// ValueFrom is the source the value of the resource is read from, in JSON or YAML, when
+	// it is kept outside of the EnvoyConfig. The content is recorded in the value of the
+	// resources of the revision when the revision is created, so a change in the content
+	// produces a new revision.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	ValueFrom *ResourceValueSource `json:"valueFrom,omitempty"`
 	// The name of a Kubernetes Secret of type "kubernetes.io/tls"
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
@@ -48,6 +67,11 @@ type Resource struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
 	GenerateFromEndpointSlices *GenerateFromEndpointSlices `json:"generateFromEndpointSlices,omitempty"`
+	// Specifies a ConfigMap whose data is used to generate the runtime resource.
+	// Changes in the data are published without creating a new revision.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	GenerateFromConfigMap *GenerateFromConfigMap `json:"generateFromConfigMap,omitempty"`
 	// Blueprint specifies a template to generate a configuration proto. It is currently
 	// only supported to generate secret configuration resources from k8s Secrets
 	// +kubebuilder:validation:Enum=tlsCertificate;validationContext;
@@ -63,12 +87,262 @@ func (r *Resource) GetBlueprint() Blueprint {
 	return defaultBlueprint
 }
 
+// GetLayerName returns the name of the runtime layer generated from the ConfigMap
+func (g *GenerateFromConfigMap) GetLayerName() string {
+	if g.LayerName != nil {
+		return *g.LayerName
+	}
+	return defaults.InitMgrRtdsLayerResourceName
+}
+
+// Canonical returns a copy of the resource with its value decoded and encoded back in a
+// deterministic way, so the formatting and the order of the fields of the value don't matter,
+// along with the name of the resource. Generated resources are returned as they are, with the
+// name of the Secret, the cluster or the runtime layer they are generated for. Values that can't
+// be decoded are returned as they are, with an empty name.
+func (r Resource) Canonical(version envoy.APIVersion) (Resource, string) {
+	switch {
+	case r.GenerateFromTlsSecret != nil:
+		return r, *r.GenerateFromTlsSecret
+
+	case r.GenerateFromEndpointSlices != nil:
+		return r, r.GenerateFromEndpointSlices.ClusterName
+
+	case r.GenerateFromConfigMap != nil:
+		return r, r.GenerateFromConfigMap.GetLayerName()
+
+	case r.Value != nil:
+		res := envoy_resources.NewGenerator(version).New(r.Type)
+		if res == nil {
+			return r, ""
+		}
+		if err := envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, version).Unmarshal(string(r.Value.Raw), res); err != nil {
+			return r, ""
+		}
+		value, err := envoy_serializer.NewResourceMarshaller(envoy_serializer.JSON, version).Marshal(res)
+		if err != nil {
+			return r, ""
+		}
+		r.Value = &runtime.RawExtension{Raw: []byte(value)}
+		return r, cache_v3.GetResourceName(res)
+	}
+
+	return r, ""
+}
+
+// hashPrinter prints the objects to hash the same way as the hash of any other object
+var hashPrinter = spew.ConfigState{Indent: " ", SortKeys: true, DisableMethods: true, SpewKeys: true}
+
+// hashResources returns the hash of the resources. The fields of the first released Resource
+// are hashed through a frozen copy of that type, the same way as any other object, so the
+// versions of the existing resources don't change when fields are added to Resource, which
+// would trigger the publication of a new revision for every EnvoyConfig on upgrade. The fields
+// added later are hashed in their JSON representation, and only when a resource sets them.
+func hashResources(resources []Resource) string {
+	hasher := fnv.New32a()
+	hashPrinter.Fprintf(hasher, "%#v", legacyResources(resources))
+	if added := addedResourceFields(resources); added != nil {
+		hasher.Write(added)
+	}
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// legacyResources returns the fields of the resources that were already part of the first
+// released Resource
+func legacyResources(resources []Resource) []legacy.Resource {
+	if resources == nil {
+		return nil
+	}
+	out := make([]legacy.Resource, 0, len(resources))
+	for _, r := range resources {
+		lr := legacy.Resource{
+			Type:                  r.Type,
+			Value:                 r.Value,
+			GenerateFromTlsSecret: r.GenerateFromTlsSecret,
+			Blueprint:             (*legacy.Blueprint)(r.Blueprint),
+		}
+		if r.GenerateFromEndpointSlices != nil {
+			lr.GenerateFromEndpointSlices = &legacy.GenerateFromEndpointSlices{
+				Selector:    r.GenerateFromEndpointSlices.Selector,
+				ClusterName: r.GenerateFromEndpointSlices.ClusterName,
+				TargetPort:  r.GenerateFromEndpointSlices.TargetPort,
+			}
+		}
+		out = append(out, lr)
+	}
+	return out
+}
+
+// addedResourceFields returns the JSON representation of the fields added to Resource after
+// the first release, or nil if none of the resources sets any of them
+func addedResourceFields(resources []Resource) []byte {
+	added := make([]Resource, 0, len(resources))
+	for _, r := range resources {
+		r.Type, r.Value, r.GenerateFromTlsSecret, r.GenerateFromEndpointSlices, r.Blueprint = "", nil, nil, nil, nil
+		added = append(added, r)
+	}
+	raw, err := json.Marshal(added)
+	if err != nil {
+		return nil
+	}
+	if unset, _ := json.Marshal(make([]Resource, len(resources))); bytes.Equal(raw, unset) {
+		return nil
+	}
+	return raw
+}
+
+// CanonicalResources returns the canonical representation of the given resources, sorted by
+// type and name, which is the same for any two lists that only differ in the order of the
+// resources or in the formatting of their values
+func CanonicalResources(resources []Resource, version envoy.APIVersion) []Resource {
+	if resources == nil {
+		return nil
+	}
+
+	type named struct {
+		resource Resource
+		name     string
+	}
+	list := make([]named, len(resources))
+	for idx, res := range resources {
+		list[idx].resource, list[idx].name = res.Canonical(version)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].resource.Type != list[j].resource.Type {
+			return list[i].resource.Type < list[j].resource.Type
+		}
+		return list[i].name < list[j].name
+	})
+
+	canonical := make([]Resource, len(list))
+	for idx := range list {
+		canonical[idx] = list[idx].resource
+	}
+	return canonical
+}
+
+// RenderResources returns a copy of the resources with the Go template expressions in the string
+// fields of their values rendered with the given parameters, which are referenced by name, like in
+// "{{ .port }}". Referencing a parameter that doesn't exist is an error. Values without template
+// expressions are returned as they are.
+func RenderResources(resources []Resource, params map[string]string) ([]Resource, error) {
+	if resources == nil {
+		return nil, nil
+	}
+
+	errList := []error{}
+	rendered := make([]Resource, len(resources))
+	for idx, res := range resources {
+		rendered[idx] = *res.DeepCopy()
+		if res.Value == nil || !bytes.Contains(res.Value.Raw, []byte("{{")) {
+			continue
+		}
+
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(res.Value.Raw))
+		// keep the numbers as they are written
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			errList = append(errList, fmt.Errorf("'spec.resources[%d].value' is not valid JSON: %w", idx, err))
+			continue
+		}
+		value, err := renderValue(value, params)
+		if err != nil {
+			errList = append(errList, fmt.Errorf("unable to render 'spec.resources[%d].value': %w", idx, err))
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		rendered[idx].Value = &runtime.RawExtension{Raw: raw}
+	}
+
+	if len(errList) > 0 {
+		return nil, NewMultiError(errList)
+	}
+	return rendered, nil
+}
+
+// renderValue renders the templates in the strings of a generic JSON value
+func renderValue(value interface{}, params map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+
+	case map[string]interface{}:
+		for key := range v {
+			rendered, err := renderValue(v[key], params)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = rendered
+		}
+		return v, nil
+
+	case []interface{}:
+		for idx := range v {
+			rendered, err := renderValue(v[idx], params)
+			if err != nil {
+				return nil, err
+			}
+			v[idx] = rendered
+		}
+		return v, nil
+
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New("").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, params); err != nil {
+			return nil, err
+		}
+		return out.String(), nil
+	}
+
+	return value, nil
+}
+
+// ResourceValueSource is the source of the value of a resource. Only one
+// of the ConfigMap or Secret references can be set.
+type ResourceValueSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the EnvoyConfig
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of a Secret in the namespace of the EnvoyConfig. The content is
+	// recorded in the revisions, so it requires the revisions to be stored in Secrets.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
 type GenerateFromEndpointSlices struct {
 	Selector    *metav1.LabelSelector `json:"selector"`
 	ClusterName string                `json:"clusterName"`
 	TargetPort  string                `json:"targetPort"`
 }
 
+// GenerateFromConfigMap generates a runtime layer from the data of a ConfigMap. Each key of the
+// data is a runtime key, and its value is typed so Envoy can use it: "true" and "false" are
+// booleans, numbers are numbers and percentages, like "12.5%", are fractional percents.
+// Anything else is a string.
+type GenerateFromConfigMap struct {
+	// Name is the name of the ConfigMap in the namespace of the EnvoyConfig
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Name string `json:"name"`
+	// LayerName is the name of the runtime layer, which must match the name of an RTDS layer
+	// in the bootstrap of the Envoy clients. Defaults to "runtime", the name of the layer
+	// configured by the marin3r init manager.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	// +optional
+	LayerName *string `json:"layerName,omitempty"`
+}
+
 // EnvoyResources holds each envoy api resource type
 type EnvoyResources struct {
 	// Endpoints is a list of the envoy ClusterLoadAssignment resource type.
@@ -100,3 +100,92 @@ func TestEnvoyResources_Resources(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderResources(t *testing.T) {
+	type args struct {
+		resources []Resource
+		params    map[string]string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []Resource
+		wantErr bool
+	}{
+		{
+			name: "Renders the templates in the string fields of the values",
+			args: args{
+				resources: []Resource{
+					{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "{{ .name }}", "connect_timeout": "{{ .timeout }}", "per_connection_buffer_limit_bytes": 32768, "dns_lookup_family": ["{{ .family }}"]}`)},
+				},
+				params: map[string]string{"name": "cluster", "timeout": "2s", "family": "V4_ONLY"},
+			},
+			want: []Resource{
+				{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"connect_timeout":"2s","dns_lookup_family":["V4_ONLY"],"name":"cluster","per_connection_buffer_limit_bytes":32768}`)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Escapes the rendered values",
+			args: args{
+				resources: []Resource{
+					{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "{{ .name }}"}`)},
+				},
+				params: map[string]string{"name": `"cluster"`},
+			},
+			want: []Resource{
+				{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name":"\"cluster\""}`)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Returns values without templates and generated resources as they are",
+			args: args{
+				resources: []Resource{
+					{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "cluster"}`)},
+					{Type: "secret", GenerateFromTlsSecret: pointer.New("secret")},
+				},
+				params: map[string]string{},
+			},
+			want: []Resource{
+				{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "cluster"}`)},
+				{Type: "secret", GenerateFromTlsSecret: pointer.New("secret")},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Fails if a parameter doesn't exist",
+			args: args{
+				resources: []Resource{
+					{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "{{ .missing }}"}`)},
+				},
+				params: map[string]string{},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Fails if a template is not valid",
+			args: args{
+				resources: []Resource{
+					{Type: "cluster", Value: k8sutil.StringtoRawExtension(`{"name": "{{ .name "}`)},
+				},
+				params: map[string]string{"name": "cluster"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderResources(tt.args.resources, tt.args.params)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RenderResources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RenderResources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
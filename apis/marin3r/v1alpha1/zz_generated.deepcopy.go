@@ -29,6 +29,47 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigDiff) DeepCopyInto(out *ConfigDiff) {
+	*out = *in
+	if in.Added != nil {
+		in, out := &in.Added, &out.Added
+		*out = make([]ResourceDiff, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Removed != nil {
+		in, out := &in.Removed, &out.Removed
+		*out = make([]ResourceDiff, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Modified != nil {
+		in, out := &in.Modified, &out.Modified
+		*out = make([]ResourceDiff, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigDiff.
+func (in *ConfigDiff) DeepCopy() *ConfigDiff {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigDiff)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigRevisionRef) DeepCopyInto(out *ConfigRevisionRef) {
 	*out = *in
@@ -72,6 +113,109 @@ func (in *EnvoyConfig) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyConfigFragment) DeepCopyInto(out *EnvoyConfigFragment) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigFragment.
+func (in *EnvoyConfigFragment) DeepCopy() *EnvoyConfigFragment {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyConfigFragment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EnvoyConfigFragment) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyConfigFragmentList) DeepCopyInto(out *EnvoyConfigFragmentList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EnvoyConfigFragment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigFragmentList.
+func (in *EnvoyConfigFragmentList) DeepCopy() *EnvoyConfigFragmentList {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyConfigFragmentList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EnvoyConfigFragmentList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyConfigFragmentSpec) DeepCopyInto(out *EnvoyConfigFragmentSpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]Resource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigFragmentSpec.
+func (in *EnvoyConfigFragmentSpec) DeepCopy() *EnvoyConfigFragmentSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyConfigFragmentSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyConfigFragmentStatus) DeepCopyInto(out *EnvoyConfigFragmentStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigFragmentStatus.
+func (in *EnvoyConfigFragmentStatus) DeepCopy() *EnvoyConfigFragmentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyConfigFragmentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvoyConfigList) DeepCopyInto(out *EnvoyConfigList) {
 	*out = *in
@@ -166,6 +310,11 @@ func (in *EnvoyConfigRevisionList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvoyConfigRevisionSpec) DeepCopyInto(out *EnvoyConfigRevisionSpec) {
 	*out = *in
+	if in.NodeIDs != nil {
+		in, out := &in.NodeIDs, &out.NodeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.EnvoyAPI != nil {
 		in, out := &in.EnvoyAPI, &out.EnvoyAPI
 		*out = new(envoy.APIVersion)
@@ -188,6 +337,31 @@ func (in *EnvoyConfigRevisionSpec) DeepCopyInto(out *EnvoyConfigRevisionSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ResourcesFrom != nil {
+		in, out := &in.ResourcesFrom, &out.ResourcesFrom
+		*out = new(ResourcesSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(FailurePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HealthAnalysis != nil {
+		in, out := &in.HealthAnalysis, &out.HealthAnalysis
+		*out = new(HealthAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(DeletionPolicy)
+		**out = **in
+	}
+	if in.RetainTTL != nil {
+		in, out := &in.RetainTTL, &out.RetainTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigRevisionSpec.
@@ -222,6 +396,21 @@ func (in *EnvoyConfigRevisionStatus) DeepCopyInto(out *EnvoyConfigRevisionStatus
 		*out = new(bool)
 		**out = **in
 	}
+	if in.LastNACKs != nil {
+		in, out := &in.LastNACKs, &out.LastNACKs
+		*out = make([]NACKReport, len(*in))
+		copy(*out, *in)
+	}
+	if in.PublishedNodeIDs != nil {
+		in, out := &in.PublishedNodeIDs, &out.PublishedNodeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RevisionRolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -244,6 +433,11 @@ func (in *EnvoyConfigRevisionStatus) DeepCopy() *EnvoyConfigRevisionStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvoyConfigSpec) DeepCopyInto(out *EnvoyConfigSpec) {
 	*out = *in
+	if in.NodeIDs != nil {
+		in, out := &in.NodeIDs, &out.NodeIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Serialization != nil {
 		in, out := &in.Serialization, &out.Serialization
 		*out = new(serializer.Serialization)
@@ -266,6 +460,83 @@ func (in *EnvoyConfigSpec) DeepCopyInto(out *EnvoyConfigSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Includes != nil {
+		in, out := &in.Includes, &out.Includes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make([]Parameter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RevisionHistoryMaxAge != nil {
+		in, out := &in.RevisionHistoryMaxAge, &out.RevisionHistoryMaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RevisionStorage != nil {
+		in, out := &in.RevisionStorage, &out.RevisionStorage
+		*out = new(RevisionStorage)
+		**out = **in
+	}
+	if in.PinnedVersion != nil {
+		in, out := &in.PinnedVersion, &out.PinnedVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailurePolicy != nil {
+		in, out := &in.FailurePolicy, &out.FailurePolicy
+		*out = new(FailurePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HealthAnalysis != nil {
+		in, out := &in.HealthAnalysis, &out.HealthAnalysis
+		*out = new(HealthAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(DeletionPolicy)
+		**out = **in
+	}
+	if in.RetainTTL != nil {
+		in, out := &in.RetainTTL, &out.RetainTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	if in.RequireApproval != nil {
+		in, out := &in.RequireApproval, &out.RequireApproval
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PublishWindows != nil {
+		in, out := &in.PublishWindows, &out.PublishWindows
+		*out = make([]PublishWindow, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigSpec.
@@ -296,6 +567,15 @@ func (in *EnvoyConfigStatus) DeepCopyInto(out *EnvoyConfigStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.PendingVersion != nil {
+		in, out := &in.PendingVersion, &out.PendingVersion
+		*out = new(string)
+		**out = **in
+	}
+	if in.NextPublishWindow != nil {
+		in, out := &in.NextPublishWindow, &out.NextPublishWindow
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -308,6 +588,21 @@ func (in *EnvoyConfigStatus) DeepCopyInto(out *EnvoyConfigStatus) {
 		*out = make([]ConfigRevisionRef, len(*in))
 		copy(*out, *in)
 	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutStatus)
+		**out = **in
+	}
+	if in.Fleet != nil {
+		in, out := &in.Fleet, &out.Fleet
+		*out = new(FleetStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Diff != nil {
+		in, out := &in.Diff, &out.Diff
+		*out = new(ConfigDiff)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyConfigStatus.
@@ -340,6 +635,86 @@ func (in *EnvoyResource) DeepCopy() *EnvoyResource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyResourceLibrary) DeepCopyInto(out *EnvoyResourceLibrary) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyResourceLibrary.
+func (in *EnvoyResourceLibrary) DeepCopy() *EnvoyResourceLibrary {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyResourceLibrary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EnvoyResourceLibrary) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyResourceLibraryList) DeepCopyInto(out *EnvoyResourceLibraryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]EnvoyResourceLibrary, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyResourceLibraryList.
+func (in *EnvoyResourceLibraryList) DeepCopy() *EnvoyResourceLibraryList {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyResourceLibraryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *EnvoyResourceLibraryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvoyResourceLibrarySpec) DeepCopyInto(out *EnvoyResourceLibrarySpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]Resource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvoyResourceLibrarySpec.
+func (in *EnvoyResourceLibrarySpec) DeepCopy() *EnvoyResourceLibrarySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvoyResourceLibrarySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvoyResources) DeepCopyInto(out *EnvoyResources) {
 	*out = *in
@@ -431,6 +806,88 @@ func (in *EnvoySecretResource) DeepCopy() *EnvoySecretResource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailurePolicy) DeepCopyInto(out *FailurePolicy) {
+	*out = *in
+	if in.NACKsPerPod != nil {
+		in, out := &in.NACKsPerPod, &out.NACKsPerPod
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PodsPercentage != nil {
+		in, out := &in.PodsPercentage, &out.PodsPercentage
+		*out = new(int32)
+		**out = **in
+	}
+	if in.EvaluationWindow != nil {
+		in, out := &in.EvaluationWindow, &out.EvaluationWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailurePolicy.
+func (in *FailurePolicy) DeepCopy() *FailurePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(FailurePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetStatus) DeepCopyInto(out *FleetStatus) {
+	*out = *in
+	if in.SubscribedPods != nil {
+		in, out := &in.SubscribedPods, &out.SubscribedPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResourceTypes != nil {
+		in, out := &in.ResourceTypes, &out.ResourceTypes
+		*out = make([]ResourceTypeFleetStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeIDs != nil {
+		in, out := &in.NodeIDs, &out.NodeIDs
+		*out = make([]NodeIDFleetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetStatus.
+func (in *FleetStatus) DeepCopy() *FleetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenerateFromConfigMap) DeepCopyInto(out *GenerateFromConfigMap) {
+	*out = *in
+	if in.LayerName != nil {
+		in, out := &in.LayerName, &out.LayerName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenerateFromConfigMap.
+func (in *GenerateFromConfigMap) DeepCopy() *GenerateFromConfigMap {
+	if in == nil {
+		return nil
+	}
+	out := new(GenerateFromConfigMap)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GenerateFromEndpointSlices) DeepCopyInto(out *GenerateFromEndpointSlices) {
 	*out = *in
@@ -451,6 +908,137 @@ func (in *GenerateFromEndpointSlices) DeepCopy() *GenerateFromEndpointSlices {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthAnalysis) DeepCopyInto(out *HealthAnalysis) {
+	*out = *in
+	if in.Thresholds != nil {
+		in, out := &in.Thresholds, &out.Thresholds
+		*out = make([]StatThreshold, len(*in))
+		copy(*out, *in)
+	}
+	if in.BakeTime != nil {
+		in, out := &in.BakeTime, &out.BakeTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.AdminPort != nil {
+		in, out := &in.AdminPort, &out.AdminPort
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthAnalysis.
+func (in *HealthAnalysis) DeepCopy() *HealthAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NACKReport) DeepCopyInto(out *NACKReport) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NACKReport.
+func (in *NACKReport) DeepCopy() *NACKReport {
+	if in == nil {
+		return nil
+	}
+	out := new(NACKReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeIDFleetStatus) DeepCopyInto(out *NodeIDFleetStatus) {
+	*out = *in
+	if in.SubscribedPods != nil {
+		in, out := &in.SubscribedPods, &out.SubscribedPods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResourceTypes != nil {
+		in, out := &in.ResourceTypes, &out.ResourceTypes
+		*out = make([]ResourceTypeFleetStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeIDFleetStatus.
+func (in *NodeIDFleetStatus) DeepCopy() *NodeIDFleetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeIDFleetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Parameter) DeepCopyInto(out *Parameter) {
+	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		*out = new(string)
+		**out = **in
+	}
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(ParameterSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Parameter.
+func (in *Parameter) DeepCopy() *Parameter {
+	if in == nil {
+		return nil
+	}
+	out := new(Parameter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ParameterSource) DeepCopyInto(out *ParameterSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ParameterSource.
+func (in *ParameterSource) DeepCopy() *ParameterSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ParameterSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublishWindow) DeepCopyInto(out *PublishWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublishWindow.
+func (in *PublishWindow) DeepCopy() *PublishWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(PublishWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resource) DeepCopyInto(out *Resource) {
 	*out = *in
@@ -459,6 +1047,11 @@ func (in *Resource) DeepCopyInto(out *Resource) {
 		*out = new(runtime.RawExtension)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(ResourceValueSource)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.GenerateFromTlsSecret != nil {
 		in, out := &in.GenerateFromTlsSecret, &out.GenerateFromTlsSecret
 		*out = new(string)
@@ -469,6 +1062,11 @@ func (in *Resource) DeepCopyInto(out *Resource) {
 		*out = new(GenerateFromEndpointSlices)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.GenerateFromConfigMap != nil {
+		in, out := &in.GenerateFromConfigMap, &out.GenerateFromConfigMap
+		*out = new(GenerateFromConfigMap)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Blueprint != nil {
 		in, out := &in.Blueprint, &out.Blueprint
 		*out = new(Blueprint)
@@ -486,6 +1084,209 @@ func (in *Resource) DeepCopy() *Resource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceDiff) DeepCopyInto(out *ResourceDiff) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceDiff.
+func (in *ResourceDiff) DeepCopy() *ResourceDiff {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceDiff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceTypeFleetStatus) DeepCopyInto(out *ResourceTypeFleetStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceTypeFleetStatus.
+func (in *ResourceTypeFleetStatus) DeepCopy() *ResourceTypeFleetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceTypeFleetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceValueSource) DeepCopyInto(out *ResourceValueSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceValueSource.
+func (in *ResourceValueSource) DeepCopy() *ResourceValueSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceValueSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourcesSource) DeepCopyInto(out *ResourcesSource) {
+	*out = *in
+	if in.Shards != nil {
+		in, out := &in.Shards, &out.Shards
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourcesSource.
+func (in *ResourcesSource) DeepCopy() *ResourcesSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourcesSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.InitialCooldown != nil {
+		in, out := &in.InitialCooldown, &out.InitialCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxCooldown != nil {
+		in, out := &in.MaxCooldown, &out.MaxCooldown
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevisionRolloutStatus) DeepCopyInto(out *RevisionRolloutStatus) {
+	*out = *in
+	in.StepStartedAt.DeepCopyInto(&out.StepStartedAt)
+	if in.SelectedPods != nil {
+		in, out := &in.SelectedPods, &out.SelectedPods
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PodsInSync != nil {
+		in, out := &in.PodsInSync, &out.PodsInSync
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionRolloutStatus.
+func (in *RevisionRolloutStatus) DeepCopy() *RevisionRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RevisionRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutPolicy) DeepCopyInto(out *RolloutPolicy) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]RolloutStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutPolicy.
+func (in *RolloutPolicy) DeepCopy() *RolloutPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStatus) DeepCopyInto(out *RolloutStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStatus.
+func (in *RolloutStatus) DeepCopy() *RolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStep) DeepCopyInto(out *RolloutStep) {
+	*out = *in
+	if in.BakeTime != nil {
+		in, out := &in.BakeTime, &out.BakeTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStep.
+func (in *RolloutStep) DeepCopy() *RolloutStep {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatThreshold) DeepCopyInto(out *StatThreshold) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatThreshold.
+func (in *StatThreshold) DeepCopy() *StatThreshold {
+	if in == nil {
+		return nil
+	}
+	out := new(StatThreshold)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VersionTracker) DeepCopyInto(out *VersionTracker) {
 	*out = *in
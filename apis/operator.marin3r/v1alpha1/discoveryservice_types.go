@@ -36,6 +36,10 @@ const (
 	// DiscoveryServiceCertificateHashLabelKey is the label in the discovery service Deployment that
 	// stores the hash of the current server certificate
 	DiscoveryServiceCertificateHashLabelKey string = "marin3r.3scale.net/server-certificate-hash"
+	// OrphanedSnapshotsCondition indicates that the discovery service keeps serving
+	// the last published resources of EnvoyConfigs that have been deleted with
+	// the "Retain" deletion policy
+	OrphanedSnapshotsCondition string = "OrphanedSnapshots"
 
 	/* Default values */
 
@@ -121,6 +125,10 @@ type DiscoveryServiceStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	// +optional
 	*appsv1.DeploymentStatus `json:"deploymentStatus,omitempty"`
+	// Conditions represent the latest available observations of an object's state
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	// internal fields
 	status.UnimplementedStatefulSetStatus `json:"-"`
 }
@@ -391,6 +391,13 @@ func (in *DiscoveryServiceStatus) DeepCopyInto(out *DiscoveryServiceStatus) {
 		*out = new(appsv1.DeploymentStatus)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	out.UnimplementedStatefulSetStatus = in.UnimplementedStatefulSetStatus
 }
 
@@ -31,6 +31,7 @@ import (
 	marin3rcontroller "github.com/3scale-ops/marin3r/controllers/marin3r"
 	"github.com/3scale-ops/marin3r/pkg/discoveryservice"
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	envoyconfigrevision "github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfigrevision"
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
@@ -70,6 +71,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(dsScheme))
 	utilruntime.Must(marin3rv1alpha1.AddToScheme(dsScheme))
 	utilruntime.Must(marin3rv1alpha1.AddToScheme(dsScheme))
+	utilruntime.Must(operatorv1alpha1.AddToScheme(dsScheme))
 
 	// +kubebuilder:scaffold:scheme
 
@@ -145,26 +147,41 @@ func runDiscoveryService(cmd *cobra.Command, args []string) {
 
 	// Start controllers
 	if err := (&marin3rcontroller.EnvoyConfigReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("envoyconfig"),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Log:            ctrl.Log.WithName("controllers").WithName("envoyconfig"),
+		Scheme:         mgr.GetScheme(),
+		DiscoveryStats: xdss.GetDiscoveryStats(envoy.APIv3),
+		Recorder:       mgr.GetEventRecorderFor("envoyconfig"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "envoyconfig")
 		os.Exit(1)
 	}
 
 	if err := (&marin3rcontroller.EnvoyConfigRevisionReconciler{
-		Client:         mgr.GetClient(),
-		Log:            ctrl.Log.WithName("controllers").WithName(fmt.Sprintf("envoyconfigrevision_%s", string(envoy.APIv3))),
-		Scheme:         mgr.GetScheme(),
-		XdsCache:       xdss.GetCache(envoy.APIv3),
-		APIVersion:     envoy.APIv3,
-		DiscoveryStats: xdss.GetDiscoveryStats(envoy.APIv3),
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName(fmt.Sprintf("envoyconfigrevision_%s", string(envoy.APIv3))),
+		Scheme:            mgr.GetScheme(),
+		XdsCache:          xdss.GetCache(envoy.APIv3),
+		APIVersion:        envoy.APIv3,
+		DiscoveryStats:    xdss.GetDiscoveryStats(envoy.APIv3),
+		Recorder:          mgr.GetEventRecorderFor(fmt.Sprintf("envoyconfigrevision_%s", string(envoy.APIv3))),
+		OrphanedSnapshots: xdss.GetOrphanedSnapshots(envoy.APIv3),
+		HealthAnalyzer:    envoyconfigrevision.NewHealthAnalyzer(&http.Client{Timeout: 5 * time.Second}),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", fmt.Sprintf("envoyconfigrevision_%s", string(envoy.APIv3)))
 		os.Exit(1)
 	}
 
+	if err := (&marin3rcontroller.OrphanedSnapshotsReconciler{
+		Client:            mgr.GetClient(),
+		Log:               ctrl.Log.WithName("controllers").WithName("orphanedsnapshots"),
+		Scheme:            mgr.GetScheme(),
+		OrphanedSnapshots: xdss.GetOrphanedSnapshots(envoy.APIv3),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "orphanedsnapshots")
+		os.Exit(1)
+	}
+
 	// register healthz and readyz checks
 	if err := mgr.AddHealthzCheck("gRPC", xdssHealthzCheck(ctrl.Log.WithName("XdssHealthzCheck"))); err != nil {
 		setupLog.Error(err, "unable to set up health check")
@@ -39,6 +39,7 @@ var (
 	initmgrCluster                  string
 	initmgrXdsHost                  string
 	initmgrXdsPort                  int
+	initmgrXdsDelta                 bool
 	initmgrConfigPath               string
 	initmgrSdsConfigSourcePath      string
 	initmgrXdsClientCertificatePath string
@@ -67,6 +68,7 @@ func init() {
 	initManagerServiceCmd.Flags().StringVar(&initmgrCluster, "cluster", "", "Identifies this cluster to the xDS server.")
 	initManagerServiceCmd.Flags().StringVar(&initmgrXdsHost, "xdss-host", "", "Address of the xDS server.")
 	initManagerServiceCmd.Flags().IntVar(&initmgrXdsPort, "xdss-port", int(operatorv1alpha1.DefaultXdsServerPort), "The port port the xDS server.")
+	initManagerServiceCmd.Flags().BoolVar(&initmgrXdsDelta, "xdss-delta", false, "Use the incremental (delta) variant of the xDS protocol.")
 	initManagerServiceCmd.Flags().StringVar(&initmgrConfigPath, "config-file", fmt.Sprintf("%s/%s", defaults.EnvoyConfigBasePath, defaults.EnvoyConfigFileName), "Path to the xDS client certificate key.")
 	initManagerServiceCmd.Flags().StringVar(&initmgrSdsConfigSourcePath, "resources-path", defaults.EnvoyConfigBasePath, "Path to the xDS client certificate key.")
 	initManagerServiceCmd.Flags().StringVar(&initmgrXdsClientCertificatePath, "client-certificate-path", defaults.EnvoyTLSBasePath, "Path to the xDS client certificate and key.")
@@ -105,6 +107,7 @@ func runInitManager(cmd *cobra.Command, args []string) {
 		Cluster:                     initmgrCluster,
 		XdsHost:                     initmgrXdsHost,
 		XdsPort:                     uint32(initmgrXdsPort),
+		XdsDelta:                    initmgrXdsDelta,
 		XdsClientCertificatePath:    fmt.Sprintf("%s/%s", initmgrXdsClientCertificatePath, corev1.TLSCertKey),
 		XdsClientCertificateKeyPath: fmt.Sprintf("%s/%s", initmgrXdsClientCertificatePath, corev1.TLSPrivateKeyKey),
 		SdsConfigSourcePath:         fmt.Sprintf("%s/%s", initmgrSdsConfigSourcePath, envoy_bootstrap_options.TlsCertificateSdsSecretFileName),
@@ -18,30 +18,54 @@ package controllers
 
 import (
 	"context"
+	"time"
 
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
 	envoyconfig "github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // EnvoyConfigReconciler reconciles a EnvoyConfig object
 type EnvoyConfigReconciler struct {
-	Client client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Client         client.Client
+	Log            logr.Logger
+	Scheme         *runtime.Scheme
+	DiscoveryStats *stats.Stats
+	Recorder       record.EventRecorder
 }
 
+// fleetStatusRefreshInterval is the interval at which the status of the
+// Envoy clients subscribed to the nodeID is refreshed
+const fleetStatusRefreshInterval = 30 * time.Second
+
 // Reconcile progresses EnvoyConfig resources to its desired state
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigrevisions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigrevisions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyresourcelibraries,verbs=get;list;watch
+// +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigfragments,verbs=get;list;watch
+// +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigfragments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=secrets,verbs=get;list;watch;create
 
 func (r *EnvoyConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("name", req.Name, "namespace", req.Namespace)
@@ -83,8 +107,19 @@ func (r *EnvoyConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
+	// merge the resources of the included libraries, render the templates in their
+	// values and read the values kept in ConfigMaps and Secrets so the version is
+	// calculated over, and the revisions hold, the resulting resources
+	if resources, err := envoyconfig.DesiredResources(ctx, r.Client, ec); err != nil {
+		log.Error(err, "unable to resolve the resources")
+		r.Recorder.Eventf(ec, corev1.EventTypeWarning, "FailedResolvingResources", "%s", err)
+		return ctrl.Result{}, err
+	} else {
+		ec.Spec.Resources = resources
+	}
+
 	revisionReconciler := envoyconfig.NewRevisionReconciler(
-		ctx, log, r.Client, r.Scheme, ec,
+		ctx, log, r.Client, r.Scheme, ec, r.Recorder,
 	)
 
 	result, err := revisionReconciler.Reconcile()
@@ -92,22 +127,148 @@ func (r *EnvoyConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return result, err
 	}
 
-	if ok := envoyconfig.IsStatusReconciled(ec, revisionReconciler.GetCacheState(), revisionReconciler.PublishedVersion(), revisionReconciler.GetRevisionList()); !ok {
+	diff, err := envoyconfig.ReconcileConfigDiff(ctx, r.Client, r.Scheme, r.Recorder, ec,
+		revisionReconciler.GetRevisionList(), revisionReconciler.DesiredVersion(), revisionReconciler.PublishedVersion())
+	if err != nil {
+		log.Error(err, "unable to reconcile the diff between the published and desired versions")
+		return ctrl.Result{}, err
+	}
+
+	if ok := envoyconfig.IsStatusReconciled(ec, revisionReconciler.GetCacheState(), revisionReconciler.DesiredVersion(),
+		revisionReconciler.PublishedVersion(), revisionReconciler.GetRevisionList(), diff, r.DiscoveryStats); !ok {
 		if err := r.Client.Status().Update(ctx, ec); err != nil {
 			log.Error(err, "unable to update EnvoyConfig status")
 			return ctrl.Result{}, err
 		}
 		log.Info("status updated for EnvoyConfig resource")
-		return reconcile.Result{}, nil
 	}
 
-	return ctrl.Result{}, nil
+	// the acknowledgements of the Envoy clients don't trigger reconciles, so the
+	// status is periodically refreshed while they are relevant
+	if r.DiscoveryStats != nil && envoyconfig.IsFleetStatusRefreshRequired(ec, revisionReconciler.GetRevisionList(), time.Now()) &&
+		(result.RequeueAfter == 0 || result.RequeueAfter > fleetStatusRefreshInterval) {
+		result.RequeueAfter = fleetStatusRefreshInterval
+	}
+
+	return result, nil
+}
+
+// ConfigMapsEventHandler returns an EventHandler that generates reconcile requests for the
+// EnvoyConfigs with parameters or resources that read their value from the ConfigMap
+func (r *EnvoyConfigReconciler) ConfigMapsEventHandler() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(r.envoyConfigsReadingFrom)
+}
+
+// SecretsEventHandler returns an EventHandler that generates reconcile requests
+// for the EnvoyConfigs with resources that read their value from the Secret
+func (r *EnvoyConfigReconciler) SecretsEventHandler() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(r.envoyConfigsReadingFrom)
+}
+
+// envoyConfigsReadingFrom returns reconcile requests for the
+// EnvoyConfigs that read values from the ConfigMap or Secret
+func (r *EnvoyConfigReconciler) envoyConfigsReadingFrom(o client.Object) []reconcile.Request {
+	keys, err := envoyconfig.EnvoyConfigsReadingFrom(context.Background(), r.Client, o)
+	if err != nil {
+		return []reconcile.Request{}
+	}
+
+	reconcileRequests := make([]reconcile.Request, 0, len(keys))
+	for _, key := range keys {
+		reconcileRequests = append(reconcileRequests, reconcile.Request{NamespacedName: key})
+	}
+	return reconcileRequests
+}
+
+// EnvoyResourceLibrariesEventHandler returns an EventHandler that generates
+// reconcile requests for the EnvoyConfigs that include the EnvoyResourceLibrary
+func (r *EnvoyConfigReconciler) EnvoyResourceLibrariesEventHandler() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			list, err := envoyconfig.ListEnvoyConfigs(context.Background(), r.Client, o.GetNamespace(), envoyconfig.IncludesIndex, o.GetName())
+			if err != nil {
+				return []reconcile.Request{}
+			}
+
+			reconcileRequests := []reconcile.Request{}
+			for _, ec := range list {
+				reconcileRequests = append(reconcileRequests,
+					reconcile.Request{NamespacedName: types.NamespacedName{
+						Name:      ec.GetName(),
+						Namespace: ec.GetNamespace(),
+					}})
+			}
+
+			return reconcileRequests
+		},
+	)
+}
+
+// EnvoyConfigFragmentsEventHandler returns an EventHandler that generates reconcile
+// requests for the EnvoyConfigs of the nodeID the EnvoyConfigFragment is labelled with.
+// On updates, the EnvoyConfigs of both the previous and the current nodeID are reconciled,
+// so a fragment moved to another nodeID is removed from the EnvoyConfigs it was merged into.
+func (r *EnvoyConfigReconciler) EnvoyConfigFragmentsEventHandler() handler.EventHandler {
+	enqueue := func(q workqueue.RateLimitingInterface, objs ...client.Object) {
+		for _, o := range objs {
+			for _, req := range r.envoyConfigsOfFragment(o) {
+				q.Add(req)
+			}
+		}
+	}
+
+	return handler.Funcs{
+		CreateFunc:  func(e event.CreateEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.ObjectOld, e.ObjectNew) },
+		DeleteFunc:  func(e event.DeleteEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+		GenericFunc: func(e event.GenericEvent, q workqueue.RateLimitingInterface) { enqueue(q, e.Object) },
+	}
+}
+
+// envoyConfigsOfFragment returns reconcile requests for the EnvoyConfigs
+// of the nodeID the EnvoyConfigFragment is labelled with
+func (r *EnvoyConfigReconciler) envoyConfigsOfFragment(o client.Object) []reconcile.Request {
+	nodeID, ok := o.GetLabels()[marin3rv1alpha1.FragmentNodeIDLabel]
+	if !ok {
+		return []reconcile.Request{}
+	}
+
+	list, err := envoyconfig.ListEnvoyConfigs(context.Background(), r.Client, o.GetNamespace(), envoyconfig.NodeIDIndex, nodeID)
+	if err != nil {
+		return []reconcile.Request{}
+	}
+
+	reconcileRequests := []reconcile.Request{}
+	for _, ec := range list {
+		reconcileRequests = append(reconcileRequests,
+			reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      ec.GetName(),
+				Namespace: ec.GetNamespace(),
+			}})
+	}
+
+	return reconcileRequests
 }
 
 // SetupWithManager adds the controller to the manager
 func (r *EnvoyConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := envoyconfig.SetupIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return err
+	}
+
+	// the ConfigMaps and Secrets owned by marin3r objects are never referenced by the resources,
+	// and the ones owned by the EnvoyConfigs already trigger reconciles through Owns
+	notOwnedByMarin3r := predicate.NewPredicateFuncs(func(o client.Object) bool { return !revisions.IsOwnedByMarin3r(o) })
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&marin3rv1alpha1.EnvoyConfig{}).
 		Owns(&marin3rv1alpha1.EnvoyConfigRevision{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, r.ConfigMapsEventHandler(), builder.WithPredicates(notOwnedByMarin3r)).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, r.SecretsEventHandler(), builder.WithPredicates(notOwnedByMarin3r)).
+		Watches(&source.Kind{Type: &marin3rv1alpha1.EnvoyResourceLibrary{}}, r.EnvoyResourceLibrariesEventHandler()).
+		// the status updates of the fragments don't need to trigger reconciles
+		Watches(&source.Kind{Type: &marin3rv1alpha1.EnvoyConfigFragment{}}, r.EnvoyConfigFragmentsEventHandler(),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
 		Complete(r)
 }
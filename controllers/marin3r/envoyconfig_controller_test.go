@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoyconfig "github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig"
+	"github.com/go-test/deep"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeIndexer registers the field indexes in a fake client builder
+type fakeIndexer struct{ builder *fake.ClientBuilder }
+
+func (i fakeIndexer) IndexField(_ context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	i.builder.WithIndex(obj, field, extractValue)
+	return nil
+}
+
+func TestEnvoyConfigReconciler_EnvoyConfigFragmentsEventHandler(t *testing.T) {
+	if err := marin3rv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := func(name, nodeID string) *marin3rv1alpha1.EnvoyConfig {
+		return &marin3rv1alpha1.EnvoyConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       marin3rv1alpha1.EnvoyConfigSpec{NodeID: nodeID},
+		}
+	}
+	fragment := func(nodeID string) *marin3rv1alpha1.EnvoyConfigFragment {
+		return &marin3rv1alpha1.EnvoyConfigFragment{ObjectMeta: metav1.ObjectMeta{
+			Name:      "team-routes",
+			Namespace: "default",
+			Labels:    map[string]string{marin3rv1alpha1.FragmentNodeIDLabel: nodeID},
+		}}
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ec("ec-a", "a"), ec("ec-b", "b"), ec("ec-c", "c"))
+	if err := envoyconfig.SetupIndexes(context.TODO(), fakeIndexer{builder}); err != nil {
+		t.Fatal(err)
+	}
+	r := &EnvoyConfigReconciler{Client: builder.Build(), Log: ctrl.Log.WithName("test")}
+
+	drain := func(q workqueue.RateLimitingInterface) []string {
+		names := []string{}
+		for q.Len() > 0 {
+			item, _ := q.Get()
+			names = append(names, item.(reconcile.Request).Name)
+			q.Done(item)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	tests := []struct {
+		name  string
+		event func(q workqueue.RateLimitingInterface)
+		want  []string
+	}{
+		{
+			name: "Create enqueues the EnvoyConfigs of the nodeID",
+			event: func(q workqueue.RateLimitingInterface) {
+				r.EnvoyConfigFragmentsEventHandler().Create(event.CreateEvent{Object: fragment("a")}, q)
+			},
+			want: []string{"ec-a"},
+		},
+		{
+			name: "Moving the fragment to another nodeID enqueues the EnvoyConfigs of both nodeIDs",
+			event: func(q workqueue.RateLimitingInterface) {
+				r.EnvoyConfigFragmentsEventHandler().Update(event.UpdateEvent{ObjectOld: fragment("a"), ObjectNew: fragment("b")}, q)
+			},
+			want: []string{"ec-a", "ec-b"},
+		},
+		{
+			name: "Delete enqueues the EnvoyConfigs of the nodeID",
+			event: func(q workqueue.RateLimitingInterface) {
+				r.EnvoyConfigFragmentsEventHandler().Delete(event.DeleteEvent{Object: fragment("c")}, q)
+			},
+			want: []string{"ec-c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+			tt.event(q)
+			if diff := deep.Equal(drain(q), tt.want); len(diff) > 0 {
+				t.Errorf("EnvoyConfigFragmentsEventHandler() enqueued = %v", diff)
+			}
+		})
+	}
+}
@@ -19,6 +19,8 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/3scale-ops/basereconciler/util"
@@ -28,6 +30,7 @@ import (
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
 	envoyconfigrevision "github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfigrevision"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
 	"github.com/go-logr/logr"
@@ -39,7 +42,9 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -57,13 +62,27 @@ type EnvoyConfigRevisionReconciler struct {
 	XdsCache       xdss.Cache
 	APIVersion     envoy.APIVersion
 	DiscoveryStats *stats.Stats
+	Recorder       record.EventRecorder
+	// OrphanedSnapshots tracks the snapshots retained
+	// after their EnvoyConfig has been deleted
+	OrphanedSnapshots *xdss.OrphanedSnapshots
+	// HealthAnalyzer analyzes the stats of the Envoy
+	// clients after a revision is published
+	HealthAnalyzer *envoyconfigrevision.HealthAnalyzer
 }
 
+// healthAnalysisInterval is the interval between the retrievals
+// of the stats of the Envoy clients during a health analysis
+const healthAnalysisInterval = 10 * time.Second
+
 // Reconcile progresses EnvoyConfigRevision resources to its desired state
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigrevisions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=marin3r.3scale.net,namespace=placeholder,resources=envoyconfigrevisions/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="core",namespace=placeholder,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=configmaps,verbs=get;list;watch
 // +kubebuilder:rbac:groups="discovery.k8s.io",namespace=placeholder,resources=endpointslices,verbs=get;list;watch
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="core",namespace=placeholder,resources=pods,verbs=get;list;watch
 func (r *EnvoyConfigRevisionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("name", req.Name, "namespace", req.Namespace)
 
@@ -106,7 +125,7 @@ func (r *EnvoyConfigRevisionReconciler) Reconcile(ctx context.Context, req ctrl.
 		if !controllerutil.ContainsFinalizer(ecr, marin3rv1alpha1.EnvoyConfigRevisionFinalizer) {
 			return reconcile.Result{}, nil
 		}
-		envoyconfigrevision.CleanupLogic(ecr, r.XdsCache, r.DiscoveryStats, log)
+		envoyconfigrevision.CleanupLogic(ecr, r.XdsCache, r.DiscoveryStats, r.OrphanedSnapshots, log)
 		controllerutil.RemoveFinalizer(ecr, marin3rv1alpha1.EnvoyConfigRevisionFinalizer)
 		if err = r.Client.Update(ctx, ecr); err != nil {
 			log.Error(err, "unable to update EnvoyConfigRevision")
@@ -116,12 +135,30 @@ func (r *EnvoyConfigRevisionReconciler) Reconcile(ctx context.Context, req ctrl.
 		return reconcile.Result{}, nil
 	}
 
+	// Clear the taint of the revision if requested through the ClearTaintAnnotation. The
+	// annotation removal triggers a new reconcile that publishes the revision if required.
+	if ok, retry := envoyconfigrevision.IsTaintClearRequested(ecr); ok {
+		if err := r.clearTaint(ctx, ecr, retry, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	var vt *marin3rv1alpha1.VersionTracker = nil
+	published := meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition)
+	canary := !published && ecr.Status.Rollout != nil && !ecr.Status.IsTainted()
 
 	// If this ecr has the RevisionPublishedCondition set to "True" pusblish the resources
-	// to the xds server cache
-	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
-		var err error
+	// to the xds server cache. If the ecr is being rolled out, publish the resources as the
+	// canary snapshot, which is only served to a percentage of the envoy clients.
+	if published || canary {
+		// The resources of revisions with a large amount of them are
+		// stored in ConfigMaps or Secrets instead of in spec.resources
+		resources, err := revisions.LoadResources(ctx, r.Client, ecr)
+		if err != nil {
+			log.Error(err, "unable to load the resources of the EnvoyConfigRevision")
+			return ctrl.Result{}, err
+		}
 		decoder := envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, r.APIVersion)
 
 		cacheReconciler := envoyconfigrevision.NewCacheReconciler(
@@ -130,7 +167,17 @@ func (r *EnvoyConfigRevisionReconciler) Reconcile(ctx context.Context, req ctrl.
 			envoy_resources.NewGenerator(r.APIVersion),
 		)
 
-		vt, err = cacheReconciler.Reconcile(ctx, req.NamespacedName, ecr.Spec.Resources, ecr.Spec.NodeID, ecr.Spec.Version)
+		if published {
+			vt, err = cacheReconciler.Reconcile(ctx, req.NamespacedName, resources, ecr.GetNodeIDs(), ecr.Spec.Version)
+			// A snapshot retained for the nodeID has been replaced by the resources of this revision
+			for _, nodeID := range ecr.GetNodeIDs() {
+				if err == nil && r.OrphanedSnapshots != nil && r.OrphanedSnapshots.Adopt(nodeID) {
+					log.Info("replaced orphaned snapshot in xDS cache", "Revision", ecr.Spec.Version, "NodeID", nodeID)
+				}
+			}
+		} else {
+			vt, err = cacheReconciler.ReconcileCanary(ctx, req.NamespacedName, resources, ecr.GetNodeIDs(), ecr.Spec.Version, ecr.Status.Rollout.Percentage)
+		}
 
 		// If a type errors.StatusError is returned it means that the config in spec.resources is wrong
 		// and cannot be written into the xDS cache. This is true for any error loading all types of resources
@@ -149,17 +196,59 @@ func (r *EnvoyConfigRevisionReconciler) Reconcile(ctx context.Context, req ctrl.
 		}
 	}
 
+	// Stop serving the canary snapshot once the rollout of this ecr completes or is aborted
+	for _, nodeID := range ecr.GetNodeIDs() {
+		if c, err := r.XdsCache.GetCanary(nodeID); !canary && err == nil && c.Version == ecr.Spec.Version {
+			if err := r.XdsCache.ClearCanary(ctx, nodeID); err != nil {
+				return ctrl.Result{}, err
+			}
+			log.Info("cleared canary snapshot from xDS cache", "Revision", ecr.Spec.Version, "NodeID", nodeID)
+		}
+	}
+
+	// Stop serving the resources to the nodeIDs removed from the revision
+	if err := envoyconfigrevision.ClearRemovedNodeIDs(ctx, ecr, r.XdsCache, r.DiscoveryStats, log); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	previousNACKs := ecr.Status.LastNACKs
+	wasTainted := ecr.Status.IsTainted()
 	if ok := envoyconfigrevision.IsStatusReconciled(ecr, vt, r.XdsCache, r.DiscoveryStats); !ok {
 		if err := r.Client.Status().Update(ctx, ecr); err != nil {
 			log.Error(err, "unable to update EnvoyConfigRevision status")
+		} else {
+			r.recordNACKEvents(ecr, previousNACKs)
+			if !wasTainted && ecr.Status.IsTainted() {
+				r.recordTaintEvent(ecr)
+			}
 		}
 		log.Info("status updated for EnvoyConfigRevision resource")
 	}
 
+	// Analyze the stats of the Envoy clients during the bake time after the publication
+	if r.HealthAnalyzer != nil {
+		if required, end := envoyconfigrevision.IsHealthAnalysisRequired(ecr, time.Now()); required {
+			requeueAfter, err := r.reconcileHealthAnalysis(ctx, ecr, end, log)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if requeueAfter > 0 {
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
+		} else {
+			r.HealthAnalyzer.Forget(ecr)
+		}
+	}
+
 	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
 		return ctrl.Result{Requeue: true, RequeueAfter: 30 * time.Second}, nil
 	}
 
+	// Keep track of the envoy clients that acknowledge the canary snapshot
+	if ecr.Status.Rollout != nil && !ecr.Status.IsTainted() {
+		return ctrl.Result{Requeue: true, RequeueAfter: 5 * time.Second}, nil
+	}
+
 	return ctrl.Result{}, nil
 
 }
@@ -182,10 +271,135 @@ func (r *EnvoyConfigRevisionReconciler) taintSelf(ctx context.Context, ecr *mari
 		}
 
 		log.Info(fmt.Sprintf("Tainted revision: %q", msg))
+		r.recordTaintEvent(ecr)
+	}
+	return nil
+}
+
+// reconcileHealthAnalysis analyzes the stats of the Envoy clients subscribed to the nodeID of the
+// revision and taints the revision if any of the thresholds is exceeded. It returns the time to
+// wait before the next analysis, zero if the revision has been tainted.
+func (r *EnvoyConfigRevisionReconciler) reconcileHealthAnalysis(ctx context.Context, ecr *marin3rv1alpha1.EnvoyConfigRevision,
+	end time.Time, log logr.Logger) (time.Duration, error) {
+
+	msg, err := r.HealthAnalyzer.Analyze(ctx, ecr, r.envoyAdminAddresses(ctx, ecr))
+	if err != nil {
+		log.Error(err, "unable to analyze the health of the revision")
+	} else if msg != "" {
+		if err := r.taintSelf(ctx, ecr, "HealthAnalysisFailed", msg, log); err != nil {
+			return 0, err
+		}
+		r.HealthAnalyzer.Forget(ecr)
+		return 0, nil
+	}
+
+	if remaining := time.Until(end); remaining < healthAnalysisInterval {
+		return remaining, nil
+	}
+	return healthAnalysisInterval, nil
+}
+
+// envoyAdminAddresses returns the addresses of the admin API of the
+// Envoy clients subscribed to the nodeIDs of the revision, by pod name
+func (r *EnvoyConfigRevisionReconciler) envoyAdminAddresses(ctx context.Context, ecr *marin3rv1alpha1.EnvoyConfigRevision) map[string]string {
+	addresses := map[string]string{}
+	if r.DiscoveryStats == nil {
+		return addresses
+	}
+
+	port := strconv.Itoa(int(ecr.Spec.HealthAnalysis.GetAdminPort()))
+	for _, nodeID := range ecr.GetNodeIDs() {
+		for name := range r.DiscoveryStats.GetSubscribedPods(nodeID, "") {
+			pod := &corev1.Pod{}
+			if err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: ecr.GetNamespace()}, pod); err != nil || pod.Status.PodIP == "" {
+				continue
+			}
+			addresses[name] = net.JoinHostPort(pod.Status.PodIP, port)
+		}
+	}
+	return addresses
+}
+
+func (r *EnvoyConfigRevisionReconciler) clearTaint(ctx context.Context, ecr *marin3rv1alpha1.EnvoyConfigRevision,
+	retry bool, log logr.Logger) error {
+
+	patch := client.MergeFrom(ecr.DeepCopy())
+	envoyconfigrevision.ClearTaint(ecr, r.DiscoveryStats, retry)
+	if err := r.Client.Status().Patch(ctx, ecr, patch); err != nil {
+		log.Error(err, "unable to update EnvoyConfigRevision status")
+		return err
+	}
+
+	patch = client.MergeFrom(ecr.DeepCopy())
+	annotations := ecr.GetAnnotations()
+	delete(annotations, marin3rv1alpha1.ClearTaintAnnotation)
+	ecr.SetAnnotations(annotations)
+	if err := r.Client.Patch(ctx, ecr, patch); err != nil {
+		log.Error(err, "unable to update EnvoyConfigRevision")
+		return err
 	}
+
+	log.Info("Cleared revision taint", "Retry", retry, "TaintRetries", ecr.Status.TaintRetries)
 	return nil
 }
 
+// recordNACKEvents emits a warning Event in the EnvoyConfig that owns the
+// revision for each NACK that was not already reported in the status
+func (r *EnvoyConfigRevisionReconciler) recordNACKEvents(ecr *marin3rv1alpha1.EnvoyConfigRevision, previous []marin3rv1alpha1.NACKReport) {
+
+	ref := ownerReference(ecr)
+	if ref == nil {
+		return
+	}
+
+	reported := map[marin3rv1alpha1.NACKReport]bool{}
+	for _, nack := range previous {
+		reported[nack] = true
+	}
+
+	for _, nack := range ecr.Status.LastNACKs {
+		if reported[nack] {
+			continue
+		}
+		r.Recorder.Eventf(ref, corev1.EventTypeWarning, "ResourcesRejected",
+			"Pod %s rejected %s resources of revision %s (version %s): %s",
+			nack.PodName, nack.ResourceType, ecr.GetName(), nack.Version, nack.Message)
+	}
+}
+
+// recordTaintEvent emits a warning Event in the EnvoyConfig that owns
+// the revision with the reason why the revision got tainted
+func (r *EnvoyConfigRevisionReconciler) recordTaintEvent(ecr *marin3rv1alpha1.EnvoyConfigRevision) {
+
+	ref := ownerReference(ecr)
+	if ref == nil {
+		return
+	}
+
+	reason, msg := "", ""
+	if cond := meta.FindStatusCondition(ecr.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition); cond != nil {
+		reason, msg = cond.Reason, cond.Message
+	}
+	r.Recorder.Eventf(ref, corev1.EventTypeWarning, "RevisionTainted",
+		"Revision %s (version %s) has been tainted (%s): %s", ecr.GetName(), ecr.Spec.Version, reason, msg)
+}
+
+// ownerReference returns a reference to the EnvoyConfig that owns the
+// revision, nil if the revision has no controller
+func ownerReference(ecr *marin3rv1alpha1.EnvoyConfigRevision) *corev1.ObjectReference {
+	owner := metav1.GetControllerOf(ecr)
+	if owner == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Name:       owner.Name,
+		Namespace:  ecr.GetNamespace(),
+		UID:        owner.UID,
+	}
+}
+
 func filterByAPIVersion(obj runtime.Object, version envoy.APIVersion) bool {
 	switch o := obj.(type) {
 	case *marin3rv1alpha1.EnvoyConfigRevision:
@@ -234,9 +448,14 @@ func (r *EnvoyConfigRevisionReconciler) SecretsEventHandler() handler.EventHandl
 
 			for _, ecr := range list.Items {
 				if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+					resources, err := revisions.LoadResources(context.Background(), r.Client, &ecr)
+					if err != nil {
+						// skip this item in case of error
+						continue
+					}
 					// check if the k8s Secret is relevant for this EnvoyConfigRevision
-					for _, s := range ecr.Spec.Resources {
-						if s.Type == envoy.Secret {
+					for _, s := range resources {
+						if s.Type == envoy.Secret && s.GenerateFromTlsSecret != nil {
 
 							if *s.GenerateFromTlsSecret == secret.GetName() {
 								reconcileRequests = append(reconcileRequests,
@@ -256,6 +475,41 @@ func (r *EnvoyConfigRevisionReconciler) SecretsEventHandler() handler.EventHandl
 	)
 }
 
+// ConfigMapsEventHandler returns an EventHandler that generates reconcile
+// requests for the ConfigMaps used to generate runtime resources
+func (r *EnvoyConfigRevisionReconciler) ConfigMapsEventHandler() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			list := &marin3rv1alpha1.EnvoyConfigRevisionList{}
+			if err := r.Client.List(context.Background(), list, client.InNamespace(o.GetNamespace())); err != nil {
+				return []reconcile.Request{}
+			}
+
+			reconcileRequests := []reconcile.Request{}
+
+			for _, ecr := range list.Items {
+				if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+					resources, err := revisions.LoadResources(context.Background(), r.Client, &ecr)
+					if err != nil {
+						// skip this item in case of error
+						continue
+					}
+					// check if the k8s ConfigMap is relevant for this EnvoyConfigRevision
+					if isRuntimeGeneratedFrom(resources, o.GetName()) {
+						reconcileRequests = append(reconcileRequests,
+							reconcile.Request{NamespacedName: types.NamespacedName{
+								Name:      ecr.GetName(),
+								Namespace: ecr.GetNamespace(),
+							}})
+					}
+				}
+			}
+
+			return reconcileRequests
+		},
+	)
+}
+
 // EndpointSlicesEventHandler returns an EventHandler that generates
 // reconcile requests for EndpointSlices
 func (r *EnvoyConfigRevisionReconciler) EndpointSlicesEventHandler() handler.EventHandler {
@@ -272,8 +526,13 @@ func (r *EnvoyConfigRevisionReconciler) EndpointSlicesEventHandler() handler.Eve
 
 			for _, ecr := range list.Items {
 				if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+					resources, err := revisions.LoadResources(context.Background(), r.Client, &ecr)
+					if err != nil {
+						// skip this item in case of error
+						continue
+					}
 					// check if the k8s EndpointSlice is relevant for this EnvoyConfigRevision
-					for _, r := range ecr.Spec.Resources {
+					for _, r := range resources {
 						if r.Type == envoy.Endpoint && r.GenerateFromEndpointSlices != nil {
 
 							selector, err := metav1.LabelSelectorAsSelector(r.GenerateFromEndpointSlices.Selector)
@@ -300,12 +559,27 @@ func (r *EnvoyConfigRevisionReconciler) EndpointSlicesEventHandler() handler.Eve
 	)
 }
 
+// isRuntimeGeneratedFrom returns true if any of the resources
+// is a runtime layer generated from the ConfigMap
+func isRuntimeGeneratedFrom(resources []marin3rv1alpha1.Resource, name string) bool {
+	for _, res := range resources {
+		if res.Type == envoy.Runtime && res.GenerateFromConfigMap != nil && res.GenerateFromConfigMap.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // SetupWithManager adds the controller to the manager
 func (r *EnvoyConfigRevisionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// the shards of the revisions are never used to generate resources
+	notOwnedByMarin3r := predicate.NewPredicateFuncs(func(o client.Object) bool { return !revisions.IsOwnedByMarin3r(o) })
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&marin3rv1alpha1.EnvoyConfigRevision{}).
 		WithEventFilter(filterByAPIVersionPredicate(r.APIVersion, filterByAPIVersion)).
-		Watches(&source.Kind{Type: &corev1.Secret{}}, r.SecretsEventHandler()).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, r.SecretsEventHandler(), builder.WithPredicates(notOwnedByMarin3r)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, r.ConfigMapsEventHandler(), builder.WithPredicates(notOwnedByMarin3r)).
 		Watches(&source.Kind{Type: &discoveryv1.EndpointSlice{}}, r.EndpointSlicesEventHandler()).
 		Complete(r)
 }
@@ -13,6 +13,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
@@ -27,18 +28,27 @@ func TestEnvoyConfigRevisionReconciler_taintSelf(t *testing.T) {
 
 	t.Run("Taints the ecr object", func(t *testing.T) {
 		ecr := &marin3rv1alpha1.EnvoyConfigRevision{
-			ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "default"},
+			ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: marin3rv1alpha1.GroupVersion.String(),
+					Kind:       "EnvoyConfig",
+					Name:       "ec",
+					Controller: pointer.New(true),
+				}},
+			},
 			Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
 				NodeID:    "node1",
 				Version:   "bbbb",
 				Resources: []marin3rv1alpha1.Resource{},
 			},
 		}
+		recorder := record.NewFakeRecorder(1)
 		r := &EnvoyConfigRevisionReconciler{
 			Client:   fake.NewFakeClient(ecr),
 			Scheme:   scheme.Scheme,
 			XdsCache: xdss_v3.NewCache(),
 			Log:      ctrl.Log.WithName("test"),
+			Recorder: recorder,
 		}
 		if err := r.taintSelf(context.TODO(), ecr, "test", "test", r.Log); err != nil {
 			t.Errorf("EnvoyConfigRevisionReconciler.taintSelf() error = %v", err)
@@ -47,6 +57,9 @@ func TestEnvoyConfigRevisionReconciler_taintSelf(t *testing.T) {
 		if !meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition) {
 			t.Errorf("EnvoyConfigRevisionReconciler.taintSelf() ecr is not tainted")
 		}
+		if got, want := <-recorder.Events, "Warning RevisionTainted Revision ecr (version bbbb) has been tainted (test): test"; got != want {
+			t.Errorf("EnvoyConfigRevisionReconciler.taintSelf() event = %q, want %q", got, want)
+		}
 	})
 }
 
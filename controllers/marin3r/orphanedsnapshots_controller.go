@@ -0,0 +1,148 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	operatorv1alpha1 "github.com/3scale-ops/marin3r/apis/operator.marin3r/v1alpha1"
+	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
+	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// OrphanedSnapshotsReconciler reports in the status of the DiscoveryService
+// resources the snapshots that the discovery service keeps serving after
+// their EnvoyConfig has been deleted
+type OrphanedSnapshotsReconciler struct {
+	Client            client.Client
+	Log               logr.Logger
+	Scheme            *runtime.Scheme
+	OrphanedSnapshots *xdss.OrphanedSnapshots
+}
+
+// Reconcile sets the OrphanedSnapshots condition of DiscoveryService resources
+// +kubebuilder:rbac:groups=operator.marin3r.3scale.net,namespace=placeholder,resources=discoveryservices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=operator.marin3r.3scale.net,namespace=placeholder,resources=discoveryservices/status,verbs=get;update;patch
+func (r *OrphanedSnapshotsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("name", req.Name, "namespace", req.Namespace)
+
+	ds := &operatorv1alpha1.DiscoveryService{}
+	if err := r.Client.Get(ctx, req.NamespacedName, ds); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	cond := calculateOrphanedSnapshotsCondition(r.OrphanedSnapshots.List())
+	if k8sutil.ConditionsEqual(&cond, meta.FindStatusCondition(ds.Status.Conditions, operatorv1alpha1.OrphanedSnapshotsCondition)) {
+		return ctrl.Result{}, nil
+	}
+
+	meta.SetStatusCondition(&ds.Status.Conditions, cond)
+	if err := r.Client.Status().Update(ctx, ds); err != nil {
+		log.Error(err, "unable to update DiscoveryService status")
+		return ctrl.Result{}, err
+	}
+	log.Info("status updated for DiscoveryService resource", "OrphanedSnapshots", cond.Status)
+	return ctrl.Result{}, nil
+}
+
+// calculateOrphanedSnapshotsCondition returns the OrphanedSnapshots
+// condition for the given list of orphaned snapshots
+func calculateOrphanedSnapshotsCondition(orphans []xdss.OrphanedSnapshot) metav1.Condition {
+	if len(orphans) == 0 {
+		return metav1.Condition{
+			Type:    operatorv1alpha1.OrphanedSnapshotsCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoOrphanedSnapshots",
+			Message: "There are no resources retained after the deletion of their EnvoyConfig",
+		}
+	}
+
+	items := make([]string, 0, len(orphans))
+	for _, orphan := range orphans {
+		expiration := "never expires"
+		if !orphan.ExpiresAt.IsZero() {
+			expiration = fmt.Sprintf("expires at %s", orphan.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+		items = append(items, fmt.Sprintf("%s (version %s, %s)", orphan.NodeID, orphan.Version, expiration))
+	}
+
+	return metav1.Condition{
+		Type:    operatorv1alpha1.OrphanedSnapshotsCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "EnvoyConfigsDeleted",
+		Message: fmt.Sprintf("Serving the resources retained after the deletion of their EnvoyConfig for nodeIDs: %s", strings.Join(items, ", ")),
+	}
+}
+
+// DiscoveryServicesEventHandler returns an EventHandler that generates
+// reconcile requests for all the DiscoveryService resources
+func (r *OrphanedSnapshotsReconciler) DiscoveryServicesEventHandler() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(
+		func(o client.Object) []reconcile.Request {
+			list := &operatorv1alpha1.DiscoveryServiceList{}
+			if err := r.Client.List(context.Background(), list); err != nil {
+				r.Log.Error(err, "unable to list DiscoveryService resources")
+				return []reconcile.Request{}
+			}
+
+			reconcileRequests := make([]reconcile.Request, 0, len(list.Items))
+			for _, ds := range list.Items {
+				reconcileRequests = append(reconcileRequests,
+					reconcile.Request{NamespacedName: types.NamespacedName{Name: ds.GetName(), Namespace: ds.GetNamespace()}})
+			}
+			return reconcileRequests
+		},
+	)
+}
+
+// SetupWithManager adds the controller to the manager
+func (r *OrphanedSnapshotsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// the orphaned snapshots are tracked in memory, so changes
+	// in the list are notified through a channel
+	events := make(chan event.GenericEvent, 1)
+	r.OrphanedSnapshots.Notify(func() {
+		select {
+		case events <- event.GenericEvent{Object: &operatorv1alpha1.DiscoveryService{}}:
+		default:
+			// a notification is already pending
+		}
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("orphanedsnapshots").
+		For(&operatorv1alpha1.DiscoveryService{}).
+		Watches(&source.Channel{Source: events}, r.DiscoveryServicesEventHandler()).
+		Complete(r)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	operatorv1alpha1 "github.com/3scale-ops/marin3r/apis/operator.marin3r/v1alpha1"
+	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	xdss_v3 "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/v3"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_calculateOrphanedSnapshotsCondition(t *testing.T) {
+	orphanedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		orphans []xdss.OrphanedSnapshot
+		want    metav1.Condition
+	}{
+		{
+			name:    "No orphaned snapshots",
+			orphans: []xdss.OrphanedSnapshot{},
+			want: metav1.Condition{
+				Type:    operatorv1alpha1.OrphanedSnapshotsCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  "NoOrphanedSnapshots",
+				Message: "There are no resources retained after the deletion of their EnvoyConfig",
+			},
+		},
+		{
+			name: "Orphaned snapshots",
+			orphans: []xdss.OrphanedSnapshot{
+				{NodeID: "node1", Version: "aaaa", OrphanedAt: orphanedAt, ExpiresAt: orphanedAt.Add(time.Hour)},
+				{NodeID: "node2", Version: "bbbb", OrphanedAt: orphanedAt},
+			},
+			want: metav1.Condition{
+				Type:   operatorv1alpha1.OrphanedSnapshotsCondition,
+				Status: metav1.ConditionTrue,
+				Reason: "EnvoyConfigsDeleted",
+				Message: "Serving the resources retained after the deletion of their EnvoyConfig for nodeIDs: " +
+					"node1 (version aaaa, expires at 2023-01-01T01:00:00Z), node2 (version bbbb, never expires)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(calculateOrphanedSnapshotsCondition(tt.orphans), tt.want); len(diff) > 0 {
+				t.Errorf("calculateOrphanedSnapshotsCondition() = %v", diff)
+			}
+		})
+	}
+}
+
+func TestOrphanedSnapshotsReconciler_Reconcile(t *testing.T) {
+	s := runtime.NewScheme()
+	if err := operatorv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	ds := &operatorv1alpha1.DiscoveryService{ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "default"}}
+	key := types.NamespacedName{Name: "ds", Namespace: "default"}
+
+	orphans := xdss.NewOrphanedSnapshots(xdss_v3.NewCache(), stats.New())
+	orphans.Add("node", "xxxx", 0)
+	r := &OrphanedSnapshotsReconciler{
+		Client:            fake.NewClientBuilder().WithScheme(s).WithObjects(ds).Build(),
+		Log:               ctrl.Log.WithName("test"),
+		Scheme:            s,
+		OrphanedSnapshots: orphans,
+	}
+
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("OrphanedSnapshotsReconciler.Reconcile() error = %v", err)
+	}
+	if err := r.Client.Get(context.TODO(), key, ds); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(ds.Status.Conditions, operatorv1alpha1.OrphanedSnapshotsCondition) {
+		t.Errorf("OrphanedSnapshotsReconciler.Reconcile() conditions = %v", ds.Status.Conditions)
+	}
+
+	orphans.Adopt("node")
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("OrphanedSnapshotsReconciler.Reconcile() error = %v", err)
+	}
+	if err := r.Client.Get(context.TODO(), key, ds); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionFalse(ds.Status.Conditions, operatorv1alpha1.OrphanedSnapshotsCondition) {
+		t.Errorf("OrphanedSnapshotsReconciler.Reconcile() conditions = %v", ds.Status.Conditions)
+	}
+}
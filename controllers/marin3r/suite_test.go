@@ -98,9 +98,10 @@ var _ = BeforeSuite(func() {
 
 	// Add the EnvoyConfig controller
 	err = (&EnvoyConfigReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("envoyconfig"),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("envoyconfig"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("envoyconfig"),
 	}).SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -112,6 +113,7 @@ var _ = BeforeSuite(func() {
 		XdsCache:       xdss_v3.NewCache(),
 		APIVersion:     envoy.APIv3,
 		DiscoveryStats: stats.New(),
+		Recorder:       mgr.GetEventRecorderFor("envoyconfigrevision_v3"),
 	}
 	err = ecrV3Reconciler.SetupWithManager(mgr)
 	Expect(err).ToNot(HaveOccurred())
@@ -28,6 +28,7 @@ import (
 	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	server_v3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -63,6 +64,7 @@ type XdsServer struct {
 	snapshotCacheV3  cache_v3.SnapshotCache
 	callbacksV3      *xdss_v3.Callbacks
 	discoveryStatsV3 *stats.Stats
+	orphanedV3       *xdss.OrphanedSnapshots
 }
 
 // NewXdsServer creates a new XdsServer object fron the given params
@@ -74,20 +76,27 @@ func NewXdsServer(ctx context.Context, xDSPort uint, tlsConfig *tls.Config, logg
 
 	// register the custom metrics collector with the global
 	// prometheus registry
-	metrics.Registry.MustRegister(discoveryStatsV3)
+	registerCollector(discoveryStatsV3)
 
-	snapshotCacheV3 := cache_v3.NewSnapshotCache(
-		true,
-		cache_v3.IDHash{},
+	// the routing cache serves a snapshot per Pod, so new versions
+	// can be progressively rolled out to the Envoy clients of a nodeID
+	snapshotCacheV3 := xdss_v3.NewRoutingCache(
 		clogger{Logger: xdsLogger.WithName("cache").WithName("v3")},
 	)
 
+	// responses to streams that NACK a config are delayed
+	// without blocking the processing of the stream
+	backoffV3 := xdss_v3.NewStreamBackoff()
+	registerCollector(backoffV3)
+
 	callbacksV3 := &xdss_v3.Callbacks{
-		Stats:  discoveryStatsV3,
-		Logger: xdsLogger.WithName("server").WithName("v3"),
+		Stats:   discoveryStatsV3,
+		Logger:  xdsLogger.WithName("server").WithName("v3"),
+		Backoff: backoffV3,
+		Routing: snapshotCacheV3,
 	}
 
-	srvV3 := server_v3.NewServer(ctx, snapshotCacheV3, callbacksV3)
+	srvV3 := server_v3.NewServer(ctx, xdss_v3.NewBackoffCache(snapshotCacheV3, backoffV3), callbacksV3)
 
 	return &XdsServer{
 		ctx:              ctx,
@@ -97,6 +106,21 @@ func NewXdsServer(ctx context.Context, xDSPort uint, tlsConfig *tls.Config, logg
 		snapshotCacheV3:  snapshotCacheV3,
 		callbacksV3:      callbacksV3,
 		discoveryStatsV3: discoveryStatsV3,
+		orphanedV3:       xdss.NewOrphanedSnapshots(xdss_v3.NewCacheFromSnapshotCache(snapshotCacheV3), discoveryStatsV3),
+	}
+}
+
+// registerCollector registers the collector with the global prometheus registry. The collector
+// registered by a previously created XdsServer, if any, is replaced, so the metrics always
+// come from the latest server and creating more than one doesn't panic.
+func registerCollector(c prometheus.Collector) {
+	if err := metrics.Registry.Register(c); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			panic(err)
+		}
+		metrics.Registry.Unregister(are.ExistingCollector)
+		metrics.Registry.MustRegister(c)
 	}
 }
 
@@ -129,7 +153,9 @@ func (xdss *XdsServer) Start(client kubernetes.Interface, namespace string) erro
 	// channel to receive errors from the gorutine running the server
 	errCh := make(chan error)
 
-	// register the ADS with the gRPC server
+	// register the ADS with the gRPC server. The ADS service holds both the state of the
+	// world (StreamAggregatedResources) and the incremental (DeltaAggregatedResources)
+	// handlers so envoy clients can use either the GRPC or the DELTA_GRPC api types.
 	envoy_service_discovery_v3.RegisterAggregatedDiscoveryServiceServer(grpcServer, xdss.serverV3)
 
 	// register a health check with the gRPC server
@@ -190,6 +216,12 @@ func (xdss *XdsServer) GetDiscoveryStats(version envoy.APIVersion) *stats.Stats
 	return xdss.discoveryStatsV3
 }
 
+// GetOrphanedSnapshots returns the snapshots that keep being
+// served after their EnvoyConfig has been deleted
+func (xdss *XdsServer) GetOrphanedSnapshots(version envoy.APIVersion) *xdss.OrphanedSnapshots {
+	return xdss.orphanedV3
+}
+
 type clogger struct {
 	Logger logr.Logger
 }
@@ -25,7 +25,6 @@ import (
 	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
 	xdss_v3 "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/v3"
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
-	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
 	server_v3 "github.com/envoyproxy/go-control-plane/pkg/server/v3"
 	"github.com/go-logr/logr"
 	"k8s.io/client-go/kubernetes/fake"
@@ -33,7 +32,7 @@ import (
 )
 
 var (
-	snapshotCacheV3 = cache_v3.NewSnapshotCache(true, cache_v3.IDHash{}, nil)
+	snapshotCacheV3 = xdss_v3.NewRoutingCache(nil)
 )
 
 func TestNewXdsServer(t *testing.T) {
@@ -52,6 +51,11 @@ func TestNewXdsServer(t *testing.T) {
 			"Returns a new XdsServer from the given params",
 			args{context.Background(), 10000, &tls.Config{}, ctrl.Log},
 		},
+		{
+			// the metrics collectors of the previous server are already registered
+			"Returns another XdsServer",
+			args{context.Background(), 10000, &tls.Config{}, ctrl.Log},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -76,6 +80,7 @@ func TestXdsServer_Start(t *testing.T) {
 			snapshotCacheV3,
 			&xdss_v3.Callbacks{Logger: ctrl.Log},
 			stats.New(),
+			nil,
 		}
 
 		go func() {
@@ -105,6 +110,7 @@ func TestXdsServer_GetCache(t *testing.T) {
 				snapshotCacheV3,
 				&xdss_v3.Callbacks{Logger: ctrl.Log},
 				stats.New(),
+				nil,
 			},
 			xdss_v3.NewCache(),
 			envoy.APIv3,
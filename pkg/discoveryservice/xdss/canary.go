@@ -0,0 +1,27 @@
+package discoveryservice
+
+import (
+	"hash/fnv"
+)
+
+// Canary is a snapshot that, during a progressive rollout, is only served
+// to a percentage of the Envoy clients of a nodeID
+type Canary struct {
+	// Version is the version of the EnvoyConfigRevision
+	// the snapshot has been generated from
+	Version string
+	// Percentage of the Envoy clients that are served the snapshot
+	Percentage int32
+	// Snapshot is the snapshot served to the selected Envoy clients
+	Snapshot Snapshot
+}
+
+// InCanary returns true if the Pod with the given name is selected to receive
+// the canary snapshot when it is served to the given percentage of the Envoy
+// clients. The selection is stable, so a Pod selected for a percentage is also
+// selected for any higher percentage.
+func InCanary(podName string, percentage int32) bool {
+	h := fnv.New32a()
+	h.Write([]byte(podName))
+	return int32(h.Sum32()%100) < percentage
+}
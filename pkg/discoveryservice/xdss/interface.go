@@ -19,6 +19,9 @@ type Cache interface {
 	GetSnapshot(string) (Snapshot, error)
 	ClearSnapshot(string)
 	NewSnapshot() Snapshot
+	SetCanary(context.Context, string, Canary) error
+	GetCanary(string) (*Canary, error)
+	ClearCanary(context.Context, string) error
 }
 
 // Snapshot is an internally consistent snapshot of xDS resources.
@@ -0,0 +1,131 @@
+package discoveryservice
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+)
+
+// OrphanedSnapshot is a snapshot that keeps being served after the
+// EnvoyConfig it was published from has been deleted
+type OrphanedSnapshot struct {
+	// NodeID is the nodeID the snapshot is served to
+	NodeID string
+	// Version is the version of the EnvoyConfigRevision
+	// the snapshot has been generated from
+	Version string
+	// OrphanedAt is the time the snapshot became orphaned
+	OrphanedAt time.Time
+	// ExpiresAt is the time the snapshot is cleared from
+	// the cache. The snapshot never expires if zero.
+	ExpiresAt time.Time
+}
+
+type orphanedSnapshot struct {
+	OrphanedSnapshot
+	timer *time.Timer
+}
+
+// OrphanedSnapshots keeps track of the snapshots of a Cache that have been
+// orphaned and clears them, along with the stats of their nodeID, once
+// their TTL expires
+type OrphanedSnapshots struct {
+	cache  Cache
+	stats  *stats.Stats
+	notify []func()
+
+	mu      sync.Mutex
+	orphans map[string]*orphanedSnapshot
+}
+
+// NewOrphanedSnapshots returns a new OrphanedSnapshots for the given cache
+func NewOrphanedSnapshots(cache Cache, discoveryStats *stats.Stats) *OrphanedSnapshots {
+	return &OrphanedSnapshots{
+		cache:   cache,
+		stats:   discoveryStats,
+		orphans: map[string]*orphanedSnapshot{},
+	}
+}
+
+// Add starts tracking the snapshot of the nodeID as orphaned. The snapshot
+// is cleared from the cache once the ttl elapses, unless the ttl is zero.
+func (o *OrphanedSnapshots) Add(nodeID, version string, ttl time.Duration) {
+	o.mu.Lock()
+	if prev, ok := o.orphans[nodeID]; ok && prev.timer != nil {
+		prev.timer.Stop()
+	}
+
+	orphan := &orphanedSnapshot{OrphanedSnapshot: OrphanedSnapshot{NodeID: nodeID, Version: version, OrphanedAt: time.Now()}}
+	if ttl > 0 {
+		orphan.ExpiresAt = orphan.OrphanedAt.Add(ttl)
+		orphan.timer = time.AfterFunc(ttl, func() { o.expire(orphan) })
+	}
+	o.orphans[nodeID] = orphan
+	o.mu.Unlock()
+
+	o.changed()
+}
+
+// Adopt stops tracking the snapshot of the nodeID as orphaned, as the nodeID
+// is again managed by an EnvoyConfig. It returns true if the snapshot was orphaned.
+func (o *OrphanedSnapshots) Adopt(nodeID string) bool {
+	o.mu.Lock()
+	orphan, ok := o.orphans[nodeID]
+	if ok {
+		if orphan.timer != nil {
+			orphan.timer.Stop()
+		}
+		delete(o.orphans, nodeID)
+	}
+	o.mu.Unlock()
+
+	if ok {
+		o.changed()
+	}
+	return ok
+}
+
+// List returns the orphaned snapshots, sorted by nodeID
+func (o *OrphanedSnapshots) List() []OrphanedSnapshot {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	list := make([]OrphanedSnapshot, 0, len(o.orphans))
+	for _, orphan := range o.orphans {
+		list = append(list, orphan.OrphanedSnapshot)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NodeID < list[j].NodeID })
+	return list
+}
+
+// Notify registers a function that is called each
+// time a snapshot is orphaned, adopted or expires
+func (o *OrphanedSnapshots) Notify(f func()) {
+	o.notify = append(o.notify, f)
+}
+
+// expire clears the snapshot from the cache, unless it has been
+// adopted or orphaned again since the timer was started
+func (o *OrphanedSnapshots) expire(orphan *orphanedSnapshot) {
+	o.mu.Lock()
+	if o.orphans[orphan.NodeID] != orphan {
+		o.mu.Unlock()
+		return
+	}
+	delete(o.orphans, orphan.NodeID)
+	o.cache.ClearSnapshot(orphan.NodeID)
+	if o.stats != nil {
+		o.stats.DeleteKeysByFilter(orphan.NodeID)
+	}
+	o.mu.Unlock()
+
+	o.changed()
+}
+
+func (o *OrphanedSnapshots) changed() {
+	for _, f := range o.notify {
+		f()
+	}
+}
@@ -0,0 +1,83 @@
+package discoveryservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+)
+
+// testCache records the nodeIDs whose snapshot is cleared
+type testCache struct {
+	Cache
+	cleared chan string
+}
+
+func (c testCache) ClearSnapshot(nodeID string) { c.cleared <- nodeID }
+
+func TestOrphanedSnapshots(t *testing.T) {
+
+	t.Run("Tracks orphaned snapshots until they are adopted", func(t *testing.T) {
+		cache := testCache{cleared: make(chan string, 1)}
+		o := NewOrphanedSnapshots(cache, stats.New())
+		notifications := 0
+		o.Notify(func() { notifications++ })
+
+		o.Add("node2", "bbbb", 0)
+		o.Add("node1", "aaaa", time.Hour)
+
+		list := o.List()
+		if len(list) != 2 || list[0].NodeID != "node1" || list[0].Version != "aaaa" || list[0].ExpiresAt.IsZero() ||
+			list[1].NodeID != "node2" || !list[1].ExpiresAt.IsZero() {
+			t.Errorf("OrphanedSnapshots.List() = %v", list)
+		}
+
+		if !o.Adopt("node1") || o.Adopt("node1") {
+			t.Errorf("OrphanedSnapshots.Adopt() did not adopt the snapshot only once")
+		}
+		if list := o.List(); len(list) != 1 || list[0].NodeID != "node2" {
+			t.Errorf("OrphanedSnapshots.List() = %v", list)
+		}
+		if notifications != 3 {
+			t.Errorf("OrphanedSnapshots notified %v changes, want 3", notifications)
+		}
+		select {
+		case nodeID := <-cache.cleared:
+			t.Errorf("OrphanedSnapshots cleared the snapshot of %s", nodeID)
+		default:
+		}
+	})
+
+	t.Run("Clears the snapshot once the TTL expires", func(t *testing.T) {
+		cache := testCache{cleared: make(chan string, 1)}
+		o := NewOrphanedSnapshots(cache, stats.New())
+
+		o.Add("node", "aaaa", 10*time.Millisecond)
+
+		select {
+		case nodeID := <-cache.cleared:
+			if nodeID != "node" {
+				t.Errorf("OrphanedSnapshots cleared the snapshot of %s, want node", nodeID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("OrphanedSnapshots did not clear the snapshot")
+		}
+		if list := o.List(); len(list) != 0 {
+			t.Errorf("OrphanedSnapshots.List() = %v, want empty", list)
+		}
+	})
+
+	t.Run("Does not clear adopted snapshots", func(t *testing.T) {
+		cache := testCache{cleared: make(chan string, 1)}
+		o := NewOrphanedSnapshots(cache, stats.New())
+
+		o.Add("node", "aaaa", 10*time.Millisecond)
+		o.Adopt("node")
+
+		select {
+		case <-cache.cleared:
+			t.Errorf("OrphanedSnapshots cleared an adopted snapshot")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
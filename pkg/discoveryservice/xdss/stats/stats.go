@@ -35,22 +35,17 @@ func (s *Stats) WriteResponseNonce(nodeID, rType, version, podID, nonce string)
 	s.SetStringWithExpiration(nodeID, rType, version, podID, "nonce:"+nonce, "", 10*time.Second)
 }
 
-func (s *Stats) ReportNACK(nodeID, rType, podID, nonce string) (int64, error) {
-	keys := s.FilterKeys(nodeID, rType, podID, "nonce:"+nonce)
-	if len(keys) != 1 {
-		return 0, fmt.Errorf("error reporting failure: unexpected number of nonces in the cache")
+// ReportNACK increments the NACK counters for the version of the response that was
+// sent with the given nonce and stores the error detail reported by the client
+func (s *Stats) ReportNACK(nodeID, rType, podID, nonce, message string) (int64, error) {
+	version, err := s.getVersionFromNonce(nodeID, rType, podID, nonce)
+	if err != nil {
+		return 0, fmt.Errorf("error reporting failure: %w", err)
 	}
 
-	// The value of version is contained in the key of the corresponding nonce stored
-	// in the cache
-	version := NewKeyFromString(func() string {
-		for k := range keys {
-			return k
-		}
-		return ""
-	}()).Version
-
 	s.IncrementCounter(nodeID, rType, version, podID, "nack_counter", 1)
+	s.SetString(nodeID, rType, version, podID, "last_nack", message)
+	s.recordNACKTime(nodeID, rType, version, podID)
 	// aggregated counter, with lower cardinality, to expose as prometheus metric
 	s.IncrementCounter(nodeID, rType, "*", podID, "nack_counter", 1)
 	return s.GetCounter(nodeID, rType, version, podID, "nack_counter")
@@ -64,10 +59,44 @@ func (s *Stats) ReportACK(nodeID, rType, version, podID string) {
 	s.SetInt64(nodeID, rType, version, podID, "info", s.clock.Now().UnixMilli())
 }
 
+// ReportDeltaACK reports an ACK received in an incremental xDS stream. Delta requests
+// don't carry the version being acknowledged, so it is looked up using the nonce
+// of the response the ACK refers to.
+func (s *Stats) ReportDeltaACK(nodeID, rType, podID, nonce string) error {
+	version, err := s.getVersionFromNonce(nodeID, rType, podID, nonce)
+	if err != nil {
+		return fmt.Errorf("error reporting delta ACK: %w", err)
+	}
+
+	s.ReportACK(nodeID, rType, version, podID)
+	return nil
+}
+
 func (s *Stats) ReportRequest(nodeID, rType, podID string) {
 	s.IncrementCounter(nodeID, rType, "*", podID, "request_counter", 1)
 }
 
+// getVersionFromNonce returns the version of the response that was sent
+// with the given nonce
+func (s *Stats) getVersionFromNonce(nodeID, rType, podID, nonce string) (string, error) {
+	versions := []string{}
+	for k := range s.FilterKeys(nodeID, rType, podID, "nonce:"+nonce) {
+		key := NewKeyFromString(k)
+		// FilterKeys matches substrings, so nonce "1" would also
+		// match nonce "10"
+		if key.StatName == "nonce:"+nonce {
+			// The value of version is contained in the key of the corresponding nonce stored
+			// in the cache
+			versions = append(versions, key.Version)
+		}
+	}
+
+	if len(versions) != 1 {
+		return "", fmt.Errorf("unexpected number of nonces in the cache")
+	}
+	return versions[0], nil
+}
+
 func GetStringValueFromMetadata(meta map[string]interface{}, key string) (string, error) {
 
 	v, ok := meta[key]
@@ -103,12 +132,134 @@ func (s *Stats) GetSubscribedPods(nodeID, rType string) map[string]int8 {
 	return m
 }
 
-func (s *Stats) GetPercentageFailing(nodeID, rType, version string) float64 {
+// GetLastNACKs returns, for each pod, the error detail of the latest NACK
+// received for the given nodeID, resource type and version
+func (s *Stats) GetLastNACKs(nodeID, rType, version string) map[string]string {
+
+	m := map[string]string{}
+	for k, v := range s.FilterKeys(nodeID, rType, version, "last_nack") {
+		key := NewKeyFromString(k)
+		// FilterKeys matches substrings, so check the key exactly matches
+		if key.NodeID != nodeID || key.ResourceType != rType || key.Version != version || key.StatName != "last_nack" {
+			continue
+		}
+		if msg, ok := v.Object.(string); ok {
+			m[key.PodID] = msg
+		}
+	}
+
+	return m
+}
+
+// GetAckedVersions returns, for each pod, the latest version of the given
+// nodeID and resource type that the pod has acknowledged
+func (s *Stats) GetAckedVersions(nodeID, rType string) map[string]string {
+
+	type acked struct {
+		version string
+		ts      int64
+	}
+	latest := map[string]acked{}
+	for k, v := range s.FilterKeys(nodeID, rType, "info") {
+		key := NewKeyFromString(k)
+		// FilterKeys matches substrings, so check the key exactly matches
+		if key.NodeID != nodeID || key.ResourceType != rType || key.StatName != "info" {
+			continue
+		}
+		if ts, ok := v.Object.(int64); ok {
+			if a, ok := latest[key.PodID]; !ok || ts > a.ts {
+				latest[key.PodID] = acked{version: key.Version, ts: ts}
+			}
+		}
+	}
+
+	m := map[string]string{}
+	for pod, a := range latest {
+		m[pod] = a.version
+	}
+	return m
+}
+
+// FailureThreshold determines when an Envoy client is considered
+// to be failing to apply a given version of a resource type
+type FailureThreshold struct {
+	// NACKs is the number of NACKs after which the client is considered to be failing
+	NACKs int64
+	// Window, if not zero, limits the NACKs taken into account to the ones
+	// received within this period of time
+	Window time.Duration
+}
+
+// DefaultFailureThreshold considers a client to be failing after 5 NACKs
+var DefaultFailureThreshold = FailureThreshold{NACKs: 5}
+
+// maxNACKTimes is the maximum number of NACK timestamps kept per
+// client, which limits the number of NACKs a FailureThreshold can use
+const maxNACKTimes int = 100
+
+// recordNACKTime keeps track of the time at which the latest NACKs were received, so
+// they can be evaluated within a window of time
+func (s *Stats) recordNACKTime(nodeID, rType, version, podID string) {
+	key := NewKey(nodeID, rType, version, podID, "nack_times").String()
+	times := []time.Time{}
+	if v, ok := s.store.Get(key); ok {
+		times = v.([]time.Time)
+	}
+	times = append(times, s.clock.Now())
+	if len(times) > maxNACKTimes {
+		times = times[len(times)-maxNACKTimes:]
+	}
+	s.store.SetDefault(key, times)
+}
+
+// GetLastNACKTime returns the time of the latest NACK received from the pod for the given
+// nodeID, resource type and version, or the zero time if none has been received
+func (s *Stats) GetLastNACKTime(nodeID, rType, version, podID string) time.Time {
+	v, ok := s.store.Get(NewKey(nodeID, rType, version, podID, "nack_times").String())
+	if !ok {
+		return time.Time{}
+	}
+	times := v.([]time.Time)
+	if len(times) == 0 {
+		return time.Time{}
+	}
+	return times[len(times)-1]
+}
+
+// IsPodFailing returns true if the given pod is failing to apply the given
+// nodeID, resource type and version, according to the given threshold
+func (s *Stats) IsPodFailing(nodeID, rType, version, podID string, threshold FailureThreshold) bool {
+
+	if threshold.Window == 0 {
+		v, err := s.GetCounter(nodeID, rType, version, podID, "nack_counter")
+		return err == nil && v >= threshold.NACKs
+	}
+
+	v, ok := s.store.Get(NewKey(nodeID, rType, version, podID, "nack_times").String())
+	if !ok {
+		return false
+	}
+	since := s.clock.Now().Add(-threshold.Window)
+	count := int64(0)
+	for _, t := range v.([]time.Time) {
+		if t.After(since) {
+			count++
+		}
+	}
+	return count >= threshold.NACKs
+}
+
+func (s *Stats) GetPercentageFailing(nodeID, rType, version string, threshold FailureThreshold) float64 {
+	return s.GetPercentageFailingForPods(nodeID, rType, version, s.GetSubscribedPods(nodeID, rType), threshold)
+}
+
+// GetPercentageFailingForPods returns the percentage of the given pods that
+// are failing to apply the given nodeID, resource type and version
+func (s *Stats) GetPercentageFailingForPods(nodeID, rType, version string, pods map[string]int8, threshold FailureThreshold) float64 {
 
 	failing := 0
-	pods := s.GetSubscribedPods(nodeID, rType)
 	for pod := range pods {
-		if v, err := s.GetCounter(nodeID, rType, version, pod, "nack_counter"); err == nil && v >= 5 {
+		if s.IsPodFailing(nodeID, rType, version, pod, threshold) {
 			failing++
 		}
 	}
@@ -119,3 +270,19 @@ func (s *Stats) GetPercentageFailing(nodeID, rType, version string) float64 {
 	}
 	return val
 }
+
+// ClearNACKs removes the NACK counters and the error details received for the given
+// nodeID, resource type and version, so previous failures are no longer taken into account
+func (s *Stats) ClearNACKs(nodeID, rType, version string) {
+
+	for k := range s.FilterKeys(nodeID, rType, version) {
+		key := NewKeyFromString(k)
+		// FilterKeys matches substrings, so check the key exactly matches
+		if key.NodeID != nodeID || key.ResourceType != rType || key.Version != version {
+			continue
+		}
+		if key.StatName == "nack_counter" || key.StatName == "last_nack" || key.StatName == "nack_times" {
+			s.store.Delete(k)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package stats
 
 import (
 	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -47,11 +48,13 @@ func TestStats_WriteResponseNonce(t *testing.T) {
 }
 
 func TestStats_ReportNACK(t *testing.T) {
+	now := time.Now()
 	type args struct {
-		nodeID string
-		rType  string
-		podID  string
-		nonce  string
+		nodeID  string
+		rType   string
+		podID   string
+		nonce   string
+		message string
 	}
 	tests := []struct {
 		name       string
@@ -66,17 +69,21 @@ func TestStats_ReportNACK(t *testing.T) {
 				"node:endpoint:aaaa:pod-xxxx:nonce:7":      {Object: "", Expiration: int64(defaultExpiration)},
 				"node:endpoint:aaaa:pod-xxxx:nack_counter": {Object: int64(5), Expiration: int64(defaultExpiration)},
 				"node:endpoint:*:pod-xxxx:nack_counter":    {Object: int64(5), Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:nack_times":   {Object: []time.Time{now.Add(-time.Minute)}, Expiration: int64(defaultExpiration)},
 			},
 			args: args{
-				nodeID: "node",
-				rType:  "endpoint",
-				podID:  "pod-xxxx",
-				nonce:  "7",
+				nodeID:  "node",
+				rType:   "endpoint",
+				podID:   "pod-xxxx",
+				nonce:   "7",
+				message: "error",
 			},
 			want: map[string]kv.Item{
 				"node:endpoint:aaaa:pod-xxxx:nonce:7":      {Object: "", Expiration: int64(defaultExpiration)},
 				"node:endpoint:aaaa:pod-xxxx:nack_counter": {Object: int64(6), Expiration: int64(defaultExpiration)},
 				"node:endpoint:*:pod-xxxx:nack_counter":    {Object: int64(6), Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:last_nack":    {Object: "error", Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:nack_times":   {Object: []time.Time{now.Add(-time.Minute), now}, Expiration: int64(defaultExpiration)},
 			},
 		},
 		{
@@ -85,22 +92,25 @@ func TestStats_ReportNACK(t *testing.T) {
 				"node:endpoint:aaaa:pod-xxxx:nonce:xyz": {Object: "", Expiration: int64(defaultExpiration)},
 			},
 			args: args{
-				nodeID: "node",
-				rType:  "endpoint",
-				podID:  "pod-xxxx",
-				nonce:  "xyz",
+				nodeID:  "node",
+				rType:   "endpoint",
+				podID:   "pod-xxxx",
+				nonce:   "xyz",
+				message: "error",
 			},
 			want: map[string]kv.Item{
 				"node:endpoint:aaaa:pod-xxxx:nonce:xyz":    {Object: "", Expiration: int64(defaultExpiration)},
 				"node:endpoint:aaaa:pod-xxxx:nack_counter": {Object: int64(1), Expiration: int64(defaultExpiration)},
 				"node:endpoint:*:pod-xxxx:nack_counter":    {Object: int64(1), Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:last_nack":    {Object: "error", Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:nack_times":   {Object: []time.Time{now}, Expiration: int64(defaultExpiration)},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, tt.cacheItems)}
-			_, err := s.ReportNACK(tt.args.nodeID, tt.args.rType, tt.args.podID, tt.args.nonce)
+			s := NewWithItems(tt.cacheItems, now)
+			_, err := s.ReportNACK(tt.args.nodeID, tt.args.rType, tt.args.podID, tt.args.nonce, tt.args.message)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Stats.ReportNACK() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -176,6 +186,72 @@ func TestStats_ReportACK(t *testing.T) {
 	}
 }
 
+func TestStats_ReportDeltaACK(t *testing.T) {
+	type args struct {
+		nodeID string
+		rType  string
+		podID  string
+		nonce  string
+	}
+	tests := []struct {
+		name       string
+		cacheItems map[string]kv.Item
+		t          time.Time
+		args       args
+		want       map[string]kv.Item
+		wantErr    bool
+	}{
+		{
+			name: "Reports an ACK for the version of the nonce",
+			cacheItems: map[string]kv.Item{
+				"node:endpoint:aaaa:pod-xxxx:nonce:1":  {Object: "", Expiration: int64(defaultExpiration)},
+				"node:endpoint:bbbb:pod-xxxx:nonce:10": {Object: "", Expiration: int64(defaultExpiration)},
+			},
+			t: time.UnixMilli(100),
+			args: args{
+				nodeID: "node",
+				rType:  "endpoint",
+				podID:  "pod-xxxx",
+				nonce:  "1",
+			},
+			want: map[string]kv.Item{
+				"node:endpoint:aaaa:pod-xxxx:nonce:1":     {Object: "", Expiration: int64(defaultExpiration)},
+				"node:endpoint:bbbb:pod-xxxx:nonce:10":    {Object: "", Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:ack_counter": {Object: int64(1), Expiration: int64(defaultExpiration)},
+				"node:endpoint:*:pod-xxxx:ack_counter":    {Object: int64(1), Expiration: int64(defaultExpiration)},
+				"node:endpoint:aaaa:pod-xxxx:info":        {Object: int64(100), Expiration: int64(defaultExpiration)},
+			},
+			wantErr: false,
+		},
+		{
+			name:       "Returns an error if the nonce is unknown",
+			cacheItems: map[string]kv.Item{},
+			t:          time.UnixMilli(100),
+			args: args{
+				nodeID: "node",
+				rType:  "endpoint",
+				podID:  "pod-xxxx",
+				nonce:  "1",
+			},
+			want:    map[string]kv.Item{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWithItems(tt.cacheItems, tt.t)
+			err := s.ReportDeltaACK(tt.args.nodeID, tt.args.rType, tt.args.podID, tt.args.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stats.ReportDeltaACK() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := s.store.Items(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stats.ReportDeltaACK() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestStats_ReportRequest(t *testing.T) {
 	type args struct {
 		nodeID string
@@ -411,9 +487,186 @@ func TestStats_GetPercentageFailing(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, tt.cacheItems)}
-			if got := s.GetPercentageFailing(tt.args.nodeID, tt.args.rType, tt.args.version); got != tt.want {
+			if got := s.GetPercentageFailing(tt.args.nodeID, tt.args.rType, tt.args.version, DefaultFailureThreshold); got != tt.want {
 				t.Errorf("Stats.GetPercentageFailing() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestStats_GetPercentageFailingForPods(t *testing.T) {
+	cacheItems := map[string]kv.Item{
+		"node:endpoint:*:pod-aaaa:request_counter": {Object: int64(2), Expiration: int64(defaultExpiration)},
+		"node:endpoint:*:pod-bbbb:request_counter": {Object: int64(5), Expiration: int64(defaultExpiration)},
+		"node:endpoint:*:pod-cccc:request_counter": {Object: int64(1), Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-aaaa:nack_counter": {Object: int64(5), Expiration: int64(defaultExpiration)},
+	}
+	tests := []struct {
+		name string
+		pods map[string]int8
+		want float64
+	}{
+		{
+			name: "Returns 100% of the given pods",
+			pods: map[string]int8{"pod-aaaa": 1},
+			want: 1,
+		},
+		{
+			name: "Returns 50% of the given pods",
+			pods: map[string]int8{"pod-aaaa": 1, "pod-bbbb": 1},
+			want: 0.5,
+		},
+		{
+			name: "Returns 0% if no pods given",
+			pods: map[string]int8{},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, cacheItems)}
+			if got := s.GetPercentageFailingForPods("node", "endpoint", "xxxx", tt.pods, DefaultFailureThreshold); got != tt.want {
+				t.Errorf("Stats.GetPercentageFailingForPods() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats_IsPodFailing(t *testing.T) {
+	now := time.Now()
+	cacheItems := map[string]kv.Item{
+		"node:endpoint:xxxx:pod-aaaa:nack_counter": {Object: int64(3), Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-aaaa:nack_times": {
+			Object:     []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(-time.Second)},
+			Expiration: int64(defaultExpiration),
+		},
+	}
+	tests := []struct {
+		name      string
+		threshold FailureThreshold
+		want      bool
+	}{
+		{
+			name:      "Failing, without window",
+			threshold: FailureThreshold{NACKs: 3},
+			want:      true,
+		},
+		{
+			name:      "Not failing, without window",
+			threshold: FailureThreshold{NACKs: 5},
+			want:      false,
+		},
+		{
+			name:      "Failing, within the window",
+			threshold: FailureThreshold{NACKs: 2, Window: 5 * time.Minute},
+			want:      true,
+		},
+		{
+			name:      "Not failing, NACKs out of the window",
+			threshold: FailureThreshold{NACKs: 2, Window: 30 * time.Second},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWithItems(cacheItems, now)
+			if got := s.IsPodFailing("node", "endpoint", "xxxx", "pod-aaaa", tt.threshold); got != tt.want {
+				t.Errorf("Stats.IsPodFailing() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats_GetLastNACKs(t *testing.T) {
+	type args struct {
+		nodeID  string
+		rType   string
+		version string
+	}
+	tests := []struct {
+		name       string
+		cacheItems map[string]kv.Item
+		args       args
+		want       map[string]string
+	}{
+		{
+			name: "Returns the last NACK of each pod",
+			cacheItems: map[string]kv.Item{
+				"node:endpoint:xxxx:pod-aaaa:last_nack":    {Object: "error a", Expiration: int64(defaultExpiration)},
+				"node:endpoint:xxxx:pod-bbbb:last_nack":    {Object: "error b", Expiration: int64(defaultExpiration)},
+				"node:endpoint:xxxx:pod-bbbb:nack_counter": {Object: int64(10), Expiration: int64(defaultExpiration)},
+				"node:endpoint:yyyy:pod-cccc:last_nack":    {Object: "error c", Expiration: int64(defaultExpiration)},
+				"node:cluster:xxxx:pod-dddd:last_nack":     {Object: "error d", Expiration: int64(defaultExpiration)},
+			},
+			args: args{
+				nodeID:  "node",
+				rType:   "endpoint",
+				version: "xxxx",
+			},
+			want: map[string]string{"pod-aaaa": "error a", "pod-bbbb": "error b"},
+		},
+		{
+			name: "Returns an empty map",
+			cacheItems: map[string]kv.Item{
+				"node:endpoint:xxxx:pod-bbbb:nack_counter": {Object: int64(10), Expiration: int64(defaultExpiration)},
+			},
+			args: args{
+				nodeID:  "node",
+				rType:   "endpoint",
+				version: "xxxx",
+			},
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, tt.cacheItems)}
+			if got := s.GetLastNACKs(tt.args.nodeID, tt.args.rType, tt.args.version); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stats.GetLastNACKs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats_GetAckedVersions(t *testing.T) {
+	s := &Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, map[string]kv.Item{
+		"node:endpoint:xxxx:pod-aaaa:info":        {Object: int64(100), Expiration: int64(defaultExpiration)},
+		"node:endpoint:yyyy:pod-aaaa:info":        {Object: int64(200), Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-bbbb:info":        {Object: int64(300), Expiration: int64(defaultExpiration)},
+		"node:endpoint:yyyy:pod-bbbb:info":        {Object: int64(200), Expiration: int64(defaultExpiration)},
+		"node:endpoint:zzzz:pod-cccc:ack_counter": {Object: int64(1), Expiration: int64(defaultExpiration)},
+		"node:cluster:zzzz:pod-dddd:info":         {Object: int64(100), Expiration: int64(defaultExpiration)},
+	})}
+
+	want := map[string]string{"pod-aaaa": "yyyy", "pod-bbbb": "xxxx"}
+	if got := s.GetAckedVersions("node", "endpoint"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats.GetAckedVersions() = %v, want %v", got, want)
+	}
+}
+
+func TestStats_ClearNACKs(t *testing.T) {
+	s := &Stats{store: kv.NewFrom(defaultExpiration, cleanupInterval, map[string]kv.Item{
+		"node:endpoint:xxxx:pod-aaaa:last_nack":    {Object: "error a", Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-aaaa:nack_counter": {Object: int64(10), Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-aaaa:ack_counter":  {Object: int64(1), Expiration: int64(defaultExpiration)},
+		"node:endpoint:xxxx:pod-bbbb:nack_counter": {Object: int64(10), Expiration: int64(defaultExpiration)},
+		"node:endpoint:yyyy:pod-aaaa:nack_counter": {Object: int64(10), Expiration: int64(defaultExpiration)},
+		"node:cluster:xxxx:pod-aaaa:nack_counter":  {Object: int64(10), Expiration: int64(defaultExpiration)},
+	})}
+
+	s.ClearNACKs("node", "endpoint", "xxxx")
+
+	want := []string{
+		"node:cluster:xxxx:pod-aaaa:nack_counter",
+		"node:endpoint:xxxx:pod-aaaa:ack_counter",
+		"node:endpoint:yyyy:pod-aaaa:nack_counter",
+	}
+	got := []string{}
+	for k := range s.DumpAll() {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats.ClearNACKs() kept keys = %v, want %v", got, want)
+	}
+}
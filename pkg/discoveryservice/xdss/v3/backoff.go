@@ -0,0 +1,237 @@
+package discoveryservice
+
+import (
+	"sync"
+	"time"
+
+	"github.com/3scale-ops/marin3r/pkg/util/clock"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	stream_v3 "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ensure StreamBackoff implements the prometheus Collector interface
+var _ prometheus.Collector = &StreamBackoff{}
+
+var streamsInBackoffDesc = prometheus.NewDesc(
+	"marin3r_xdss_streams_in_backoff",
+	"Number of xDS streams and resource types whose responses are currently being delayed after a NACK",
+	[]string{}, nil,
+)
+
+// streamKey identifies a resource type within an xDS stream. State of the world and
+// incremental streams are numbered independently so the stream ID is not enough to
+// identify a stream. The type URL is part of the key as ADS streams carry several
+// resource types, and a NACK of one of them must not delay the others.
+type streamKey struct {
+	id      int64
+	delta   bool
+	typeURL string
+}
+
+// StreamBackoff keeps track of the resource types of the xDS streams that need to wait
+// before receiving a new response because the Envoy client rejected the previous one.
+// Responses to streams in backoff are delayed without blocking the goroutine that
+// processes the requests of the stream.
+type StreamBackoff struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	// newTimer starts the timers that delay the responses
+	newTimer timerFunc
+	// streams holds the time until which each stream and type is in backoff
+	streams map[streamKey]time.Time
+	// requests holds the last request received in each stream for each type, so the
+	// watches created for it can be matched with the stream they belong to
+	requests map[interface{}]streamKey
+	last     map[streamKey]interface{}
+}
+
+// NewStreamBackoff returns a new StreamBackoff
+func NewStreamBackoff() *StreamBackoff {
+	return &StreamBackoff{
+		clock:    clock.Real{},
+		newTimer: realTimer,
+		streams:  map[streamKey]time.Time{},
+		requests: map[interface{}]streamKey{},
+		last:     map[streamKey]interface{}{},
+	}
+}
+
+// trackRequest associates a request with the stream it was received in. Only
+// the last request of each stream and type is tracked.
+func (sb *StreamBackoff) trackRequest(key streamKey, req interface{}) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if prev, ok := sb.last[key]; ok {
+		delete(sb.requests, prev)
+	}
+	sb.requests[req] = key
+	sb.last[key] = req
+}
+
+// backoff puts the type of the stream in backoff for the given duration
+func (sb *StreamBackoff) backoff(key streamKey, d time.Duration) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.streams[key] = sb.clock.Now().Add(d)
+}
+
+// reset removes the backoff of the type of the stream
+func (sb *StreamBackoff) reset(key streamKey) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	delete(sb.streams, key)
+}
+
+// remove forgets all the state kept for the stream, for all the types
+func (sb *StreamBackoff) remove(id int64, delta bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	for key := range sb.streams {
+		if key.id == id && key.delta == delta {
+			delete(sb.streams, key)
+		}
+	}
+	for key, req := range sb.last {
+		if key.id == id && key.delta == delta {
+			delete(sb.requests, req)
+			delete(sb.last, key)
+		}
+	}
+}
+
+// delayFor returns how long the response to the given request needs
+// to be delayed. Zero is returned if the stream is not in backoff.
+func (sb *StreamBackoff) delayFor(req interface{}) time.Duration {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	key, ok := sb.requests[req]
+	if !ok {
+		return 0
+	}
+	until, ok := sb.streams[key]
+	if !ok {
+		return 0
+	}
+	if d := until.Sub(sb.clock.Now()); d > 0 {
+		return d
+	}
+	// backoff has expired
+	delete(sb.streams, key)
+	return 0
+}
+
+// InBackoff returns the number of streams and types currently in backoff
+func (sb *StreamBackoff) InBackoff() int {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	count := 0
+	now := sb.clock.Now()
+	for _, until := range sb.streams {
+		if until.After(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// Describe implements prometheus.Collector
+func (sb *StreamBackoff) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(sb, ch)
+}
+
+// Collect implements prometheus.Collector
+func (sb *StreamBackoff) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(streamsInBackoffDesc, prometheus.GaugeValue, float64(sb.InBackoff()))
+}
+
+// timerFunc starts a timer that fires after the given duration, returning the channel
+// the time is delivered to when it fires and a function to stop it
+type timerFunc func(d time.Duration) (<-chan time.Time, func() bool)
+
+// realTimer is a timerFunc backed by a time.Timer
+func realTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// BackoffCache wraps a go-control-plane cache so the responses
+// to streams in backoff are delayed until the backoff expires
+type BackoffCache struct {
+	cache_v3.Cache
+	backoff *StreamBackoff
+}
+
+var _ cache_v3.Cache = &BackoffCache{}
+
+// NewBackoffCache returns a BackoffCache that wraps the given cache
+func NewBackoffCache(cache cache_v3.Cache, backoff *StreamBackoff) *BackoffCache {
+	return &BackoffCache{Cache: cache, backoff: backoff}
+}
+
+// CreateWatch implements go-control-plane/pkg/cache/v3.ConfigWatcher.CreateWatch
+func (c *BackoffCache) CreateWatch(req *cache_v3.Request, state stream_v3.StreamState, out chan cache_v3.Response) func() {
+	d := c.backoff.delayFor(req)
+	if d <= 0 {
+		return c.Cache.CreateWatch(req, state, out)
+	}
+
+	in := make(chan cache_v3.Response, 1)
+	fire, stop := c.backoff.newTimer(d)
+	return delayedWatch(fire, stop, c.Cache.CreateWatch(req, state, in), in, out)
+}
+
+// CreateDeltaWatch implements go-control-plane/pkg/cache/v3.ConfigWatcher.CreateDeltaWatch
+func (c *BackoffCache) CreateDeltaWatch(req *cache_v3.DeltaRequest, state stream_v3.StreamState, out chan cache_v3.DeltaResponse) func() {
+	d := c.backoff.delayFor(req)
+	if d <= 0 {
+		return c.Cache.CreateDeltaWatch(req, state, out)
+	}
+
+	in := make(chan cache_v3.DeltaResponse, 1)
+	fire, stop := c.backoff.newTimer(d)
+	return delayedWatch(fire, stop, c.Cache.CreateDeltaWatch(req, state, in), in, out)
+}
+
+// delayedWatch forwards the response of a watch once the timer fires. The returned
+// cancel function stops the forwarding and cancels the underlying watch.
+func delayedWatch[T any](fire <-chan time.Time, stop func() bool, cancel func(), in <-chan T, out chan<- T) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer stop()
+
+		select {
+		case <-fire:
+		case <-done:
+			return
+		}
+
+		// the watch might have been cancelled at the same time the timer fired
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		select {
+		case rsp := <-in:
+			out <- rsp
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			if cancel != nil {
+				cancel()
+			}
+		})
+	}
+}
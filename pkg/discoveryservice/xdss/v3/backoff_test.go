@@ -0,0 +1,351 @@
+package discoveryservice
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	"github.com/3scale-ops/marin3r/pkg/util/clock"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	stream_v3 "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// testCache is a cache that always responds immediately to watches
+type testCache struct {
+	cache_v3.Cache
+}
+
+func (testCache) CreateWatch(req *cache_v3.Request, _ stream_v3.StreamState, out chan cache_v3.Response) func() {
+	out <- &cache_v3.RawResponse{Request: req, Version: "1"}
+	return nil
+}
+
+func (testCache) CreateDeltaWatch(req *cache_v3.DeltaRequest, _ stream_v3.StreamState, out chan cache_v3.DeltaResponse) func() {
+	out <- &cache_v3.RawDeltaResponse{DeltaRequest: req, SystemVersionInfo: "1"}
+	return nil
+}
+
+func TestStreamBackoff_delayFor(t *testing.T) {
+	now := time.Now()
+	req := &envoy_service_discovery_v3.DiscoveryRequest{}
+
+	tests := []struct {
+		name  string
+		setup func(*StreamBackoff)
+		req   interface{}
+		want  time.Duration
+	}{
+		{
+			name: "Stream in backoff",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1}, req)
+				sb.backoff(streamKey{id: 1}, time.Second)
+			},
+			req:  req,
+			want: time.Second,
+		},
+		{
+			name: "Stream not in backoff",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1}, req)
+				sb.backoff(streamKey{id: 2}, time.Second)
+			},
+			req:  req,
+			want: 0,
+		},
+		{
+			name: "Stream backoff has been reset",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1}, req)
+				sb.backoff(streamKey{id: 1}, time.Second)
+				sb.reset(streamKey{id: 1})
+			},
+			req:  req,
+			want: 0,
+		},
+		{
+			name: "Incremental stream with the same ID not in backoff",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1, delta: true}, req)
+				sb.backoff(streamKey{id: 1}, time.Second)
+			},
+			req:  req,
+			want: 0,
+		},
+		{
+			name: "Other type of the same stream in backoff",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1, typeURL: "cluster"}, req)
+				sb.backoff(streamKey{id: 1, typeURL: "listener"}, time.Second)
+			},
+			req:  req,
+			want: 0,
+		},
+		{
+			name: "Request is not the last one of the stream",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1}, req)
+				sb.trackRequest(streamKey{id: 1}, &envoy_service_discovery_v3.DiscoveryRequest{})
+				sb.backoff(streamKey{id: 1}, time.Second)
+			},
+			req:  req,
+			want: 0,
+		},
+		{
+			name: "Backoff has expired",
+			setup: func(sb *StreamBackoff) {
+				sb.trackRequest(streamKey{id: 1}, req)
+				sb.backoff(streamKey{id: 1}, -time.Second)
+			},
+			req:  req,
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := NewStreamBackoff()
+			sb.clock = clock.NewTest(now)
+			tt.setup(sb)
+			if got := sb.delayFor(tt.req); got != tt.want {
+				t.Errorf("StreamBackoff.delayFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallbacks_backoff_perType(t *testing.T) {
+	sb := NewStreamBackoff()
+	sb.clock = clock.NewTest(time.Now())
+	cb := &Callbacks{Stats: stats.New(), Logger: ctrl.Log, Backoff: sb}
+	node := &envoy_config_core_v3.Node{
+		Id: "node",
+		Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"pod_name": structpb.NewStringValue("pod"),
+		}},
+	}
+
+	// an ADS stream NACKs the listeners and ACKs the clusters
+	nack := &envoy_service_discovery_v3.DiscoveryRequest{
+		Node: node, TypeUrl: "listener", ResponseNonce: "1", ErrorDetail: &status.Status{Message: "error"},
+	}
+	ack := &envoy_service_discovery_v3.DiscoveryRequest{
+		Node: node, TypeUrl: "cluster", ResponseNonce: "2", VersionInfo: "1",
+	}
+	for _, req := range []*envoy_service_discovery_v3.DiscoveryRequest{nack, ack} {
+		if err := cb.OnStreamRequest(1, req); err != nil {
+			t.Fatalf("Callbacks.OnStreamRequest() error = %v", err)
+		}
+	}
+
+	if got := sb.delayFor(nack); got == 0 {
+		t.Errorf("StreamBackoff.delayFor() the ACK of the clusters reset the backoff of the listeners")
+	}
+	if got := sb.delayFor(ack); got != 0 {
+		t.Errorf("StreamBackoff.delayFor() = %v, the clusters must not be in backoff", got)
+	}
+
+	cb.OnStreamClosed(1, node)
+	if len(sb.streams) != 0 || len(sb.requests) != 0 || len(sb.last) != 0 {
+		t.Errorf("StreamBackoff state not released after closing the stream")
+	}
+}
+
+func TestStreamBackoff_Collect(t *testing.T) {
+	sb := NewStreamBackoff()
+	sb.backoff(streamKey{id: 1}, time.Minute)
+	sb.backoff(streamKey{id: 1, delta: true}, time.Minute)
+	sb.backoff(streamKey{id: 2}, -time.Minute)
+
+	if got := testutil.ToFloat64(sb); got != 2 {
+		t.Errorf("StreamBackoff.Collect() = %v, want %v", got, 2)
+	}
+}
+
+// testTimers creates timers that only fire when the test fires them
+type testTimers struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	stopped   int
+	fire      chan time.Time
+}
+
+func newTestTimers() *testTimers {
+	return &testTimers{fire: make(chan time.Time)}
+}
+
+func (tt *testTimers) newTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.durations = append(tt.durations, d)
+	return tt.fire, func() bool {
+		tt.mu.Lock()
+		defer tt.mu.Unlock()
+		tt.stopped++
+		return true
+	}
+}
+
+// fireAll fires all the timers, the ones already created and the ones created later on
+func (tt *testTimers) fireAll() { close(tt.fire) }
+
+func (tt *testTimers) started() []time.Duration {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return append([]time.Duration{}, tt.durations...)
+}
+
+func TestBackoffCache_CreateWatch(t *testing.T) {
+	t.Run("Responds immediately to streams not in backoff", func(t *testing.T) {
+		sb := NewStreamBackoff()
+		timers := newTestTimers()
+		sb.newTimer = timers.newTimer
+		c := NewBackoffCache(testCache{}, sb)
+		req := &envoy_service_discovery_v3.DiscoveryRequest{}
+		sb.trackRequest(streamKey{id: 1}, req)
+
+		out := make(chan cache_v3.Response, 1)
+		c.CreateWatch(req, stream_v3.NewStreamState(false, nil), out)
+		select {
+		case <-out:
+		default:
+			t.Errorf("BackoffCache.CreateWatch() response was delayed")
+		}
+		if got := timers.started(); len(got) != 0 {
+			t.Errorf("BackoffCache.CreateWatch() started timers %v, want none", got)
+		}
+	})
+
+	t.Run("Delays the response to streams in backoff", func(t *testing.T) {
+		sb := NewStreamBackoff()
+		sb.clock = clock.NewTest(time.Now())
+		timers := newTestTimers()
+		sb.newTimer = timers.newTimer
+		c := NewBackoffCache(testCache{}, sb)
+		req := &envoy_service_discovery_v3.DiscoveryRequest{}
+		sb.trackRequest(streamKey{id: 1}, req)
+		sb.backoff(streamKey{id: 1}, 100*time.Millisecond)
+
+		out := make(chan cache_v3.Response, 1)
+		c.CreateWatch(req, stream_v3.NewStreamState(false, nil), out)
+		if got := timers.started(); !reflect.DeepEqual(got, []time.Duration{100 * time.Millisecond}) {
+			t.Errorf("BackoffCache.CreateWatch() started timers %v, want [100ms]", got)
+		}
+		select {
+		case <-out:
+			t.Errorf("BackoffCache.CreateWatch() responded before the backoff expired")
+		default:
+		}
+
+		timers.fireAll()
+		<-out
+	})
+
+	t.Run("Cancelled watches don't respond", func(t *testing.T) {
+		sb := NewStreamBackoff()
+		sb.clock = clock.NewTest(time.Now())
+		timers := newTestTimers()
+		sb.newTimer = timers.newTimer
+		c := NewBackoffCache(testCache{}, sb)
+		req := &envoy_service_discovery_v3.DeltaDiscoveryRequest{}
+		sb.trackRequest(streamKey{id: 1, delta: true}, req)
+		sb.backoff(streamKey{id: 1, delta: true}, 50*time.Millisecond)
+
+		out := make(chan cache_v3.DeltaResponse, 1)
+		cancel := c.CreateDeltaWatch(req, stream_v3.NewStreamState(false, nil), out)
+		cancel()
+		// cancelling twice must be safe
+		cancel()
+		timers.fireAll()
+		select {
+		case <-out:
+			t.Errorf("BackoffCache.CreateDeltaWatch() cancelled watch responded")
+		default:
+		}
+	})
+}
+
+func TestCallbacks_backoff_concurrency(t *testing.T) {
+	const streams = 500
+
+	sb := NewStreamBackoff()
+	// freeze the clock and the timers so backoffs only
+	// expire when the test fires the timers
+	sb.clock = clock.NewTest(time.Now())
+	timers := newTestTimers()
+	sb.newTimer = timers.newTimer
+	cb := &Callbacks{Stats: stats.New(), Logger: ctrl.Log, Backoff: sb}
+	c := NewBackoffCache(testCache{}, sb)
+
+	outs := make([]chan cache_v3.Response, streams+1)
+	var wg sync.WaitGroup
+	for i := 1; i <= streams; i++ {
+		outs[i] = make(chan cache_v3.Response, 1)
+		wg.Add(1)
+		go func(id int64, out chan cache_v3.Response) {
+			defer wg.Done()
+			node := &envoy_config_core_v3.Node{
+				Id: "node",
+				Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+					"pod_name": structpb.NewStringValue(fmt.Sprintf("pod-%d", id)),
+				}},
+			}
+			req := &envoy_service_discovery_v3.DiscoveryRequest{
+				Node: node, TypeUrl: "some-type", ResponseNonce: "1", VersionInfo: "1",
+			}
+			if id%2 == 0 {
+				req.ErrorDetail = &status.Status{Message: "error"}
+			}
+
+			// callbacks return while the stream is in backoff, the
+			// response is delayed by the watch instead
+			if err := cb.OnStreamRequest(id, req); err != nil {
+				t.Errorf("Callbacks.OnStreamRequest() error = %v", err)
+			}
+			c.CreateWatch(req, stream_v3.NewStreamState(false, nil), out)
+		}(int64(i), outs[i])
+	}
+	wg.Wait()
+
+	// all the streams that sent a NACK are in backoff at the same time,
+	// and the streams that sent an ACK have already been responded
+	if got := sb.InBackoff(); got != streams/2 {
+		t.Errorf("StreamBackoff.InBackoff() = %v, want %v", got, streams/2)
+	}
+	if got := timers.started(); len(got) != streams/2 {
+		t.Errorf("BackoffCache.CreateWatch() started %v timers, want %v", len(got), streams/2)
+	}
+	for i := 1; i <= streams; i++ {
+		select {
+		case <-outs[i]:
+			if i%2 == 0 {
+				t.Errorf("response to the NACK of stream %d was not delayed", i)
+			}
+		default:
+			if i%2 != 0 {
+				t.Errorf("response to the ACK of stream %d was delayed", i)
+			}
+		}
+	}
+
+	// all the delayed responses are sent once the backoffs expire
+	timers.fireAll()
+	for i := 2; i <= streams; i += 2 {
+		<-outs[i]
+	}
+
+	for i := 1; i <= streams; i++ {
+		cb.OnStreamClosed(int64(i), nil)
+	}
+	if len(sb.streams) != 0 || len(sb.requests) != 0 || len(sb.last) != 0 {
+		t.Errorf("StreamBackoff state not released after closing the streams")
+	}
+}
@@ -2,6 +2,7 @@ package discoveryservice
 
 import (
 	"context"
+	"fmt"
 
 	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
 	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
@@ -16,7 +17,7 @@ type Cache struct {
 
 // NewCache returns a Cache object.
 func NewCache() Cache {
-	return Cache{v3: cache_v3.NewSnapshotCache(true, cache_v3.IDHash{}, nil)}
+	return Cache{v3: NewRoutingCache(nil)}
 }
 
 // NewCache returns a Cache object.
@@ -50,3 +51,39 @@ func (c Cache) NewSnapshot() xdss.Snapshot {
 
 	return NewSnapshot()
 }
+
+// SetCanary sets the snapshot that is served to a percentage of the Envoy
+// clients of a node during a progressive rollout.
+func (c Cache) SetCanary(ctx context.Context, nodeID string, canary xdss.Canary) error {
+	rc, ok := c.v3.(*RoutingCache)
+	if !ok {
+		return fmt.Errorf("canary snapshots are not supported by the cache")
+	}
+	return rc.SetCanary(ctx, nodeID, canary.Version, canary.Percentage, canary.Snapshot.(Snapshot).v3)
+}
+
+// GetCanary gets the canary snapshot for a node, and returns an error if not found.
+func (c Cache) GetCanary(nodeID string) (*xdss.Canary, error) {
+	rc, ok := c.v3.(*RoutingCache)
+	if !ok {
+		return nil, fmt.Errorf("canary snapshots are not supported by the cache")
+	}
+	snap, version, percentage, ok := rc.GetCanary(nodeID)
+	if !ok {
+		return nil, fmt.Errorf("no canary snapshot found for node %s", nodeID)
+	}
+	return &xdss.Canary{
+		Version:    version,
+		Percentage: percentage,
+		Snapshot:   &Snapshot{v3: snap.(*cache_v3.Snapshot)},
+	}, nil
+}
+
+// ClearCanary stops serving the canary snapshot of a node.
+func (c Cache) ClearCanary(ctx context.Context, nodeID string) error {
+	rc, ok := c.v3.(*RoutingCache)
+	if !ok {
+		return nil
+	}
+	return rc.ClearCanary(ctx, nodeID)
+}
@@ -16,6 +16,7 @@ package discoveryservice
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
@@ -31,8 +32,20 @@ import (
 
 // Callbacks is a type that implements go-control-plane/pkg/server/Callbacks
 type Callbacks struct {
-	Stats  *stats.Stats
-	Logger logr.Logger
+	Stats   *stats.Stats
+	Logger  logr.Logger
+	Backoff *StreamBackoff
+	// Routing, if set, is notified of the streams opened and closed
+	// by the Envoy clients, so it can release the snapshots of the
+	// Pods that are gone
+	Routing *RoutingCache
+
+	// nodes holds the node of each open state of the world
+	// xDS stream, indexed by stream ID
+	nodes sync.Map
+	// deltaNodes holds the node of each open incremental
+	// xDS stream, indexed by stream ID
+	deltaNodes sync.Map
 }
 
 var _ server_v3.Callbacks = &Callbacks{}
@@ -47,6 +60,10 @@ func (cb *Callbacks) OnStreamOpen(ctx context.Context, id int64, typ string) err
 // OnStreamClosed implements go-control-plane/pkg/server/Callbacks.OnStreamClosed
 // OnStreamClosed is called immediately prior to closing an xDS stream with a stream ID.
 func (cb *Callbacks) OnStreamClosed(id int64, node *envoy_config_core_v3.Node) {
+	if v, ok := cb.nodes.LoadAndDelete(id); ok && cb.Routing != nil {
+		cb.Routing.StreamClosed(v.(*envoy_config_core_v3.Node))
+	}
+	cb.Backoff.remove(id, false)
 	cb.Logger.V(1).Info("Stream closed", "StreamID", id)
 }
 
@@ -54,6 +71,17 @@ func (cb *Callbacks) OnStreamClosed(id int64, node *envoy_config_core_v3.Node) {
 // OnStreamRequest is called once a request is received on a stream.
 // Returning an error will end processing and close the stream. OnStreamClosed will still be called.
 func (cb *Callbacks) OnStreamRequest(id int64, req *envoy_service_discovery_v3.DiscoveryRequest) error {
+	// Track the request so the response to it can be delayed if the stream is in backoff
+	key := streamKey{id: id, typeURL: req.GetTypeUrl()}
+	cb.Backoff.trackRequest(key, req)
+
+	// The node is sent in the first request of the stream
+	if req.GetNode() != nil {
+		if _, loaded := cb.nodes.LoadOrStore(id, req.GetNode()); !loaded && cb.Routing != nil {
+			cb.Routing.StreamOpened(req.GetNode())
+		}
+	}
+
 	// Try to get the Pod name associated with the request
 	podName, err := stats.GetStringValueFromMetadata(req.GetNode().Metadata.AsMap(), "pod_name")
 	if err != nil {
@@ -66,21 +94,16 @@ func (cb *Callbacks) OnStreamRequest(id int64, req *envoy_service_discovery_v3.D
 
 	if req.GetResponseNonce() != "" {
 		if req.GetErrorDetail() != nil {
-			log.Info("Discovery NACK")
-			failures, err := cb.Stats.ReportNACK(req.GetNode().GetId(), req.GetTypeUrl(), podName, req.GetResponseNonce())
+			log.Info("Discovery NACK", "ErrorDetail", req.GetErrorDetail().GetMessage())
+			failures, err := cb.Stats.ReportNACK(req.GetNode().GetId(), req.GetTypeUrl(), podName, req.GetResponseNonce(), req.GetErrorDetail().GetMessage())
 			if err != nil {
 				log.Error(err, "error trying to report a response NACK")
 			}
-
-			// Backoff
-			if failures == 0 {
-				time.Sleep(100 * time.Millisecond)
-			} else {
-				time.Sleep(backoff.Default.Duration(int(failures)))
-			}
+			cb.Backoff.backoff(key, backoffDuration(failures))
 
 		} else {
 			log.Info("Discovery ACK")
+			cb.Backoff.reset(key)
 			cb.Stats.ReportACK(req.GetNode().GetId(), req.GetTypeUrl(), req.GetVersionInfo(), podName)
 		}
 
@@ -135,17 +158,110 @@ func (cb *Callbacks) OnFetchResponse(*envoy_service_discovery_v3.DiscoveryReques
 
 // OnDeltaStreamOpen is called once an incremental xDS stream is open with a stream ID and the type URL (or "" for ADS).
 // Returning an error will end processing and close the stream. OnStreamClosed will still be called.
-func (cb *Callbacks) OnDeltaStreamOpen(context.Context, int64, string) error { return nil }
+func (cb *Callbacks) OnDeltaStreamOpen(ctx context.Context, id int64, typ string) error {
+	cb.Logger.V(1).Info("Delta stream opened", "StreamId", id)
+	return nil
+}
 
 // OnDeltaStreamClosed is called immediately prior to closing an xDS stream with a stream ID.
-func (cb *Callbacks) OnDeltaStreamClosed(int64, *envoy_config_core_v3.Node) {}
+func (cb *Callbacks) OnDeltaStreamClosed(id int64, node *envoy_config_core_v3.Node) {
+	if v, ok := cb.deltaNodes.LoadAndDelete(id); ok && cb.Routing != nil {
+		cb.Routing.StreamClosed(v.(*envoy_config_core_v3.Node))
+	}
+	cb.Backoff.remove(id, true)
+	cb.Logger.V(1).Info("Delta stream closed", "StreamID", id)
+}
 
 // OnStreamDeltaRequest is called once a request is received on a stream.
 // Returning an error will end processing and close the stream. OnStreamClosed will still be called.
-func (cb *Callbacks) OnStreamDeltaRequest(int64, *envoy_service_discovery_v3.DeltaDiscoveryRequest) error {
+func (cb *Callbacks) OnStreamDeltaRequest(id int64, req *envoy_service_discovery_v3.DeltaDiscoveryRequest) error {
+	// Track the request so the response to it can be delayed if the stream is in backoff
+	key := streamKey{id: id, delta: true, typeURL: req.GetTypeUrl()}
+	cb.Backoff.trackRequest(key, req)
+
+	// Envoy might only send the node in the first request of an incremental
+	// stream, so keep track of it to be able to identify the subsequent ones
+	node := req.GetNode()
+	if node != nil {
+		if _, loaded := cb.deltaNodes.Swap(id, node); !loaded && cb.Routing != nil {
+			cb.Routing.StreamOpened(node)
+		}
+	} else if v, ok := cb.deltaNodes.Load(id); ok {
+		node = v.(*envoy_config_core_v3.Node)
+	}
+
+	// Try to get the Pod name associated with the request
+	podName, err := stats.GetStringValueFromMetadata(node.GetMetadata().AsMap(), "pod_name")
+	if err != nil {
+		cb.Logger.Error(err, "an error ocurred, Pod name could not be retrieved", "NodeID", node.GetId(), "StreamID", id)
+		podName = "unknown"
+	}
+
+	log := cb.Logger.WithValues("TypeURL", req.GetTypeUrl(), "NodeID", node.GetId(), "StreamID", id, "Pod", podName,
+		"Subscribe", req.GetResourceNamesSubscribe(), "Unsubscribe", req.GetResourceNamesUnsubscribe())
+
+	if req.GetResponseNonce() != "" {
+		if req.GetErrorDetail() != nil {
+			log.Info("Delta discovery NACK", "ErrorDetail", req.GetErrorDetail().GetMessage())
+			failures, err := cb.Stats.ReportNACK(node.GetId(), req.GetTypeUrl(), podName, req.GetResponseNonce(), req.GetErrorDetail().GetMessage())
+			if err != nil {
+				log.Error(err, "error trying to report a response NACK")
+			}
+			cb.Backoff.backoff(key, backoffDuration(failures))
+
+		} else {
+			log.Info("Delta discovery ACK")
+			cb.Backoff.reset(key)
+			if err := cb.Stats.ReportDeltaACK(node.GetId(), req.GetTypeUrl(), podName, req.GetResponseNonce()); err != nil {
+				log.Error(err, "error trying to report a response ACK")
+			}
+		}
+
+	} else {
+		log.Info("Delta discovery request")
+		cb.Stats.ReportRequest(node.GetId(), req.GetTypeUrl(), podName)
+	}
+
 	return nil
 }
 
-// OnStreamDelatResponse is called immediately prior to sending a response on a stream.
-func (cb *Callbacks) OnStreamDeltaResponse(int64, *envoy_service_discovery_v3.DeltaDiscoveryRequest, *envoy_service_discovery_v3.DeltaDiscoveryResponse) {
+// backoffDuration returns the time a stream has to wait before receiving
+// a new response, given the number of failures of the rejected version
+func backoffDuration(failures int64) time.Duration {
+	if failures == 0 {
+		return 100 * time.Millisecond
+	}
+	return backoff.Default.Duration(int(failures))
+}
+
+// OnStreamDeltaResponse is called immediately prior to sending a response on a stream.
+func (cb *Callbacks) OnStreamDeltaResponse(id int64, req *envoy_service_discovery_v3.DeltaDiscoveryRequest,
+	rsp *envoy_service_discovery_v3.DeltaDiscoveryResponse) {
+
+	log := cb.Logger.WithValues("TypeURL", req.GetTypeUrl(), "NodeID", req.GetNode().GetId(), "StreamID", id, "Version", rsp.GetSystemVersionInfo())
+
+	// Track the nonce of this response in the stats cache. The system version of delta
+	// responses matches the version of the resource type in the snapshot, so tainting
+	// of revisions works the same way as with state of the world streams.
+	podName, err := stats.GetStringValueFromMetadata(req.GetNode().GetMetadata().AsMap(), "pod_name")
+	if err != nil {
+		log.Error(err, "an error ocurred, nonce won't be tracked")
+	} else {
+		cb.Stats.WriteResponseNonce(req.GetNode().GetId(), rsp.GetTypeUrl(), rsp.GetSystemVersionInfo(), podName, rsp.GetNonce())
+	}
+
+	// Log resources when in debug mode
+	resources := []string{}
+	for _, r := range rsp.GetResources() {
+		j, _ := envoy_serializer.NewResourceMarshaller(envoy_serializer.JSON, envoy.APIv3).Marshal(r.GetResource())
+		resources = append(resources, string(j))
+	}
+	if rsp.TypeUrl == envoy_resources_v3.Mappings()[envoy.Secret] {
+		// Do not log secret contents
+		log.V(1).Info("Delta discovery response", "ResourcesNames", req.GetResourceNamesSubscribe(),
+			"RemovedResources", rsp.GetRemovedResources(), "Pod", podName)
+	} else {
+		log.V(1).Info("Delta discovery response", "Resources", resources,
+			"RemovedResources", rsp.GetRemovedResources(), "Pod", podName)
+	}
 }
@@ -23,6 +23,7 @@ import (
 	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -40,7 +41,7 @@ func TestCallbacks_OnStreamOpen(t *testing.T) {
 	}{
 		{
 			"OnStreamOpen()",
-			&Callbacks{Logger: ctrl.Log},
+			&Callbacks{Logger: ctrl.Log, Backoff: NewStreamBackoff()},
 			args{context.Background(), 1, "xxxx"},
 			false,
 		},
@@ -66,8 +67,9 @@ func TestCallbacks_OnStreamClosed(t *testing.T) {
 		{
 			"OnStreamClosed()",
 			&Callbacks{
-				Stats:  stats.New(),
-				Logger: ctrl.Log,
+				Stats:   stats.New(),
+				Logger:  ctrl.Log,
+				Backoff: NewStreamBackoff(),
 			},
 			args{1},
 		}}
@@ -92,8 +94,9 @@ func TestCallbacks_OnStreamRequest(t *testing.T) {
 		{
 			"OnStreamRequest()",
 			&Callbacks{
-				Stats:  stats.New(),
-				Logger: ctrl.Log,
+				Stats:   stats.New(),
+				Logger:  ctrl.Log,
+				Backoff: NewStreamBackoff(),
 			},
 			args{1, &envoy_service_discovery_v3.DiscoveryRequest{
 				Node:          &envoy_config_core_v3.Node{Id: "node1", Cluster: "cluster1"},
@@ -106,8 +109,9 @@ func TestCallbacks_OnStreamRequest(t *testing.T) {
 		{
 			"OnStreamRequest() NACK received",
 			&Callbacks{
-				Stats:  stats.New(),
-				Logger: ctrl.Log,
+				Stats:   stats.New(),
+				Logger:  ctrl.Log,
+				Backoff: NewStreamBackoff(),
 			},
 			args{1, &envoy_service_discovery_v3.DiscoveryRequest{
 				Node:          &envoy_config_core_v3.Node{Id: "node1", Cluster: "cluster1"},
@@ -141,8 +145,9 @@ func TestCallbacks_OnStreamResponse(t *testing.T) {
 		{
 			"OnStreamResponse()",
 			&Callbacks{
-				Stats:  stats.New(),
-				Logger: ctrl.Log,
+				Stats:   stats.New(),
+				Logger:  ctrl.Log,
+				Backoff: NewStreamBackoff(),
 			},
 			args{1,
 				&envoy_service_discovery_v3.DiscoveryRequest{
@@ -162,8 +167,9 @@ func TestCallbacks_OnStreamResponse(t *testing.T) {
 		{
 			"OnStreamResponse() special treatment of secret resources",
 			&Callbacks{
-				Stats:  stats.New(),
-				Logger: ctrl.Log,
+				Stats:   stats.New(),
+				Logger:  ctrl.Log,
+				Backoff: NewStreamBackoff(),
 			},
 			args{1,
 				&envoy_service_discovery_v3.DiscoveryRequest{
@@ -201,7 +207,7 @@ func TestCallbacks_OnFetchRequest(t *testing.T) {
 	}{
 		{
 			"OnFetchRequest()",
-			&Callbacks{Logger: ctrl.Log},
+			&Callbacks{Logger: ctrl.Log, Backoff: NewStreamBackoff()},
 			args{
 				context.Background(),
 				&envoy_service_discovery_v3.DiscoveryRequest{},
@@ -230,7 +236,7 @@ func TestCallbacks_OnFetchResponse(t *testing.T) {
 	}{
 		{
 			"OnFetchResponse()",
-			&Callbacks{Logger: ctrl.Log},
+			&Callbacks{Logger: ctrl.Log, Backoff: NewStreamBackoff()},
 			args{&envoy_service_discovery_v3.DiscoveryRequest{}, &envoy_service_discovery_v3.DiscoveryResponse{}},
 		},
 	}
@@ -240,3 +246,92 @@ func TestCallbacks_OnFetchResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestCallbacks_OnStreamDeltaRequest(t *testing.T) {
+	node := &envoy_config_core_v3.Node{
+		Id: "node1",
+		Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"pod_name": structpb.NewStringValue("pod1"),
+		}},
+	}
+
+	t.Run("Tracks requests and ACKs of delta streams", func(t *testing.T) {
+		cb := &Callbacks{Stats: stats.New(), Logger: ctrl.Log, Backoff: NewStreamBackoff()}
+
+		// first request carries the node
+		if err := cb.OnStreamDeltaRequest(1, &envoy_service_discovery_v3.DeltaDiscoveryRequest{
+			Node: node, TypeUrl: "some-type",
+		}); err != nil {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() error = %v", err)
+		}
+		if got := cb.Stats.GetSubscribedPods("node1", "some-type"); len(got) != 1 {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() subscribed pods = %v, want 1", got)
+		}
+
+		cb.OnStreamDeltaResponse(1,
+			&envoy_service_discovery_v3.DeltaDiscoveryRequest{Node: node, TypeUrl: "some-type"},
+			&envoy_service_discovery_v3.DeltaDiscoveryResponse{TypeUrl: "some-type", SystemVersionInfo: "aaaa", Nonce: "1"},
+		)
+
+		// subsequent requests might not carry the node
+		if err := cb.OnStreamDeltaRequest(1, &envoy_service_discovery_v3.DeltaDiscoveryRequest{
+			TypeUrl: "some-type", ResponseNonce: "1",
+		}); err != nil {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() error = %v", err)
+		}
+		if got, _ := cb.Stats.GetCounter("node1", "some-type", "aaaa", "pod1", "ack_counter"); got != 1 {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() ack_counter = %v, want 1", got)
+		}
+
+		cb.OnDeltaStreamClosed(1, node)
+		if _, ok := cb.deltaNodes.Load(int64(1)); ok {
+			t.Errorf("Callbacks.OnDeltaStreamClosed() stream node not released")
+		}
+	})
+
+	t.Run("Tracks NACKs of delta streams", func(t *testing.T) {
+		cb := &Callbacks{Stats: stats.New(), Logger: ctrl.Log, Backoff: NewStreamBackoff()}
+		cb.OnStreamDeltaResponse(1,
+			&envoy_service_discovery_v3.DeltaDiscoveryRequest{Node: node, TypeUrl: "some-type"},
+			&envoy_service_discovery_v3.DeltaDiscoveryResponse{TypeUrl: "some-type", SystemVersionInfo: "aaaa", Nonce: "1"},
+		)
+		if err := cb.OnStreamDeltaRequest(1, &envoy_service_discovery_v3.DeltaDiscoveryRequest{
+			Node: node, TypeUrl: "some-type", ResponseNonce: "1", ErrorDetail: &status.Status{Code: 0, Message: "xxxx"},
+		}); err != nil {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() error = %v", err)
+		}
+		if got, _ := cb.Stats.GetCounter("node1", "some-type", "aaaa", "pod1", "nack_counter"); got != 1 {
+			t.Errorf("Callbacks.OnStreamDeltaRequest() nack_counter = %v, want 1", got)
+		}
+	})
+}
+
+func TestCallbacks_Routing(t *testing.T) {
+	node := &envoy_config_core_v3.Node{
+		Id: "node",
+		Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"pod_name": structpb.NewStringValue("pod"),
+		}},
+	}
+	rc := NewRoutingCache(nil)
+	cb := &Callbacks{Stats: stats.New(), Logger: ctrl.Log, Backoff: NewStreamBackoff(), Routing: rc}
+
+	// a state of the world and an incremental stream, with several requests each
+	for i := 0; i < 2; i++ {
+		if err := cb.OnStreamRequest(1, &envoy_service_discovery_v3.DiscoveryRequest{Node: node, TypeUrl: "some-type"}); err != nil {
+			t.Fatalf("Callbacks.OnStreamRequest() error = %v", err)
+		}
+		if err := cb.OnStreamDeltaRequest(1, &envoy_service_discovery_v3.DeltaDiscoveryRequest{Node: node, TypeUrl: "some-type"}); err != nil {
+			t.Fatalf("Callbacks.OnStreamDeltaRequest() error = %v", err)
+		}
+	}
+	if got := rc.clients["node"]["pod"]; got != 2 {
+		t.Errorf("Callbacks registered %d streams, want 2", got)
+	}
+
+	cb.OnStreamClosed(1, node)
+	cb.OnDeltaStreamClosed(1, node)
+	if _, ok := rc.clients["node"]; ok {
+		t.Errorf("Callbacks didn't unregister the closed streams")
+	}
+}
@@ -0,0 +1,299 @@
+package discoveryservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/log"
+	stream_v3 "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+)
+
+// PodHash identifies each Envoy client by its nodeID and the name of its
+// Pod, so different snapshots can be served to the Pods of the same nodeID.
+// Clients that don't report the Pod name in their metadata are identified
+// by their nodeID.
+type PodHash struct{}
+
+var _ cache_v3.NodeHash = PodHash{}
+
+// ID implements go-control-plane/pkg/cache/v3.NodeHash.ID
+func (PodHash) ID(node *envoy_config_core_v3.Node) string {
+	podName := podNameOf(node)
+	if podName == "" {
+		return node.GetId()
+	}
+	return podKey(node.GetId(), podName)
+}
+
+// podKeySeparator separates the nodeID and the Pod name in the keys of the underlying
+// cache. The NUL character can't be part of the nodeID of an Envoy client, so the key of
+// a Pod never matches the key of a different nodeID and Pod.
+const podKeySeparator = "\x00"
+
+func podKey(nodeID, podName string) string {
+	return nodeID + podKeySeparator + podName
+}
+
+// podNameOf returns the name of the Pod reported in the metadata
+// of the Envoy client, or an empty string if it is not reported
+func podNameOf(node *envoy_config_core_v3.Node) string {
+	podName, err := stats.GetStringValueFromMetadata(node.GetMetadata().AsMap(), "pod_name")
+	if err != nil {
+		return ""
+	}
+	return podName
+}
+
+// RoutingCache is a go-control-plane SnapshotCache that holds, for each nodeID, the published
+// snapshot and, during a progressive rollout, a canary snapshot. Each Envoy client is routed
+// to one of them based on the name of its Pod.
+type RoutingCache struct {
+	// cache holds a snapshot per Pod
+	cache cache_v3.SnapshotCache
+
+	mu        sync.RWMutex
+	published map[string]cache_v3.ResourceSnapshot
+	canaries  map[string]canary
+	// clients holds, for each nodeID, the number of open streams of each
+	// one of its Pods, so their snapshots can be released once they leave
+	clients map[string]map[string]int
+}
+
+type canary struct {
+	version    string
+	percentage int32
+	snapshot   cache_v3.ResourceSnapshot
+}
+
+var _ cache_v3.SnapshotCache = &RoutingCache{}
+
+// NewRoutingCache returns a new RoutingCache
+func NewRoutingCache(logger log.Logger) *RoutingCache {
+	return &RoutingCache{
+		cache:     cache_v3.NewSnapshotCache(true, PodHash{}, logger),
+		published: map[string]cache_v3.ResourceSnapshot{},
+		canaries:  map[string]canary{},
+		clients:   map[string]map[string]int{},
+	}
+}
+
+// SetSnapshot sets the published snapshot of a nodeID
+func (rc *RoutingCache) SetSnapshot(ctx context.Context, nodeID string, snapshot cache_v3.ResourceSnapshot) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.published[nodeID] = snapshot
+	return rc.route(ctx, nodeID)
+}
+
+// GetSnapshot returns the published snapshot of a nodeID
+func (rc *RoutingCache) GetSnapshot(nodeID string) (cache_v3.ResourceSnapshot, error) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	snapshot, ok := rc.published[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot found for node %s", nodeID)
+	}
+	return snapshot, nil
+}
+
+// ClearSnapshot removes the snapshots, canary included, and
+// the status information of a nodeID and all its Pods
+func (rc *RoutingCache) ClearSnapshot(nodeID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	delete(rc.published, nodeID)
+	delete(rc.canaries, nodeID)
+	for _, key := range rc.keys(nodeID) {
+		rc.cache.ClearSnapshot(key)
+	}
+	delete(rc.clients, nodeID)
+	rc.cache.ClearSnapshot(nodeID)
+}
+
+// StreamOpened registers a stream opened by an Envoy client. The snapshot of
+// a Pod is kept in the underlying cache while the Pod has open streams.
+func (rc *RoutingCache) StreamOpened(node *envoy_config_core_v3.Node) {
+	podName := podNameOf(node)
+	if podName == "" {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.track(node.GetId(), podName)
+	rc.clients[node.GetId()][podName]++
+}
+
+// StreamClosed unregisters a stream of an Envoy client. Once the last stream of a
+// Pod is closed, its snapshot and status are removed from the underlying cache.
+func (rc *RoutingCache) StreamClosed(node *envoy_config_core_v3.Node) {
+	podName := podNameOf(node)
+	if podName == "" {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	pods, ok := rc.clients[node.GetId()]
+	if !ok {
+		return
+	}
+	if _, ok := pods[podName]; !ok {
+		return
+	}
+	if pods[podName]--; pods[podName] > 0 {
+		return
+	}
+	delete(pods, podName)
+	if len(pods) == 0 {
+		delete(rc.clients, node.GetId())
+	}
+	rc.cache.ClearSnapshot(podKey(node.GetId(), podName))
+}
+
+// SetCanary sets the canary snapshot of a nodeID
+func (rc *RoutingCache) SetCanary(ctx context.Context, nodeID, version string, percentage int32, snapshot cache_v3.ResourceSnapshot) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.canaries[nodeID] = canary{version: version, percentage: percentage, snapshot: snapshot}
+	return rc.route(ctx, nodeID)
+}
+
+// GetCanary returns the canary snapshot of a nodeID, with the version it belongs to
+// and the percentage of clients it is served to. Returns false if there is no canary.
+func (rc *RoutingCache) GetCanary(nodeID string) (cache_v3.ResourceSnapshot, string, int32, bool) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	c, ok := rc.canaries[nodeID]
+	return c.snapshot, c.version, c.percentage, ok
+}
+
+// ClearCanary stops serving the canary snapshot of a nodeID, routing
+// all the clients back to the published snapshot
+func (rc *RoutingCache) ClearCanary(ctx context.Context, nodeID string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.canaries[nodeID]; !ok {
+		return nil
+	}
+	delete(rc.canaries, nodeID)
+	return rc.route(ctx, nodeID)
+}
+
+// GetStatusInfo implements go-control-plane/pkg/cache/v3.SnapshotCache.GetStatusInfo
+func (rc *RoutingCache) GetStatusInfo(key string) cache_v3.StatusInfo {
+	return rc.cache.GetStatusInfo(key)
+}
+
+// GetStatusKeys implements go-control-plane/pkg/cache/v3.SnapshotCache.GetStatusKeys
+func (rc *RoutingCache) GetStatusKeys() []string {
+	return rc.cache.GetStatusKeys()
+}
+
+// CreateWatch implements go-control-plane/pkg/cache/v3.ConfigWatcher.CreateWatch
+func (rc *RoutingCache) CreateWatch(req *cache_v3.Request, state stream_v3.StreamState, out chan cache_v3.Response) func() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.ensure(req.GetNode())
+	return rc.cache.CreateWatch(req, state, out)
+}
+
+// CreateDeltaWatch implements go-control-plane/pkg/cache/v3.ConfigWatcher.CreateDeltaWatch
+func (rc *RoutingCache) CreateDeltaWatch(req *cache_v3.DeltaRequest, state stream_v3.StreamState, out chan cache_v3.DeltaResponse) func() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.ensure(req.GetNode())
+	return rc.cache.CreateDeltaWatch(req, state, out)
+}
+
+// Fetch implements go-control-plane/pkg/cache/v3.ConfigFetcher.Fetch
+func (rc *RoutingCache) Fetch(ctx context.Context, req *cache_v3.Request) (cache_v3.Response, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.ensure(req.GetNode())
+	return rc.cache.Fetch(ctx, req)
+}
+
+// snapshotFor returns the snapshot that should be served to
+// the given Pod. Must be called with the lock held.
+func (rc *RoutingCache) snapshotFor(nodeID, podName string) (cache_v3.ResourceSnapshot, bool) {
+	if c, ok := rc.canaries[nodeID]; ok && podName != "" && xdss.InCanary(podName, c.percentage) {
+		return c.snapshot, true
+	}
+	snapshot, ok := rc.published[nodeID]
+	return snapshot, ok
+}
+
+// ensure sets the snapshot for the client if the client is connecting for
+// the first time. Must be called with the lock held.
+func (rc *RoutingCache) ensure(node *envoy_config_core_v3.Node) {
+	podName := podNameOf(node)
+	if podName != "" {
+		rc.track(node.GetId(), podName)
+	}
+
+	key := PodHash{}.ID(node)
+	if _, err := rc.cache.GetSnapshot(key); err == nil {
+		return
+	}
+	if snapshot, ok := rc.snapshotFor(node.GetId(), podName); ok {
+		// there is no way of returning an error from the watch creation path, the
+		// snapshot will be set again the next time the clients of the nodeID are routed
+		_ = rc.cache.SetSnapshot(context.Background(), key, snapshot)
+	}
+}
+
+// track adds the Pod to the clients of the nodeID, if not already
+// there, so it gets routed. Must be called with the lock held.
+func (rc *RoutingCache) track(nodeID, podName string) {
+	if _, ok := rc.clients[nodeID]; !ok {
+		rc.clients[nodeID] = map[string]int{}
+	}
+	if _, ok := rc.clients[nodeID][podName]; !ok {
+		rc.clients[nodeID][podName] = 0
+	}
+}
+
+// route sets the corresponding snapshot for each one of the clients of
+// a nodeID. Must be called with the lock held.
+func (rc *RoutingCache) route(ctx context.Context, nodeID string) error {
+	for podName := range rc.clients[nodeID] {
+		snapshot, ok := rc.snapshotFor(nodeID, podName)
+		if !ok {
+			continue
+		}
+		if err := rc.cache.SetSnapshot(ctx, podKey(nodeID, podName), snapshot); err != nil {
+			return err
+		}
+	}
+	if snapshot, ok := rc.snapshotFor(nodeID, ""); ok {
+		return rc.cache.SetSnapshot(ctx, nodeID, snapshot)
+	}
+	return nil
+}
+
+// keys returns the keys of the Pods of a nodeID in the
+// underlying cache. Must be called with the lock held.
+func (rc *RoutingCache) keys(nodeID string) []string {
+	keys := make([]string, 0, len(rc.clients[nodeID]))
+	for podName := range rc.clients[nodeID] {
+		keys = append(keys, podKey(nodeID, podName))
+	}
+	return keys
+}
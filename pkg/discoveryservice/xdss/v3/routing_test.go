@@ -0,0 +1,203 @@
+package discoveryservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	resource_v3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	stream_v3 "github.com/envoyproxy/go-control-plane/pkg/server/stream/v3"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func testNode(nodeID, podName string) *envoy_config_core_v3.Node {
+	node := &envoy_config_core_v3.Node{Id: nodeID}
+	if podName != "" {
+		node.Metadata = &structpb.Struct{Fields: map[string]*structpb.Value{
+			"pod_name": structpb.NewStringValue(podName),
+		}}
+	}
+	return node
+}
+
+func testSnapshot(clusterName string) cache_v3.ResourceSnapshot {
+	return NewSnapshot().SetResources(envoy.Endpoint, []envoy.Resource{
+		&envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: clusterName},
+	}).(Snapshot).v3
+}
+
+// servedVersion returns the version of the endpoints served to the given node
+func servedVersion(t *testing.T, rc *RoutingCache, node *envoy_config_core_v3.Node) string {
+	t.Helper()
+	out := make(chan cache_v3.Response, 1)
+	rc.CreateWatch(&cache_v3.Request{Node: node, TypeUrl: resource_v3.EndpointType}, stream_v3.NewStreamState(false, nil), out)
+	select {
+	case rsp := <-out:
+		version, _ := rsp.GetVersion()
+		return version
+	default:
+		return ""
+	}
+}
+
+func TestPodHash_ID(t *testing.T) {
+	tests := []struct {
+		name string
+		node *envoy_config_core_v3.Node
+		want string
+	}{
+		{
+			name: "Returns nodeID and pod name",
+			node: testNode("node", "pod-a"),
+			want: "node\x00pod-a",
+		},
+		{
+			name: "Returns nodeID if pod name is missing",
+			node: testNode("node", ""),
+			want: "node",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (PodHash{}).ID(tt.node); got != tt.want {
+				t.Errorf("PodHash.ID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Keys of different nodeIDs don't collide", func(t *testing.T) {
+		if a, b := (PodHash{}).ID(testNode("node:pod", "a")), (PodHash{}).ID(testNode("node", "pod:a")); a == b {
+			t.Errorf("PodHash.ID() = %q for two different clients", a)
+		}
+	})
+}
+
+func TestRoutingCache(t *testing.T) {
+	ctx := context.TODO()
+	published := testSnapshot("published")
+	canary := testSnapshot("canary")
+	publishedVersion := published.GetVersion(resource_v3.EndpointType)
+	canaryVersion := canary.GetVersion(resource_v3.EndpointType)
+
+	// pod-a is selected for percentages above 34, pod-c for percentages above 96
+	podA := testNode("node", "pod-a")
+	podC := testNode("node", "pod-c")
+	noPod := testNode("node", "")
+
+	rc := NewRoutingCache(nil)
+	if err := rc.SetSnapshot(ctx, "node", published); err != nil {
+		t.Fatalf("RoutingCache.SetSnapshot() error = %v", err)
+	}
+
+	t.Run("Serves the published snapshot to all the clients", func(t *testing.T) {
+		for _, node := range []*envoy_config_core_v3.Node{podA, podC, noPod} {
+			if got := servedVersion(t, rc, node); got != publishedVersion {
+				t.Errorf("RoutingCache served %q to %v, want %q", got, node.GetMetadata(), publishedVersion)
+			}
+		}
+	})
+
+	t.Run("Serves the canary snapshot to the selected clients", func(t *testing.T) {
+		if err := rc.SetCanary(ctx, "node", "xxxx", 50, canary); err != nil {
+			t.Fatalf("RoutingCache.SetCanary() error = %v", err)
+		}
+		if got := servedVersion(t, rc, podA); got != canaryVersion {
+			t.Errorf("RoutingCache served %q to pod-a, want %q", got, canaryVersion)
+		}
+		if got := servedVersion(t, rc, podC); got != publishedVersion {
+			t.Errorf("RoutingCache served %q to pod-c, want %q", got, publishedVersion)
+		}
+		if got := servedVersion(t, rc, noPod); got != publishedVersion {
+			t.Errorf("RoutingCache served %q to client without pod name, want %q", got, publishedVersion)
+		}
+		if _, version, percentage, ok := rc.GetCanary("node"); !ok || version != "xxxx" || percentage != 50 {
+			t.Errorf("RoutingCache.GetCanary() = %v, %v, %v", version, percentage, ok)
+		}
+		if got, _ := rc.GetSnapshot("node"); got != published {
+			t.Errorf("RoutingCache.GetSnapshot() did not return the published snapshot")
+		}
+	})
+
+	t.Run("Serves the published snapshot once the canary is cleared", func(t *testing.T) {
+		if err := rc.ClearCanary(ctx, "node"); err != nil {
+			t.Fatalf("RoutingCache.ClearCanary() error = %v", err)
+		}
+		if got := servedVersion(t, rc, podA); got != publishedVersion {
+			t.Errorf("RoutingCache served %q to pod-a, want %q", got, publishedVersion)
+		}
+		if _, _, _, ok := rc.GetCanary("node"); ok {
+			t.Errorf("RoutingCache.GetCanary() found a canary after clearing it")
+		}
+	})
+
+	t.Run("Clears the snapshots of all the clients", func(t *testing.T) {
+		rc.ClearSnapshot("node")
+		if _, err := rc.GetSnapshot("node"); err == nil {
+			t.Errorf("RoutingCache.GetSnapshot() found a snapshot after clearing it")
+		}
+		if keys := rc.keys("node"); len(keys) != 0 {
+			t.Errorf("RoutingCache kept the status of the clients: %v", keys)
+		}
+	})
+}
+
+func TestRoutingCache_StreamClosed(t *testing.T) {
+	ctx := context.TODO()
+	published := testSnapshot("published")
+	podA := testNode("node", "pod-a")
+	podB := testNode("node", "pod-b")
+	other := testNode("node:pod", "a")
+
+	rc := NewRoutingCache(nil)
+	if err := rc.SetSnapshot(ctx, "node", published); err != nil {
+		t.Fatalf("RoutingCache.SetSnapshot() error = %v", err)
+	}
+	if err := rc.SetSnapshot(ctx, "node:pod", published); err != nil {
+		t.Fatalf("RoutingCache.SetSnapshot() error = %v", err)
+	}
+
+	// pod-a opens two streams, pod-b one
+	for _, node := range []*envoy_config_core_v3.Node{podA, podA, podB, other} {
+		rc.StreamOpened(node)
+		servedVersion(t, rc, node)
+	}
+
+	t.Run("Keeps the snapshot while the Pod has open streams", func(t *testing.T) {
+		rc.StreamClosed(podA)
+		if _, err := rc.cache.GetSnapshot(podKey("node", "pod-a")); err != nil {
+			t.Errorf("RoutingCache released the snapshot of a Pod with open streams")
+		}
+	})
+
+	t.Run("Releases the snapshot once the last stream of the Pod is closed", func(t *testing.T) {
+		rc.StreamClosed(podA)
+		if _, err := rc.cache.GetSnapshot(podKey("node", "pod-a")); err == nil {
+			t.Errorf("RoutingCache kept the snapshot of a Pod without open streams")
+		}
+		if keys := rc.keys("node"); len(keys) != 1 || keys[0] != podKey("node", "pod-b") {
+			t.Errorf("RoutingCache.keys() = %q, want only pod-b", keys)
+		}
+		if keys := rc.keys("node:pod"); len(keys) != 1 {
+			t.Errorf("RoutingCache.keys() = %q, the clients of another nodeID must be kept", keys)
+		}
+	})
+
+	t.Run("Doesn't set snapshots for released Pods", func(t *testing.T) {
+		if err := rc.SetSnapshot(ctx, "node", testSnapshot("new")); err != nil {
+			t.Fatalf("RoutingCache.SetSnapshot() error = %v", err)
+		}
+		if _, err := rc.cache.GetSnapshot(podKey("node", "pod-a")); err == nil {
+			t.Errorf("RoutingCache set the snapshot of a released Pod")
+		}
+	})
+
+	t.Run("Serves the Pod again when it reconnects", func(t *testing.T) {
+		rc.StreamOpened(podA)
+		if got, want := servedVersion(t, rc, podA), testSnapshot("new").GetVersion(resource_v3.EndpointType); got != want {
+			t.Errorf("RoutingCache served %q to pod-a, want %q", got, want)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	reconcilerutil "github.com/3scale-ops/basereconciler/util"
 	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
 	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
 	envoy_resources_v3 "github.com/3scale-ops/marin3r/pkg/envoy/resources/v3"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
 	cache_types "github.com/envoyproxy/go-control-plane/pkg/cache/types"
@@ -36,16 +37,23 @@ func NewSnapshot() Snapshot {
 	return Snapshot{v3: snap}
 }
 
-// Consistent check verifies that the dependent resources are exactly listed in the
-// snapshot:
-// - all EDS resources are listed by name in CDS resources
-// - all RDS resources are listed by name in LDS resources
+// Consistent check verifies that the resources referenced by name by other resources
+// are listed in the snapshot:
+// - all EDS resources referenced by CDS resources
+// - all RDS resources referenced by LDS and SRDS resources
 //
-// Note that clusters and listeners are requested without name references, so
-// Envoy will accept the snapshot list of clusters as-is even if it does not match
-// all references found in xDS.
+// Unlike the go-control-plane check, resources that are not referenced by any other
+// resource are allowed, as they don't prevent Envoy from warming the listeners and
+// clusters. A DanglingReferencesError listing the missing resources is returned
+// if the snapshot is not consistent.
 func (s Snapshot) Consistent() error {
-	return s.v3.Consistent()
+	resources := map[envoy.Type][]envoy.Resource{}
+	for _, rType := range []envoy.Type{envoy.Endpoint, envoy.Cluster, envoy.Route, envoy.ScopedRoute, envoy.Listener} {
+		for _, r := range s.GetResources(rType) {
+			resources[rType] = append(resources[rType], r)
+		}
+	}
+	return envoy_resources.CheckReferences(resources, envoy.APIv3)
 }
 
 func (s Snapshot) SetResources(rType envoy.Type, resources []envoy.Resource) xdss.Snapshot {
@@ -57,6 +65,10 @@ func (s Snapshot) SetResources(rType envoy.Type, resources []envoy.Resource) xds
 
 	cv3resources := cache_v3.NewResources("", items)
 	s.v3.Resources[v3CacheResources(rType)] = cv3resources
+	// The version map is used to compute incremental xDS responses and is
+	// lazily built by the cache. Reset it so it gets recomputed with the new
+	// resources.
+	s.v3.VersionMap = nil
 
 	s.SetVersion(rType, s.recalculateVersion(rType))
 
@@ -152,6 +152,42 @@ func TestSnapshot_SetVersion(t *testing.T) {
 	}
 }
 
+func TestSnapshot_Consistent(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot xdss.Snapshot
+		wantErr  string
+	}{
+		{
+			name: "Consistent snapshot",
+			snapshot: NewSnapshot().
+				SetResources(envoy.Cluster, []envoy.Resource{&envoy_config_cluster_v3.Cluster{
+					Name:                 "cluster",
+					ClusterDiscoveryType: &envoy_config_cluster_v3.Cluster_Type{Type: envoy_config_cluster_v3.Cluster_EDS},
+				}}).
+				SetResources(envoy.Endpoint, []envoy.Resource{&envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: "cluster"}}),
+			wantErr: "",
+		},
+		{
+			name: "Cluster references a missing endpoint",
+			snapshot: NewSnapshot().
+				SetResources(envoy.Cluster, []envoy.Resource{&envoy_config_cluster_v3.Cluster{
+					Name:                 "cluster",
+					ClusterDiscoveryType: &envoy_config_cluster_v3.Cluster_Type{Type: envoy_config_cluster_v3.Cluster_EDS},
+				}}),
+			wantErr: `dangling references to missing resources: endpoint "cluster"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.snapshot.Consistent()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("Snapshot.Consistent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func Test_v3CacheResources(t *testing.T) {
 	type args struct {
 		rType envoy.Type
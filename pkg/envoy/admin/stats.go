@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	statsEndpoint string = "/stats"
+)
+
+// GetCounters retrieves from the Envoy admin API listening at the given address the
+// stats whose name matches the given regular expression. Stats without an integer
+// value, like histograms, are ignored.
+func GetCounters(ctx context.Context, client *http.Client, address string, filter *regexp.Regexp) (map[string]uint64, error) {
+
+	u := url.URL{Scheme: "http", Host: address, Path: statsEndpoint, RawQuery: url.Values{"filter": {filter.String()}}.Encode()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d retrieving stats from %s", resp.StatusCode, address)
+	}
+
+	return parseCounters(resp.Body, filter)
+}
+
+// parseCounters parses stats in the plain text format of the Envoy admin API,
+// one "<name>: <value>" pair per line
+func parseCounters(stats io.Reader, filter *regexp.Regexp) (map[string]uint64, error) {
+	counters := map[string]uint64{}
+
+	scanner := bufio.NewScanner(stats)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok || !filter.MatchString(name) {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[name] = v
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestGetCounters(t *testing.T) {
+	stats := `cluster.backend.upstream_rq_5xx: 7
+cluster.backend.upstream_rq_2xx: 100
+cluster.backend.upstream_rq_time: P0(nan,1.0) P25(nan,1.05)
+http.ingress.downstream_rq_5xx: 3
+`
+	var gotFilter string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		gotFilter = r.URL.Query().Get("filter")
+		w.Write([]byte(stats))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	tests := []struct {
+		name    string
+		address string
+		filter  *regexp.Regexp
+		want    map[string]uint64
+		wantErr bool
+	}{
+		{
+			name:    "Returns the matching counters",
+			address: u.Host,
+			filter:  regexp.MustCompile(`^(cluster\..*\.upstream_rq_5xx|http\..*\.downstream_rq_5xx)$`),
+			want: map[string]uint64{
+				"cluster.backend.upstream_rq_5xx": 7,
+				"http.ingress.downstream_rq_5xx":  3,
+			},
+		},
+		{
+			name:    "Ignores stats without an integer value",
+			address: u.Host,
+			filter:  regexp.MustCompile(`^cluster\.backend\..*$`),
+			want: map[string]uint64{
+				"cluster.backend.upstream_rq_5xx": 7,
+				"cluster.backend.upstream_rq_2xx": 100,
+			},
+		},
+		{
+			name:    "Fails if the admin API is unreachable",
+			address: "127.0.0.1:1",
+			filter:  regexp.MustCompile(`.*`),
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetCounters(context.TODO(), server.Client(), tt.address, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCounters() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("GetCounters() = %v", diff)
+			}
+			if !tt.wantErr && gotFilter != tt.filter.String() {
+				t.Errorf("GetCounters() filter = %v, want %v", gotFilter, tt.filter.String())
+			}
+		})
+	}
+}
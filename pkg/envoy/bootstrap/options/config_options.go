@@ -13,6 +13,7 @@ type ConfigOptions struct {
 	XdsPort                     uint32
 	XdsClientCertificatePath    string
 	XdsClientCertificateKeyPath string
+	XdsDelta                    bool
 	SdsConfigSourcePath         string
 	RtdsLayerResourceName       string
 	AdminAddress                string
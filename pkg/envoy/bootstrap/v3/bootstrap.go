@@ -34,6 +34,13 @@ func (c *Config) getAdminAccessLogPath() string {
 	return stringOrDefault(c.Options.AdminAccessLogPath, "/dev/null")
 }
 
+func (c *Config) getAdsApiType() envoy_config_core_v3.ApiConfigSource_ApiType {
+	if c.Options.XdsDelta {
+		return envoy_config_core_v3.ApiConfigSource_DELTA_GRPC
+	}
+	return envoy_config_core_v3.ApiConfigSource_GRPC
+}
+
 // GenerateStatic returns the json serialized representation of an envoy
 // bootstrap object that can be passed as the configuration file to an envoy proxy
 // so it can connect to the discovery service.
@@ -103,7 +110,7 @@ func (c *Config) GenerateStatic() (string, error) {
 		},
 		DynamicResources: &envoy_config_bootstrap_v3.Bootstrap_DynamicResources{
 			AdsConfig: &envoy_config_core_v3.ApiConfigSource{
-				ApiType:             envoy_config_core_v3.ApiConfigSource_GRPC,
+				ApiType:             c.getAdsApiType(),
 				TransportApiVersion: envoy_config_core_v3.ApiVersion_V3,
 				GrpcServices: []*envoy_config_core_v3.GrpcService{
 					{
@@ -37,6 +37,7 @@ type ContainerConfig struct {
 	InitManagerImage string
 	XdssHost         string
 	XdssPort         int
+	XdssDelta        bool
 	APIVersion       string
 
 	// Shutdown manager container configuration
@@ -217,19 +218,25 @@ func (cc *ContainerConfig) InitContainers() []corev1.Container {
 				},
 			},
 		},
-		Args: []string{
-			"init-manager",
-			"--admin-access-log-path", cc.AdminAccessLogPath,
-			"--admin-bind-address", fmt.Sprintf("%s:%d", cc.AdminBindAddress, cc.AdminPort),
-			"--api-version", cc.APIVersion,
-			"--client-certificate-path", cc.TLSBasePath,
-			"--config-file", fmt.Sprintf("%s/%s", cc.ConfigBasePath, cc.ConfigFileName),
-			"--resources-path", cc.ConfigBasePath,
-			"--rtds-resource-name", defaults.InitMgrRtdsLayerResourceName,
-			"--xdss-host", cc.XdssHost,
-			"--xdss-port", fmt.Sprintf("%d", cc.XdssPort),
-			"--envoy-image", cc.Image,
-		},
+		Args: func() []string {
+			args := []string{
+				"init-manager",
+				"--admin-access-log-path", cc.AdminAccessLogPath,
+				"--admin-bind-address", fmt.Sprintf("%s:%d", cc.AdminBindAddress, cc.AdminPort),
+				"--api-version", cc.APIVersion,
+				"--client-certificate-path", cc.TLSBasePath,
+				"--config-file", fmt.Sprintf("%s/%s", cc.ConfigBasePath, cc.ConfigFileName),
+				"--resources-path", cc.ConfigBasePath,
+				"--rtds-resource-name", defaults.InitMgrRtdsLayerResourceName,
+				"--xdss-host", cc.XdssHost,
+				"--xdss-port", fmt.Sprintf("%d", cc.XdssPort),
+				"--envoy-image", cc.Image,
+			}
+			if cc.XdssDelta {
+				args = append(args, "--xdss-delta")
+			}
+			return args
+		}(),
 		VolumeMounts: []corev1.VolumeMount{
 			{
 				Name:      cc.ConfigVolume,
@@ -13,6 +13,7 @@ type Generator interface {
 	NewValidationContextSecret(string, string) envoy.Resource
 	NewSecretFromPath(string, string, string) envoy.Resource
 	NewClusterLoadAssignment(string, ...envoy.UpstreamHost) envoy.Resource
+	NewRuntime(string, map[string]string) envoy.Resource
 }
 
 // NewGenerator returns a generator struct for the given API version
@@ -0,0 +1,44 @@
+package envoy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_resources_v3 "github.com/3scale-ops/marin3r/pkg/envoy/resources/v3"
+)
+
+// DanglingReferencesError is returned when some resources reference
+// other resources that do not exist
+type DanglingReferencesError struct {
+	// References holds, for each resource type, the names
+	// of the resources that are referenced but missing
+	References map[envoy.Type][]string
+}
+
+func (e *DanglingReferencesError) Error() string {
+	rTypes := make([]string, 0, len(e.References))
+	for rType := range e.References {
+		rTypes = append(rTypes, string(rType))
+	}
+	sort.Strings(rTypes)
+
+	refs := []string{}
+	for _, rType := range rTypes {
+		for _, name := range e.References[envoy.Type(rType)] {
+			refs = append(refs, fmt.Sprintf("%s %q", rType, name))
+		}
+	}
+	return fmt.Sprintf("dangling references to missing resources: %s", strings.Join(refs, ", "))
+}
+
+// CheckReferences returns a DanglingReferencesError if any of the given resources references,
+// by name, a resource that is not within the given ones. Envoy keeps waiting for the missing
+// resources forever, so the listeners and clusters that reference them never get warmed.
+func CheckReferences(resources map[envoy.Type][]envoy.Resource, version envoy.APIVersion) error {
+	if dangling := envoy_resources_v3.DanglingReferences(resources); len(dangling) > 0 {
+		return &DanglingReferencesError{References: dangling}
+	}
+	return nil
+}
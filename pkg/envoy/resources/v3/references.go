@@ -0,0 +1,56 @@
+package envoy
+
+import (
+	"sort"
+
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	cache_types "github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+)
+
+// DanglingReferences returns, for each resource type, the names of the resources that are
+// referenced by other resources but are missing from the given ones, sorted by name. The
+// references checked are the ones that Envoy requests by name: the ClusterLoadAssignments of
+// EDS clusters and the RouteConfigurations of RDS listeners and scoped routes. Resources
+// that are not referenced by any other resource are not considered an inconsistency.
+func DanglingReferences(resources map[envoy.Type][]envoy.Resource) map[envoy.Type][]string {
+
+	items := map[string]cache_types.ResourceWithTTL{}
+	names := map[string]map[string]bool{}
+	for rType, list := range resources {
+		typeURL := Mappings()[rType]
+		names[typeURL] = map[string]bool{}
+		for _, res := range list {
+			name := cache_v3.GetResourceName(res)
+			names[typeURL][name] = true
+			items[typeURL+"/"+name] = cache_types.ResourceWithTTL{Resource: res}
+		}
+	}
+
+	dangling := map[envoy.Type][]string{}
+	for typeURL, refs := range cache_v3.GetResourceReferences(items) {
+		for name := range refs {
+			// empty names are a validation error of the referencing
+			// resource, not a reference to a missing resource
+			if name == "" || names[typeURL][name] {
+				continue
+			}
+			rType := typeFromURL(typeURL)
+			dangling[rType] = append(dangling[rType], name)
+		}
+	}
+	for rType := range dangling {
+		sort.Strings(dangling[rType])
+	}
+
+	return dangling
+}
+
+func typeFromURL(typeURL string) envoy.Type {
+	for rType, url := range Mappings() {
+		if url == typeURL {
+			return rType
+		}
+	}
+	return envoy.Type(typeURL)
+}
@@ -0,0 +1,83 @@
+package envoy
+
+import (
+	"reflect"
+	"testing"
+
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	http_connection_manager_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func testEDSCluster(name string) envoy.Resource {
+	return &envoy_config_cluster_v3.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &envoy_config_cluster_v3.Cluster_Type{Type: envoy_config_cluster_v3.Cluster_EDS},
+	}
+}
+
+func testRDSListener(name, routeConfigName string) envoy.Resource {
+	hcm, _ := anypb.New(&http_connection_manager_v3.HttpConnectionManager{
+		RouteSpecifier: &http_connection_manager_v3.HttpConnectionManager_Rds{
+			Rds: &http_connection_manager_v3.Rds{RouteConfigName: routeConfigName},
+		},
+	})
+	return &envoy_config_listener_v3.Listener{
+		Name: name,
+		FilterChains: []*envoy_config_listener_v3.FilterChain{{
+			Filters: []*envoy_config_listener_v3.Filter{{
+				Name:       "envoy.filters.network.http_connection_manager",
+				ConfigType: &envoy_config_listener_v3.Filter_TypedConfig{TypedConfig: hcm},
+			}},
+		}},
+	}
+}
+
+func TestDanglingReferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources map[envoy.Type][]envoy.Resource
+		want      map[envoy.Type][]string
+	}{
+		{
+			name: "No dangling references",
+			resources: map[envoy.Type][]envoy.Resource{
+				envoy.Cluster:  {testEDSCluster("cluster")},
+				envoy.Endpoint: {&envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: "cluster"}},
+				envoy.Listener: {testRDSListener("listener", "route")},
+				envoy.Route:    {&envoy_config_route_v3.RouteConfiguration{Name: "route"}},
+			},
+			want: map[envoy.Type][]string{},
+		},
+		{
+			name: "Unreferenced resources are allowed",
+			resources: map[envoy.Type][]envoy.Resource{
+				envoy.Endpoint: {&envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: "cluster"}},
+				envoy.Route:    {&envoy_config_route_v3.RouteConfiguration{Name: "route"}},
+			},
+			want: map[envoy.Type][]string{},
+		},
+		{
+			name: "Returns the missing endpoints and routes",
+			resources: map[envoy.Type][]envoy.Resource{
+				envoy.Cluster:  {testEDSCluster("cluster2"), testEDSCluster("cluster1")},
+				envoy.Listener: {testRDSListener("listener", "route")},
+			},
+			want: map[envoy.Type][]string{
+				envoy.Endpoint: {"cluster1", "cluster2"},
+				envoy.Route:    {"route"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DanglingReferences(tt.resources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DanglingReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
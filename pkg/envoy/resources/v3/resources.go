@@ -1,6 +1,10 @@
 package envoy
 
 import (
+	"math"
+	"strconv"
+	"strings"
+
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -9,6 +13,8 @@ import (
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	envoy_service_runtime_v3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Generator returns a strcut that implements the envoy_resources.Generator
@@ -122,6 +128,76 @@ func (g Generator) NewClusterLoadAssignment(clusterName string, hosts ...envoy.U
 	}
 }
 
+// NewRuntime returns a runtime layer with the given name holding the given
+// values, each one of them typed as described in RuntimeValue
+func (g Generator) NewRuntime(name string, values map[string]string) envoy.Resource {
+	fields := make(map[string]*structpb.Value, len(values))
+	for key, value := range values {
+		fields[key] = RuntimeValue(value)
+	}
+
+	return &envoy_service_runtime_v3.Runtime{
+		Name:  name,
+		Layer: &structpb.Struct{Fields: fields},
+	}
+}
+
+// RuntimeValue returns the runtime value for the given string, typed so Envoy can use it
+// as a feature flag, a numeric setting or a fractional percent: "true" and "false" are
+// booleans, numbers are numbers and percentages, like "12.5%", are fractional percents
+// with the smallest denominator that represents them exactly. Anything else is a string.
+func RuntimeValue(value string) *structpb.Value {
+	switch value {
+	case "true":
+		return structpb.NewBoolValue(true)
+	case "false":
+		return structpb.NewBoolValue(false)
+	}
+
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		if fp := fractionalPercent(percent); fp != nil {
+			return structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+				"numerator":   structpb.NewNumberValue(float64(fp.GetNumerator())),
+				"denominator": structpb.NewStringValue(fp.GetDenominator().String()),
+			}})
+		}
+	}
+
+	if n, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+		return structpb.NewNumberValue(n)
+	}
+
+	return structpb.NewStringValue(value)
+}
+
+// fractionalPercent returns the fractional percent for a percentage between 0 and 100 with
+// up to 4 decimals, like "12.5", or nil if the percentage can't be represented exactly
+func fractionalPercent(percent string) *envoy_type_v3.FractionalPercent {
+	integer, decimals, _ := strings.Cut(percent, ".")
+	if integer == "" || strings.Trim(integer+decimals, "0123456789") != "" {
+		return nil
+	}
+
+	var denominator envoy_type_v3.FractionalPercent_DenominatorType
+	var digits int
+	switch {
+	case decimals == "":
+		denominator, digits = envoy_type_v3.FractionalPercent_HUNDRED, 0
+	case len(decimals) <= 2:
+		denominator, digits = envoy_type_v3.FractionalPercent_TEN_THOUSAND, 2
+	case len(decimals) <= 4:
+		denominator, digits = envoy_type_v3.FractionalPercent_MILLION, 4
+	default:
+		return nil
+	}
+
+	numerator, err := strconv.ParseUint(integer+decimals+strings.Repeat("0", digits-len(decimals)), 10, 32)
+	if err != nil || numerator > 100*uint64(math.Pow10(digits)) {
+		return nil
+	}
+	return &envoy_type_v3.FractionalPercent{Numerator: uint32(numerator), Denominator: denominator}
+}
+
 func LbEndpoint(host envoy.UpstreamHost) envoy.Resource {
 	return &envoy_config_endpoint_v3.LbEndpoint{
 		HostIdentifier: &envoy_config_endpoint_v3.LbEndpoint_Endpoint{
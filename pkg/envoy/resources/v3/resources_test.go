@@ -19,7 +19,9 @@ import (
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoy_service_runtime_v3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func TestSecretGenerator_New(t *testing.T) {
@@ -66,3 +68,60 @@ func TestSecretGenerator_New(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerator_NewRuntime(t *testing.T) {
+	got := Generator{}.NewRuntime("runtime", map[string]string{
+		"envoy.reloadable_features.flag":   "true",
+		"upstream.healthy_panic_threshold": "25",
+		"feature.enabled":                  "12.5%",
+		"feature.name":                     "canary",
+	})
+	want := &envoy_service_runtime_v3.Runtime{
+		Name: "runtime",
+		Layer: &structpb.Struct{Fields: map[string]*structpb.Value{
+			"envoy.reloadable_features.flag":   structpb.NewBoolValue(true),
+			"upstream.healthy_panic_threshold": structpb.NewNumberValue(25),
+			"feature.enabled": structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+				"numerator":   structpb.NewNumberValue(1250),
+				"denominator": structpb.NewStringValue("TEN_THOUSAND"),
+			}}),
+			"feature.name": structpb.NewStringValue("canary"),
+		}},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Generator.NewRuntime() = %v, want %v", got, want)
+	}
+}
+
+func TestRuntimeValue(t *testing.T) {
+	percent := func(numerator float64, denominator string) *structpb.Value {
+		return structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"numerator":   structpb.NewNumberValue(numerator),
+			"denominator": structpb.NewStringValue(denominator),
+		}})
+	}
+	tests := []struct {
+		name  string
+		value string
+		want  *structpb.Value
+	}{
+		{"Booleans", "false", structpb.NewBoolValue(false)},
+		{"Integers", "100", structpb.NewNumberValue(100)},
+		{"Decimals", "0.75", structpb.NewNumberValue(0.75)},
+		{"Integer percentages", "5%", percent(5, "HUNDRED")},
+		{"Percentages with 2 decimals", "0.01%", percent(1, "TEN_THOUSAND")},
+		{"Percentages with 4 decimals", "99.995%", percent(999950, "MILLION")},
+		{"Percentages with too many decimals are strings", "0.00001%", structpb.NewStringValue("0.00001%")},
+		{"Percentages over 100 are strings", "101%", structpb.NewStringValue("101%")},
+		{"Negative percentages are strings", "-1%", structpb.NewStringValue("-1%")},
+		{"Not a number", "NaN", structpb.NewStringValue("NaN")},
+		{"Strings", "True", structpb.NewStringValue("True")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RuntimeValue(tt.value); !proto.Equal(got, tt.want) {
+				t.Errorf("RuntimeValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
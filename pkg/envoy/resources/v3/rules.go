@@ -0,0 +1,291 @@
+package envoy
+
+import (
+	"fmt"
+	"net"
+
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	http_connection_manager_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	cache_v3 "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// DeclaredResource is a decoded resource along with the
+// field path where it is declared
+type DeclaredResource struct {
+	Type     envoy.Type
+	Path     *field.Path
+	Resource envoy.Resource
+}
+
+// Rule is a semantic validation rule that runs over the whole set of resources of a config.
+// Errors are problems that would make Envoy reject or never use the config, while warnings
+// are likely problems that don't necessarily break it.
+type Rule interface {
+	Validate(resources []DeclaredResource) (field.ErrorList, []string)
+}
+
+// RuleFunc is an adapter to use ordinary functions as Rules
+type RuleFunc func(resources []DeclaredResource) (field.ErrorList, []string)
+
+// Validate implements Rule
+func (f RuleFunc) Validate(resources []DeclaredResource) (field.ErrorList, []string) {
+	return f(resources)
+}
+
+// DefaultRules is the list of rules run by ValidateRules when no other rules are given
+var DefaultRules = []Rule{
+	RuleFunc(UniqueNames),
+	RuleFunc(UniqueListenerAddresses),
+	RuleFunc(RouteClustersExist),
+	RuleFunc(EDSEndpointsExist),
+	RuleFunc(RDSRoutesExist),
+}
+
+// ValidateRules runs the given rules, or the DefaultRules if none are
+// given, and returns all the errors and warnings found
+func ValidateRules(resources []DeclaredResource, rules ...Rule) (field.ErrorList, []string) {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+
+	errs := field.ErrorList{}
+	warnings := []string{}
+	for _, rule := range rules {
+		e, w := rule.Validate(resources)
+		errs = append(errs, e...)
+		warnings = append(warnings, w...)
+	}
+	return errs, warnings
+}
+
+// AsWarnings returns a Rule that reports the errors of the given rule as warnings, for the
+// sets of resources that can be completed with other resources not known at validation time
+func AsWarnings(rule Rule) Rule {
+	return RuleFunc(func(resources []DeclaredResource) (field.ErrorList, []string) {
+		errs, warnings := rule.Validate(resources)
+		for _, err := range errs {
+			warnings = append(warnings, err.Error())
+		}
+		return nil, warnings
+	})
+}
+
+// UniqueNames rejects resources that share the same name with other resources of the same
+// type, as only one of them would be sent to the Envoy clients
+func UniqueNames(resources []DeclaredResource) (field.ErrorList, []string) {
+	errs := field.ErrorList{}
+	seen := map[envoy.Type]map[string]bool{}
+	for _, r := range resources {
+		if _, ok := seen[r.Type]; !ok {
+			seen[r.Type] = map[string]bool{}
+		}
+		name := cache_v3.GetResourceName(r.Resource)
+		if seen[r.Type][name] {
+			errs = append(errs, field.Duplicate(r.Path, fmt.Sprintf("%s %q", r.Type, name)))
+		}
+		seen[r.Type][name] = true
+	}
+	return errs, nil
+}
+
+// UniqueListenerAddresses rejects listeners that bind to the same address, port and protocol
+// than another listener. Listeners that bind to the same port and protocol than a listener
+// bound to the wildcard address get a warning, as they would only work if both listeners
+// use the SO_REUSEPORT socket option.
+func UniqueListenerAddresses(resources []DeclaredResource) (field.ErrorList, []string) {
+	errs := field.ErrorList{}
+	warnings := []string{}
+
+	type bind struct {
+		protocol string
+		address  string
+		port     uint32
+	}
+	seen := map[bind]string{}
+	binds := []bind{}
+	for _, r := range resources {
+		l, ok := r.Resource.(*envoy_config_listener_v3.Listener)
+		if !ok || (l.GetBindToPort() != nil && !l.GetBindToPort().GetValue()) {
+			continue
+		}
+		sa := l.GetAddress().GetSocketAddress()
+		if sa == nil {
+			continue
+		}
+		b := bind{protocol: sa.GetProtocol().String(), address: sa.GetAddress(), port: sa.GetPortValue()}
+
+		if other, ok := seen[b]; ok {
+			errs = append(errs, field.Invalid(r.Path, l.GetName(),
+				fmt.Sprintf("listener binds to %s, same as listener %q", net.JoinHostPort(b.address, fmt.Sprint(b.port)), other)))
+			continue
+		}
+		for _, prev := range binds {
+			if prev.protocol == b.protocol && prev.port == b.port && (isWildcard(prev.address) || isWildcard(b.address)) {
+				warnings = append(warnings, fmt.Sprintf("%s: listener %q binds to %s, which overlaps with listener %q",
+					r.Path, l.GetName(), net.JoinHostPort(b.address, fmt.Sprint(b.port)), seen[prev]))
+			}
+		}
+		seen[b] = l.GetName()
+		binds = append(binds, b)
+	}
+	return errs, warnings
+}
+
+func isWildcard(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// RouteClustersExist warns about routes that point to clusters that are not declared. This
+// is not an error, as the clusters could be declared in the Envoy bootstrap config.
+func RouteClustersExist(resources []DeclaredResource) (field.ErrorList, []string) {
+	warnings := []string{}
+
+	clusters := names(resources, envoy.Cluster)
+	for _, r := range resources {
+		var routeConfigs []*envoy_config_route_v3.RouteConfiguration
+		switch o := r.Resource.(type) {
+		case *envoy_config_route_v3.RouteConfiguration:
+			routeConfigs = append(routeConfigs, o)
+		case *envoy_config_listener_v3.Listener:
+			for _, hcm := range httpConnectionManagers(o) {
+				if rc := hcm.GetRouteConfig(); rc != nil {
+					routeConfigs = append(routeConfigs, rc)
+				}
+			}
+		default:
+			continue
+		}
+
+		for _, rc := range routeConfigs {
+			for _, cluster := range routeClusters(rc) {
+				if !clusters[cluster] {
+					warnings = append(warnings, fmt.Sprintf("%s: route configuration %q references cluster %q, which is not declared",
+						r.Path, rc.GetName(), cluster))
+				}
+			}
+		}
+	}
+	return nil, warnings
+}
+
+// EDSEndpointsExist rejects EDS clusters whose endpoints are not declared, as Envoy would wait
+// for them forever. Endpoints that are not used by any EDS cluster get a warning.
+func EDSEndpointsExist(resources []DeclaredResource) (field.ErrorList, []string) {
+	errs := field.ErrorList{}
+	warnings := []string{}
+
+	endpoints := names(resources, envoy.Endpoint)
+	used := map[string]bool{}
+	for _, r := range resources {
+		c, ok := r.Resource.(*envoy_config_cluster_v3.Cluster)
+		if !ok || c.GetType() != envoy_config_cluster_v3.Cluster_EDS {
+			continue
+		}
+		name := c.GetEdsClusterConfig().GetServiceName()
+		if name == "" {
+			name = c.GetName()
+		}
+		used[name] = true
+		if !endpoints[name] {
+			errs = append(errs, field.NotFound(r.Path, fmt.Sprintf("%s %q", envoy.Endpoint, name)))
+		}
+	}
+
+	for _, r := range resources {
+		if r.Type != envoy.Endpoint {
+			continue
+		}
+		if name := cache_v3.GetResourceName(r.Resource); !used[name] {
+			warnings = append(warnings, fmt.Sprintf("%s: endpoint %q is not used by any EDS cluster", r.Path, name))
+		}
+	}
+	return errs, warnings
+}
+
+// RDSRoutesExist rejects listeners and scoped routes that reference route
+// configurations that are not declared, as Envoy would wait for them forever
+func RDSRoutesExist(resources []DeclaredResource) (field.ErrorList, []string) {
+	errs := field.ErrorList{}
+
+	routes := names(resources, envoy.Route)
+	for _, r := range resources {
+		refs := []string{}
+		switch o := r.Resource.(type) {
+		case *envoy_config_listener_v3.Listener:
+			for _, hcm := range httpConnectionManagers(o) {
+				if name := hcm.GetRds().GetRouteConfigName(); name != "" {
+					refs = append(refs, name)
+				}
+			}
+		case *envoy_config_route_v3.ScopedRouteConfiguration:
+			if name := o.GetRouteConfigurationName(); name != "" {
+				refs = append(refs, name)
+			}
+		}
+
+		for _, name := range refs {
+			if !routes[name] {
+				errs = append(errs, field.NotFound(r.Path, fmt.Sprintf("%s %q", envoy.Route, name)))
+			}
+		}
+	}
+	return errs, nil
+}
+
+// names returns the names of the resources of the given type
+func names(resources []DeclaredResource, rType envoy.Type) map[string]bool {
+	m := map[string]bool{}
+	for _, r := range resources {
+		if r.Type == rType {
+			m[cache_v3.GetResourceName(r.Resource)] = true
+		}
+	}
+	return m
+}
+
+// httpConnectionManagers returns the http connection managers
+// configured in the filter chains of a listener
+func httpConnectionManagers(l *envoy_config_listener_v3.Listener) []*http_connection_manager_v3.HttpConnectionManager {
+	chains := append([]*envoy_config_listener_v3.FilterChain{}, l.GetFilterChains()...)
+	if l.GetDefaultFilterChain() != nil {
+		chains = append(chains, l.GetDefaultFilterChain())
+	}
+
+	list := []*http_connection_manager_v3.HttpConnectionManager{}
+	for _, chain := range chains {
+		for _, filter := range chain.GetFilters() {
+			hcm := &http_connection_manager_v3.HttpConnectionManager{}
+			if tc := filter.GetTypedConfig(); tc != nil && tc.MessageIs(hcm) && tc.UnmarshalTo(hcm) == nil {
+				list = append(list, hcm)
+			}
+		}
+	}
+	return list
+}
+
+// routeClusters returns the names of the clusters the routes of a route configuration point to
+func routeClusters(rc *envoy_config_route_v3.RouteConfiguration) []string {
+	list := []string{}
+	for _, vh := range rc.GetVirtualHosts() {
+		for _, route := range vh.GetRoutes() {
+			action := route.GetRoute()
+			if action == nil {
+				continue
+			}
+			if name := action.GetCluster(); name != "" {
+				list = append(list, name)
+			}
+			for _, wc := range action.GetWeightedClusters().GetClusters() {
+				if wc.GetName() != "" {
+					list = append(list, wc.GetName())
+				}
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,170 @@
+package envoy
+
+import (
+	"testing"
+
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func testDeclared(rType envoy.Type, idx int, res envoy.Resource) DeclaredResource {
+	return DeclaredResource{Type: rType, Path: field.NewPath("spec", "resources").Index(idx).Child("value"), Resource: res}
+}
+
+func testListener(name, address string, port uint32) envoy.Resource {
+	return &envoy_config_listener_v3.Listener{
+		Name: name,
+		Address: &envoy_config_core_v3.Address{
+			Address: &envoy_config_core_v3.Address_SocketAddress{
+				SocketAddress: &envoy_config_core_v3.SocketAddress{
+					Address:       address,
+					PortSpecifier: &envoy_config_core_v3.SocketAddress_PortValue{PortValue: port},
+				},
+			},
+		},
+	}
+}
+
+func testRouteConfiguration(name string, clusters ...string) envoy.Resource {
+	routes := []*envoy_config_route_v3.Route{}
+	for _, cluster := range clusters {
+		routes = append(routes, &envoy_config_route_v3.Route{
+			Action: &envoy_config_route_v3.Route_Route{
+				Route: &envoy_config_route_v3.RouteAction{
+					ClusterSpecifier: &envoy_config_route_v3.RouteAction_Cluster{Cluster: cluster},
+				},
+			},
+		})
+	}
+	return &envoy_config_route_v3.RouteConfiguration{
+		Name:         name,
+		VirtualHosts: []*envoy_config_route_v3.VirtualHost{{Name: "vh", Routes: routes}},
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		resources    []DeclaredResource
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{
+			name: "Consistent set of resources",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Endpoint, 0, &envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: "cluster"}),
+				testDeclared(envoy.Cluster, 1, testEDSCluster("cluster")),
+				testDeclared(envoy.Route, 2, testRouteConfiguration("route", "cluster")),
+				testDeclared(envoy.Listener, 3, testRDSListener("listener", "route")),
+			},
+			wantErrs:     []string{},
+			wantWarnings: []string{},
+		},
+		{
+			name: "Duplicate names",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Cluster, 0, &envoy_config_cluster_v3.Cluster{Name: "cluster"}),
+				testDeclared(envoy.Cluster, 1, &envoy_config_cluster_v3.Cluster{Name: "cluster"}),
+				testDeclared(envoy.Route, 2, &envoy_config_route_v3.RouteConfiguration{Name: "cluster"}),
+			},
+			wantErrs:     []string{`spec.resources[1].value: Duplicate value: "cluster \"cluster\""`},
+			wantWarnings: []string{},
+		},
+		{
+			name: "Listeners bound to the same address",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Listener, 0, testListener("a", "0.0.0.0", 8080)),
+				testDeclared(envoy.Listener, 1, testListener("b", "0.0.0.0", 8080)),
+				testDeclared(envoy.Listener, 2, testListener("c", "0.0.0.0", 8081)),
+			},
+			wantErrs:     []string{`spec.resources[1].value: Invalid value: "b": listener binds to 0.0.0.0:8080, same as listener "a"`},
+			wantWarnings: []string{},
+		},
+		{
+			name: "Listener overlaps with a wildcard listener",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Listener, 0, testListener("a", "0.0.0.0", 8080)),
+				testDeclared(envoy.Listener, 1, testListener("b", "127.0.0.1", 8080)),
+			},
+			wantErrs:     []string{},
+			wantWarnings: []string{`spec.resources[1].value: listener "b" binds to 127.0.0.1:8080, which overlaps with listener "a"`},
+		},
+		{
+			name: "Route points to a missing cluster",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Route, 0, testRouteConfiguration("route", "missing")),
+			},
+			wantErrs:     []string{},
+			wantWarnings: []string{`spec.resources[0].value: route configuration "route" references cluster "missing", which is not declared`},
+		},
+		{
+			name: "EDS cluster without endpoint and unused endpoint",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Cluster, 0, testEDSCluster("cluster")),
+				testDeclared(envoy.Endpoint, 1, &envoy_config_endpoint_v3.ClusterLoadAssignment{ClusterName: "other"}),
+			},
+			wantErrs:     []string{`spec.resources[0].value: Not found: "endpoint \"cluster\""`},
+			wantWarnings: []string{`spec.resources[1].value: endpoint "other" is not used by any EDS cluster`},
+		},
+		{
+			name: "Listener and scoped route reference a missing route",
+			resources: []DeclaredResource{
+				testDeclared(envoy.Listener, 0, testRDSListener("listener", "route")),
+				testDeclared(envoy.ScopedRoute, 1, &envoy_config_route_v3.ScopedRouteConfiguration{Name: "scope", RouteConfigurationName: "route"}),
+			},
+			wantErrs: []string{
+				`spec.resources[0].value: Not found: "route \"route\""`,
+				`spec.resources[1].value: Not found: "route \"route\""`,
+			},
+			wantWarnings: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, warnings := ValidateRules(tt.resources)
+			gotErrs := []string{}
+			for _, err := range errs {
+				gotErrs = append(gotErrs, err.Error())
+			}
+			if diff := deep.Equal(gotErrs, tt.wantErrs); len(diff) > 0 {
+				t.Errorf("ValidateRules() errs = %v", diff)
+			}
+			if diff := deep.Equal(warnings, tt.wantWarnings); len(diff) > 0 {
+				t.Errorf("ValidateRules() warnings = %v", diff)
+			}
+		})
+	}
+}
+
+func TestValidateRules_custom(t *testing.T) {
+	called := false
+	rule := RuleFunc(func(resources []DeclaredResource) (field.ErrorList, []string) {
+		called = true
+		return nil, []string{"warning"}
+	})
+
+	_, warnings := ValidateRules(nil, rule)
+	if !called || len(warnings) != 1 {
+		t.Errorf("ValidateRules() did not run the given rule instead of the default ones")
+	}
+}
+
+func TestAsWarnings(t *testing.T) {
+	rule := RuleFunc(func(resources []DeclaredResource) (field.ErrorList, []string) {
+		return field.ErrorList{field.NotFound(field.NewPath("spec"), "route")}, []string{"warning"}
+	})
+
+	errs, warnings := ValidateRules(nil, AsWarnings(rule))
+	if len(errs) != 0 {
+		t.Errorf("AsWarnings() errs = %v", errs)
+	}
+	if diff := deep.Equal(warnings, []string{"warning", `spec: Not found: "route"`}); len(diff) > 0 {
+		t.Errorf("AsWarnings() warnings = %v", diff)
+	}
+}
@@ -1,11 +1,22 @@
 package envoy
 
 import (
+	"errors"
+	"regexp"
+	"strconv"
+	"unicode"
+
 	"github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
-func Validate(resource string, encoding envoy_serializer.Serialization, version envoy.APIVersion, rType envoy.Type) error {
+// Validate checks that the resource can be decoded into the Envoy type and that it
+// passes the protoc-gen-validate rules of the type. Errors of the validation rules
+// point to the failing field within the given path.
+func Validate(resource string, encoding envoy_serializer.Serialization, version envoy.APIVersion, rType envoy.Type, path *field.Path) error {
 	decoder := envoy_serializer.NewResourceUnmarshaller(encoding, version)
 	generator := NewGenerator(version)
 	res := generator.New(rType)
@@ -13,5 +24,132 @@ func Validate(resource string, encoding envoy_serializer.Serialization, version
 		return err
 	}
 
-	return nil
+	return ValidateAll(res, path).ToAggregate()
+}
+
+// ValidateAll runs the protoc-gen-validate rules of the resource and returns the failing
+// fields within the given path. The rules are also run for the messages packed in Any
+// fields, like the typed configs of the filters, that protoc-gen-validate skips.
+func ValidateAll(res envoy.Resource, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	if v, ok := res.(interface{ ValidateAll() error }); ok {
+		if err := v.ValidateAll(); err != nil {
+			errs = append(errs, pgvFieldErrors(err, path)...)
+		}
+	}
+	errs = append(errs, validateAnyFields(res.ProtoReflect(), path)...)
+
+	return errs
+}
+
+// validateAnyFields looks for Any fields within the message and validates the messages
+// packed in them. Messages of types that are not known are skipped.
+func validateAnyFields(m protoreflect.Message, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fpath := path.Child(string(fd.Name()))
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				errs = append(errs, validateEmbedded(list.Get(i).Message(), fpath.Index(i))...)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				errs = append(errs, validateEmbedded(mv.Message(), fpath.Key(k.String()))...)
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			errs = append(errs, validateEmbedded(v.Message(), fpath)...)
+		}
+		return true
+	})
+
+	return errs
+}
+
+func validateEmbedded(m protoreflect.Message, path *field.Path) field.ErrorList {
+	if a, ok := m.Interface().(*anypb.Any); ok {
+		msg, err := a.UnmarshalNew()
+		if err != nil {
+			return field.ErrorList{}
+		}
+		return ValidateAll(msg, path)
+	}
+	return validateAnyFields(m, path)
+}
+
+// pgvError is the interface implemented by the errors that
+// protoc-gen-validate generates for each message type
+type pgvError interface {
+	Field() string
+	Reason() string
+	Cause() error
+}
+
+// pgvMultiError is the interface implemented by the errors that
+// protoc-gen-validate ValidateAll methods return
+type pgvMultiError interface {
+	AllErrors() []error
+}
+
+var pgvIndexedField = regexp.MustCompile(`^(\w+)\[(.*)\]$`)
+
+// pgvFieldErrors converts the errors returned by protoc-gen-validate into field
+// errors, following the causes of the errors of the embedded messages
+func pgvFieldErrors(err error, path *field.Path) field.ErrorList {
+	var multi pgvMultiError
+	if errors.As(err, &multi) {
+		errs := field.ErrorList{}
+		for _, e := range multi.AllErrors() {
+			errs = append(errs, pgvFieldErrors(e, path)...)
+		}
+		return errs
+	}
+
+	var pgv pgvError
+	if !errors.As(err, &pgv) {
+		return field.ErrorList{field.Invalid(path, field.OmitValueType{}, err.Error())}
+	}
+
+	fpath := pgvFieldPath(pgv.Field(), path)
+	if cause := pgv.Cause(); cause != nil {
+		var causeMulti pgvMultiError
+		var causePGV pgvError
+		if errors.As(cause, &causeMulti) || errors.As(cause, &causePGV) {
+			return pgvFieldErrors(cause, fpath)
+		}
+		return field.ErrorList{field.Invalid(fpath, field.OmitValueType{}, pgv.Reason()+": "+cause.Error())}
+	}
+	return field.ErrorList{field.Invalid(fpath, field.OmitValueType{}, pgv.Reason())}
+}
+
+// pgvFieldPath converts the name of the field reported by protoc-gen-validate, which is the name
+// of the Go struct field with an optional index or key (i.e "FilterChains[0]"), into a child of
+// the given path named after the proto field (i.e "filter_chains[0]")
+func pgvFieldPath(name string, path *field.Path) *field.Path {
+	if m := pgvIndexedField.FindStringSubmatch(name); m != nil {
+		fpath := path.Child(snakeCase(m[1]))
+		if idx, err := strconv.Atoi(m[2]); err == nil {
+			return fpath.Index(idx)
+		}
+		return fpath.Key(m[2])
+	}
+	return path.Child(snakeCase(name))
+}
+
+func snakeCase(s string) string {
+	out := []rune{}
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	return string(out)
 }
@@ -0,0 +1,81 @@
+package envoy
+
+import (
+	"testing"
+
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidate(t *testing.T) {
+	path := field.NewPath("spec", "resources").Index(0).Child("value")
+
+	tests := []struct {
+		name     string
+		resource string
+		rType    envoy.Type
+		want     []string
+	}{
+		{
+			name:     "Valid resource",
+			resource: `{"name": "cluster", "connect_timeout": "1s"}`,
+			rType:    envoy.Cluster,
+			want:     []string{},
+		},
+		{
+			name:     "Fails a rule of a field",
+			resource: `{"name": "cluster", "connect_timeout": "-1s"}`,
+			rType:    envoy.Cluster,
+			want:     []string{"spec.resources[0].value.connect_timeout: Invalid value: value must be greater than 0s"},
+		},
+		{
+			name:     "Fails a rule of a field of an embedded message",
+			resource: `{"name": "route", "virtual_hosts": [{"name": "vh"}]}`,
+			rType:    envoy.Route,
+			want:     []string{"spec.resources[0].value.virtual_hosts[0].domains: Invalid value: value must contain at least 1 item(s)"},
+		},
+		{
+			name: "Fails a rule of a field of a message packed in an Any field",
+			resource: `{"name":"listener","address":{"socket_address":{"address":"0.0.0.0","port_value":8080}},"filter_chains":[{"filters":[{"name":"envoy.filters.network.http_connection_manager",` +
+				`"typed_config":{"@type":"type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager","rds":{"route_config_name":"route","config_source":{"ads":{}}}}}]}]}`,
+			rType: envoy.Listener,
+			want:  []string{"spec.resources[0].value.filter_chains[0].filters[0].typed_config.stat_prefix: Invalid value: value length must be at least 1 runes"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			if err := Validate(tt.resource, envoy_serializer.JSON, envoy.APIv3, tt.rType, path); err != nil {
+				for _, e := range err.(interface{ Errors() []error }).Errors() {
+					got = append(got, e.Error())
+				}
+			}
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("Validate() = %v", diff)
+			}
+		})
+	}
+}
+
+func Test_pgvFieldPath(t *testing.T) {
+	path := field.NewPath("value")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "ConnectTimeout", want: "value.connect_timeout"},
+		{name: "FilterChains[2]", want: "value.filter_chains[2]"},
+		{name: "TypedFilterConfig[envoy.filters.http.router]", want: "value.typed_filter_config[envoy.filters.http.router]"},
+		{name: "Http2ProtocolOptions", want: "value.http2_protocol_options"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pgvFieldPath(tt.name, path).String(); got != tt.want {
+				t.Errorf("pgvFieldPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
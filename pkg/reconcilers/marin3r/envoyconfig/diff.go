@@ -0,0 +1,277 @@
+package reconcilers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// configDiffMaxSize is the maximum size, in bytes, of the lists of resources
+	// of a diff stored in the status. Larger diffs are stored in a ConfigMap.
+	configDiffMaxSize int = 8 * 1024
+	// ConfigDiffConfigMapKey is the key of the ConfigMap data that holds the diff
+	ConfigDiffConfigMapKey string = "diff.json"
+	// ConfigDiffLabelKey is the label of the ConfigMaps that hold the diff
+	// of an EnvoyConfig, set to the name of the EnvoyConfig
+	ConfigDiffLabelKey string = "marin3r.3scale.net/config-diff"
+)
+
+// ConfigDiffConfigMapName returns the name of the ConfigMap that
+// holds the diff of the EnvoyConfig when it is too large for the status
+func ConfigDiffConfigMapName(ec *marin3rv1alpha1.EnvoyConfig) string {
+	return fmt.Sprintf("%s-diff", ec.GetName())
+}
+
+// ReconcileConfigDiff calculates the diff between the published and the desired revisions of the
+// EnvoyConfig and returns it to be stored in the status. Diffs too large to be stored in the status
+// are written to a ConfigMap owned by the EnvoyConfig, which is deleted once no longer needed. A
+// ConfigMap with the same name that was not created for the EnvoyConfig is never modified: an event
+// is emitted and only the versions are reported in the status.
+func ReconcileConfigDiff(ctx context.Context, cl client.Client, s *runtime.Scheme, recorder record.EventRecorder,
+	ec *marin3rv1alpha1.EnvoyConfig, list *marin3rv1alpha1.EnvoyConfigRevisionList,
+	desiredVersion, publishedVersion string) (*marin3rv1alpha1.ConfigDiff, error) {
+
+	published, err := withLoadedResources(ctx, cl, findRevision(list, publishedVersion))
+	if err != nil {
+		return nil, err
+	}
+	desired, err := withLoadedResources(ctx, cl, findRevision(list, desiredVersion))
+	if err != nil {
+		return nil, err
+	}
+	diff := GenerateConfigDiff(published, desired, ec.GetEnvoyAPIVersion())
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &corev1.ConfigMap{}
+	cm.SetName(ConfigDiffConfigMapName(ec))
+	cm.SetNamespace(ec.GetNamespace())
+
+	if diff == nil || len(data) <= configDiffMaxSize {
+		// the ConfigMap is only deleted if the status says it exists to
+		// avoid a call to the API on every reconcile
+		if ec.Status.Diff != nil && ec.Status.Diff.ConfigMapRef != nil {
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(cm), cm); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			} else if err == nil && isConfigDiffOf(cm, ec) {
+				if err := cl.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+					return nil, err
+				}
+			}
+		}
+		return diff, nil
+	}
+
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(cm), cm); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	} else if err == nil && !isConfigDiffOf(cm, ec) {
+		recorder.Eventf(ec, corev1.EventTypeWarning, "ConfigDiffConfigMapConflict",
+			"ConfigMap %s already exists and is not managed by the EnvoyConfig, the diff is not stored", cm.GetName())
+		return &marin3rv1alpha1.ConfigDiff{
+			PublishedVersion: diff.PublishedVersion,
+			DesiredVersion:   diff.DesiredVersion,
+		}, nil
+	}
+
+	if _, err := controllerutil.CreateOrUpdate(ctx, cl, cm, func() error {
+		cm.SetLabels(map[string]string{ConfigDiffLabelKey: ec.GetName()})
+		cm.Data = map[string]string{ConfigDiffConfigMapKey: string(data)}
+		return controllerutil.SetControllerReference(ec, cm, s)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &marin3rv1alpha1.ConfigDiff{
+		PublishedVersion: diff.PublishedVersion,
+		DesiredVersion:   diff.DesiredVersion,
+		ConfigMapRef:     &corev1.LocalObjectReference{Name: cm.GetName()},
+	}, nil
+}
+
+// isConfigDiffOf returns true if the ConfigMap is controlled by the
+// EnvoyConfig and labelled as the one that holds its diff
+func isConfigDiffOf(cm *corev1.ConfigMap, ec *marin3rv1alpha1.EnvoyConfig) bool {
+	return metav1.IsControlledBy(cm, ec) && cm.GetLabels()[ConfigDiffLabelKey] == ec.GetName()
+}
+
+// GenerateConfigDiff returns the resources added, removed and modified in the desired revision with
+// respect to the published revision. Resources are matched by type and name and, for the modified
+// ones, the JSON field paths of the values that differ are returned. It returns nil if any of the
+// revisions is missing or if both are the same revision.
+func GenerateConfigDiff(published, desired *marin3rv1alpha1.EnvoyConfigRevision, version envoy.APIVersion) *marin3rv1alpha1.ConfigDiff {
+
+	if published == nil || desired == nil || published.Spec.Version == desired.Spec.Version {
+		return nil
+	}
+
+	diff := &marin3rv1alpha1.ConfigDiff{
+		PublishedVersion: published.Spec.Version,
+		DesiredVersion:   desired.Spec.Version,
+	}
+
+	from := indexResources(published.Spec.Resources, version)
+	to := indexResources(desired.Spec.Resources, version)
+
+	for _, key := range sortedKeys(to) {
+		if _, ok := from[key]; !ok {
+			diff.Added = append(diff.Added, marin3rv1alpha1.ResourceDiff{Type: key.rType, Name: key.name})
+		}
+	}
+	for _, key := range sortedKeys(from) {
+		value, ok := to[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, marin3rv1alpha1.ResourceDiff{Type: key.rType, Name: key.name})
+			continue
+		}
+		if paths := diffPaths("", from[key], value); len(paths) > 0 {
+			diff.Modified = append(diff.Modified, marin3rv1alpha1.ResourceDiff{Type: key.rType, Name: key.name, Paths: paths})
+		}
+	}
+
+	return diff
+}
+
+// withLoadedResources returns a copy of the revision with its resources in spec.resources,
+// loading them from the shards the revision is stored in, if any
+func withLoadedResources(ctx context.Context, cl client.Client, ecr *marin3rv1alpha1.EnvoyConfigRevision) (*marin3rv1alpha1.EnvoyConfigRevision, error) {
+	if ecr == nil || ecr.Spec.ResourcesFrom == nil {
+		return ecr, nil
+	}
+	resources, err := revisions.LoadResources(ctx, cl, ecr)
+	if err != nil {
+		return nil, err
+	}
+	loaded := ecr.DeepCopy()
+	loaded.Spec.Resources = resources
+	return loaded, nil
+}
+
+// resourceKey identifies a resource within a revision
+type resourceKey struct {
+	rType envoy.Type
+	name  string
+}
+
+// indexResources returns the resources indexed by type and name, each one as a generic JSON
+// value so they can be compared. Resources with a value are compared by their canonical
+// representation. Generated resources are compared by their definition, as their values
+// are only known when the revision is published.
+func indexResources(resources []marin3rv1alpha1.Resource, version envoy.APIVersion) map[resourceKey]interface{} {
+
+	index := map[resourceKey]interface{}{}
+	for idx, res := range resources {
+		canonical, name := res.Canonical(version)
+
+		// resources without a name can't be matched with the ones
+		// of the other revision, so they are identified by position
+		if name == "" {
+			name = fmt.Sprintf("spec.resources[%d]", idx)
+		}
+
+		var data []byte
+		if canonical.Value != nil && canonical.GenerateFromEndpointSlices == nil {
+			data = canonical.Value.Raw
+		} else {
+			data, _ = json.Marshal(canonical)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			value = string(data)
+		}
+		index[resourceKey{rType: res.Type, name: name}] = value
+	}
+
+	return index
+}
+
+// sortedKeys returns the keys of the index sorted by type and name
+func sortedKeys(index map[resourceKey]interface{}) []resourceKey {
+	keys := make([]resourceKey, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].rType != keys[j].rType {
+			return keys[i].rType < keys[j].rType
+		}
+		return keys[i].name < keys[j].name
+	})
+	return keys
+}
+
+// diffPaths returns the JSON field paths, relative to the given path, of the values that differ
+// between two generic JSON values. Lists of different length are reported as a whole.
+func diffPaths(path string, from, to interface{}) []string {
+
+	switch f := from.(type) {
+
+	case map[string]interface{}:
+		t, ok := to.(map[string]interface{})
+		if !ok {
+			return []string{pathOrRoot(path)}
+		}
+		fields := map[string]bool{}
+		for field := range f {
+			fields[field] = true
+		}
+		for field := range t {
+			fields[field] = true
+		}
+		sorted := make([]string, 0, len(fields))
+		for field := range fields {
+			sorted = append(sorted, field)
+		}
+		sort.Strings(sorted)
+
+		paths := []string{}
+		for _, field := range sorted {
+			child := field
+			if path != "" {
+				child = path + "." + field
+			}
+			paths = append(paths, diffPaths(child, f[field], t[field])...)
+		}
+		return paths
+
+	case []interface{}:
+		t, ok := to.([]interface{})
+		if !ok || len(f) != len(t) {
+			return []string{pathOrRoot(path)}
+		}
+		paths := []string{}
+		for idx := range f {
+			paths = append(paths, diffPaths(fmt.Sprintf("%s[%d]", path, idx), f[idx], t[idx])...)
+		}
+		return paths
+
+	default:
+		if !reflect.DeepEqual(from, to) {
+			return []string{pathOrRoot(path)}
+		}
+		return []string{}
+	}
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
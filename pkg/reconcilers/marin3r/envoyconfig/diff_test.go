@@ -0,0 +1,224 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testDiffRevision(version string, resources ...marin3rv1alpha1.Resource) *marin3rv1alpha1.EnvoyConfigRevision {
+	return &marin3rv1alpha1.EnvoyConfigRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecr-" + version, Namespace: "default"},
+		Spec:       marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: version, Resources: resources},
+	}
+}
+
+func testDiffCluster(value string) marin3rv1alpha1.Resource {
+	return marin3rv1alpha1.Resource{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(value)}
+}
+
+func TestGenerateConfigDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		published *marin3rv1alpha1.EnvoyConfigRevision
+		desired   *marin3rv1alpha1.EnvoyConfigRevision
+		want      *marin3rv1alpha1.ConfigDiff
+	}{
+		{
+			name:      "Returns nil for the same revision",
+			published: testDiffRevision("aaaa", testDiffCluster(`{"name": "a"}`)),
+			desired:   testDiffRevision("aaaa", testDiffCluster(`{"name": "a"}`)),
+			want:      nil,
+		},
+		{
+			name:      "Returns nil if the published revision is missing",
+			published: nil,
+			desired:   testDiffRevision("aaaa", testDiffCluster(`{"name": "a"}`)),
+			want:      nil,
+		},
+		{
+			name: "Returns the added, removed and modified resources",
+			published: testDiffRevision("aaaa",
+				testDiffCluster(`{"name": "a", "connectTimeout": "1s", "type": "STRICT_DNS"}`),
+				testDiffCluster(`{"name": "b"}`),
+			),
+			desired: testDiffRevision("bbbb",
+				testDiffCluster(`{"type": "STRICT_DNS", "name": "a", "connect_timeout": "2s"}`),
+				testDiffCluster(`{"name": "c"}`),
+				marin3rv1alpha1.Resource{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("cert")},
+			),
+			want: &marin3rv1alpha1.ConfigDiff{
+				PublishedVersion: "aaaa",
+				DesiredVersion:   "bbbb",
+				Added: []marin3rv1alpha1.ResourceDiff{
+					{Type: envoy.Cluster, Name: "c"},
+					{Type: envoy.Secret, Name: "cert"},
+				},
+				Removed: []marin3rv1alpha1.ResourceDiff{
+					{Type: envoy.Cluster, Name: "b"},
+				},
+				Modified: []marin3rv1alpha1.ResourceDiff{
+					{Type: envoy.Cluster, Name: "a", Paths: []string{"connect_timeout"}},
+				},
+			},
+		},
+		{
+			name: "Returns the paths of nested fields and lists",
+			published: testDiffRevision("aaaa",
+				marin3rv1alpha1.Resource{Type: envoy.Listener, Value: k8sutil.StringtoRawExtension(
+					`{"name": "l", "address": {"socket_address": {"address": "0.0.0.0", "port_value": 8080}}, "listener_filters": [{"name": "a"}, {"name": "b"}]}`)},
+				testDiffCluster(`{"name": "a", "load_assignment": {"cluster_name": "a", "endpoints": [{}]}}`),
+			),
+			desired: testDiffRevision("bbbb",
+				marin3rv1alpha1.Resource{Type: envoy.Listener, Value: k8sutil.StringtoRawExtension(
+					`{"name": "l", "address": {"socket_address": {"address": "0.0.0.0", "port_value": 8081}}, "listener_filters": [{"name": "a"}, {"name": "c"}]}`)},
+				testDiffCluster(`{"name": "a", "load_assignment": {"cluster_name": "a", "endpoints": [{}, {}]}}`),
+			),
+			want: &marin3rv1alpha1.ConfigDiff{
+				PublishedVersion: "aaaa",
+				DesiredVersion:   "bbbb",
+				Modified: []marin3rv1alpha1.ResourceDiff{
+					{Type: envoy.Cluster, Name: "a", Paths: []string{"load_assignment.endpoints"}},
+					{Type: envoy.Listener, Name: "l", Paths: []string{"address.socket_address.port_value", "listener_filters[1].name"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(GenerateConfigDiff(tt.published, tt.desired, envoy.APIv3), tt.want); len(diff) > 0 {
+				t.Errorf("GenerateConfigDiff() = %v", diff)
+			}
+		})
+	}
+}
+
+func TestReconcileConfigDiff(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default", UID: "uid"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID:    "node",
+			Resources: []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "a"}`)},
+		},
+	}
+	desiredVersion := ec.GetEnvoyResourcesVersion()
+	key := types.NamespacedName{Name: "ec-diff", Namespace: "default"}
+
+	large := []marin3rv1alpha1.Resource{}
+	for i := 0; i < 500; i++ {
+		large = append(large, testDiffCluster(fmt.Sprintf(`{"name": "cluster-%d"}`, i)))
+	}
+	list := &marin3rv1alpha1.EnvoyConfigRevisionList{
+		Items: []marin3rv1alpha1.EnvoyConfigRevision{
+			*testDiffRevision("small", testDiffCluster(`{"name": "b"}`)),
+			*testDiffRevision("large", large...),
+			*testDiffRevision(desiredVersion, testDiffCluster(`{"name": "a"}`)),
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(ec).Build()
+
+	diff, err := ReconcileConfigDiff(context.TODO(), cl, s, record.NewFakeRecorder(10), ec, list, desiredVersion, "small")
+	if err != nil {
+		t.Fatalf("ReconcileConfigDiff() error = %v", err)
+	}
+	if diff == nil || diff.ConfigMapRef != nil || len(diff.Added) != 1 || len(diff.Removed) != 1 {
+		t.Errorf("ReconcileConfigDiff() = %v, want the diff in the status", diff)
+	}
+
+	diff, err = ReconcileConfigDiff(context.TODO(), cl, s, record.NewFakeRecorder(10), ec, list, desiredVersion, "large")
+	if err != nil {
+		t.Fatalf("ReconcileConfigDiff() error = %v", err)
+	}
+	if diff == nil || diff.ConfigMapRef == nil || diff.ConfigMapRef.Name != "ec-diff" || len(diff.Removed) != 0 {
+		t.Errorf("ReconcileConfigDiff() = %v, want a reference to the ConfigMap", diff)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), key, cm); err != nil {
+		t.Fatalf("ReconcileConfigDiff() ConfigMap not found: %v", err)
+	}
+	if len(cm.Data[ConfigDiffConfigMapKey]) == 0 || len(cm.GetOwnerReferences()) != 1 || cm.GetLabels()[ConfigDiffLabelKey] != "ec" {
+		t.Errorf("ReconcileConfigDiff() ConfigMap = %v", cm)
+	}
+
+	ec.Status.Diff = diff
+	diff, err = ReconcileConfigDiff(context.TODO(), cl, s, record.NewFakeRecorder(10), ec, list, desiredVersion, desiredVersion)
+	if err != nil {
+		t.Fatalf("ReconcileConfigDiff() error = %v", err)
+	}
+	if diff != nil {
+		t.Errorf("ReconcileConfigDiff() = %v, want nil", diff)
+	}
+	if err := cl.Get(context.TODO(), key, cm); !errors.IsNotFound(err) {
+		t.Errorf("ReconcileConfigDiff() ConfigMap not deleted: %v", err)
+	}
+}
+
+func TestReconcileConfigDiff_ConfigMapConflict(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default", UID: "uid"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID:    "node",
+			Resources: []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "a"}`)},
+		},
+		Status: marin3rv1alpha1.EnvoyConfigStatus{
+			Diff: &marin3rv1alpha1.ConfigDiff{ConfigMapRef: &corev1.LocalObjectReference{Name: "ec-diff"}},
+		},
+	}
+	desiredVersion := ec.GetEnvoyResourcesVersion()
+
+	large := []marin3rv1alpha1.Resource{}
+	for i := 0; i < 500; i++ {
+		large = append(large, testDiffCluster(fmt.Sprintf(`{"name": "cluster-%d"}`, i)))
+	}
+	list := &marin3rv1alpha1.EnvoyConfigRevisionList{
+		Items: []marin3rv1alpha1.EnvoyConfigRevision{
+			*testDiffRevision("large", large...),
+			*testDiffRevision(desiredVersion, testDiffCluster(`{"name": "a"}`)),
+		},
+	}
+	// a ConfigMap of the user that happens to have the name of the diff ConfigMap
+	userCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec-diff", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(ec, userCM).Build()
+	recorder := record.NewFakeRecorder(10)
+	key := types.NamespacedName{Name: "ec-diff", Namespace: "default"}
+
+	diff, err := ReconcileConfigDiff(context.TODO(), cl, s, recorder, ec, list, desiredVersion, "large")
+	if err != nil {
+		t.Fatalf("ReconcileConfigDiff() error = %v", err)
+	}
+	if diff == nil || diff.ConfigMapRef != nil || diff.DesiredVersion != desiredVersion || len(diff.Removed) != 0 {
+		t.Errorf("ReconcileConfigDiff() = %v, want only the versions", diff)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("ReconcileConfigDiff() want an event about the conflict")
+	}
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), key, cm); err != nil {
+		t.Fatalf("ReconcileConfigDiff() ConfigMap not found: %v", err)
+	}
+	if diff := deep.Equal(cm.Data, userCM.Data); len(diff) > 0 || len(cm.GetOwnerReferences()) != 0 {
+		t.Errorf("ReconcileConfigDiff() the ConfigMap of the user was modified: %v", cm)
+	}
+
+	if _, err := ReconcileConfigDiff(context.TODO(), cl, s, recorder, ec, list, desiredVersion, desiredVersion); err != nil {
+		t.Fatalf("ReconcileConfigDiff() error = %v", err)
+	}
+	if err := cl.Get(context.TODO(), key, cm); err != nil {
+		t.Errorf("ReconcileConfigDiff() the ConfigMap of the user was deleted: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ListFragments returns the EnvoyConfigFragments in the namespace of the EnvoyConfig
+// labelled with its nodeID, sorted by name so they are always aggregated in the same order
+func ListFragments(ctx context.Context, cl client.Client, ec *marin3rv1alpha1.EnvoyConfig) ([]marin3rv1alpha1.EnvoyConfigFragment, error) {
+	list := &marin3rv1alpha1.EnvoyConfigFragmentList{}
+	if err := cl.List(ctx, list, client.InNamespace(ec.GetNamespace()),
+		client.MatchingLabels{marin3rv1alpha1.FragmentNodeIDLabel: ec.Spec.NodeID}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].GetName() < list.Items[j].GetName()
+	})
+	return list.Items, nil
+}
+
+// aggregateFragment renders and validates the resources of the EnvoyConfigFragment, returning them
+// along with the condition that reports the result in the status of the fragment. Fragments are
+// aggregated as a whole, so no resources are returned if any of them is invalid or has already
+// been declared elsewhere.
+func aggregateFragment(ec *marin3rv1alpha1.EnvoyConfig, fragment *marin3rv1alpha1.EnvoyConfigFragment,
+	render func([]marin3rv1alpha1.Resource) ([]marin3rv1alpha1.Resource, error),
+	version envoy.APIVersion, origins map[resourceKey]string) ([]marin3rv1alpha1.Resource, metav1.Condition) {
+
+	rejected := func(reason, msg string) ([]marin3rv1alpha1.Resource, metav1.Condition) {
+		return nil, metav1.Condition{
+			Type:    marin3rv1alpha1.FragmentAcceptedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: msg,
+		}
+	}
+
+	resources, err := render(fragment.Spec.Resources)
+	if err != nil {
+		return rejected(marin3rv1alpha1.FragmentInvalidResourcesReason, err.Error())
+	}
+	if err := marin3rv1alpha1.ValidateResourcesSchema(resources, version); err != nil {
+		return rejected(marin3rv1alpha1.FragmentInvalidResourcesReason, err.Error())
+	}
+	if key, other := findCollision(resources, version, origins); other != "" {
+		return rejected(marin3rv1alpha1.FragmentResourceCollisionReason,
+			fmt.Sprintf("%s '%s' is already declared in %s", key.rType, key.name, other))
+	}
+
+	addOrigins(resources, version, origins, fmt.Sprintf("EnvoyConfigFragment '%s'", fragment.GetName()))
+	return resources, metav1.Condition{
+		Type:    marin3rv1alpha1.FragmentAcceptedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  marin3rv1alpha1.FragmentAggregatedReason,
+		Message: fmt.Sprintf("resources aggregated into EnvoyConfig '%s'", ec.GetName()),
+	}
+}
+
+// reconcileFragmentStatus sets the condition in the status of the EnvoyConfigFragment,
+// updating it only if the condition has changed
+func reconcileFragmentStatus(ctx context.Context, cl client.Client, fragment *marin3rv1alpha1.EnvoyConfigFragment, cond metav1.Condition) error {
+	cond.ObservedGeneration = fragment.GetGeneration()
+
+	current := meta.FindStatusCondition(fragment.Status.Conditions, cond.Type)
+	if current != nil && current.Status == cond.Status && current.Reason == cond.Reason &&
+		current.Message == cond.Message && current.ObservedGeneration == cond.ObservedGeneration {
+		return nil
+	}
+
+	meta.SetStatusCondition(&fragment.Status.Conditions, cond)
+	return cl.Status().Update(ctx, fragment)
+}
@@ -0,0 +1,80 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/go-test/deep"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testFragment(name, nodeID string, resources ...marin3rv1alpha1.Resource) *marin3rv1alpha1.EnvoyConfigFragment {
+	return &marin3rv1alpha1.EnvoyConfigFragment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{marin3rv1alpha1.FragmentNodeIDLabel: nodeID},
+		},
+		Spec: marin3rv1alpha1.EnvoyConfigFragmentSpec{Resources: resources},
+	}
+}
+
+func TestDesiredResources_Fragments(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID:    "gateway",
+			Resources: []marin3rv1alpha1.Resource{testDiffCluster(`{"name":"shared"}`)},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		testFragment("team-a", "gateway", testDiffCluster(`{"name":"a"}`)),
+		testFragment("team-b", "gateway", testDiffCluster(`{"name":"b","connect_timeout":"wrong"}`)),
+		testFragment("team-c", "gateway", testDiffCluster(`{"name":"c"}`), testDiffCluster(`{"name":"a"}`)),
+		testFragment("team-d", "gateway",
+			marin3rv1alpha1.Resource{Type: envoy.Route, Value: testDiffCluster(`{"name":"d"}`).Value}),
+		testFragment("other", "other", testDiffCluster(`{"name":"other"}`)),
+	).Build()
+
+	got, err := DesiredResources(context.TODO(), cl, ec)
+	if err != nil {
+		t.Fatalf("DesiredResources() error = %v", err)
+	}
+	want := []marin3rv1alpha1.Resource{
+		testDiffCluster(`{"name":"shared"}`),
+		testDiffCluster(`{"name":"a"}`),
+		{Type: envoy.Route, Value: testDiffCluster(`{"name":"d"}`).Value},
+	}
+	if diff := deep.Equal(got, want); len(diff) > 0 {
+		t.Errorf("DesiredResources() = %v", diff)
+	}
+
+	for name, reason := range map[string]string{
+		"team-a": marin3rv1alpha1.FragmentAggregatedReason,
+		"team-b": marin3rv1alpha1.FragmentInvalidResourcesReason,
+		"team-c": marin3rv1alpha1.FragmentResourceCollisionReason,
+		"team-d": marin3rv1alpha1.FragmentAggregatedReason,
+	} {
+		fragment := &marin3rv1alpha1.EnvoyConfigFragment{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "default"}, fragment); err != nil {
+			t.Fatal(err)
+		}
+		cond := meta.FindStatusCondition(fragment.Status.Conditions, marin3rv1alpha1.FragmentAcceptedCondition)
+		if cond == nil || cond.Reason != reason {
+			t.Errorf("DesiredResources() fragment %s condition = %v, want reason %s", name, cond, reason)
+		}
+	}
+
+	fragment := &marin3rv1alpha1.EnvoyConfigFragment{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "other", Namespace: "default"}, fragment); err != nil {
+		t.Fatal(err)
+	}
+	if len(fragment.Status.Conditions) != 0 {
+		t.Errorf("DesiredResources() fragment of another nodeID got conditions %v", fragment.Status.Conditions)
+	}
+}
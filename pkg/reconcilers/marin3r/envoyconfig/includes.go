@@ -0,0 +1,119 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DesiredResources returns the resources of the EnvoyConfig merged with the resources of the
+// EnvoyResourceLibraries it includes and of the EnvoyConfigFragments of its nodeID, with the
+// templates in their values rendered with the parameters and the content of the ConfigMaps and
+// Secrets they read their value from recorded in their value. Resources of the same type and name
+// declared both in the EnvoyConfig and in an included library, or in several of the included
+// libraries, are an error. Fragments are validated one by one instead, and the ones that fail
+// are left out with the error reported in their status. The resources are returned as they are
+// if there are no parameters, included libraries, fragments or values read from other objects.
+func DesiredResources(ctx context.Context, cl client.Client, ec *marin3rv1alpha1.EnvoyConfig) ([]marin3rv1alpha1.Resource, error) {
+	fragments, err := ListFragments(ctx, cl, ec)
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.Spec.Parameters) == 0 && len(ec.Spec.Includes) == 0 && len(fragments) == 0 && !hasValueFrom(ec.Spec.Resources) {
+		return ec.Spec.Resources, nil
+	}
+
+	var params map[string]string
+	if len(ec.Spec.Parameters) > 0 {
+		if params, err = ResolveParameters(ctx, cl, ec); err != nil {
+			return nil, err
+		}
+	}
+	render := func(resources []marin3rv1alpha1.Resource) ([]marin3rv1alpha1.Resource, error) {
+		if params != nil {
+			rendered, err := marin3rv1alpha1.RenderResources(resources, params)
+			if err != nil {
+				return nil, err
+			}
+			resources = rendered
+		}
+		return ResolveValues(ctx, cl, ec.GetNamespace(), ec.GetRevisionStorage(), resources)
+	}
+
+	resources, err := render(ec.Spec.Resources)
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.Spec.Includes) == 0 && len(fragments) == 0 {
+		return resources, nil
+	}
+
+	version := ec.GetEnvoyAPIVersion()
+	// origins holds where each resource has been declared. The resources declared
+	// more than once in the EnvoyConfig itself are left as they are.
+	origins := map[resourceKey]string{}
+	for _, res := range resources {
+		if _, name := res.Canonical(version); name != "" {
+			origins[resourceKey{rType: res.Type, name: name}] = "the EnvoyConfig"
+		}
+	}
+
+	merged := append([]marin3rv1alpha1.Resource{}, resources...)
+	for _, include := range ec.Spec.Includes {
+		library := &marin3rv1alpha1.EnvoyResourceLibrary{}
+		if err := cl.Get(ctx, types.NamespacedName{Name: include, Namespace: ec.GetNamespace()}, library); err != nil {
+			return nil, fmt.Errorf("unable to get EnvoyResourceLibrary '%s': %w", include, err)
+		}
+		included, err := render(library.Spec.Resources)
+		if err != nil {
+			return nil, fmt.Errorf("unable to render the resources of EnvoyResourceLibrary '%s': %w", include, err)
+		}
+
+		origin := fmt.Sprintf("EnvoyResourceLibrary '%s'", include)
+		if key, other := findCollision(included, version, origins); other != "" {
+			return nil, fmt.Errorf("%s '%s' of %s is already declared in %s", key.rType, key.name, origin, other)
+		}
+		addOrigins(included, version, origins, origin)
+		merged = append(merged, included...)
+	}
+
+	for idx := range fragments {
+		fragment := &fragments[idx]
+		aggregated, cond := aggregateFragment(ec, fragment, render, version, origins)
+		if aggregated != nil {
+			merged = append(merged, aggregated...)
+		}
+		if err := reconcileFragmentStatus(ctx, cl, fragment, cond); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// findCollision returns the first resource of the list that has already been declared
+// elsewhere, along with where it was declared. It returns an empty string if none has.
+func findCollision(resources []marin3rv1alpha1.Resource, version envoy.APIVersion, origins map[resourceKey]string) (resourceKey, string) {
+	for _, res := range resources {
+		if _, name := res.Canonical(version); name != "" {
+			key := resourceKey{rType: res.Type, name: name}
+			if other, ok := origins[key]; ok {
+				return key, other
+			}
+		}
+	}
+	return resourceKey{}, ""
+}
+
+// addOrigins records the origin of the named resources of the list
+func addOrigins(resources []marin3rv1alpha1.Resource, version envoy.APIVersion, origins map[resourceKey]string, origin string) {
+	for _, res := range resources {
+		if _, name := res.Canonical(version); name != "" {
+			origins[resourceKey{rType: res.Type, name: name}] = origin
+		}
+	}
+}
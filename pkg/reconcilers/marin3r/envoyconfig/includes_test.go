@@ -0,0 +1,119 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testLibrary(name string, resources ...marin3rv1alpha1.Resource) *marin3rv1alpha1.EnvoyResourceLibrary {
+	return &marin3rv1alpha1.EnvoyResourceLibrary{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       marin3rv1alpha1.EnvoyResourceLibrarySpec{Resources: resources},
+	}
+}
+
+func TestDesiredResources(t *testing.T) {
+	auth := testLibrary("auth", testDiffCluster(`{"name":"auth"}`))
+	telemetry := testLibrary("telemetry",
+		testDiffCluster(`{"name":"{{ .telemetry }}"}`),
+		marin3rv1alpha1.Resource{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("telemetry-cert")},
+	)
+	colliding := testLibrary("colliding", testDiffCluster(`{"name":"auth"}`))
+
+	tests := []struct {
+		name    string
+		spec    marin3rv1alpha1.EnvoyConfigSpec
+		want    []marin3rv1alpha1.Resource
+		wantErr bool
+	}{
+		{
+			name: "Returns the resources as they are without includes or parameters",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Resources: []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "a"}`)},
+			},
+			want:    []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "a"}`)},
+			wantErr: false,
+		},
+		{
+			name: "Merges the resources of the included libraries, rendered with the parameters",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Resources:  []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "a"}`)},
+				Includes:   []string{"auth", "telemetry"},
+				Parameters: []marin3rv1alpha1.Parameter{{Name: "telemetry", Value: pointer.New("otel")}},
+			},
+			want: []marin3rv1alpha1.Resource{
+				testDiffCluster(`{"name": "a"}`),
+				testDiffCluster(`{"name":"auth"}`),
+				testDiffCluster(`{"name":"otel"}`),
+				{Type: envoy.Secret, GenerateFromTlsSecret: pointer.New("telemetry-cert")},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Only includes libraries",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Includes: []string{"auth"},
+			},
+			want:    []marin3rv1alpha1.Resource{testDiffCluster(`{"name":"auth"}`)},
+			wantErr: false,
+		},
+		{
+			name: "Fails on a collision with the resources of the EnvoyConfig",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Resources: []marin3rv1alpha1.Resource{testDiffCluster(`{"name": "auth", "connect_timeout": "1s"}`)},
+				Includes:  []string{"auth"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Fails on a collision between libraries",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Includes: []string{"auth", "colliding"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Fails if a library doesn't exist",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Includes: []string{"missing"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Fails if a library references a parameter that doesn't exist",
+			spec: marin3rv1alpha1.EnvoyConfigSpec{
+				Includes:   []string{"telemetry"},
+				Parameters: []marin3rv1alpha1.Parameter{{Name: "other", Value: pointer.New("value")}},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &marin3rv1alpha1.EnvoyConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+			cl := fake.NewClientBuilder().WithScheme(s).WithObjects(auth, telemetry, colliding).Build()
+			got, err := DesiredResources(context.TODO(), cl, ec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DesiredResources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("DesiredResources() = %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package reconcilers
+
+import (
+	"context"
+	"sort"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ConfigMapsIndex indexes EnvoyConfigs, EnvoyResourceLibraries and
+	// EnvoyConfigFragments by the ConfigMaps they read values from
+	ConfigMapsIndex string = "marin3r.3scale.net/configmaps"
+	// SecretsIndex indexes EnvoyConfigs, EnvoyResourceLibraries and
+	// EnvoyConfigFragments by the Secrets they read values from
+	SecretsIndex string = "marin3r.3scale.net/secrets"
+	// IncludesIndex indexes EnvoyConfigs by the EnvoyResourceLibraries they include
+	IncludesIndex string = "spec.includes"
+	// NodeIDIndex indexes EnvoyConfigs by their nodeID
+	NodeIDIndex string = "spec.nodeID"
+)
+
+// indexes are the field indexes registered by SetupIndexes
+var indexes = []struct {
+	obj     client.Object
+	field   string
+	extract client.IndexerFunc
+}{
+	{&marin3rv1alpha1.EnvoyConfig{}, ConfigMapsIndex, envoyConfigConfigMaps},
+	{&marin3rv1alpha1.EnvoyConfig{}, SecretsIndex, envoyConfigSecrets},
+	{&marin3rv1alpha1.EnvoyConfig{}, IncludesIndex, envoyConfigIncludes},
+	{&marin3rv1alpha1.EnvoyConfig{}, NodeIDIndex, envoyConfigNodeID},
+	{&marin3rv1alpha1.EnvoyResourceLibrary{}, ConfigMapsIndex, libraryConfigMaps},
+	{&marin3rv1alpha1.EnvoyResourceLibrary{}, SecretsIndex, librarySecrets},
+	{&marin3rv1alpha1.EnvoyConfigFragment{}, ConfigMapsIndex, fragmentConfigMaps},
+	{&marin3rv1alpha1.EnvoyConfigFragment{}, SecretsIndex, fragmentSecrets},
+}
+
+// SetupIndexes registers the field indexes used to find the EnvoyConfigs
+// affected by a change in the objects they read resources or values from
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, idx := range indexes {
+		if err := indexer.IndexField(ctx, idx.obj, idx.field, idx.extract); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envoyConfigConfigMaps(o client.Object) []string {
+	ec := o.(*marin3rv1alpha1.EnvoyConfig)
+	names := configMapsOf(ec.Spec.Resources)
+	for _, param := range ec.Spec.Parameters {
+		if param.ValueFrom != nil && param.ValueFrom.ConfigMapKeyRef != nil {
+			names = append(names, param.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+	return names
+}
+
+func envoyConfigSecrets(o client.Object) []string {
+	return secretsOf(o.(*marin3rv1alpha1.EnvoyConfig).Spec.Resources)
+}
+
+func envoyConfigIncludes(o client.Object) []string {
+	return o.(*marin3rv1alpha1.EnvoyConfig).Spec.Includes
+}
+
+func envoyConfigNodeID(o client.Object) []string {
+	return []string{o.(*marin3rv1alpha1.EnvoyConfig).Spec.NodeID}
+}
+
+func libraryConfigMaps(o client.Object) []string {
+	return configMapsOf(o.(*marin3rv1alpha1.EnvoyResourceLibrary).Spec.Resources)
+}
+
+func librarySecrets(o client.Object) []string {
+	return secretsOf(o.(*marin3rv1alpha1.EnvoyResourceLibrary).Spec.Resources)
+}
+
+func fragmentConfigMaps(o client.Object) []string {
+	return configMapsOf(o.(*marin3rv1alpha1.EnvoyConfigFragment).Spec.Resources)
+}
+
+func fragmentSecrets(o client.Object) []string {
+	return secretsOf(o.(*marin3rv1alpha1.EnvoyConfigFragment).Spec.Resources)
+}
+
+// configMapsOf returns the names of the ConfigMaps the resources read their value from
+func configMapsOf(resources []marin3rv1alpha1.Resource) []string {
+	names := []string{}
+	for _, res := range resources {
+		if res.ValueFrom != nil && res.ValueFrom.ConfigMapKeyRef != nil {
+			names = append(names, res.ValueFrom.ConfigMapKeyRef.Name)
+		}
+	}
+	return names
+}
+
+// secretsOf returns the names of the Secrets the resources read their value from
+func secretsOf(resources []marin3rv1alpha1.Resource) []string {
+	names := []string{}
+	for _, res := range resources {
+		if res.ValueFrom != nil && res.ValueFrom.SecretKeyRef != nil {
+			names = append(names, res.ValueFrom.SecretKeyRef.Name)
+		}
+	}
+	return names
+}
+
+// EnvoyConfigsReadingFrom returns the EnvoyConfigs that read values from the ConfigMap or Secret, either
+// in their own parameters and resources or in the resources of the EnvoyResourceLibraries they include
+// or of the EnvoyConfigFragments of their nodeID. The indexes registered by SetupIndexes are required.
+func EnvoyConfigsReadingFrom(ctx context.Context, cl client.Client, obj client.Object) ([]types.NamespacedName, error) {
+	var index string
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		index = ConfigMapsIndex
+	case *corev1.Secret:
+		index = SecretsIndex
+	default:
+		return nil, nil
+	}
+
+	keys := map[types.NamespacedName]struct{}{}
+	addEnvoyConfigs := func(field, value string) error {
+		list, err := ListEnvoyConfigs(ctx, cl, obj.GetNamespace(), field, value)
+		if err != nil {
+			return err
+		}
+		for _, ec := range list {
+			keys[client.ObjectKeyFromObject(&ec)] = struct{}{}
+		}
+		return nil
+	}
+
+	if err := addEnvoyConfigs(index, obj.GetName()); err != nil {
+		return nil, err
+	}
+
+	libraries := &marin3rv1alpha1.EnvoyResourceLibraryList{}
+	if err := cl.List(ctx, libraries, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()}); err != nil {
+		return nil, err
+	}
+	for _, library := range libraries.Items {
+		if err := addEnvoyConfigs(IncludesIndex, library.GetName()); err != nil {
+			return nil, err
+		}
+	}
+
+	fragments := &marin3rv1alpha1.EnvoyConfigFragmentList{}
+	if err := cl.List(ctx, fragments, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()}); err != nil {
+		return nil, err
+	}
+	for _, fragment := range fragments.Items {
+		if nodeID, ok := fragment.GetLabels()[marin3rv1alpha1.FragmentNodeIDLabel]; ok {
+			if err := addEnvoyConfigs(NodeIDIndex, nodeID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	out := make([]types.NamespacedName, 0, len(keys))
+	for key := range keys {
+		out = append(out, key)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out, nil
+}
+
+// ListEnvoyConfigs returns the EnvoyConfigs in the namespace
+// with the given value in one of the indexes registered by SetupIndexes
+func ListEnvoyConfigs(ctx context.Context, cl client.Client, namespace, index, value string) ([]marin3rv1alpha1.EnvoyConfig, error) {
+	list := &marin3rv1alpha1.EnvoyConfigList{}
+	if err := cl.List(ctx, list, client.InNamespace(namespace), client.MatchingFields{index: value}); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
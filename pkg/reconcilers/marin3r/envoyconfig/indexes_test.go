@@ -0,0 +1,98 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/go-test/deep"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEnvoyConfigsReadingFrom(t *testing.T) {
+	fromSecret := marin3rv1alpha1.Resource{
+		Type: envoy.Cluster,
+		ValueFrom: &marin3rv1alpha1.ResourceValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "values"}, Key: "cluster.json"}},
+	}
+	ec := func(name, nodeID string, mutate func(*marin3rv1alpha1.EnvoyConfigSpec)) *marin3rv1alpha1.EnvoyConfig {
+		ec := &marin3rv1alpha1.EnvoyConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       marin3rv1alpha1.EnvoyConfigSpec{NodeID: nodeID},
+		}
+		mutate(&ec.Spec)
+		return ec
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(s).WithObjects(
+		ec("resource", "a", func(spec *marin3rv1alpha1.EnvoyConfigSpec) {
+			spec.Resources = []marin3rv1alpha1.Resource{testResourceFromConfigMap(envoy.Route, "values", "route.yaml", false)}
+		}),
+		ec("parameter", "b", func(spec *marin3rv1alpha1.EnvoyConfigSpec) {
+			spec.Parameters = []marin3rv1alpha1.Parameter{{Name: "host", ValueFrom: &marin3rv1alpha1.ParameterSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "values"}, Key: "host"}}}}
+		}),
+		ec("library", "c", func(spec *marin3rv1alpha1.EnvoyConfigSpec) { spec.Includes = []string{"shared"} }),
+		ec("fragment", "gateway", func(spec *marin3rv1alpha1.EnvoyConfigSpec) {}),
+		ec("secret", "d", func(spec *marin3rv1alpha1.EnvoyConfigSpec) {
+			spec.Resources = []marin3rv1alpha1.Resource{fromSecret}
+		}),
+		ec("unrelated", "e", func(spec *marin3rv1alpha1.EnvoyConfigSpec) {
+			spec.Resources = []marin3rv1alpha1.Resource{testResourceFromConfigMap(envoy.Route, "other", "route.yaml", false)}
+		}),
+		&marin3rv1alpha1.EnvoyResourceLibrary{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+			Spec: marin3rv1alpha1.EnvoyResourceLibrarySpec{
+				Resources: []marin3rv1alpha1.Resource{testResourceFromConfigMap(envoy.Listener, "values", "listener.yaml", false)},
+			},
+		},
+		testFragment("team-a", "gateway", testResourceFromConfigMap(envoy.Cluster, "values", "cluster.yaml", false)),
+	)
+	for _, idx := range indexes {
+		builder = builder.WithIndex(idx.obj, idx.field, idx.extract)
+	}
+	cl := builder.Build()
+
+	tests := []struct {
+		name string
+		obj  client.Object
+		want []types.NamespacedName
+	}{
+		{
+			name: "ConfigMap read by EnvoyConfigs, libraries and fragments",
+			obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "default"}},
+			want: []types.NamespacedName{
+				{Name: "fragment", Namespace: "default"},
+				{Name: "library", Namespace: "default"},
+				{Name: "parameter", Namespace: "default"},
+				{Name: "resource", Namespace: "default"},
+			},
+		},
+		{
+			name: "Secret with the same name",
+			obj:  &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "default"}},
+			want: []types.NamespacedName{{Name: "secret", Namespace: "default"}},
+		},
+		{
+			name: "ConfigMap in another namespace",
+			obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "values", Namespace: "other"}},
+			want: []types.NamespacedName{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EnvoyConfigsReadingFrom(context.TODO(), cl, tt.obj)
+			if err != nil {
+				t.Fatalf("EnvoyConfigsReadingFrom() error = %v", err)
+			}
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("EnvoyConfigsReadingFrom() = %v", diff)
+			}
+		})
+	}
+}
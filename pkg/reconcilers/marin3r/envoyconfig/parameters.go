@@ -0,0 +1,48 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResolveParameters returns the values of the parameters of the EnvoyConfig, indexed by name,
+// reading from the Kubernetes API the ones that reference a key of a ConfigMap. Missing
+// ConfigMaps or keys are an error unless the reference is optional, in which case the
+// value of the parameter is empty.
+func ResolveParameters(ctx context.Context, cl client.Client, ec *marin3rv1alpha1.EnvoyConfig) (map[string]string, error) {
+	values := make(map[string]string, len(ec.Spec.Parameters))
+
+	for _, param := range ec.Spec.Parameters {
+		if param.Value != nil {
+			values[param.Name] = *param.Value
+			continue
+		}
+		if param.ValueFrom == nil || param.ValueFrom.ConfigMapKeyRef == nil {
+			return nil, fmt.Errorf("parameter '%s' has no value", param.Name)
+		}
+
+		ref := param.ValueFrom.ConfigMapKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		cm := &corev1.ConfigMap{}
+		if err := cl.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ec.GetNamespace()}, cm); err != nil {
+			if errors.IsNotFound(err) && optional {
+				values[param.Name] = ""
+				continue
+			}
+			return nil, fmt.Errorf("unable to get ConfigMap '%s' for parameter '%s': %w", ref.Name, param.Name, err)
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok && !optional {
+			return nil, fmt.Errorf("key '%s' not found in ConfigMap '%s' for parameter '%s'", ref.Key, ref.Name, param.Name)
+		}
+		values[param.Name] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,132 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testParameterFromConfigMap(name, cm, key string, optional bool) marin3rv1alpha1.Parameter {
+	return marin3rv1alpha1.Parameter{
+		Name: name,
+		ValueFrom: &marin3rv1alpha1.ParameterSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cm},
+				Key:                  key,
+				Optional:             pointer.New(optional),
+			},
+		},
+	}
+}
+
+func TestResolveParameters(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "params", Namespace: "default"},
+		Data:       map[string]string{"host": "example.com"},
+	}
+	tests := []struct {
+		name    string
+		params  []marin3rv1alpha1.Parameter
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "Returns literal values and values read from ConfigMaps",
+			params: []marin3rv1alpha1.Parameter{
+				{Name: "port", Value: pointer.New("8080")},
+				testParameterFromConfigMap("host", "params", "host", false),
+			},
+			want:    map[string]string{"port": "8080", "host": "example.com"},
+			wantErr: false,
+		},
+		{
+			name: "Returns empty values for missing optional references",
+			params: []marin3rv1alpha1.Parameter{
+				testParameterFromConfigMap("host", "params", "missing", true),
+				testParameterFromConfigMap("port", "missing", "port", true),
+			},
+			want:    map[string]string{"host": "", "port": ""},
+			wantErr: false,
+		},
+		{
+			name:    "Fails for a missing key",
+			params:  []marin3rv1alpha1.Parameter{testParameterFromConfigMap("host", "params", "missing", false)},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Fails for a missing ConfigMap",
+			params:  []marin3rv1alpha1.Parameter{testParameterFromConfigMap("host", "missing", "host", false)},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &marin3rv1alpha1.EnvoyConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+				Spec:       marin3rv1alpha1.EnvoyConfigSpec{NodeID: "node", Parameters: tt.params},
+			}
+			cl := fake.NewClientBuilder().WithScheme(s).WithObjects(cm).Build()
+			got, err := ResolveParameters(context.TODO(), cl, ec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveParameters() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("ResolveParameters() = %v", diff)
+			}
+		})
+	}
+}
+
+func TestDesiredResources_Parameters(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID: "node",
+			Resources: []marin3rv1alpha1.Resource{
+				{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "cluster", "connect_timeout": "{{ .timeout }}"}`)},
+			},
+			Parameters: []marin3rv1alpha1.Parameter{testParameterFromConfigMap("timeout", "params", "timeout", false)},
+		},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "params", Namespace: "default"},
+		Data:       map[string]string{"timeout": "1s"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(cm).Build()
+
+	// version returns the version of the resources rendered with the current parameters
+	version := func() string {
+		resources, err := DesiredResources(context.TODO(), cl, ec)
+		if err != nil {
+			t.Fatalf("DesiredResources() error = %v", err)
+		}
+		rendered := ec.DeepCopy()
+		rendered.Spec.Resources = resources
+		return rendered.GetEnvoyResourcesVersion()
+	}
+
+	before := version()
+	cm.Data["timeout"] = "2s"
+	if err := cl.Update(context.TODO(), cm); err != nil {
+		t.Fatal(err)
+	}
+	if after := version(); after == before {
+		t.Errorf("DesiredResources() the version didn't change with the value of the parameter")
+	}
+
+	resources, _ := DesiredResources(context.TODO(), cl, ec)
+	if got := string(resources[0].Value.Raw); got != `{"connect_timeout":"2s","name":"cluster"}` {
+		t.Errorf("DesiredResources() = %v", got)
+	}
+}
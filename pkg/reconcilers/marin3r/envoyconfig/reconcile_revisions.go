@@ -3,6 +3,8 @@ package reconcilers
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"time"
 
 	reconcilerutil "github.com/3scale-ops/basereconciler/util"
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
@@ -11,18 +13,17 @@ import (
 	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-const (
-	maxRevisions = 10
-)
-
 // RevisionReconciler is a struct with methods to reconcile EnvoyConfig revisions
 type RevisionReconciler struct {
 	ctx    context.Context
@@ -30,6 +31,8 @@ type RevisionReconciler struct {
 	client client.Client
 	scheme *runtime.Scheme
 	ec     *marin3rv1alpha1.EnvoyConfig
+	// recorder emits Events in the EnvoyConfig
+	recorder record.EventRecorder
 
 	// This fields are only available once Reconcile()
 	// has been succesfully run
@@ -41,9 +44,9 @@ type RevisionReconciler struct {
 
 // NewRevisionReconciler returns a new RevisionReconciler
 func NewRevisionReconciler(ctx context.Context, logger logr.Logger, client client.Client,
-	s *runtime.Scheme, ec *marin3rv1alpha1.EnvoyConfig) RevisionReconciler {
+	s *runtime.Scheme, ec *marin3rv1alpha1.EnvoyConfig, recorder record.EventRecorder) RevisionReconciler {
 
-	return RevisionReconciler{ctx, logger, client, s, ec, nil, nil, nil, nil}
+	return RevisionReconciler{ctx, logger, client, s, ec, recorder, nil, nil, nil, nil}
 }
 
 // Instance returns the EnvoyConfig the reconciler has been instantiated with
@@ -106,6 +109,18 @@ func (r *RevisionReconciler) Reconcile() (ctrl.Result, error) {
 
 	_, err := revisions.Get(r.ctx, r.client, r.Namespace(),
 		filters.ByNodeID(r.NodeID()), filters.ByVersion(r.DesiredVersion()), filters.ByEnvoyAPI(r.EnvoyAPI()))
+	if err != nil && revisions.ErrorIsNoMatchesForFilter(err) {
+		// Revisions created by previous releases are versioned with the hash of the resources
+		// as they are written. If there is one for the current resources keep using it, so
+		// upgrading doesn't trigger the publication of a new revision with the same resources.
+		if legacy := r.Instance().GetLegacyEnvoyResourcesVersion(); legacy != r.DesiredVersion() {
+			if _, lerr := revisions.Get(r.ctx, r.client, r.Namespace(),
+				filters.ByNodeID(r.NodeID()), filters.ByVersion(legacy), filters.ByEnvoyAPI(r.EnvoyAPI())); lerr == nil {
+				r.desiredVersion = pointer.New(legacy)
+				err = nil
+			}
+		}
+	}
 	if err != nil {
 		if revisions.ErrorIsNoMatchesForFilter(err) {
 			ecr := r.newRevisionForCurrentResources()
@@ -113,12 +128,32 @@ func (r *RevisionReconciler) Reconcile() (ctrl.Result, error) {
 				log.Error(err, "unable to SetControllerReference for new EnvoyConfigRevision resource", "Phase", "ReconcileRevisionForCurrentResources")
 				return ctrl.Result{}, err
 			}
+			var shards [][]byte
+			if storage := r.Instance().GetRevisionStorage(); storage != marin3rv1alpha1.RevisionStorageInline {
+				if shards, err = revisions.NewShardedRevision(ecr, storage); err != nil {
+					log.Error(err, "unable to encode the resources of the new EnvoyConfigRevision", "Phase", "ReconcileRevisionForCurrentResources")
+					return ctrl.Result{}, err
+				}
+			}
 			if err := r.client.Create(r.ctx, ecr); err != nil {
 				log.Error(err, "unable to create EnvoyConfigRevision resource", "Phase", "ReconcileRevisionForCurrentResources")
 				return ctrl.Result{}, err
 			}
+			if shards != nil {
+				if err := revisions.StoreShards(r.ctx, r.client, r.scheme, ecr, shards); err != nil {
+					log.Error(err, "unable to store the resources of the new EnvoyConfigRevision", "Phase", "ReconcileRevisionForCurrentResources")
+					// delete the revision so it gets created again along with all its
+					// shards, the ones already stored are garbage collected with it
+					if err := r.client.Delete(r.ctx, ecr); err != nil {
+						log.Error(err, "unable to delete EnvoyConfigRevision with missing shards", "Phase", "ReconcileRevisionForCurrentResources")
+					}
+					return ctrl.Result{}, err
+				}
+			}
 			// New EnvoyConfigRevision created, trigger a new reconcile loop
 			log.Info("created EnvoyConfigRevision for current resources", "version", r.DesiredVersion())
+			r.recorder.Eventf(r.Instance(), corev1.EventTypeNormal, "RevisionCreated",
+				"Created revision %s for version %s", ecr.GetName(), r.DesiredVersion())
 			return ctrl.Result{Requeue: true}, nil
 		}
 		if revisions.ErrorIsMultipleMatchesForFilter(err) {
@@ -135,10 +170,42 @@ func (r *RevisionReconciler) Reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 	r.revisionList = revisions.SortByPublication(r.DesiredVersion(), list)
+
+	// Keep the failure and deletion policies of the revisions in sync with the EnvoyConfig's ones
+	for _, ecr := range r.isRevisionPoliciesReconciled() {
+		if err := r.client.Update(r.ctx, ecr); err != nil {
+			log.Error(err, "unable to update revision", "Phase", "ReconcilePolicies", "Name/Namespace", reconcilerutil.ObjectKey(ecr))
+			return ctrl.Result{}, err
+		}
+	}
+
+	listed := r.revisionList.DeepCopy()
 	publishedVersion, cacheState := r.getVersionToPublish()
+
+	var result ctrl.Result
+	if cacheState == marin3rv1alpha1.InSyncState {
+		publishedVersion, cacheState, result = r.reconcilePublicationGates(publishedVersion, time.Now())
+	}
+
+	if r.Instance().Spec.Rollout != nil && cacheState == marin3rv1alpha1.InSyncState {
+		publishedVersion, cacheState, result = r.reconcileRollout(publishedVersion, time.Now())
+	}
 	r.cacheState = &cacheState
 	r.publishedVersion = &publishedVersion
 
+	// Update the rollout status of the revisions before reconciling the
+	// RevisionPublished condition, which might update the same revisions
+	r.abortStaleRollouts(cacheState)
+	for idx := range r.revisionList.Items {
+		ecr := &r.revisionList.Items[idx]
+		if !reflect.DeepEqual(listed.Items[idx].Status.Rollout, ecr.Status.Rollout) {
+			if err := r.client.Status().Update(r.ctx, ecr); err != nil {
+				log.Error(err, "unable to update revision", "Phase", "ReconcileRollout", "Name/Namespace", reconcilerutil.ObjectKey(ecr))
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
 	shouldBeTrue, shouldBeFalse := r.isRevisionPublishedConditionReconciled(r.PublishedVersion())
 
 	for _, ecr := range shouldBeFalse {
@@ -155,19 +222,59 @@ func (r *RevisionReconciler) Reconcile() (ctrl.Result, error) {
 			return ctrl.Result{}, err
 		}
 		log.Info("updated the published EnvoyConfigRevision", "Namespace/Name", reconcilerutil.ObjectKey(shouldBeTrue))
+		if cacheState == marin3rv1alpha1.RollbackState {
+			r.recorder.Eventf(r.Instance(), corev1.EventTypeWarning, "RollbackPerformed",
+				"Rolled back to revision %s (version %s), the revision for version %s is tainted",
+				shouldBeTrue.GetName(), shouldBeTrue.Spec.Version, r.DesiredVersion())
+		} else {
+			r.recorder.Eventf(r.Instance(), corev1.EventTypeNormal, "RevisionPublished",
+				"Published revision %s (version %s)", shouldBeTrue.GetName(), shouldBeTrue.Spec.Version)
+		}
+	}
+
+	// The RollbackFailed condition of the EnvoyConfig is set after the
+	// revisions are reconciled, use it to report the failure only once
+	if cacheState == marin3rv1alpha1.RollbackFailedState &&
+		!meta.IsStatusConditionTrue(r.Instance().Status.Conditions, marin3rv1alpha1.RollbackFailedCondition) {
+		r.recorder.Event(r.Instance(), corev1.EventTypeWarning, "RollbackFailed",
+			"All the revisions are tainted, there is no version to roll back to")
 	}
 
-	shouldBeDeleted := r.isRevisionRetentionReconciled(maxRevisions)
+	if policy := r.Instance().Spec.RetryPolicy; policy != nil {
+		shouldBeRetried, requeueAfter := r.isTaintRetryReconciled(policy, time.Now())
+		if shouldBeRetried != nil {
+			patch := client.MergeFrom(shouldBeRetried.DeepCopy())
+			annotations := shouldBeRetried.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[marin3rv1alpha1.ClearTaintAnnotation] = marin3rv1alpha1.ClearTaintRetryValue
+			shouldBeRetried.SetAnnotations(annotations)
+			if err := r.client.Patch(r.ctx, shouldBeRetried, patch); err != nil {
+				log.Error(err, "unable to update revision", "Phase", "RetryTaintedRevision", "Name/Namespace", reconcilerutil.ObjectKey(shouldBeRetried))
+				return ctrl.Result{}, err
+			}
+			log.Info("retrying tainted EnvoyConfigRevision", "Namespace/Name", reconcilerutil.ObjectKey(shouldBeRetried),
+				"attempt", shouldBeRetried.Status.TaintRetries+1)
+		}
+		if requeueAfter > 0 && (result.RequeueAfter == 0 || requeueAfter < result.RequeueAfter) {
+			result.RequeueAfter = requeueAfter
+		}
+	}
+
+	shouldBeDeleted := r.isRevisionRetentionReconciled(r.Instance().GetRevisionHistoryLimit(), r.Instance().GetRevisionHistoryMaxAge(), time.Now())
 	for _, ecr := range shouldBeDeleted {
 		if err := r.client.Delete(r.ctx, &ecr); err != nil {
 			log.Error(err, "unable to delete revision", "Phase", "ApplyRevisionRetention", "Name/Namespace", reconcilerutil.ObjectKey(&ecr))
 			return ctrl.Result{}, err
 		}
 		log.Info("deleted old EnvoyConfigRevision", "Namespace/Name", reconcilerutil.ObjectKey(&ecr))
+		r.recorder.Eventf(r.Instance(), corev1.EventTypeNormal, "RevisionDeleted",
+			"Garbage collected revision %s (version %s)", ecr.GetName(), ecr.Spec.Version)
 	}
 
 	log.Info(fmt.Sprintf("CacheState is %s after revision reconcile", cacheState))
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
 // getVersionToPublish takes an EnvoyConfigRevisionList and returns the version that should be
@@ -176,6 +283,16 @@ func (r *RevisionReconciler) Reconcile() (ctrl.Result, error) {
 func (r *RevisionReconciler) getVersionToPublish() (string, string) {
 	var versionToPublish string
 
+	// A pinned version takes precedence, as long as its revision is not tainted
+	if pinned := r.Instance().Spec.PinnedVersion; pinned != nil {
+		for _, ecr := range r.revisionList.Items {
+			if ecr.Spec.Version == *pinned && !meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition) {
+				return *pinned, marin3rv1alpha1.PinnedState
+			}
+		}
+		r.logger.Info("ignoring pinned version, there is no untainted revision for it", "version", *pinned)
+	}
+
 	topIdx := len(r.revisionList.Items) - 1
 
 	// Starting from the highest index in the list and going
@@ -199,6 +316,163 @@ func (r *RevisionReconciler) getVersionToPublish() (string, string) {
 
 }
 
+// reconcilePublicationGates holds the publication of the revision at the top of the list,
+// which is the one that getVersionToPublish has selected for publishing, while the EnvoyConfig
+// is suspended, its version has not been approved or all its publish windows are closed. The
+// currently published version is returned in that case, along with the SuspendedState, the
+// PendingApprovalState or the OutsidePublishWindowState. The returned result requeues the
+// EnvoyConfig once the next publish window opens.
+func (r *RevisionReconciler) reconcilePublicationGates(versionToPublish string, now time.Time) (string, string, ctrl.Result) {
+
+	// Publication is only held when replacing a healthy published version
+	current := r.getPublishedRevision()
+	if current == nil || current.Spec.Version == versionToPublish || current.Status.IsTainted() {
+		return versionToPublish, marin3rv1alpha1.InSyncState, ctrl.Result{}
+	}
+
+	if r.Instance().IsSuspended() {
+		r.logger.Info("holding publication, the EnvoyConfig is suspended", "version", versionToPublish)
+		return current.Spec.Version, marin3rv1alpha1.SuspendedState, ctrl.Result{}
+	}
+
+	if !r.Instance().IsApproved(versionToPublish) {
+		r.logger.Info("holding publication, the version has not been approved", "version", versionToPublish)
+		return current.Spec.Version, marin3rv1alpha1.PendingApprovalState, ctrl.Result{}
+	}
+
+	if open, err := r.Instance().IsPublishWindowOpen(now); err != nil || !open {
+		result := ctrl.Result{}
+		if err != nil {
+			r.logger.Error(err, "unable to evaluate the publish windows, holding publication", "version", versionToPublish)
+		} else if next, err := r.Instance().GetNextPublishWindow(now); err == nil {
+			result.RequeueAfter = next.Sub(now)
+		}
+		r.logger.Info("holding publication, outside of the publish windows", "version", versionToPublish)
+		return current.Spec.Version, marin3rv1alpha1.OutsidePublishWindowState, result
+	}
+
+	return versionToPublish, marin3rv1alpha1.InSyncState, ctrl.Result{}
+}
+
+// reconcileRollout progresses the rollout of the revision at the top of the list, which is
+// the one that getVersionToPublish has selected for publishing, following the steps
+// of the rollout policy. The version of the revision is only published once all the
+// steps have completed, until then the currently published version is returned, along
+// with the RolloutState. The returned result requeues the EnvoyConfig once the bake time
+// of the current step elapses.
+func (r *RevisionReconciler) reconcileRollout(versionToPublish string, now time.Time) (string, string, ctrl.Result) {
+	candidate := &r.revisionList.Items[len(r.revisionList.Items)-1]
+	steps := r.Instance().Spec.Rollout.Steps
+
+	// A rollout is only required when replacing a healthy published version
+	current := r.getPublishedRevision()
+	if current == nil || current.Spec.Version == versionToPublish || current.Status.IsTainted() {
+		candidate.Status.Rollout = nil
+		return versionToPublish, marin3rv1alpha1.InSyncState, ctrl.Result{}
+	}
+
+	rollout := candidate.Status.Rollout
+	if rollout == nil {
+		candidate.Status.Rollout = newRevisionRolloutStatus(0, steps[0].Percentage, now)
+		r.logger.Info("started rollout", "version", versionToPublish, "step", 0, "percentage", steps[0].Percentage)
+		return current.Spec.Version, marin3rv1alpha1.RolloutState, ctrl.Result{}
+	}
+
+	// The rollout policy might have changed since the rollout started
+	step := int(rollout.Step)
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+	if rollout.Percentage != steps[step].Percentage || int(rollout.Step) != step {
+		candidate.Status.Rollout = newRevisionRolloutStatus(int32(step), steps[step].Percentage, now)
+		return current.Spec.Version, marin3rv1alpha1.RolloutState, ctrl.Result{}
+	}
+
+	if !rollout.IsStepComplete(steps[step].GetBakeTime(), now) {
+		result := ctrl.Result{}
+		if rollout.IsStepComplete(0, now) {
+			// only the bake time is pending
+			result.RequeueAfter = rollout.StepStartedAt.Add(steps[step].GetBakeTime()).Sub(now)
+		}
+		return current.Spec.Version, marin3rv1alpha1.RolloutState, result
+	}
+
+	if step == len(steps)-1 {
+		candidate.Status.Rollout = nil
+		r.logger.Info("completed rollout", "version", versionToPublish)
+		return versionToPublish, marin3rv1alpha1.InSyncState, ctrl.Result{}
+	}
+
+	candidate.Status.Rollout = newRevisionRolloutStatus(int32(step+1), steps[step+1].Percentage, now)
+	r.logger.Info("promoted rollout", "version", versionToPublish, "step", step+1, "percentage", steps[step+1].Percentage)
+	return current.Spec.Version, marin3rv1alpha1.RolloutState, ctrl.Result{}
+}
+
+// getPublishedRevision returns the revision that currently has the RevisionPublished
+// condition set to true, nil if there is none
+func (r *RevisionReconciler) getPublishedRevision() *marin3rv1alpha1.EnvoyConfigRevision {
+	for idx := range r.revisionList.Items {
+		if meta.IsStatusConditionTrue(r.revisionList.Items[idx].Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+			return &r.revisionList.Items[idx]
+		}
+	}
+	return nil
+}
+
+func newRevisionRolloutStatus(step, percentage int32, now time.Time) *marin3rv1alpha1.RevisionRolloutStatus {
+	return &marin3rv1alpha1.RevisionRolloutStatus{
+		Step:          step,
+		Percentage:    percentage,
+		StepStartedAt: metav1.NewTime(now),
+	}
+}
+
+// abortStaleRollouts removes the rollout status from the revisions that are not
+// being rolled out. Only the revision at the top of the list can be rolled out.
+func (r *RevisionReconciler) abortStaleRollouts(cacheState string) {
+	topIdx := len(r.revisionList.Items) - 1
+	for idx := range r.revisionList.Items {
+		ecr := &r.revisionList.Items[idx]
+		if ecr.Status.Rollout == nil || (idx == topIdx && cacheState == marin3rv1alpha1.RolloutState) {
+			continue
+		}
+		ecr.Status.Rollout = nil
+		r.logger.Info("aborted rollout", "version", ecr.Spec.Version)
+	}
+}
+
+// isRevisionPoliciesReconciled sets the additional nodeIDs, the failure and deletion policies and the health analysis of the
+// EnvoyConfig in the revisions of the list and returns the revisions whose policies have changed, nil if none.
+func (r *RevisionReconciler) isRevisionPoliciesReconciled() []*marin3rv1alpha1.EnvoyConfigRevision {
+	var shouldBeUpdated []*marin3rv1alpha1.EnvoyConfigRevision
+	for idx := range r.revisionList.Items {
+		ecr := &r.revisionList.Items[idx]
+		changed := false
+		if !equality.Semantic.DeepEqual(ecr.Spec.NodeIDs, r.Instance().Spec.NodeIDs) {
+			ecr.Spec.NodeIDs = copyNodeIDs(r.Instance().Spec.NodeIDs)
+			changed = true
+		}
+		if !equality.Semantic.DeepEqual(ecr.Spec.FailurePolicy, r.Instance().Spec.FailurePolicy) {
+			ecr.Spec.FailurePolicy = r.Instance().Spec.FailurePolicy.DeepCopy()
+			changed = true
+		}
+		if !equality.Semantic.DeepEqual(ecr.Spec.HealthAnalysis, r.Instance().Spec.HealthAnalysis) {
+			ecr.Spec.HealthAnalysis = r.Instance().Spec.HealthAnalysis.DeepCopy()
+			changed = true
+		}
+		if !equality.Semantic.DeepEqual(ecr.Spec.DeletionPolicy, r.Instance().Spec.DeletionPolicy) ||
+			!equality.Semantic.DeepEqual(ecr.Spec.RetainTTL, r.Instance().Spec.RetainTTL) {
+			ecr.Spec.DeletionPolicy = pointer.Copy(r.Instance().Spec.DeletionPolicy)
+			ecr.Spec.RetainTTL = pointer.Copy(r.Instance().Spec.RetainTTL)
+			changed = true
+		}
+		if changed {
+			shouldBeUpdated = append(shouldBeUpdated, ecr)
+		}
+	}
+	return shouldBeUpdated
+}
+
 // isRevisionPublishedConditionReconciled returns the revisions that need the RevisionPublished condition reconciled.
 // As the first return value returns the EnvoyConfigRevision that needs the condition set to true, nil if update
 // not required. As the second return value returns a list of the EnvoyConfigRevisions that need the condition
@@ -231,27 +505,86 @@ func (r *RevisionReconciler) isRevisionPublishedConditionReconciled(versionToPub
 	return shouldBeTrue, shouldBeFalse
 }
 
-// isRevisionRetentionReconciled removes items from the revisionList until the list holds the number of items
-// determined by the 'retention' parameter
-func (r *RevisionReconciler) isRevisionRetentionReconciled(retention int) []marin3rv1alpha1.EnvoyConfigRevision {
+// isTaintRetryReconciled returns the revision for the desired version if it is tainted and the retry policy
+// allows retrying it, nil otherwise. Each retry happens after a cooldown, counted from the time the revision
+// got tainted, that doubles with each attempt. If the cooldown has not yet elapsed, the remaining time is returned.
+func (r *RevisionReconciler) isTaintRetryReconciled(policy *marin3rv1alpha1.RetryPolicy, now time.Time) (*marin3rv1alpha1.EnvoyConfigRevision, time.Duration) {
+	ecr := &r.revisionList.Items[len(r.revisionList.Items)-1]
+
+	if ecr.Spec.Version != r.DesiredVersion() || ecr.Status.TaintRetries >= policy.MaxAttempts {
+		return nil, 0
+	}
+	cond := meta.FindStatusCondition(ecr.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition)
+	if cond == nil || cond.Status != metav1.ConditionTrue {
+		return nil, 0
+	}
+	// a retry has already been requested
+	if _, ok := ecr.GetAnnotations()[marin3rv1alpha1.ClearTaintAnnotation]; ok {
+		return nil, 0
+	}
+
+	if remaining := cond.LastTransitionTime.Add(policy.GetCooldown(ecr.Status.TaintRetries)).Sub(now); remaining > 0 {
+		return nil, remaining
+	}
+	return ecr, 0
+}
+
+// isRevisionRetentionReconciled removes items from the revisionList, starting from the oldest ones, until the list
+// holds the number of items determined by the 'retention' parameter. Items that have not been published for longer
+// than 'maxAge' are also removed, unless 'maxAge' is zero. The published revision, the pinned revision and the
+// revision for the desired version are never removed. The removed items are returned.
+func (r *RevisionReconciler) isRevisionRetentionReconciled(retention int, maxAge time.Duration, now time.Time) []marin3rv1alpha1.EnvoyConfigRevision {
 
 	var toBeDeleted []marin3rv1alpha1.EnvoyConfigRevision = []marin3rv1alpha1.EnvoyConfigRevision{}
 	var revisionList *[]marin3rv1alpha1.EnvoyConfigRevision = &(r.GetRevisionList().Items)
 
-	for len(*revisionList) > retention {
-		toBeDeleted = append(toBeDeleted, popRevision(revisionList))
+	excess := len(*revisionList) - retention
+	kept := make([]marin3rv1alpha1.EnvoyConfigRevision, 0, len(*revisionList))
+	for idx, ecr := range *revisionList {
+		if idx == len(*revisionList)-1 || r.isRevisionProtected(&ecr) {
+			kept = append(kept, ecr)
+			continue
+		}
+		if excess > 0 {
+			toBeDeleted = append(toBeDeleted, ecr)
+			excess--
+			continue
+		}
+		if maxAge > 0 && now.Sub(lastPublishedOrCreated(&ecr)) > maxAge {
+			toBeDeleted = append(toBeDeleted, ecr)
+			continue
+		}
+		kept = append(kept, ecr)
 	}
 
+	if len(toBeDeleted) > 0 {
+		*revisionList = kept
+	}
 	return toBeDeleted
 }
 
-// popRevision removes an EnvoyConfigRevision from a list of EnvoyConfigRevision resources, starting from
-// the lowest index in the slice. The removed element is returned as a return value and the list is
-// modified "in place".
-func popRevision(list *[]marin3rv1alpha1.EnvoyConfigRevision) marin3rv1alpha1.EnvoyConfigRevision {
-	item := (*list)[0]
-	*list = (*list)[1:]
-	return item
+// isRevisionProtected returns true for the revisions that cannot
+// be garbage collected: the published and the pinned revisions
+func (r *RevisionReconciler) isRevisionProtected(ecr *marin3rv1alpha1.EnvoyConfigRevision) bool {
+	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+		return true
+	}
+	if r.publishedVersion != nil && ecr.Spec.Version == r.PublishedVersion() {
+		return true
+	}
+	if pinned := r.Instance().Spec.PinnedVersion; pinned != nil && ecr.Spec.Version == *pinned {
+		return true
+	}
+	return false
+}
+
+// lastPublishedOrCreated returns the last time the revision was published
+// or, if it has never been published, the time it was created
+func lastPublishedOrCreated(ecr *marin3rv1alpha1.EnvoyConfigRevision) time.Time {
+	if ecr.Status.LastPublishedAt.IsZero() {
+		return ecr.GetCreationTimestamp().Time
+	}
+	return ecr.Status.LastPublishedAt.Time
 }
 
 // newRevisionForCurrentResources generates an EnvoyConfigRevision resource for the current
@@ -268,10 +601,23 @@ func (r *RevisionReconciler) newRevisionForCurrentResources() *marin3rv1alpha1.E
 			},
 		},
 		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
-			NodeID:    r.NodeID(),
-			EnvoyAPI:  pointer.New(r.EnvoyAPI()),
-			Version:   r.DesiredVersion(),
-			Resources: r.Instance().Spec.Resources,
+			NodeID:         r.NodeID(),
+			NodeIDs:        copyNodeIDs(r.Instance().Spec.NodeIDs),
+			EnvoyAPI:       pointer.New(r.EnvoyAPI()),
+			Version:        r.DesiredVersion(),
+			Resources:      r.Instance().Spec.Resources,
+			FailurePolicy:  r.Instance().Spec.FailurePolicy.DeepCopy(),
+			HealthAnalysis: r.Instance().Spec.HealthAnalysis.DeepCopy(),
+			DeletionPolicy: pointer.Copy(r.Instance().Spec.DeletionPolicy),
+			RetainTTL:      pointer.Copy(r.Instance().Spec.RetainTTL),
 		},
 	}
 }
+
+// copyNodeIDs returns a copy of the list of nodeIDs, nil if empty
+func copyNodeIDs(nodeIDs []string) []string {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	return append([]string{}, nodeIDs...)
+}
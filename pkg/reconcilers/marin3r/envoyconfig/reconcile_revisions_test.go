@@ -4,11 +4,13 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
 	reconcilerutil "github.com/3scale-ops/basereconciler/util"
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
 	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/filters"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
 	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
 	"github.com/go-logr/logr"
@@ -18,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -30,20 +33,26 @@ func init() {
 		&marin3rv1alpha1.EnvoyConfigRevision{},
 		&marin3rv1alpha1.EnvoyConfigRevisionList{},
 		&marin3rv1alpha1.EnvoyConfig{},
+		&marin3rv1alpha1.EnvoyConfigList{},
+		&marin3rv1alpha1.EnvoyResourceLibrary{},
+		&marin3rv1alpha1.EnvoyResourceLibraryList{},
+		&marin3rv1alpha1.EnvoyConfigFragment{},
+		&marin3rv1alpha1.EnvoyConfigFragmentList{},
 	)
 }
 
 func testRevisionReconcilerBuilder(s *runtime.Scheme, instance *marin3rv1alpha1.EnvoyConfig, objs ...runtime.Object) RevisionReconciler {
-	return RevisionReconciler{context.TODO(), ctrl.Log.WithName("test"), fake.NewFakeClientWithScheme(s, objs...), s, instance, nil, nil, nil, nil}
+	return RevisionReconciler{context.TODO(), ctrl.Log.WithName("test"), fake.NewFakeClientWithScheme(s, objs...), s, instance, record.NewFakeRecorder(10), nil, nil, nil, nil}
 }
 
 func TestNewRevisionReconciler(t *testing.T) {
 	type args struct {
-		ctx    context.Context
-		logger logr.Logger
-		client client.Client
-		s      *runtime.Scheme
-		ec     *marin3rv1alpha1.EnvoyConfig
+		ctx      context.Context
+		logger   logr.Logger
+		client   client.Client
+		s        *runtime.Scheme
+		ec       *marin3rv1alpha1.EnvoyConfig
+		recorder record.EventRecorder
 	}
 	tests := []struct {
 		name string
@@ -52,13 +61,13 @@ func TestNewRevisionReconciler(t *testing.T) {
 	}{
 		{
 			name: "Returns a RevisionReconciler",
-			args: args{context.TODO(), logr.Logger{}, fake.NewFakeClient(), s, nil},
-			want: RevisionReconciler{context.TODO(), logr.Logger{}, fake.NewFakeClient(), s, nil, nil, nil, nil, nil},
+			args: args{context.TODO(), logr.Logger{}, fake.NewFakeClient(), s, nil, nil},
+			want: RevisionReconciler{context.TODO(), logr.Logger{}, fake.NewFakeClient(), s, nil, nil, nil, nil, nil, nil},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewRevisionReconciler(tt.args.ctx, tt.args.logger, tt.args.client, tt.args.s, tt.args.ec); !reflect.DeepEqual(got, tt.want) {
+			if got := NewRevisionReconciler(tt.args.ctx, tt.args.logger, tt.args.client, tt.args.s, tt.args.ec, tt.args.recorder); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewRevisionReconciler() = %v, want %v", got, tt.want)
 			}
 		})
@@ -352,6 +361,11 @@ func TestRevisionReconciler_GetCacheState(t *testing.T) {
 }
 
 func TestRevisionReconciler_Reconcile(t *testing.T) {
+	legacyResources := []marin3rv1alpha1.Resource{{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "cluster"}`)}}
+	legacyVersion := (&marin3rv1alpha1.EnvoyConfig{
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{Resources: legacyResources},
+	}).GetLegacyEnvoyResourcesVersion()
+
 	type fields struct {
 		ctx    context.Context
 		logger logr.Logger
@@ -360,10 +374,11 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 		ec     *marin3rv1alpha1.EnvoyConfig
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		want    ctrl.Result
-		wantErr bool
+		name       string
+		fields     fields
+		want       ctrl.Result
+		wantErr    bool
+		wantEvents []string
 	}{
 		{
 			name: "Creates a new EnvoyConfigRevision, no error and requeue",
@@ -381,8 +396,9 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 					},
 				},
 			},
-			want:    ctrl.Result{Requeue: true},
-			wantErr: false,
+			want:       ctrl.Result{Requeue: true},
+			wantErr:    false,
+			wantEvents: []string{"Normal RevisionCreated Created revision node-v3-" + reconcilerutil.Hash([]marin3rv1alpha1.Resource{}) + " for version " + reconcilerutil.Hash([]marin3rv1alpha1.Resource{})},
 		},
 		{
 			name: "Multiple EnvoyConfigRevision for current version, error and requeue",
@@ -426,8 +442,9 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 					},
 				},
 			},
-			want:    ctrl.Result{},
-			wantErr: true,
+			want:       ctrl.Result{},
+			wantErr:    true,
+			wantEvents: []string{},
 		},
 		{
 			name: "EnvoyConfigRevision exists for current version, reconcile without error or requeue",
@@ -445,7 +462,7 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 								filters.VersionTag:  reconcilerutil.Hash([]marin3rv1alpha1.Resource{}),
 							},
 						},
-						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{},
+						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: reconcilerutil.Hash([]marin3rv1alpha1.Resource{})},
 					},
 				),
 				scheme: s,
@@ -459,18 +476,104 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 					},
 				},
 			},
-			want:    ctrl.Result{},
-			wantErr: false,
+			want:       ctrl.Result{},
+			wantErr:    false,
+			wantEvents: []string{"Normal RevisionPublished Published revision ecr1 (version " + reconcilerutil.Hash([]marin3rv1alpha1.Resource{}) + ")"},
+		},
+		{
+			name: "EnvoyConfigRevision exists for the legacy version of the current resources, reuses it",
+			fields: fields{
+				ctx:    context.TODO(),
+				logger: ctrl.Log.WithName("test"),
+				client: fake.NewFakeClientWithScheme(s,
+					&marin3rv1alpha1.EnvoyConfigRevision{
+						TypeMeta: metav1.TypeMeta{Kind: "EnvoyConfigRevision", APIVersion: "v1alpha1"},
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "ecr1", Namespace: "test",
+							Labels: map[string]string{
+								filters.NodeIDTag:   "node",
+								filters.EnvoyAPITag: envoy.APIv3.String(),
+								filters.VersionTag:  legacyVersion,
+							},
+						},
+						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: legacyVersion, Resources: legacyResources},
+					},
+				),
+				scheme: s,
+				ec: &marin3rv1alpha1.EnvoyConfig{
+					TypeMeta:   metav1.TypeMeta{Kind: "EnvoyConfig", APIVersion: "v1alpha1"},
+					ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigSpec{
+						NodeID:    "node",
+						EnvoyAPI:  pointer.New(envoy.APIv3),
+						Resources: legacyResources,
+					},
+				},
+			},
+			want:       ctrl.Result{},
+			wantErr:    false,
+			wantEvents: []string{"Normal RevisionPublished Published revision ecr1 (version " + legacyVersion + ")"},
+		},
+		{
+			name: "EnvoyConfigRevision for current version is tainted, rolls back to the previous one",
+			fields: fields{
+				ctx:    context.TODO(),
+				logger: ctrl.Log.WithName("test"),
+				client: fake.NewFakeClientWithScheme(s,
+					&marin3rv1alpha1.EnvoyConfigRevision{
+						TypeMeta: metav1.TypeMeta{Kind: "EnvoyConfigRevision", APIVersion: "v1alpha1"},
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "ecr0", Namespace: "test",
+							Labels: map[string]string{
+								filters.NodeIDTag:   "node",
+								filters.EnvoyAPITag: envoy.APIv3.String(),
+								filters.VersionTag:  "aaaa",
+							},
+						},
+						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"},
+					},
+					&marin3rv1alpha1.EnvoyConfigRevision{
+						TypeMeta: metav1.TypeMeta{Kind: "EnvoyConfigRevision", APIVersion: "v1alpha1"},
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "ecr1", Namespace: "test",
+							Labels: map[string]string{
+								filters.NodeIDTag:   "node",
+								filters.EnvoyAPITag: envoy.APIv3.String(),
+								filters.VersionTag:  reconcilerutil.Hash([]marin3rv1alpha1.Resource{}),
+							},
+						},
+						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: reconcilerutil.Hash([]marin3rv1alpha1.Resource{})},
+						Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+							Conditions: []metav1.Condition{{Type: marin3rv1alpha1.RevisionTaintedCondition, Status: metav1.ConditionTrue}},
+						},
+					},
+				),
+				scheme: s,
+				ec: &marin3rv1alpha1.EnvoyConfig{
+					TypeMeta:   metav1.TypeMeta{Kind: "EnvoyConfig", APIVersion: "v1alpha1"},
+					ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigSpec{
+						NodeID:    "node",
+						EnvoyAPI:  pointer.New(envoy.APIv3),
+						Resources: []marin3rv1alpha1.Resource{},
+					},
+				},
+			},
+			want:       ctrl.Result{},
+			wantErr:    false,
+			wantEvents: []string{"Warning RollbackPerformed Rolled back to revision ecr0 (version aaaa), the revision for version " + reconcilerutil.Hash([]marin3rv1alpha1.Resource{}) + " is tainted"},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
 			r := &RevisionReconciler{
-				ctx:    tt.fields.ctx,
-				logger: tt.fields.logger,
-				client: tt.fields.client,
-				scheme: tt.fields.scheme,
-				ec:     tt.fields.ec,
+				ctx:      tt.fields.ctx,
+				logger:   tt.fields.logger,
+				client:   tt.fields.client,
+				scheme:   tt.fields.scheme,
+				ec:       tt.fields.ec,
+				recorder: recorder,
 			}
 			got, err := r.Reconcile()
 			if (err != nil) != tt.wantErr {
@@ -480,14 +583,57 @@ func TestRevisionReconciler_Reconcile(t *testing.T) {
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("RevisionReconciler.Reconcile() = %v, want %v", got, tt.want)
 			}
+			close(recorder.Events)
+			gotEvents := []string{}
+			for event := range recorder.Events {
+				gotEvents = append(gotEvents, event)
+			}
+			if diff := deep.Equal(gotEvents, tt.wantEvents); len(diff) > 0 {
+				t.Errorf("RevisionReconciler.Reconcile() events = %v", diff)
+			}
 		})
 	}
 }
 
+func TestRevisionReconciler_Reconcile_RevisionStorage(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		TypeMeta:   metav1.TypeMeta{Kind: "EnvoyConfig", APIVersion: "v1alpha1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "test"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID:          "node",
+			RevisionStorage: pointer.New(marin3rv1alpha1.RevisionStorageSecret),
+			Resources:       []marin3rv1alpha1.Resource{{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name":"cluster"}`)}},
+		},
+	}
+	r := testRevisionReconcilerBuilder(s, ec)
+
+	if _, err := r.Reconcile(); err != nil {
+		t.Fatalf("RevisionReconciler.Reconcile() error = %v", err)
+	}
+
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{}
+	key := types.NamespacedName{Name: "node-v3-" + ec.GetEnvoyResourcesVersion(), Namespace: "test"}
+	if err := r.client.Get(context.TODO(), key, ecr); err != nil {
+		t.Fatalf("RevisionReconciler.Reconcile() revision not found: %v", err)
+	}
+	if ecr.Spec.Resources != nil || ecr.Spec.ResourcesFrom == nil || ecr.Spec.ResourcesFrom.Kind != marin3rv1alpha1.RevisionStorageSecret {
+		t.Fatalf("RevisionReconciler.Reconcile() revision spec = %v", ecr.Spec)
+	}
+
+	got, err := revisions.LoadResources(context.TODO(), r.client, ecr)
+	if err != nil {
+		t.Fatalf("revisions.LoadResources() error = %v", err)
+	}
+	if diff := deep.Equal(got, ec.Spec.Resources); len(diff) > 0 {
+		t.Errorf("revisions.LoadResources() = %v", diff)
+	}
+}
+
 func TestRevisionReconciler_getVersionToPublish(t *testing.T) {
 	tests := []struct {
 		name           string
 		revisionList   *marin3rv1alpha1.EnvoyConfigRevisionList
+		pinnedVersion  *string
 		wantVersion    string
 		wantCacheState string
 	}{
@@ -539,10 +685,50 @@ func TestRevisionReconciler_getVersionToPublish(t *testing.T) {
 			wantVersion:    "",
 			wantCacheState: marin3rv1alpha1.RollbackFailedState,
 		},
+		{
+			name: "Returns the pinned version and Pinned state",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"}},
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"}},
+				},
+			},
+			pinnedVersion:  pointer.New("aaaa"),
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.PinnedState,
+		},
+		{
+			name: "Ignores the pinned version if its revision is tainted",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"},
+						Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+							Conditions: []metav1.Condition{{
+								Type:   marin3rv1alpha1.RevisionTaintedCondition,
+								Status: metav1.ConditionTrue,
+							}}}},
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"}},
+				},
+			},
+			pinnedVersion:  pointer.New("aaaa"),
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+		{
+			name: "Ignores the pinned version if there is no revision for it",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"}},
+				},
+			},
+			pinnedVersion:  pointer.New("aaaa"),
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{})
+			r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PinnedVersion: tt.pinnedVersion}})
 			r.revisionList = tt.revisionList
 			gotVersion, gotCacheState := r.getVersionToPublish()
 			if gotVersion != tt.wantVersion {
@@ -555,6 +741,434 @@ func TestRevisionReconciler_getVersionToPublish(t *testing.T) {
 	}
 }
 
+func TestRevisionReconciler_reconcilePublicationGates(t *testing.T) {
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+	published := marin3rv1alpha1.EnvoyConfigRevision{
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"},
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			Conditions: []metav1.Condition{{
+				Type:   marin3rv1alpha1.RevisionPublishedCondition,
+				Status: metav1.ConditionTrue,
+			}}},
+	}
+	tainted := *published.DeepCopy()
+	tainted.Status.Tainted = pointer.New(true)
+	tainted.Status.Conditions = append(tainted.Status.Conditions, metav1.Condition{
+		Type:   marin3rv1alpha1.RevisionTaintedCondition,
+		Status: metav1.ConditionTrue,
+	})
+	candidate := marin3rv1alpha1.EnvoyConfigRevision{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"}}
+
+	tests := []struct {
+		name           string
+		ec             *marin3rv1alpha1.EnvoyConfig
+		revisionList   *marin3rv1alpha1.EnvoyConfigRevisionList
+		wantVersion    string
+		wantCacheState string
+		wantResult     ctrl.Result
+	}{
+		{
+			name: "Publishes if not suspended and approval is not required",
+			ec:   &marin3rv1alpha1.EnvoyConfig{},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+		{
+			name: "Holds the publication if suspended",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{Suspend: pointer.New(true)}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.SuspendedState,
+		},
+		{
+			name: "Holds the publication if suspended, even if approved",
+			ec: &marin3rv1alpha1.EnvoyConfig{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{marin3rv1alpha1.ApprovedVersionAnnotation: "xxxx"}},
+				Spec:       marin3rv1alpha1.EnvoyConfigSpec{Suspend: pointer.New(true), RequireApproval: pointer.New(true)},
+			},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.SuspendedState,
+		},
+		{
+			name: "Holds the publication until the version is approved",
+			ec: &marin3rv1alpha1.EnvoyConfig{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{marin3rv1alpha1.ApprovedVersionAnnotation: "zzzz"}},
+				Spec:       marin3rv1alpha1.EnvoyConfigSpec{RequireApproval: pointer.New(true)},
+			},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.PendingApprovalState,
+		},
+		{
+			name: "Publishes the approved version",
+			ec: &marin3rv1alpha1.EnvoyConfig{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{marin3rv1alpha1.ApprovedVersionAnnotation: "xxxx"}},
+				Spec:       marin3rv1alpha1.EnvoyConfigSpec{RequireApproval: pointer.New(true)},
+			},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+		{
+			name: "Publishes inside a publish window",
+			ec: &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PublishWindows: []marin3rv1alpha1.PublishWindow{
+				{Schedule: "0 8 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Schedule: "0 11 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}},
+			}}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+		{
+			name: "Holds the publication until the next publish window opens",
+			ec: &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PublishWindows: []marin3rv1alpha1.PublishWindow{
+				{Schedule: "0 8 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Schedule: "30 14 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			}}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.OutsidePublishWindowState,
+			wantResult:     ctrl.Result{RequeueAfter: 150 * time.Minute},
+		},
+		{
+			name: "Holds the publication if the publish windows are invalid",
+			ec: &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PublishWindows: []marin3rv1alpha1.PublishWindow{
+				{Schedule: "invalid", Duration: metav1.Duration{Duration: time.Hour}},
+			}}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.OutsidePublishWindowState,
+		},
+		{
+			name: "Publishes if there is no published revision",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{Suspend: pointer.New(true)}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{candidate},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+		{
+			name: "Publishes if the published revision is tainted",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{Suspend: pointer.New(true)}},
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{tainted, candidate},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRevisionReconcilerBuilder(s, tt.ec)
+			r.revisionList = tt.revisionList.DeepCopy()
+			gotVersion, gotCacheState, gotResult := r.reconcilePublicationGates("xxxx", now)
+			if gotVersion != tt.wantVersion {
+				t.Errorf("RevisionReconciler.reconcilePublicationGates() gotVersion = %v, want %v", gotVersion, tt.wantVersion)
+			}
+			if gotCacheState != tt.wantCacheState {
+				t.Errorf("RevisionReconciler.reconcilePublicationGates() gotCacheState = %v, want %v", gotCacheState, tt.wantCacheState)
+			}
+			if gotResult != tt.wantResult {
+				t.Errorf("RevisionReconciler.reconcilePublicationGates() gotResult = %v, want %v", gotResult, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestRevisionReconciler_reconcileRollout(t *testing.T) {
+	now := time.Now()
+	published := marin3rv1alpha1.EnvoyConfigRevision{
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"},
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			Conditions: []metav1.Condition{{
+				Type:   marin3rv1alpha1.RevisionPublishedCondition,
+				Status: metav1.ConditionTrue,
+			}}},
+	}
+	candidate := func(rollout *marin3rv1alpha1.RevisionRolloutStatus) marin3rv1alpha1.EnvoyConfigRevision {
+		return marin3rv1alpha1.EnvoyConfigRevision{
+			Spec:   marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"},
+			Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Rollout: rollout},
+		}
+	}
+	policy := &marin3rv1alpha1.RolloutPolicy{Steps: []marin3rv1alpha1.RolloutStep{
+		{Percentage: 10, BakeTime: &metav1.Duration{Duration: time.Minute}},
+		{Percentage: 50},
+	}}
+
+	tests := []struct {
+		name           string
+		revisionList   *marin3rv1alpha1.EnvoyConfigRevisionList
+		wantVersion    string
+		wantCacheState string
+		wantRollout    *marin3rv1alpha1.RevisionRolloutStatus
+		wantResult     ctrl.Result
+	}{
+		{
+			name: "Publishes directly if there is no published revision",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{candidate(nil)},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+			wantRollout:    nil,
+		},
+		{
+			name: "Starts the rollout",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate(nil)},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.RolloutState,
+			wantRollout:    &marin3rv1alpha1.RevisionRolloutStatus{Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now)},
+		},
+		{
+			name: "Waits for the selected pods to be in sync",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate(&marin3rv1alpha1.RevisionRolloutStatus{
+					Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now.Add(-time.Hour)),
+					SelectedPods: pointer.New(int32(2)), PodsInSync: pointer.New(int32(1)),
+				})},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.RolloutState,
+			wantRollout: &marin3rv1alpha1.RevisionRolloutStatus{
+				Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now.Add(-time.Hour)),
+				SelectedPods: pointer.New(int32(2)), PodsInSync: pointer.New(int32(1)),
+			},
+		},
+		{
+			name: "Waits for the bake time to elapse",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate(&marin3rv1alpha1.RevisionRolloutStatus{
+					Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now.Add(-10 * time.Second)),
+					SelectedPods: pointer.New(int32(2)), PodsInSync: pointer.New(int32(2)),
+				})},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.RolloutState,
+			wantRollout: &marin3rv1alpha1.RevisionRolloutStatus{
+				Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now.Add(-10 * time.Second)),
+				SelectedPods: pointer.New(int32(2)), PodsInSync: pointer.New(int32(2)),
+			},
+			wantResult: ctrl.Result{RequeueAfter: 50 * time.Second},
+		},
+		{
+			name: "Promotes to the next step",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate(&marin3rv1alpha1.RevisionRolloutStatus{
+					Step: 0, Percentage: 10, StepStartedAt: metav1.NewTime(now.Add(-time.Hour)),
+					SelectedPods: pointer.New(int32(2)), PodsInSync: pointer.New(int32(2)),
+				})},
+			},
+			wantVersion:    "aaaa",
+			wantCacheState: marin3rv1alpha1.RolloutState,
+			wantRollout:    &marin3rv1alpha1.RevisionRolloutStatus{Step: 1, Percentage: 50, StepStartedAt: metav1.NewTime(now)},
+		},
+		{
+			name: "Publishes after the last step",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{published, candidate(&marin3rv1alpha1.RevisionRolloutStatus{
+					Step: 1, Percentage: 50, StepStartedAt: metav1.NewTime(now),
+					SelectedPods: pointer.New(int32(5)), PodsInSync: pointer.New(int32(5)),
+				})},
+			},
+			wantVersion:    "xxxx",
+			wantCacheState: marin3rv1alpha1.InSyncState,
+			wantRollout:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{Rollout: policy}})
+			r.revisionList = tt.revisionList.DeepCopy()
+			gotVersion, gotCacheState, gotResult := r.reconcileRollout("xxxx", now)
+			if gotVersion != tt.wantVersion {
+				t.Errorf("RevisionReconciler.reconcileRollout() gotVersion = %v, want %v", gotVersion, tt.wantVersion)
+			}
+			if gotCacheState != tt.wantCacheState {
+				t.Errorf("RevisionReconciler.reconcileRollout() gotCacheState = %v, want %v", gotCacheState, tt.wantCacheState)
+			}
+			if gotResult != tt.wantResult {
+				t.Errorf("RevisionReconciler.reconcileRollout() gotResult = %v, want %v", gotResult, tt.wantResult)
+			}
+			gotRollout := r.revisionList.Items[len(r.revisionList.Items)-1].Status.Rollout
+			if diff := deep.Equal(gotRollout, tt.wantRollout); len(diff) > 0 {
+				t.Errorf("RevisionReconciler.reconcileRollout() rollout diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestRevisionReconciler_abortStaleRollouts(t *testing.T) {
+	rollout := &marin3rv1alpha1.RevisionRolloutStatus{Step: 0, Percentage: 10}
+	list := &marin3rv1alpha1.EnvoyConfigRevisionList{
+		Items: []marin3rv1alpha1.EnvoyConfigRevision{
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"},
+				Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Rollout: rollout}},
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"},
+				Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Rollout: rollout}},
+		},
+	}
+
+	t.Run("Keeps the rollout of the top revision", func(t *testing.T) {
+		r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{})
+		r.revisionList = list.DeepCopy()
+		r.abortStaleRollouts(marin3rv1alpha1.RolloutState)
+		if r.revisionList.Items[0].Status.Rollout != nil || r.revisionList.Items[1].Status.Rollout == nil {
+			t.Errorf("RevisionReconciler.abortStaleRollouts() got = %v", r.revisionList.Items)
+		}
+	})
+
+	t.Run("Aborts all rollouts if not in rollout state", func(t *testing.T) {
+		r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{})
+		r.revisionList = list.DeepCopy()
+		r.abortStaleRollouts(marin3rv1alpha1.RollbackState)
+		if r.revisionList.Items[0].Status.Rollout != nil || r.revisionList.Items[1].Status.Rollout != nil {
+			t.Errorf("RevisionReconciler.abortStaleRollouts() got = %v", r.revisionList.Items)
+		}
+	})
+}
+
+func TestRevisionReconciler_isTaintRetryReconciled(t *testing.T) {
+	now := time.Now()
+	policy := &marin3rv1alpha1.RetryPolicy{MaxAttempts: 2}
+	tainted := func(since time.Duration, retries int32, annotations map[string]string) marin3rv1alpha1.EnvoyConfigRevision {
+		return marin3rv1alpha1.EnvoyConfigRevision{
+			ObjectMeta: metav1.ObjectMeta{Annotations: annotations},
+			Spec:       marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"},
+			Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+				Conditions: []metav1.Condition{{
+					Type:               marin3rv1alpha1.RevisionTaintedCondition,
+					Status:             metav1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(now.Add(-since)),
+				}},
+				TaintRetries: retries,
+			},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		revisionList  *marin3rv1alpha1.EnvoyConfigRevisionList
+		wantRetry     bool
+		wantRemaining time.Duration
+	}{
+		{
+			name: "Retries once the cooldown elapses",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{tainted(2*time.Minute, 0, nil)},
+			},
+			wantRetry: true,
+		},
+		{
+			name: "Waits for the cooldown, which doubles with each attempt",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{tainted(30*time.Second, 1, nil)},
+			},
+			wantRetry:     false,
+			wantRemaining: 90 * time.Second,
+		},
+		{
+			name: "Max attempts reached",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{tainted(time.Hour, 2, nil)},
+			},
+			wantRetry: false,
+		},
+		{
+			name: "Retry already requested",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{tainted(time.Hour, 0,
+					map[string]string{marin3rv1alpha1.ClearTaintAnnotation: marin3rv1alpha1.ClearTaintRetryValue})},
+			},
+			wantRetry: false,
+		},
+		{
+			name: "Revision is not tainted",
+			revisionList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx"}},
+				},
+			},
+			wantRetry: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{})
+			r.desiredVersion = pointer.New("xxxx")
+			r.revisionList = tt.revisionList.DeepCopy()
+			got, gotRemaining := r.isTaintRetryReconciled(policy, now)
+			if (got != nil) != tt.wantRetry {
+				t.Errorf("RevisionReconciler.isTaintRetryReconciled() got = %v, wantRetry %v", got, tt.wantRetry)
+			}
+			if gotRemaining != tt.wantRemaining {
+				t.Errorf("RevisionReconciler.isTaintRetryReconciled() gotRemaining = %v, want %v", gotRemaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRevisionReconciler_isRevisionPoliciesReconciled(t *testing.T) {
+	policy := &marin3rv1alpha1.FailurePolicy{NACKsPerPod: pointer.New(int32(1))}
+	deletionPolicy := pointer.New(marin3rv1alpha1.DeletionPolicyRetain)
+	ttl := &metav1.Duration{Duration: time.Hour}
+	analysis := &marin3rv1alpha1.HealthAnalysis{Thresholds: []marin3rv1alpha1.StatThreshold{{Stat: "cluster.*.upstream_rq_5xx"}}}
+	r := testRevisionReconcilerBuilder(s, &marin3rv1alpha1.EnvoyConfig{
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{NodeIDs: []string{"other"}, FailurePolicy: policy, DeletionPolicy: deletionPolicy, RetainTTL: ttl, HealthAnalysis: analysis},
+	})
+	r.revisionList = &marin3rv1alpha1.EnvoyConfigRevisionList{
+		Items: []marin3rv1alpha1.EnvoyConfigRevision{
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "aaaa"}},
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "bbbb", FailurePolicy: policy.DeepCopy()}},
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "xxxx", NodeIDs: []string{"other"}, FailurePolicy: policy.DeepCopy(), HealthAnalysis: analysis.DeepCopy(),
+				DeletionPolicy: pointer.New(marin3rv1alpha1.DeletionPolicyRetain), RetainTTL: &metav1.Duration{Duration: time.Hour}}},
+		},
+	}
+
+	got := r.isRevisionPoliciesReconciled()
+	if len(got) != 2 || got[0].Spec.Version != "aaaa" || got[1].Spec.Version != "bbbb" {
+		t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() got = %v", got)
+	}
+	for _, ecr := range r.revisionList.Items {
+		if diff := deep.Equal(ecr.Spec.NodeIDs, []string{"other"}); len(diff) > 0 {
+			t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() nodeIDs diff = %v", diff)
+		}
+		if diff := deep.Equal(ecr.Spec.FailurePolicy, policy); len(diff) > 0 {
+			t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() failure policy diff = %v", diff)
+		}
+		if diff := deep.Equal(ecr.Spec.HealthAnalysis, analysis); len(diff) > 0 {
+			t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() health analysis diff = %v", diff)
+		}
+		if diff := deep.Equal(ecr.Spec.DeletionPolicy, deletionPolicy); len(diff) > 0 {
+			t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() deletion policy diff = %v", diff)
+		}
+		if diff := deep.Equal(ecr.Spec.RetainTTL, ttl); len(diff) > 0 {
+			t.Errorf("RevisionReconciler.isRevisionPoliciesReconciled() retain ttl diff = %v", diff)
+		}
+	}
+}
+
 func TestRevisionReconciler_isRevisionPublishedConditionReconciled(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -770,18 +1384,18 @@ func TestRevisionReconciler_newRevisionForCurrentResources(t *testing.T) {
 			),
 			want: &marin3rv1alpha1.EnvoyConfigRevision{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      "node-v3-6b64fb99b6",
+					Name:      "node-v3-655fcdd7c9",
 					Namespace: "test",
 					Labels: map[string]string{
 						filters.EnvoyAPITag: envoy.APIv3.String(),
 						filters.NodeIDTag:   "node",
-						filters.VersionTag:  "6b64fb99b6",
+						filters.VersionTag:  "655fcdd7c9",
 					},
 				},
 				Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
 					NodeID:   "node",
 					EnvoyAPI: pointer.New(envoy.APIv3),
-					Version:  "6b64fb99b6",
+					Version:  "655fcdd7c9",
 					Resources: []marin3rv1alpha1.Resource{
 						{
 							Type:  "endpoint",
@@ -815,7 +1429,9 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 	}
 	type args struct {
 		retention int
+		maxAge    time.Duration
 	}
+	now := time.Now()
 	tests := []struct {
 		name        string
 		fields      fields
@@ -825,7 +1441,7 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 	}{
 		{
 			name: "Resulting list has 'retention' elements and returns trimmed elements",
-			fields: fields{nil, logr.Logger{}, nil, nil, nil, nil, nil, nil,
+			fields: fields{nil, logr.Logger{}, nil, nil, &marin3rv1alpha1.EnvoyConfig{}, nil, nil, nil,
 				&marin3rv1alpha1.EnvoyConfigRevisionList{
 					Items: []marin3rv1alpha1.EnvoyConfigRevision{
 						{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}},
@@ -847,7 +1463,7 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 		},
 		{
 			name: "List is not modified if elements within 'retention' parameter",
-			fields: fields{nil, logr.Logger{}, nil, nil, nil, nil, nil, nil,
+			fields: fields{nil, logr.Logger{}, nil, nil, &marin3rv1alpha1.EnvoyConfig{}, nil, nil, nil,
 				&marin3rv1alpha1.EnvoyConfigRevisionList{
 					Items: []marin3rv1alpha1.EnvoyConfigRevision{
 						{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}},
@@ -862,6 +1478,61 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Published and pinned revisions are never trimmed",
+			fields: fields{nil, logr.Logger{}, nil, nil,
+				&marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PinnedVersion: pointer.New("2")}}, nil, nil, nil,
+				&marin3rv1alpha1.EnvoyConfigRevisionList{
+					Items: []marin3rv1alpha1.EnvoyConfigRevision{
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "1"},
+							Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Conditions: []metav1.Condition{
+								{Type: marin3rv1alpha1.RevisionPublishedCondition, Status: metav1.ConditionTrue},
+							}}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr2"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "2"}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr3"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "3"}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr4"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "4"}},
+					},
+				},
+			},
+			args: args{retention: 1},
+			wantTrimmed: []marin3rv1alpha1.EnvoyConfigRevision{
+				{ObjectMeta: metav1.ObjectMeta{Name: "ecr3"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "3"}},
+			},
+			wantList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "1"},
+						Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Conditions: []metav1.Condition{
+							{Type: marin3rv1alpha1.RevisionPublishedCondition, Status: metav1.ConditionTrue},
+						}}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "ecr2"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "2"}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "ecr4"}, Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "4"}},
+				},
+			},
+		},
+		{
+			name: "Revisions older than 'maxAge' are trimmed",
+			fields: fields{nil, logr.Logger{}, nil, nil, &marin3rv1alpha1.EnvoyConfig{}, nil, nil, nil,
+				&marin3rv1alpha1.EnvoyConfigRevisionList{
+					Items: []marin3rv1alpha1.EnvoyConfigRevision{
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr1", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr2", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))},
+							Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{LastPublishedAt: pointer.New(metav1.NewTime(now.Add(-time.Hour)))}},
+						{ObjectMeta: metav1.ObjectMeta{Name: "ecr3", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}},
+					},
+				},
+			},
+			args: args{retention: 10, maxAge: 24 * time.Hour},
+			wantTrimmed: []marin3rv1alpha1.EnvoyConfigRevision{
+				{ObjectMeta: metav1.ObjectMeta{Name: "ecr1", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}},
+			},
+			wantList: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{ObjectMeta: metav1.ObjectMeta{Name: "ecr2", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))},
+						Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{LastPublishedAt: pointer.New(metav1.NewTime(now.Add(-time.Hour)))}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "ecr3", CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -876,7 +1547,7 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 				cacheState:       tt.fields.cacheState,
 				revisionList:     tt.fields.revisionList,
 			}
-			if got := r.isRevisionRetentionReconciled(tt.args.retention); !reflect.DeepEqual(got, tt.wantTrimmed) {
+			if got := r.isRevisionRetentionReconciled(tt.args.retention, tt.args.maxAge, now); !reflect.DeepEqual(got, tt.wantTrimmed) {
 				t.Errorf("RevisionReconciler.isRevisionRetentionReconciled() = %v, want %v", got, tt.wantTrimmed)
 			}
 			if !reflect.DeepEqual(r.GetRevisionList(), tt.wantList) {
@@ -885,39 +1556,3 @@ func TestRevisionReconciler_isRevisionRetentionReconciled(t *testing.T) {
 		})
 	}
 }
-
-func Test_popRevision(t *testing.T) {
-	type args struct {
-		list *[]marin3rv1alpha1.EnvoyConfigRevision
-	}
-	tests := []struct {
-		name     string
-		list     []marin3rv1alpha1.EnvoyConfigRevision
-		wantItem marin3rv1alpha1.EnvoyConfigRevision
-		wantList []marin3rv1alpha1.EnvoyConfigRevision
-	}{
-		{
-			name: "Pops an element from the list",
-			list: []marin3rv1alpha1.EnvoyConfigRevision{
-				{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}},
-				{ObjectMeta: metav1.ObjectMeta{Name: "ecr2"}},
-				{ObjectMeta: metav1.ObjectMeta{Name: "ecr3"}},
-			},
-			wantItem: marin3rv1alpha1.EnvoyConfigRevision{ObjectMeta: metav1.ObjectMeta{Name: "ecr1"}},
-			wantList: []marin3rv1alpha1.EnvoyConfigRevision{
-				{ObjectMeta: metav1.ObjectMeta{Name: "ecr2"}},
-				{ObjectMeta: metav1.ObjectMeta{Name: "ecr3"}},
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := popRevision(&tt.list); !reflect.DeepEqual(got, tt.wantItem) {
-				t.Errorf("popRevision() = %v, want %v", got, tt.wantItem)
-			}
-			if !reflect.DeepEqual(tt.list, tt.wantList) {
-				t.Errorf("popRevision() = %v, want %v", tt.list, tt.wantList)
-			}
-		})
-	}
-}
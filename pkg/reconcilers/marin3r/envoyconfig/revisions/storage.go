@@ -0,0 +1,179 @@
+package revisions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// ResourcesShardKey is the key of the ConfigMap or Secret data that holds a shard
+	ResourcesShardKey string = "resources.json.gz"
+	// shardSize is the maximum size, in bytes, of each shard. It is kept well
+	// below the 1MiB limit of the data of ConfigMaps and Secrets.
+	shardSize int = 768 * 1024
+)
+
+// ShardName returns the name of the ConfigMap or Secret that holds
+// the shard with the given index of the resources of a revision
+func ShardName(ecr *marin3rv1alpha1.EnvoyConfigRevision, idx int) string {
+	return fmt.Sprintf("%s-%d", ecr.GetName(), idx)
+}
+
+// EncodeResources serializes the resources to JSON, compresses them with
+// gzip and splits the result into shards of at most shardSize bytes
+func EncodeResources(resources []marin3rv1alpha1.Resource) ([][]byte, error) {
+	data, err := json.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	compressed := buf.Bytes()
+	shards := [][]byte{}
+	for len(compressed) > shardSize {
+		shards = append(shards, compressed[:shardSize])
+		compressed = compressed[shardSize:]
+	}
+	return append(shards, compressed), nil
+}
+
+// DecodeResources joins the shards, decompresses them and
+// deserializes the resulting JSON into a list of resources
+func DecodeResources(shards [][]byte) ([]marin3rv1alpha1.Resource, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(shards, nil)))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []marin3rv1alpha1.Resource{}
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// NewShardedRevision sets the spec.resourcesFrom field of the EnvoyConfigRevision so its resources are
+// read from ConfigMaps or Secrets of the given kind, clearing the spec.resources field. It returns the
+// shards, which need to be stored with StoreShards once the EnvoyConfigRevision has been created.
+func NewShardedRevision(ecr *marin3rv1alpha1.EnvoyConfigRevision, kind marin3rv1alpha1.RevisionStorage) ([][]byte, error) {
+	shards, err := EncodeResources(ecr.Spec.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(shards))
+	for idx := range shards {
+		names[idx] = ShardName(ecr, idx)
+	}
+	ecr.Spec.Resources = nil
+	ecr.Spec.ResourcesFrom = &marin3rv1alpha1.ResourcesSource{Kind: kind, Shards: names}
+
+	return shards, nil
+}
+
+// StoreShards creates the immutable ConfigMaps or Secrets listed in the spec.resourcesFrom field of the
+// EnvoyConfigRevision with the given shards. They are owned by the EnvoyConfigRevision so they are
+// garbage collected along with it.
+func StoreShards(ctx context.Context, k8sClient client.Client, s *runtime.Scheme,
+	ecr *marin3rv1alpha1.EnvoyConfigRevision, shards [][]byte) error {
+
+	for idx, name := range ecr.Spec.ResourcesFrom.Shards {
+		obj := newShardObject(ecr.Spec.ResourcesFrom.Kind)
+		obj.SetName(name)
+		obj.SetNamespace(ecr.GetNamespace())
+		obj.SetLabels(ecr.GetLabels())
+
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			o.BinaryData = map[string][]byte{ResourcesShardKey: shards[idx]}
+			o.Immutable = pointer.New(true)
+		case *corev1.Secret:
+			o.Data = map[string][]byte{ResourcesShardKey: shards[idx]}
+			o.Immutable = pointer.New(true)
+		}
+
+		if err := controllerutil.SetControllerReference(ecr, obj, s); err != nil {
+			return err
+		}
+		if err := k8sClient.Create(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsOwnedByMarin3r returns true if the object is controlled by a marin3r object, like the ConfigMaps
+// that hold the diff of an EnvoyConfig or the shards of the resources of an EnvoyConfigRevision.
+// These are never referenced by the resources, so their events can be ignored by the controllers
+// that watch the ConfigMaps and Secrets the resources are read or generated from.
+func IsOwnedByMarin3r(o client.Object) bool {
+	owner := metav1.GetControllerOf(o)
+	return owner != nil && owner.APIVersion == marin3rv1alpha1.GroupVersion.String()
+}
+
+// LoadResources returns the resources of the EnvoyConfigRevision, reading them from the shards
+// listed in the spec.resourcesFrom field if set. Errors are wrapped so they are not mistaken
+// for errors in the resources themselves.
+func LoadResources(ctx context.Context, k8sClient client.Client, ecr *marin3rv1alpha1.EnvoyConfigRevision) ([]marin3rv1alpha1.Resource, error) {
+	if ecr.Spec.ResourcesFrom == nil {
+		return ecr.Spec.Resources, nil
+	}
+
+	shards := make([][]byte, len(ecr.Spec.ResourcesFrom.Shards))
+	for idx, name := range ecr.Spec.ResourcesFrom.Shards {
+		obj := newShardObject(ecr.Spec.ResourcesFrom.Kind)
+		key := types.NamespacedName{Name: name, Namespace: ecr.GetNamespace()}
+		if err := k8sClient.Get(ctx, key, obj); err != nil {
+			return nil, fmt.Errorf("unable to get shard %s of the resources: %w", name, err)
+		}
+
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			shards[idx] = o.BinaryData[ResourcesShardKey]
+		case *corev1.Secret:
+			shards[idx] = o.Data[ResourcesShardKey]
+		}
+	}
+
+	resources, err := DecodeResources(shards)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the resources: %w", err)
+	}
+	return resources, nil
+}
+
+// newShardObject returns an empty object of the given kind of revision storage
+func newShardObject(kind marin3rv1alpha1.RevisionStorage) client.Object {
+	if kind == marin3rv1alpha1.RevisionStorageSecret {
+		return &corev1.Secret{}
+	}
+	return &corev1.ConfigMap{}
+}
@@ -0,0 +1,160 @@
+package revisions
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	k8sutil "github.com/3scale-ops/marin3r/pkg/util/k8s"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testStorageResources returns a list of clusters whose names don't compress
+// well, so the compressed resources take roughly 37 bytes per cluster
+func testStorageResources(count int) []marin3rv1alpha1.Resource {
+	resources := make([]marin3rv1alpha1.Resource, count)
+	for i := 0; i < count; i++ {
+		resources[i] = marin3rv1alpha1.Resource{
+			Type:  envoy.Cluster,
+			Value: k8sutil.StringtoRawExtension(fmt.Sprintf(`{"name":"%x"}`, sha256.Sum256([]byte(fmt.Sprint(i))))),
+		}
+	}
+	return resources
+}
+
+func TestEncodeResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		resources  []marin3rv1alpha1.Resource
+		wantShards int
+	}{
+		{"Returns a single shard for small revisions", testStorageResources(10), 1},
+		{"Splits large revisions into several shards", testStorageResources(50000), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shards, err := EncodeResources(tt.resources)
+			if err != nil {
+				t.Fatalf("EncodeResources() error = %v", err)
+			}
+			if len(shards) != tt.wantShards {
+				t.Errorf("EncodeResources() got %v shards, want %v", len(shards), tt.wantShards)
+			}
+			for _, shard := range shards {
+				if len(shard) > shardSize {
+					t.Errorf("EncodeResources() got a shard of %v bytes", len(shard))
+				}
+			}
+			got, err := DecodeResources(shards)
+			if err != nil {
+				t.Fatalf("DecodeResources() error = %v", err)
+			}
+			if diff := deep.Equal(got, tt.resources); len(diff) > 0 {
+				t.Errorf("DecodeResources() = %v", diff)
+			}
+		})
+	}
+}
+
+func TestStoreShards_LoadResources(t *testing.T) {
+	resources := testStorageResources(25000)
+
+	for _, kind := range []marin3rv1alpha1.RevisionStorage{marin3rv1alpha1.RevisionStorageConfigMap, marin3rv1alpha1.RevisionStorageSecret} {
+		t.Run(string(kind), func(t *testing.T) {
+			ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+				ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "default", UID: "uid"},
+				Spec:       marin3rv1alpha1.EnvoyConfigRevisionSpec{NodeID: "node", Version: "xxxx", Resources: resources},
+			}
+			cl := fake.NewClientBuilder().WithScheme(s).Build()
+
+			shards, err := NewShardedRevision(ecr, kind)
+			if err != nil {
+				t.Fatalf("NewShardedRevision() error = %v", err)
+			}
+			if ecr.Spec.Resources != nil || ecr.Spec.ResourcesFrom == nil || ecr.Spec.ResourcesFrom.Kind != kind {
+				t.Fatalf("NewShardedRevision() spec = %v", ecr.Spec)
+			}
+			if diff := deep.Equal(ecr.Spec.ResourcesFrom.Shards, []string{"ecr-0", "ecr-1"}); len(diff) > 0 {
+				t.Errorf("NewShardedRevision() shards = %v", diff)
+			}
+
+			if err := StoreShards(context.TODO(), cl, s, ecr, shards); err != nil {
+				t.Fatalf("StoreShards() error = %v", err)
+			}
+			obj := newShardObject(kind)
+			if err := cl.Get(context.TODO(), types.NamespacedName{Name: "ecr-1", Namespace: "default"}, obj); err != nil {
+				t.Fatalf("StoreShards() shard not found: %v", err)
+			}
+			if len(obj.GetOwnerReferences()) != 1 || obj.GetOwnerReferences()[0].Name != "ecr" {
+				t.Errorf("StoreShards() owner references = %v", obj.GetOwnerReferences())
+			}
+
+			got, err := LoadResources(context.TODO(), cl, ecr)
+			if err != nil {
+				t.Fatalf("LoadResources() error = %v", err)
+			}
+			if diff := deep.Equal(got, resources); len(diff) > 0 {
+				t.Errorf("LoadResources() = %v", diff)
+			}
+
+			// a missing shard must not be reported as a StatusError,
+			// as those taint the revision
+			if err := cl.Delete(context.TODO(), obj); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadResources(context.TODO(), cl, ecr); err == nil {
+				t.Errorf("LoadResources() expected an error")
+			} else if _, ok := err.(*errors.StatusError); ok {
+				t.Errorf("LoadResources() error = %v, must not be a StatusError", err)
+			}
+		})
+	}
+}
+
+func TestIsOwnedByMarin3r(t *testing.T) {
+	controlledBy := func(apiVersion, kind string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: "owner", Controller: pointer.New(true)}}
+	}
+	tests := []struct {
+		name   string
+		owners []metav1.OwnerReference
+		want   bool
+	}{
+		{"Not owned", nil, false},
+		{"Shard of an EnvoyConfigRevision", controlledBy(marin3rv1alpha1.GroupVersion.String(), "EnvoyConfigRevision"), true},
+		{"Diff of an EnvoyConfig", controlledBy(marin3rv1alpha1.GroupVersion.String(), "EnvoyConfig"), true},
+		{"Controlled by another API group", controlledBy("operator.marin3r.3scale.net/v1alpha1", "DiscoveryServiceCertificate"), false},
+		{"Owned but not controlled", []metav1.OwnerReference{{APIVersion: marin3rv1alpha1.GroupVersion.String(), Kind: "EnvoyConfig", Name: "owner"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default", OwnerReferences: tt.owners}}
+			if got := IsOwnedByMarin3r(obj); got != tt.want {
+				t.Errorf("IsOwnedByMarin3r() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadResources_Inline(t *testing.T) {
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "default"},
+		Spec:       marin3rv1alpha1.EnvoyConfigRevisionSpec{Resources: testStorageResources(1)},
+	}
+	got, err := LoadResources(context.TODO(), fake.NewClientBuilder().WithScheme(s).Build(), ecr)
+	if err != nil {
+		t.Fatalf("LoadResources() error = %v", err)
+	}
+	if diff := deep.Equal(got, ecr.Spec.Resources); len(diff) > 0 {
+		t.Errorf("LoadResources() = %v", diff)
+	}
+}
@@ -0,0 +1,67 @@
+package revisions
+
+import (
+	"context"
+	"fmt"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// ResolveValue returns the value of a resource read from the key of the ConfigMap or Secret
+// referenced by its valueFrom field, converted to JSON if written in YAML. Missing objects or
+// keys are an error unless the reference is optional, in which case false is returned.
+func ResolveValue(ctx context.Context, k8sClient client.Client, namespace string, src *marin3rv1alpha1.ResourceValueSource) ([]byte, bool, error) {
+	var obj client.Object
+	var name, key, kind string
+	var optional *bool
+
+	switch {
+	case src.ConfigMapKeyRef != nil:
+		obj, kind = &corev1.ConfigMap{}, "ConfigMap"
+		name, key, optional = src.ConfigMapKeyRef.Name, src.ConfigMapKeyRef.Key, src.ConfigMapKeyRef.Optional
+	case src.SecretKeyRef != nil:
+		obj, kind = &corev1.Secret{}, "Secret"
+		name, key, optional = src.SecretKeyRef.Name, src.SecretKeyRef.Key, src.SecretKeyRef.Optional
+	default:
+		return nil, false, fmt.Errorf("one of 'configMapKeyRef', 'secretKeyRef' must be set")
+	}
+
+	if err := k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, obj); err != nil {
+		if errors.IsNotFound(err) && optional != nil && *optional {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("unable to get %s '%s': %w", kind, name, err)
+	}
+
+	var data []byte
+	var ok bool
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		var s string
+		if s, ok = o.Data[key]; ok {
+			data = []byte(s)
+		} else {
+			data, ok = o.BinaryData[key]
+		}
+	case *corev1.Secret:
+		data, ok = o.Data[key]
+	}
+	if !ok {
+		if optional != nil && *optional {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("key '%s' not found in %s '%s'", key, kind, name)
+	}
+
+	// JSON is a subset of YAML, so both are converted the same way
+	value, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to decode key '%s' of %s '%s': %w", key, kind, name, err)
+	}
+	return value, true, nil
+}
@@ -0,0 +1,78 @@
+package revisions
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testConfigMapValueSource(name, key string, optional bool) *marin3rv1alpha1.ResourceValueSource {
+	return &marin3rv1alpha1.ResourceValueSource{
+		ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  key,
+			Optional:             pointer.New(optional),
+		},
+	}
+}
+
+func TestResolveValue(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "default"},
+		Data: map[string]string{
+			"json": `{"name": "route"}`,
+			"yaml": "name: route\nvirtual_hosts:\n- name: vhost\n  domains: [\"*\"]\n",
+			"bad":  "name: [route",
+		},
+		BinaryData: map[string][]byte{"binary": []byte(`{"name": "route"}`)},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default"},
+		Data:       map[string][]byte{"yaml": []byte("name: route\n")},
+	}
+
+	tests := []struct {
+		name      string
+		src       *marin3rv1alpha1.ResourceValueSource
+		want      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"Reads JSON from a ConfigMap", testConfigMapValueSource("cm", "json", false), `{"name":"route"}`, true, false},
+		{"Converts YAML to JSON", testConfigMapValueSource("cm", "yaml", false), `{"name":"route","virtual_hosts":[{"domains":["*"],"name":"vhost"}]}`, true, false},
+		{"Reads the binary data of a ConfigMap", testConfigMapValueSource("cm", "binary", false), `{"name":"route"}`, true, false},
+		{
+			name: "Reads from a Secret",
+			src: &marin3rv1alpha1.ResourceValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "secret"}, Key: "yaml"}},
+			want: `{"name":"route"}`, wantFound: true, wantErr: false,
+		},
+		{"Returns not found for an optional missing key", testConfigMapValueSource("cm", "missing", true), "", false, false},
+		{"Returns not found for an optional missing ConfigMap", testConfigMapValueSource("missing", "json", true), "", false, false},
+		{"Fails for a missing key", testConfigMapValueSource("cm", "missing", false), "", false, true},
+		{"Fails for a missing ConfigMap", testConfigMapValueSource("missing", "json", false), "", false, true},
+		{"Fails for content that is not JSON or YAML", testConfigMapValueSource("cm", "bad", false), "", false, true},
+		{"Fails without a reference", &marin3rv1alpha1.ResourceValueSource{}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := fake.NewClientBuilder().WithScheme(s).WithObjects(cm, secret).Build()
+			got, found, err := ResolveValue(context.TODO(), cl, "default", tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("ResolveValue() found = %v, want %v", found, tt.wantFound)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ResolveValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,24 @@
 package reconcilers
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"time"
 
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // IsStatusReconciled calculates the status of the resource
-func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVersion string, list *marin3rv1alpha1.EnvoyConfigRevisionList) bool {
+func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, desiredVersion, publishedVersion string,
+	list *marin3rv1alpha1.EnvoyConfigRevisionList, diff *marin3rv1alpha1.ConfigDiff, dStats *stats.Stats) bool {
 
 	ok := true
 
@@ -20,8 +28,6 @@ func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVe
 		ok = false
 	}
 
-	desiredVersion := ec.GetEnvoyResourcesVersion()
-
 	if ec.Status.PublishedVersion == nil || *ec.Status.PublishedVersion != publishedVersion {
 		ec.Status.PublishedVersion = &publishedVersion
 		ok = false
@@ -32,6 +38,23 @@ func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVe
 		ok = false
 	}
 
+	pendingVersion := generatePendingVersion(list, cacheState)
+	if !reflect.DeepEqual(ec.Status.PendingVersion, pendingVersion) {
+		ec.Status.PendingVersion = pendingVersion
+		ok = false
+	}
+
+	nextPublishWindow := generateNextPublishWindow(ec, time.Now())
+	if !reflect.DeepEqual(ec.Status.NextPublishWindow, nextPublishWindow) {
+		ec.Status.NextPublishWindow = nextPublishWindow
+		ok = false
+	}
+
+	if !reflect.DeepEqual(ec.Status.Diff, diff) {
+		ec.Status.Diff = diff
+		ok = false
+	}
+
 	if ec.Status.CacheState == nil || *ec.Status.CacheState != cacheState {
 		ec.Status.CacheState = &cacheState
 		ok = false
@@ -42,14 +65,39 @@ func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVe
 		ok = false
 	}
 
+	rollout := generateRolloutStatus(list)
+	if !reflect.DeepEqual(ec.Status.Rollout, rollout) {
+		ec.Status.Rollout = rollout
+		ok = false
+	}
+
 	// Reconcile the CacheOutOfSyncCondition
-	if desiredVersion != publishedVersion && !meta.IsStatusConditionTrue(ec.Status.Conditions, marin3rv1alpha1.CacheOutOfSyncCondition) {
-		meta.SetStatusCondition(&ec.Status.Conditions, metav1.Condition{
-			Type:    marin3rv1alpha1.CacheOutOfSyncCondition,
-			Status:  metav1.ConditionTrue,
-			Reason:  "CantPublishDesiredVersion",
-			Message: "Desired resources spec cannot be applied",
-		})
+	outOfSync := metav1.Condition{
+		Type:    marin3rv1alpha1.CacheOutOfSyncCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "CantPublishDesiredVersion",
+		Message: "Desired resources spec cannot be applied",
+	}
+	switch cacheState {
+	case marin3rv1alpha1.RolloutState:
+		outOfSync.Reason = "RolloutInProgress"
+		outOfSync.Message = "Desired resources spec is being progressively rolled out"
+	case marin3rv1alpha1.PinnedState:
+		outOfSync.Reason = "VersionPinned"
+		outOfSync.Message = fmt.Sprintf("Pinned version '%s' is published instead of the desired resources spec", publishedVersion)
+	case marin3rv1alpha1.SuspendedState:
+		outOfSync.Reason = "PublicationSuspended"
+		outOfSync.Message = "Desired resources spec will be published when the EnvoyConfig is resumed"
+	case marin3rv1alpha1.PendingApprovalState:
+		outOfSync.Reason = "PendingApproval"
+		outOfSync.Message = fmt.Sprintf("Desired resources spec will be published when version '%s' is approved", desiredVersion)
+	case marin3rv1alpha1.OutsidePublishWindowState:
+		outOfSync.Reason = "OutsidePublishWindow"
+		outOfSync.Message = "Desired resources spec will be published when the next publish window opens"
+	}
+	if cond := meta.FindStatusCondition(ec.Status.Conditions, marin3rv1alpha1.CacheOutOfSyncCondition); desiredVersion != publishedVersion &&
+		(cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != outOfSync.Reason) {
+		meta.SetStatusCondition(&ec.Status.Conditions, outOfSync)
 		ok = false
 
 	} else if desiredVersion == publishedVersion && meta.IsStatusConditionTrue(ec.Status.Conditions, marin3rv1alpha1.CacheOutOfSyncCondition) {
@@ -82,6 +130,22 @@ func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVe
 		ok = false
 	}
 
+	// Reconcile the fleet status and the FleetInSyncCondition
+	if dStats != nil {
+		fleet := generateFleetStatus(ec, findRevision(list, publishedVersion), dStats)
+		if !reflect.DeepEqual(ec.Status.Fleet, fleet) {
+			ec.Status.Fleet = fleet
+			ok = false
+		}
+
+		inSync := calculateFleetInSyncCondition(fleet)
+		if cond := meta.FindStatusCondition(ec.Status.Conditions, marin3rv1alpha1.FleetInSyncCondition); cond == nil ||
+			cond.Status != inSync.Status || cond.Reason != inSync.Reason {
+			meta.SetStatusCondition(&ec.Status.Conditions, inSync)
+			ok = false
+		}
+	}
+
 	// Temporary fix for RollbackFailedCondition conditions that are missing  the .Message property, which
 	// will be required in an upcoming release
 	if cond := meta.FindStatusCondition(ec.Status.Conditions, marin3rv1alpha1.RollbackFailedCondition); cond != nil && cond.Message == "" {
@@ -93,6 +157,214 @@ func IsStatusReconciled(ec *marin3rv1alpha1.EnvoyConfig, cacheState, publishedVe
 	return ok
 }
 
+// generateRolloutStatus returns the progress of the rollout of the
+// revision at the top of the list, nil if it is not being rolled out
+func generateRolloutStatus(list *marin3rv1alpha1.EnvoyConfigRevisionList) *marin3rv1alpha1.RolloutStatus {
+
+	if len(list.Items) == 0 {
+		return nil
+	}
+	ecr := list.Items[len(list.Items)-1]
+	if ecr.Status.Rollout == nil {
+		return nil
+	}
+
+	return &marin3rv1alpha1.RolloutStatus{
+		Version:    ecr.Spec.Version,
+		Step:       ecr.Status.Rollout.Step,
+		Percentage: ecr.Status.Rollout.Percentage,
+	}
+}
+
+// generatePendingVersion returns the version of the revision at the top of the
+// list if its publication is being held, nil otherwise
+func generatePendingVersion(list *marin3rv1alpha1.EnvoyConfigRevisionList, cacheState string) *string {
+
+	switch cacheState {
+	case marin3rv1alpha1.SuspendedState, marin3rv1alpha1.PendingApprovalState, marin3rv1alpha1.OutsidePublishWindowState:
+	default:
+		return nil
+	}
+	if len(list.Items) == 0 {
+		return nil
+	}
+
+	return pointer.New(list.Items[len(list.Items)-1].Spec.Version)
+}
+
+// generateNextPublishWindow returns the time at which the next publish window
+// of the EnvoyConfig opens, nil if it has no publish windows
+func generateNextPublishWindow(ec *marin3rv1alpha1.EnvoyConfig, now time.Time) *metav1.Time {
+
+	next, err := ec.GetNextPublishWindow(now)
+	if err != nil || next.IsZero() {
+		return nil
+	}
+
+	return &metav1.Time{Time: next}
+}
+
+// findRevision returns the revision of the given version, nil if not found
+func findRevision(list *marin3rv1alpha1.EnvoyConfigRevisionList, version string) *marin3rv1alpha1.EnvoyConfigRevision {
+	for idx := range list.Items {
+		if list.Items[idx].Spec.Version == version {
+			return &list.Items[idx]
+		}
+	}
+	return nil
+}
+
+// generateFleetStatus returns, for each resource type, how many of the Envoy clients subscribed
+// to the nodeIDs of the EnvoyConfig have acknowledged the version published by the given revision
+// as their latest version. Resource types without subscribed clients are not included. When the
+// EnvoyConfig has more than one nodeID, the status of the Envoy clients of each one is also returned.
+func generateFleetStatus(ec *marin3rv1alpha1.EnvoyConfig, published *marin3rv1alpha1.EnvoyConfigRevision, dStats *stats.Stats) *marin3rv1alpha1.FleetStatus {
+
+	if published == nil || published.Status.ProvidesVersions == nil {
+		return nil
+	}
+	vt := published.Status.ProvidesVersions
+
+	nodeIDs := ec.GetNodeIDs()
+	nodes := make([]marin3rv1alpha1.NodeIDFleetStatus, len(nodeIDs))
+	nodePods := make([]map[string]bool, len(nodeIDs))
+	for idx, nodeID := range nodeIDs {
+		nodes[idx].NodeID = nodeID
+		nodePods[idx] = map[string]bool{}
+	}
+
+	fleet := &marin3rv1alpha1.FleetStatus{}
+	pods := map[string]bool{}
+	for _, tv := range []struct {
+		rType   envoy.Type
+		version string
+	}{
+		{envoy.Endpoint, vt.Endpoints},
+		{envoy.Cluster, vt.Clusters},
+		{envoy.Route, vt.Routes},
+		{envoy.ScopedRoute, vt.ScopedRoutes},
+		{envoy.Listener, vt.Listeners},
+		{envoy.Secret, vt.Secrets},
+		{envoy.Runtime, vt.Runtimes},
+		{envoy.ExtensionConfig, vt.ExtensionConfigs},
+	} {
+		if tv.version == "" {
+			continue
+		}
+		rType := envoy_resources.TypeURL(tv.rType, ec.GetEnvoyAPIVersion())
+		total := marin3rv1alpha1.ResourceTypeFleetStatus{Type: tv.rType, Version: tv.version}
+
+		for idx, nodeID := range nodeIDs {
+			subscribed := dStats.GetSubscribedPods(nodeID, rType)
+			if len(subscribed) == 0 {
+				continue
+			}
+
+			acked := dStats.GetAckedVersions(nodeID, rType)
+			status := marin3rv1alpha1.ResourceTypeFleetStatus{Type: tv.rType, Version: tv.version}
+			for pod := range subscribed {
+				pods[pod] = true
+				nodePods[idx][pod] = true
+				status.Subscribed++
+				if acked[pod] == tv.version {
+					status.InSync++
+				}
+			}
+			nodes[idx].ResourceTypes = append(nodes[idx].ResourceTypes, status)
+			total.Subscribed += status.Subscribed
+			total.InSync += status.InSync
+		}
+
+		if total.Subscribed > 0 {
+			fleet.ResourceTypes = append(fleet.ResourceTypes, total)
+		}
+	}
+
+	if len(pods) == 0 {
+		return nil
+	}
+	fleet.SubscribedPods = sortedPods(pods)
+
+	if len(nodeIDs) > 1 {
+		for idx := range nodes {
+			if len(nodePods[idx]) > 0 {
+				nodes[idx].SubscribedPods = sortedPods(nodePods[idx])
+			}
+		}
+		fleet.NodeIDs = nodes
+	}
+
+	return fleet
+}
+
+// sortedPods returns the names of the pods in the set, sorted
+func sortedPods(pods map[string]bool) []string {
+	list := make([]string, 0, len(pods))
+	for pod := range pods {
+		list = append(list, pod)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// IsFleetStatusRefreshRequired returns true if the status of the Envoy clients needs to be
+// periodically refreshed, as the acknowledgements of the clients don't trigger reconciles. That
+// is the case while a rollout or the health analysis of the published revision is in progress,
+// or while some of the subscribed clients have not acknowledged the published version yet.
+func IsFleetStatusRefreshRequired(ec *marin3rv1alpha1.EnvoyConfig, list *marin3rv1alpha1.EnvoyConfigRevisionList, now time.Time) bool {
+
+	if ec.Status.Rollout != nil {
+		return true
+	}
+
+	if cond := meta.FindStatusCondition(ec.Status.Conditions, marin3rv1alpha1.FleetInSyncCondition); cond != nil &&
+		cond.Status == metav1.ConditionFalse && cond.Reason == "PublishedVersionNotAcknowledged" {
+		return true
+	}
+
+	if ec.Spec.HealthAnalysis != nil && list != nil {
+		for _, ecr := range list.Items {
+			if ecr.Status.IsPublished() && ecr.Status.LastPublishedAt != nil &&
+				now.Before(ecr.Status.LastPublishedAt.Add(ec.Spec.HealthAnalysis.GetBakeTime())) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// calculateFleetInSyncCondition returns the FleetInSyncCondition for the given fleet status
+func calculateFleetInSyncCondition(fleet *marin3rv1alpha1.FleetStatus) metav1.Condition {
+
+	if fleet == nil {
+		return metav1.Condition{
+			Type:    marin3rv1alpha1.FleetInSyncCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NoSubscribedPods",
+			Message: "There are no Envoy clients subscribed to the published version",
+		}
+	}
+
+	for _, rt := range fleet.ResourceTypes {
+		if rt.InSync < rt.Subscribed {
+			return metav1.Condition{
+				Type:    marin3rv1alpha1.FleetInSyncCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  "PublishedVersionNotAcknowledged",
+				Message: "Some of the subscribed Envoy clients have not acknowledged the published version",
+			}
+		}
+	}
+
+	return metav1.Condition{
+		Type:    marin3rv1alpha1.FleetInSyncCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "PublishedVersionAcknowledged",
+		Message: "All the subscribed Envoy clients have acknowledged the published version",
+	}
+}
+
 func generateRevisionList(list *marin3rv1alpha1.EnvoyConfigRevisionList) []marin3rv1alpha1.ConfigRevisionRef {
 
 	revisionList := make([]marin3rv1alpha1.ConfigRevisionRef, len(list.Items))
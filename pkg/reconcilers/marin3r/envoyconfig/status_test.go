@@ -3,9 +3,15 @@ package reconcilers
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
 	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"github.com/go-test/deep"
+	kv "github.com/patrickmn/go-cache"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -16,6 +22,7 @@ func TestIsStatusReconciled(t *testing.T) {
 		cacheState       string
 		publishedVersion string
 		list             *marin3rv1alpha1.EnvoyConfigRevisionList
+		diff             *marin3rv1alpha1.ConfigDiff
 	}
 	tests := []struct {
 		name string
@@ -183,6 +190,53 @@ func TestIsStatusReconciled(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "CacheOutOfSyncCondition needs to report the rollout, returns false",
+			args: args{
+				ec: &marin3rv1alpha1.EnvoyConfig{
+					Status: marin3rv1alpha1.EnvoyConfigStatus{
+						DesiredVersion:   pointer.New("6758fd786c"),
+						PublishedVersion: pointer.New("xxxx"),
+						CacheState:       pointer.New(marin3rv1alpha1.RolloutState),
+						ConfigRevisions:  []marin3rv1alpha1.ConfigRevisionRef{},
+						Conditions: []metav1.Condition{
+							{Type: marin3rv1alpha1.CacheOutOfSyncCondition, Status: metav1.ConditionTrue, Reason: "CantPublishDesiredVersion", Message: "a"},
+							{Type: marin3rv1alpha1.RollbackFailedCondition, Status: metav1.ConditionFalse, Message: "a"},
+						},
+					},
+				},
+				cacheState:       marin3rv1alpha1.RolloutState,
+				publishedVersion: "xxxx",
+				list:             &marin3rv1alpha1.EnvoyConfigRevisionList{},
+			},
+			want: false,
+		},
+		{
+			name: "Diff needs to be updated, returns false",
+			args: args{
+				ec: &marin3rv1alpha1.EnvoyConfig{
+					Status: marin3rv1alpha1.EnvoyConfigStatus{
+						DesiredVersion:   pointer.New("6758fd786c"),
+						PublishedVersion: pointer.New("xxxx"),
+						CacheState:       pointer.New(marin3rv1alpha1.RollbackState),
+						ConfigRevisions:  []marin3rv1alpha1.ConfigRevisionRef{},
+						Conditions: []metav1.Condition{
+							{Type: marin3rv1alpha1.CacheOutOfSyncCondition, Status: metav1.ConditionTrue, Reason: "CantPublishDesiredVersion", Message: "a"},
+							{Type: marin3rv1alpha1.RollbackFailedCondition, Status: metav1.ConditionFalse, Message: "a"},
+						},
+					},
+				},
+				cacheState:       marin3rv1alpha1.RollbackState,
+				publishedVersion: "xxxx",
+				list:             &marin3rv1alpha1.EnvoyConfigRevisionList{},
+				diff: &marin3rv1alpha1.ConfigDiff{
+					PublishedVersion: "xxxx",
+					DesiredVersion:   "6758fd786c",
+					Removed:          []marin3rv1alpha1.ResourceDiff{{Type: envoy.Cluster, Name: "cluster"}},
+				},
+			},
+			want: false,
+		},
 		{
 			name: "Status empty, return false",
 			args: args{
@@ -230,6 +284,27 @@ func TestIsStatusReconciled(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "CacheOutOfSyncCondition needs to report the rollout, returns false",
+			args: args{
+				ec: &marin3rv1alpha1.EnvoyConfig{
+					Status: marin3rv1alpha1.EnvoyConfigStatus{
+						DesiredVersion:   pointer.New("6758fd786c"),
+						PublishedVersion: pointer.New("xxxx"),
+						CacheState:       pointer.New(marin3rv1alpha1.RolloutState),
+						ConfigRevisions:  []marin3rv1alpha1.ConfigRevisionRef{},
+						Conditions: []metav1.Condition{
+							{Type: marin3rv1alpha1.CacheOutOfSyncCondition, Status: metav1.ConditionTrue, Reason: "CantPublishDesiredVersion", Message: "a"},
+							{Type: marin3rv1alpha1.RollbackFailedCondition, Status: metav1.ConditionFalse, Message: "a"},
+						},
+					},
+				},
+				cacheState:       marin3rv1alpha1.RolloutState,
+				publishedVersion: "xxxx",
+				list:             &marin3rv1alpha1.EnvoyConfigRevisionList{},
+			},
+			want: false,
+		},
 		{
 			name: "Status empty, return false",
 			args: args{
@@ -245,7 +320,7 @@ func TestIsStatusReconciled(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := IsStatusReconciled(tt.args.ec, tt.args.cacheState, tt.args.publishedVersion, tt.args.list); got != tt.want {
+			if got := IsStatusReconciled(tt.args.ec, tt.args.cacheState, tt.args.ec.GetEnvoyResourcesVersion(), tt.args.publishedVersion, tt.args.list, tt.args.diff, nil); got != tt.want {
 				t.Errorf("IsStatusReconciled() = %v, want %v", got, tt.want)
 			}
 		})
@@ -311,3 +386,364 @@ func Test_generateRevisionList(t *testing.T) {
 		})
 	}
 }
+
+func Test_generateRolloutStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		list *marin3rv1alpha1.EnvoyConfigRevisionList
+		want *marin3rv1alpha1.RolloutStatus
+	}{
+		{
+			name: "Returns the rollout status of the top revision",
+			list: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "1"}},
+					{
+						Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "2"},
+						Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+							Rollout: &marin3rv1alpha1.RevisionRolloutStatus{Step: 1, Percentage: 50},
+						},
+					},
+				},
+			},
+			want: &marin3rv1alpha1.RolloutStatus{Version: "2", Step: 1, Percentage: 50},
+		},
+		{
+			name: "Returns nil if the top revision is not being rolled out",
+			list: &marin3rv1alpha1.EnvoyConfigRevisionList{
+				Items: []marin3rv1alpha1.EnvoyConfigRevision{
+					{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "1"}},
+				},
+			},
+			want: nil,
+		},
+		{
+			name: "Returns nil for an empty list",
+			list: &marin3rv1alpha1.EnvoyConfigRevisionList{},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generateRolloutStatus(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generateRolloutStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_generatePendingVersion(t *testing.T) {
+	list := &marin3rv1alpha1.EnvoyConfigRevisionList{
+		Items: []marin3rv1alpha1.EnvoyConfigRevision{
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "1"}},
+			{Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{Version: "2"}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		list       *marin3rv1alpha1.EnvoyConfigRevisionList
+		cacheState string
+		want       *string
+	}{
+		{
+			name:       "Returns the version of the top revision if suspended",
+			list:       list,
+			cacheState: marin3rv1alpha1.SuspendedState,
+			want:       pointer.New("2"),
+		},
+		{
+			name:       "Returns the version of the top revision if pending approval",
+			list:       list,
+			cacheState: marin3rv1alpha1.PendingApprovalState,
+			want:       pointer.New("2"),
+		},
+		{
+			name:       "Returns the version of the top revision if outside of the publish windows",
+			list:       list,
+			cacheState: marin3rv1alpha1.OutsidePublishWindowState,
+			want:       pointer.New("2"),
+		},
+		{
+			name:       "Returns nil if the publication is not held",
+			list:       list,
+			cacheState: marin3rv1alpha1.InSyncState,
+			want:       nil,
+		},
+		{
+			name:       "Returns nil for an empty list",
+			list:       &marin3rv1alpha1.EnvoyConfigRevisionList{},
+			cacheState: marin3rv1alpha1.SuspendedState,
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := generatePendingVersion(tt.list, tt.cacheState); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generatePendingVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_generateNextPublishWindow(t *testing.T) {
+	now := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		windows []marin3rv1alpha1.PublishWindow
+		want    *metav1.Time
+	}{
+		{
+			name: "Returns the earliest opening of the publish windows",
+			windows: []marin3rv1alpha1.PublishWindow{
+				{Schedule: "0 8 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+				{Schedule: "30 14 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			},
+			want: &metav1.Time{Time: time.Date(2023, 1, 2, 14, 30, 0, 0, time.UTC)},
+		},
+		{
+			name:    "Returns nil if there are no publish windows",
+			windows: nil,
+			want:    nil,
+		},
+		{
+			name:    "Returns nil if the publish windows are invalid",
+			windows: []marin3rv1alpha1.PublishWindow{{Schedule: "invalid"}},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{PublishWindows: tt.windows}}
+			if got := generateNextPublishWindow(ec, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generateNextPublishWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_generateFleetStatus(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{NodeID: "node"}}
+	published := &marin3rv1alpha1.EnvoyConfigRevision{
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			ProvidesVersions: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx", Clusters: "yyyy", Listeners: "zzzz"},
+		},
+	}
+	endpoint := envoy_resources.TypeURL(envoy.Endpoint, envoy.APIv3)
+	cluster := envoy_resources.TypeURL(envoy.Cluster, envoy.APIv3)
+
+	tests := []struct {
+		name      string
+		published *marin3rv1alpha1.EnvoyConfigRevision
+		items     map[string]kv.Item
+		want      *marin3rv1alpha1.FleetStatus
+	}{
+		{
+			name:      "Counts the pods that acknowledged the published version",
+			published: published,
+			items: map[string]kv.Item{
+				"node:" + endpoint + ":*:pod-a:request_counter": {Object: int64(1)},
+				"node:" + endpoint + ":*:pod-b:request_counter": {Object: int64(1)},
+				"node:" + cluster + ":*:pod-a:request_counter":  {Object: int64(1)},
+				"node:" + endpoint + ":xxxx:pod-a:info":         {Object: int64(100)},
+				// pod-b acknowledged the published version but then moved to another one
+				"node:" + endpoint + ":xxxx:pod-b:info": {Object: int64(100)},
+				"node:" + endpoint + ":aaaa:pod-b:info": {Object: int64(200)},
+				"node:" + cluster + ":yyyy:pod-a:info":  {Object: int64(100)},
+			},
+			want: &marin3rv1alpha1.FleetStatus{
+				SubscribedPods: []string{"pod-a", "pod-b"},
+				ResourceTypes: []marin3rv1alpha1.ResourceTypeFleetStatus{
+					{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 2, InSync: 1},
+					{Type: envoy.Cluster, Version: "yyyy", Subscribed: 1, InSync: 1},
+				},
+			},
+		},
+		{
+			name:      "No subscribed pods",
+			published: published,
+			items:     map[string]kv.Item{},
+			want:      nil,
+		},
+		{
+			name:      "No published revision",
+			published: nil,
+			items: map[string]kv.Item{
+				"node:" + endpoint + ":*:pod-a:request_counter": {Object: int64(1)},
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateFleetStatus(ec, tt.published, stats.NewWithItems(tt.items, time.Now()))
+			if diff := deep.Equal(got, tt.want); len(diff) > 0 {
+				t.Errorf("generateFleetStatus() = %v", diff)
+			}
+		})
+	}
+}
+
+func Test_generateFleetStatus_NodeIDs(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{Spec: marin3rv1alpha1.EnvoyConfigSpec{NodeID: "node", NodeIDs: []string{"other", "idle"}}}
+	published := &marin3rv1alpha1.EnvoyConfigRevision{
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			ProvidesVersions: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+		},
+	}
+	endpoint := envoy_resources.TypeURL(envoy.Endpoint, envoy.APIv3)
+	items := map[string]kv.Item{
+		"node:" + endpoint + ":*:pod-a:request_counter":  {Object: int64(1)},
+		"node:" + endpoint + ":xxxx:pod-a:info":          {Object: int64(100)},
+		"other:" + endpoint + ":*:pod-b:request_counter": {Object: int64(1)},
+	}
+
+	want := &marin3rv1alpha1.FleetStatus{
+		SubscribedPods: []string{"pod-a", "pod-b"},
+		ResourceTypes: []marin3rv1alpha1.ResourceTypeFleetStatus{
+			{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 2, InSync: 1},
+		},
+		NodeIDs: []marin3rv1alpha1.NodeIDFleetStatus{
+			{
+				NodeID:         "node",
+				SubscribedPods: []string{"pod-a"},
+				ResourceTypes:  []marin3rv1alpha1.ResourceTypeFleetStatus{{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 1, InSync: 1}},
+			},
+			{
+				NodeID:         "other",
+				SubscribedPods: []string{"pod-b"},
+				ResourceTypes:  []marin3rv1alpha1.ResourceTypeFleetStatus{{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 1, InSync: 0}},
+			},
+			{NodeID: "idle"},
+		},
+	}
+
+	got := generateFleetStatus(ec, published, stats.NewWithItems(items, time.Now()))
+	if diff := deep.Equal(got, want); len(diff) > 0 {
+		t.Errorf("generateFleetStatus() = %v", diff)
+	}
+}
+
+func Test_calculateFleetInSyncCondition(t *testing.T) {
+	tests := []struct {
+		name       string
+		fleet      *marin3rv1alpha1.FleetStatus
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{
+		{
+			name:       "No subscribed pods",
+			fleet:      nil,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "NoSubscribedPods",
+		},
+		{
+			name: "Some pods are not in sync",
+			fleet: &marin3rv1alpha1.FleetStatus{
+				SubscribedPods: []string{"pod-a", "pod-b"},
+				ResourceTypes: []marin3rv1alpha1.ResourceTypeFleetStatus{
+					{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 2, InSync: 2},
+					{Type: envoy.Cluster, Version: "yyyy", Subscribed: 2, InSync: 1},
+				},
+			},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: "PublishedVersionNotAcknowledged",
+		},
+		{
+			name: "All pods are in sync",
+			fleet: &marin3rv1alpha1.FleetStatus{
+				SubscribedPods: []string{"pod-a", "pod-b"},
+				ResourceTypes: []marin3rv1alpha1.ResourceTypeFleetStatus{
+					{Type: envoy.Endpoint, Version: "xxxx", Subscribed: 2, InSync: 2},
+				},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: "PublishedVersionAcknowledged",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateFleetInSyncCondition(tt.fleet)
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason {
+				t.Errorf("calculateFleetInSyncCondition() = %v/%v, want %v/%v", got.Status, got.Reason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestIsFleetStatusRefreshRequired(t *testing.T) {
+	now := time.Now()
+	published := func(at time.Time) *marin3rv1alpha1.EnvoyConfigRevisionList {
+		return &marin3rv1alpha1.EnvoyConfigRevisionList{Items: []marin3rv1alpha1.EnvoyConfigRevision{{
+			Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+				Published:       pointer.New(true),
+				LastPublishedAt: &metav1.Time{Time: at},
+			},
+		}}}
+	}
+	fleetInSync := func(status metav1.ConditionStatus, reason string) marin3rv1alpha1.EnvoyConfigStatus {
+		return marin3rv1alpha1.EnvoyConfigStatus{Conditions: []metav1.Condition{
+			{Type: marin3rv1alpha1.FleetInSyncCondition, Status: status, Reason: reason},
+		}}
+	}
+
+	tests := []struct {
+		name string
+		ec   *marin3rv1alpha1.EnvoyConfig
+		list *marin3rv1alpha1.EnvoyConfigRevisionList
+		want bool
+	}{
+		{
+			name: "Not required when the fleet is in sync",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Status: fleetInSync(metav1.ConditionTrue, "PublishedVersionAcknowledged")},
+			list: published(now.Add(-time.Hour)),
+			want: false,
+		},
+		{
+			name: "Not required without subscribed clients",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Status: fleetInSync(metav1.ConditionFalse, "NoSubscribedPods")},
+			list: published(now.Add(-time.Hour)),
+			want: false,
+		},
+		{
+			name: "Required while the published version is not acknowledged",
+			ec:   &marin3rv1alpha1.EnvoyConfig{Status: fleetInSync(metav1.ConditionFalse, "PublishedVersionNotAcknowledged")},
+			list: published(now.Add(-time.Hour)),
+			want: true,
+		},
+		{
+			name: "Required while a rollout is in progress",
+			ec: &marin3rv1alpha1.EnvoyConfig{Status: marin3rv1alpha1.EnvoyConfigStatus{
+				Rollout: &marin3rv1alpha1.RolloutStatus{Version: "xxxx", Percentage: 10},
+			}},
+			list: published(now.Add(-time.Hour)),
+			want: true,
+		},
+		{
+			name: "Required during the health analysis of the published revision",
+			ec: &marin3rv1alpha1.EnvoyConfig{
+				Spec:   marin3rv1alpha1.EnvoyConfigSpec{HealthAnalysis: &marin3rv1alpha1.HealthAnalysis{}},
+				Status: fleetInSync(metav1.ConditionTrue, "PublishedVersionAcknowledged"),
+			},
+			list: published(now.Add(-time.Minute)),
+			want: true,
+		},
+		{
+			name: "Not required once the health analysis is over",
+			ec: &marin3rv1alpha1.EnvoyConfig{
+				Spec:   marin3rv1alpha1.EnvoyConfigSpec{HealthAnalysis: &marin3rv1alpha1.HealthAnalysis{}},
+				Status: fleetInSync(metav1.ConditionTrue, "PublishedVersionAcknowledged"),
+			},
+			list: published(now.Add(-time.Hour)),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsFleetStatusRefreshRequired(tt.ec, tt.list, now); got != tt.want {
+				t.Errorf("IsFleetStatusRefreshRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ResolveValues returns a copy of the resources with the content of the ConfigMaps and Secrets
+// referenced by their valueFrom field recorded in their value, so the version of the resources
+// changes with the content. The revisions are served from the recorded value, and the valueFrom
+// field is only kept to show where it was read from. Resources whose optional reference doesn't
+// exist are left out. Values can only be read from Secrets when the revisions are stored in Secrets,
+// as they would be recorded in plain text otherwise. The resources are returned as they are if none
+// reads its value from a ConfigMap or a Secret.
+func ResolveValues(ctx context.Context, cl client.Client, namespace string, storage marin3rv1alpha1.RevisionStorage,
+	resources []marin3rv1alpha1.Resource) ([]marin3rv1alpha1.Resource, error) {
+	if !hasValueFrom(resources) {
+		return resources, nil
+	}
+
+	resolved := make([]marin3rv1alpha1.Resource, 0, len(resources))
+	for idx, res := range resources {
+		if res.ValueFrom == nil {
+			resolved = append(resolved, res)
+			continue
+		}
+		if res.ValueFrom.SecretKeyRef != nil && storage != marin3rv1alpha1.RevisionStorageSecret {
+			return nil, fmt.Errorf("resource %d reads its value from a Secret, which requires the revisions to be stored in Secrets", idx)
+		}
+		value, found, err := revisions.ResolveValue(ctx, cl, namespace, res.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve the value of resource %d: %w", idx, err)
+		}
+		if !found {
+			continue
+		}
+		res.Value = &runtime.RawExtension{Raw: value}
+		resolved = append(resolved, res)
+	}
+	return resolved, nil
+}
+
+// hasValueFrom returns true if any of the resources
+// reads its value from a ConfigMap or a Secret
+func hasValueFrom(resources []marin3rv1alpha1.Resource) bool {
+	for _, res := range resources {
+		if res.ValueFrom != nil {
+			return true
+		}
+	}
+	return false
+}
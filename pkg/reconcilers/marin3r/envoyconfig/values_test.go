@@ -0,0 +1,118 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testResourceFromConfigMap(rType envoy.Type, cm, key string, optional bool) marin3rv1alpha1.Resource {
+	return marin3rv1alpha1.Resource{
+		Type: rType,
+		ValueFrom: &marin3rv1alpha1.ResourceValueSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cm},
+				Key:                  key,
+				Optional:             pointer.New(optional),
+			},
+		},
+	}
+}
+
+func TestDesiredResources_ValueFrom(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID: "node",
+			Resources: []marin3rv1alpha1.Resource{
+				testDiffCluster(`{"name":"cluster"}`),
+				testResourceFromConfigMap(envoy.Route, "routes", "route.yaml", false),
+				testResourceFromConfigMap(envoy.Listener, "listeners", "listener.yaml", true),
+			},
+		},
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "routes", Namespace: "default"},
+		Data:       map[string]string{"route.yaml": "name: route\nvirtual_hosts: []\n"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(cm).Build()
+
+	// version returns the version of the resources with the current content of the ConfigMap
+	version := func() string {
+		resources, err := DesiredResources(context.TODO(), cl, ec)
+		if err != nil {
+			t.Fatalf("DesiredResources() error = %v", err)
+		}
+		rendered := ec.DeepCopy()
+		rendered.Spec.Resources = resources
+		return rendered.GetEnvoyResourcesVersion()
+	}
+
+	before := version()
+	cm.Data["route.yaml"] = "name: route\nvirtual_hosts:\n- name: vhost\n  domains: [\"*\"]\n"
+	if err := cl.Update(context.TODO(), cm); err != nil {
+		t.Fatal(err)
+	}
+	if after := version(); after == before {
+		t.Errorf("DesiredResources() the version didn't change with the content of the ConfigMap")
+	}
+
+	resources, _ := DesiredResources(context.TODO(), cl, ec)
+	if len(resources) != 2 {
+		t.Fatalf("DesiredResources() = %v, the resource with a missing optional reference must be left out", resources)
+	}
+	if resources[1].ValueFrom == nil {
+		t.Errorf("DesiredResources() the valueFrom field must be kept")
+	}
+	if got := string(resources[1].Value.Raw); got != `{"name":"route","virtual_hosts":[{"domains":["*"],"name":"vhost"}]}` {
+		t.Errorf("DesiredResources() = %v", got)
+	}
+	if ec.Spec.Resources[1].Value != nil {
+		t.Errorf("DesiredResources() the resources of the EnvoyConfig must not be modified")
+	}
+
+	if err := cl.Delete(context.TODO(), cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DesiredResources(context.TODO(), cl, ec); err == nil {
+		t.Errorf("DesiredResources() expected an error for a missing ConfigMap")
+	}
+}
+
+func TestDesiredResources_ValueFromSecret(t *testing.T) {
+	ec := &marin3rv1alpha1.EnvoyConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "ec", Namespace: "default"},
+		Spec: marin3rv1alpha1.EnvoyConfigSpec{
+			NodeID: "node",
+			Resources: []marin3rv1alpha1.Resource{{
+				Type: envoy.Cluster,
+				ValueFrom: &marin3rv1alpha1.ResourceValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster.json"}},
+			}},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "clusters", Namespace: "default"},
+		Data:       map[string][]byte{"cluster.json": []byte(`{"name":"cluster"}`)},
+	}
+	cl := fake.NewClientBuilder().WithScheme(s).WithObjects(secret).Build()
+
+	if _, err := DesiredResources(context.TODO(), cl, ec); err == nil {
+		t.Errorf("DesiredResources() expected an error when the revisions are not stored in Secrets")
+	}
+
+	ec.Spec.RevisionStorage = pointer.New(marin3rv1alpha1.RevisionStorageSecret)
+	resources, err := DesiredResources(context.TODO(), cl, ec)
+	if err != nil {
+		t.Fatalf("DesiredResources() error = %v", err)
+	}
+	if got := string(resources[0].Value.Raw); got != `{"name":"cluster"}` {
+		t.Errorf("DesiredResources() = %v", got)
+	}
+}
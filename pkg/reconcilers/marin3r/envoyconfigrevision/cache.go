@@ -9,10 +9,12 @@ import (
 	envoy "github.com/3scale-ops/marin3r/pkg/envoy"
 	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
 	envoy_serializer "github.com/3scale-ops/marin3r/pkg/envoy/serializer"
+	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfig/revisions"
 	"github.com/3scale-ops/marin3r/pkg/reconcilers/marin3r/envoyconfigrevision/discover"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -39,8 +41,9 @@ func NewCacheReconciler(ctx context.Context, logger logr.Logger, client client.C
 	return CacheReconciler{ctx, logger, client, xdsCache, decoder, generator}
 }
 
+// Reconcile writes the snapshot of the revision to the xDS cache for each one of the nodeIDs
 func (r *CacheReconciler) Reconcile(ctx context.Context, req types.NamespacedName, resources []marin3rv1alpha1.Resource,
-	nodeID, version string) (*marin3rv1alpha1.VersionTracker, error) {
+	nodeIDs []string, version string) (*marin3rv1alpha1.VersionTracker, error) {
 
 	snap, err := r.GenerateSnapshot(req, resources)
 
@@ -48,16 +51,48 @@ func (r *CacheReconciler) Reconcile(ctx context.Context, req types.NamespacedNam
 		return nil, err
 	}
 
-	oldSnap, err := r.xdsCache.GetSnapshot(nodeID)
-	if err != nil || areDifferent(snap, oldSnap) {
+	for _, nodeID := range nodeIDs {
+		oldSnap, err := r.xdsCache.GetSnapshot(nodeID)
+		if err != nil || areDifferent(snap, oldSnap) {
+
+			r.logger.Info("Writing new snapshot to xDS cache", "Revision", version, "NodeID", nodeID)
+			if err := r.xdsCache.SetSnapshot(ctx, nodeID, snap); err != nil {
+				return nil, err
+			}
 
-		r.logger.Info("Writing new snapshot to xDS cache", "Revision", version, "NodeID", nodeID)
-		if err := r.xdsCache.SetSnapshot(ctx, nodeID, snap); err != nil {
-			return nil, err
 		}
+	}
+
+	return versionTrackerFor(snap), nil
+}
+
+// ReconcileCanary writes the snapshot of the revision to the xDS cache as the canary snapshot of
+// each one of the nodeIDs, so it is only served to the given percentage of the Envoy clients
+func (r *CacheReconciler) ReconcileCanary(ctx context.Context, req types.NamespacedName, resources []marin3rv1alpha1.Resource,
+	nodeIDs []string, version string, percentage int32) (*marin3rv1alpha1.VersionTracker, error) {
+
+	snap, err := r.GenerateSnapshot(req, resources)
 
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nodeID := range nodeIDs {
+		oldCanary, err := r.xdsCache.GetCanary(nodeID)
+		if err != nil || oldCanary.Version != version || oldCanary.Percentage != percentage || areDifferent(snap, oldCanary.Snapshot) {
+
+			r.logger.Info("Writing new canary snapshot to xDS cache", "Revision", version, "NodeID", nodeID, "Percentage", percentage)
+			if err := r.xdsCache.SetCanary(ctx, nodeID, xdss.Canary{Version: version, Percentage: percentage, Snapshot: snap}); err != nil {
+				return nil, err
+			}
+
+		}
 	}
 
+	return versionTrackerFor(snap), nil
+}
+
+func versionTrackerFor(snap xdss.Snapshot) *marin3rv1alpha1.VersionTracker {
 	return &marin3rv1alpha1.VersionTracker{
 		Endpoints:        snap.GetVersion(envoy.Endpoint),
 		Clusters:         snap.GetVersion(envoy.Cluster),
@@ -67,7 +102,7 @@ func (r *CacheReconciler) Reconcile(ctx context.Context, req types.NamespacedNam
 		Secrets:          snap.GetVersion(envoy.Secret),
 		Runtimes:         snap.GetVersion(envoy.Runtime),
 		ExtensionConfigs: snap.GetVersion(envoy.ExtensionConfig),
-	}, nil
+	}
 }
 
 func (r *CacheReconciler) GenerateSnapshot(req types.NamespacedName, resources []marin3rv1alpha1.Resource) (xdss.Snapshot, error) {
@@ -83,6 +118,24 @@ func (r *CacheReconciler) GenerateSnapshot(req types.NamespacedName, resources [
 	secrets := make([]envoy.Resource, 0, len(resources))
 
 	for idx, resourceDefinition := range resources {
+		// The content of the ConfigMaps and Secrets is recorded in the value when the
+		// revision is created, so changes in the content are only published through new
+		// revisions. It is only read here for revisions that don't record it.
+		if resourceDefinition.ValueFrom != nil && resourceDefinition.Value == nil {
+			value, found, err := revisions.ResolveValue(r.ctx, r.client, req.Namespace, resourceDefinition.ValueFrom)
+			if err != nil {
+				return nil,
+					resourceLoaderError(
+						req, field.OmitValueType{}, field.NewPath("spec", "resources").Index(idx).Child("valueFrom"),
+						err.Error(),
+					)
+			}
+			if !found {
+				continue
+			}
+			resourceDefinition.Value = &runtime.RawExtension{Raw: value}
+		}
+
 		switch resourceDefinition.Type {
 
 		case envoy.Endpoint:
@@ -101,58 +154,38 @@ func (r *CacheReconciler) GenerateSnapshot(req types.NamespacedName, resources [
 
 			} else {
 				// Raw value provided
-				res := r.generator.New(envoy.Endpoint)
-				if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-					return nil,
-						resourceLoaderError(
-							req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-							fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-						)
+				res, err := r.loadResource(req, idx, resourceDefinition, envoy.Endpoint)
+				if err != nil {
+					return nil, err
 				}
 				endpoints = append(endpoints, res)
 			}
 
 		case envoy.Cluster:
-			res := r.generator.New(envoy.Cluster)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+			res, err := r.loadResource(req, idx, resourceDefinition, envoy.Cluster)
+			if err != nil {
+				return nil, err
 			}
 			clusters = append(clusters, res)
 
 		case envoy.Route:
-			res := r.generator.New(envoy.Route)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+			res, err := r.loadResource(req, idx, resourceDefinition, envoy.Route)
+			if err != nil {
+				return nil, err
 			}
 			routes = append(routes, res)
 
 		case envoy.ScopedRoute:
-			res := r.generator.New(envoy.ScopedRoute)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+			res, err := r.loadResource(req, idx, resourceDefinition, envoy.ScopedRoute)
+			if err != nil {
+				return nil, err
 			}
 			scopedRoutes = append(scopedRoutes, res)
 
 		case envoy.Listener:
-			res := r.generator.New(envoy.Listener)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+			res, err := r.loadResource(req, idx, resourceDefinition, envoy.Listener)
+			if err != nil {
+				return nil, err
 			}
 			listeners = append(listeners, res)
 
@@ -188,24 +221,29 @@ func (r *CacheReconciler) GenerateSnapshot(req types.NamespacedName, resources [
 			}
 
 		case envoy.Runtime:
-			res := r.generator.New(envoy.Runtime)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+
+			if resourceDefinition.GenerateFromConfigMap != nil {
+				// Runtime layer generated from the data of a ConfigMap
+				cm := &corev1.ConfigMap{}
+				key := types.NamespacedName{Name: resourceDefinition.GenerateFromConfigMap.Name, Namespace: req.Namespace}
+				if err := r.client.Get(r.ctx, key, cm); err != nil {
+					return nil, fmt.Errorf("%s", err.Error())
+				}
+				runtimes = append(runtimes, r.generator.NewRuntime(resourceDefinition.GenerateFromConfigMap.GetLayerName(), cm.Data))
+
+			} else {
+				// Raw value provided
+				res, err := r.loadResource(req, idx, resourceDefinition, envoy.Runtime)
+				if err != nil {
+					return nil, err
+				}
+				runtimes = append(runtimes, res)
 			}
-			runtimes = append(runtimes, res)
 
 		case envoy.ExtensionConfig:
-			res := r.generator.New(envoy.ExtensionConfig)
-			if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
-				return nil,
-					resourceLoaderError(
-						req, string(resourceDefinition.Value.Raw), field.NewPath("spec", "resources").Index(idx).Child("value"),
-						fmt.Sprintf("Invalid envoy resource value: '%s'", err),
-					)
+			res, err := r.loadResource(req, idx, resourceDefinition, envoy.ExtensionConfig)
+			if err != nil {
+				return nil, err
 			}
 			extensionConfigs = append(extensionConfigs, res)
 
@@ -224,9 +262,43 @@ func (r *CacheReconciler) GenerateSnapshot(req types.NamespacedName, resources [
 	snap.SetResources(envoy.Runtime, runtimes)
 	snap.SetResources(envoy.ExtensionConfig, extensionConfigs)
 
+	// Envoy waits forever for the resources that are referenced by name, leaving the
+	// listeners and clusters that reference them warming, so refuse to publish the snapshot
+	if err := snap.Consistent(); err != nil {
+		return nil,
+			resourceLoaderError(
+				req, field.OmitValueType{}, field.NewPath("spec", "resources"),
+				fmt.Sprintf("Inconsistent snapshot: %s", err),
+			)
+	}
+
 	return snap, nil
 }
 
+// loadResource decodes the value of a resource and runs the validation rules of its type
+func (r *CacheReconciler) loadResource(req types.NamespacedName, idx int, resourceDefinition marin3rv1alpha1.Resource, rType envoy.Type) (envoy.Resource, error) {
+	path := field.NewPath("spec", "resources").Index(idx).Child("value")
+
+	res := r.generator.New(rType)
+	if err := r.decoder.Unmarshal(string(resourceDefinition.Value.Raw), res); err != nil {
+		return nil,
+			resourceLoaderError(
+				req, string(resourceDefinition.Value.Raw), path,
+				fmt.Sprintf("Invalid envoy resource value: '%s'", err),
+			)
+	}
+
+	if errs := envoy_resources.ValidateAll(res, path); len(errs) > 0 {
+		return nil, errors.NewInvalid(
+			schema.GroupKind{Group: "envoy", Kind: "EnvoyConfig"},
+			fmt.Sprintf("%s/%s", req.Namespace, req.Name),
+			errs,
+		)
+	}
+
+	return res, nil
+}
+
 func resourceLoaderError(req types.NamespacedName, value interface{}, resPath *field.Path, msg string) error {
 	return errors.NewInvalid(
 		schema.GroupKind{Group: "envoy", Kind: "EnvoyConfig"},
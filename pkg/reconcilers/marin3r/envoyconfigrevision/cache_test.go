@@ -24,6 +24,7 @@ import (
 	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	envoy_service_runtime_v3 "github.com/envoyproxy/go-control-plane/envoy/service/runtime/v3"
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/types/known/structpb"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -138,7 +139,7 @@ func TestCacheReconciler_Reconcile(t *testing.T) {
 				decoder:   tt.fields.decoder,
 				generator: tt.fields.generator,
 			}
-			got, err := r.Reconcile(context.TODO(), tt.args.req, tt.args.resources, tt.args.nodeID, tt.args.version)
+			got, err := r.Reconcile(context.TODO(), tt.args.req, tt.args.resources, []string{tt.args.nodeID}, tt.args.version)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CacheReconciler.Reconcile() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -159,6 +160,28 @@ func TestCacheReconciler_Reconcile(t *testing.T) {
 	}
 }
 
+func TestCacheReconciler_Reconcile_NodeIDs(t *testing.T) {
+	xdsCache := xdss_v3.NewCache()
+	r := NewCacheReconciler(context.TODO(), ctrl.Log.WithName("test"), fake.NewClientBuilder().Build(), xdsCache,
+		envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3), envoy_resources.NewGenerator(envoy.APIv3))
+
+	resources := []marin3rv1alpha1.Resource{{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension(`{"name": "cluster"}`)}}
+	vt, err := r.Reconcile(context.TODO(), types.NamespacedName{Name: "ecr", Namespace: "test"}, resources, []string{"node-a", "node-b"}, "xxxx")
+	if err != nil {
+		t.Fatalf("CacheReconciler.Reconcile() error = %v", err)
+	}
+
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		snap, err := xdsCache.GetSnapshot(nodeID)
+		if err != nil {
+			t.Fatalf("CacheReconciler.Reconcile() snapshot for nodeID %q not found", nodeID)
+		}
+		if !reflect.DeepEqual(versionTrackerFor(snap), vt) {
+			t.Errorf("CacheReconciler.Reconcile() snapshot for nodeID %q = %v, want %v", nodeID, versionTrackerFor(snap), vt)
+		}
+	}
+}
+
 func TestCacheReconciler_GenerateSnapshot(t *testing.T) {
 	type fields struct {
 		ctx       context.Context
@@ -195,7 +218,7 @@ func TestCacheReconciler_GenerateSnapshot(t *testing.T) {
 					{Type: envoy.Endpoint, Value: k8sutil.StringtoRawExtension("{\"cluster_name\": \"endpoint\"}")},
 					{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension("{\"name\": \"cluster\"}")},
 					{Type: envoy.Route, Value: k8sutil.StringtoRawExtension("{\"name\": \"route\"}")},
-					{Type: envoy.ScopedRoute, Value: k8sutil.StringtoRawExtension("{\"name\": \"scoped_route\"}")},
+					{Type: envoy.ScopedRoute, Value: k8sutil.StringtoRawExtension("{\"name\": \"scoped_route\", \"key\": {\"fragments\": [{\"string_key\": \"key\"}]}}")},
 					{Type: envoy.Listener, Value: k8sutil.StringtoRawExtension("{\"name\": \"listener\"}")},
 					{Type: envoy.Runtime, Value: k8sutil.StringtoRawExtension("{\"name\": \"runtime\"}")},
 				},
@@ -211,7 +234,14 @@ func TestCacheReconciler_GenerateSnapshot(t *testing.T) {
 					&envoy_config_route_v3.RouteConfiguration{Name: "route"},
 				}).
 				SetResources(envoy.ScopedRoute, []envoy.Resource{
-					&envoy_config_route_v3.ScopedRouteConfiguration{Name: "scoped_route"},
+					&envoy_config_route_v3.ScopedRouteConfiguration{
+						Name: "scoped_route",
+						Key: &envoy_config_route_v3.ScopedRouteConfiguration_Key{
+							Fragments: []*envoy_config_route_v3.ScopedRouteConfiguration_Key_Fragment{{
+								Type: &envoy_config_route_v3.ScopedRouteConfiguration_Key_Fragment_StringKey{StringKey: "key"},
+							}},
+						},
+					},
 				}).
 				SetResources(envoy.Listener, []envoy.Resource{
 					&envoy_config_listener_v3.Listener{Name: "listener"},
@@ -221,6 +251,45 @@ func TestCacheReconciler_GenerateSnapshot(t *testing.T) {
 				}),
 			wantErr: false,
 		},
+		{
+			name: "Error, cluster fails validation rules",
+			fields: fields{
+				ctx:       context.TODO(),
+				logger:    ctrl.Log.WithName("test"),
+				client:    fake.NewClientBuilder().Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension("{\"name\": \"cluster\", \"connect_timeout\": \"-1s\"}")},
+				},
+			},
+			wantErr: true,
+			want:    xdss_v3.NewSnapshot(),
+		},
+		{
+			name: "Error, cluster references a missing endpoint",
+			fields: fields{
+				ctx:       context.TODO(),
+				logger:    ctrl.Log.WithName("test"),
+				client:    fake.NewClientBuilder().Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{Type: envoy.Endpoint, Value: k8sutil.StringtoRawExtension("{\"cluster_name\": \"endpoint\"}")},
+					{Type: envoy.Cluster, Value: k8sutil.StringtoRawExtension("{\"name\": \"cluster\", \"type\": \"EDS\"}")},
+				},
+			},
+			wantErr: true,
+			want:    xdss_v3.NewSnapshot(),
+		},
 		{
 			name: "Error, bad endpoint value",
 			fields: fields{
@@ -335,6 +404,131 @@ func TestCacheReconciler_GenerateSnapshot(t *testing.T) {
 			wantErr: true,
 			want:    xdss_v3.NewSnapshot(),
 		},
+		{
+			name: "Loads resources that read their value from ConfigMaps and Secrets into the snapshot",
+			fields: fields{
+				ctx:    context.TODO(),
+				logger: ctrl.Log.WithName("test"),
+				client: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "routes", Namespace: "xx"},
+						Data:       map[string]string{"route.yaml": "name: current\n"},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "clusters", Namespace: "xx"},
+						Data:       map[string][]byte{"cluster.json": []byte(`{"name": "cluster"}`)},
+					},
+				).Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{
+						Type: envoy.Route,
+						// the value recorded when the revision was created is served
+						Value: k8sutil.StringtoRawExtension(`{"name": "recorded"}`),
+						ValueFrom: &marin3rv1alpha1.ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "routes"}, Key: "route.yaml"}},
+					},
+					{
+						Type: envoy.Cluster,
+						ValueFrom: &marin3rv1alpha1.ResourceValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "clusters"}, Key: "cluster.json"}},
+					},
+					{
+						Type: envoy.Listener,
+						ValueFrom: &marin3rv1alpha1.ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "listener.yaml", Optional: pointer.New(true)}},
+					},
+				},
+			},
+			want: xdss_v3.NewSnapshot().
+				SetResources(envoy.Cluster, []envoy.Resource{
+					&envoy_config_cluster_v3.Cluster{Name: "cluster"},
+				}).
+				SetResources(envoy.Route, []envoy.Resource{
+					&envoy_config_route_v3.RouteConfiguration{Name: "recorded"},
+				}),
+			wantErr: false,
+		},
+		{
+			name: "Error, the ConfigMap a value is read from doesn't exist",
+			fields: fields{
+				ctx:       context.TODO(),
+				logger:    ctrl.Log.WithName("test"),
+				client:    fake.NewClientBuilder().Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{
+						Type: envoy.Route,
+						ValueFrom: &marin3rv1alpha1.ResourceValueSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "routes"}, Key: "route.yaml"}},
+					},
+				},
+			},
+			wantErr: true,
+			want:    xdss_v3.NewSnapshot(),
+		},
+		{
+			name: "Loads runtime resources generated from ConfigMaps into the snapshot",
+			fields: fields{
+				ctx:    context.TODO(),
+				logger: ctrl.Log.WithName("test"),
+				client: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "flags", Namespace: "xx"},
+						Data:       map[string]string{"feature.enabled": "true", "retries": "3"},
+					},
+				).Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{Type: envoy.Runtime, GenerateFromConfigMap: &marin3rv1alpha1.GenerateFromConfigMap{Name: "flags"}},
+				},
+			},
+			want: xdss_v3.NewSnapshot().
+				SetResources(envoy.Runtime, []envoy.Resource{
+					&envoy_service_runtime_v3.Runtime{
+						Name: "runtime",
+						Layer: &structpb.Struct{Fields: map[string]*structpb.Value{
+							"feature.enabled": structpb.NewBoolValue(true),
+							"retries":         structpb.NewNumberValue(3),
+						}},
+					},
+				}),
+			wantErr: false,
+		},
+		{
+			name: "Error, the ConfigMap a runtime is generated from doesn't exist",
+			fields: fields{
+				ctx:       context.TODO(),
+				logger:    ctrl.Log.WithName("test"),
+				client:    fake.NewClientBuilder().Build(),
+				xdsCache:  xdss_v3.NewCache(),
+				decoder:   envoy_serializer.NewResourceUnmarshaller(envoy_serializer.JSON, envoy.APIv3),
+				generator: envoy_resources_v3.Generator{},
+			},
+			args: args{
+				req: types.NamespacedName{Name: "xx", Namespace: "xx"},
+				resources: []marin3rv1alpha1.Resource{
+					{Type: envoy.Runtime, GenerateFromConfigMap: &marin3rv1alpha1.GenerateFromConfigMap{Name: "flags"}},
+				},
+			},
+			wantErr: true,
+			want:    xdss_v3.NewSnapshot(),
+		},
 		{
 			name: "Loads secret:tlsCertificate resources into the snapshot (v3)",
 			fields: fields{
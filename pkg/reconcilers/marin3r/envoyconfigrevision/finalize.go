@@ -1,6 +1,9 @@
 package reconcilers
 
 import (
+	"context"
+	"reflect"
+
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
 	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
 	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
@@ -8,12 +11,64 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 )
 
-// CleanupLogic executes finalization code for EnvoyConfigRevision resources
-func CleanupLogic(ecr *marin3rv1alpha1.EnvoyConfigRevision, xdssCache xdss.Cache, discoveryStats *stats.Stats, log logr.Logger) {
+// CleanupLogic executes finalization code for EnvoyConfigRevision resources. The snapshot of a published
+// revision with the "Retain" deletion policy is not cleared, it is tracked as orphaned instead.
+func CleanupLogic(ecr *marin3rv1alpha1.EnvoyConfigRevision, xdssCache xdss.Cache, discoveryStats *stats.Stats,
+	orphans *xdss.OrphanedSnapshots, log logr.Logger) {
+
+	published := meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition)
+
+	for _, nodeID := range ecr.GetNodeIDs() {
+		if published && ecr.GetDeletionPolicy() == marin3rv1alpha1.DeletionPolicyRetain && orphans != nil {
+			orphans.Add(nodeID, ecr.Spec.Version, ecr.GetRetainTTL())
+			log.Info("Retained snapshot in xDS server cache", "XDSS", string(ecr.GetEnvoyAPIVersion()), "NodeID", nodeID,
+				"TTL", ecr.GetRetainTTL().String())
+
+		} else if published {
+			discoveryStats.DeleteKeysByFilter(nodeID)
+			xdssCache.ClearSnapshot(nodeID)
+			log.Info("Successfully cleared xDS server cache", "XDSS", string(ecr.GetEnvoyAPIVersion()), "NodeID", nodeID)
 
-	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
-		discoveryStats.DeleteKeysByFilter(ecr.Spec.NodeID)
-		xdssCache.ClearSnapshot(ecr.Spec.NodeID)
-		log.Info("Successfully cleared xDS server cache", "XDSS", string(ecr.GetEnvoyAPIVersion()), "NodeID", ecr.Spec.NodeID)
+		} else if canary, err := xdssCache.GetCanary(nodeID); err == nil && canary.Version == ecr.Spec.Version {
+			if err := xdssCache.ClearCanary(context.Background(), nodeID); err != nil {
+				log.Error(err, "unable to clear canary snapshot from xDS server cache", "NodeID", nodeID)
+				continue
+			}
+			log.Info("Successfully cleared canary snapshot from xDS server cache", "XDSS", string(ecr.GetEnvoyAPIVersion()), "NodeID", nodeID)
+		}
 	}
 }
+
+// ClearRemovedNodeIDs clears the snapshots written for the nodeIDs in status.publishedNodeIDs that have been
+// removed from the spec of the EnvoyConfigRevision. Snapshots are only cleared if they still hold the resources
+// of this revision, as the nodeID could already be served by another EnvoyConfig.
+func ClearRemovedNodeIDs(ctx context.Context, ecr *marin3rv1alpha1.EnvoyConfigRevision, xdssCache xdss.Cache,
+	discoveryStats *stats.Stats, log logr.Logger) error {
+
+	current := map[string]bool{}
+	for _, nodeID := range ecr.GetNodeIDs() {
+		current[nodeID] = true
+	}
+
+	for _, nodeID := range ecr.Status.PublishedNodeIDs {
+		if current[nodeID] {
+			continue
+		}
+
+		if snap, err := xdssCache.GetSnapshot(nodeID); err == nil && ecr.Status.ProvidesVersions != nil &&
+			reflect.DeepEqual(versionTrackerFor(snap), ecr.Status.ProvidesVersions) {
+			discoveryStats.DeleteKeysByFilter(nodeID)
+			xdssCache.ClearSnapshot(nodeID)
+			log.Info("Cleared snapshot of removed nodeID from xDS server cache", "NodeID", nodeID)
+		}
+
+		if canary, err := xdssCache.GetCanary(nodeID); err == nil && canary.Version == ecr.Spec.Version {
+			if err := xdssCache.ClearCanary(ctx, nodeID); err != nil {
+				return err
+			}
+			log.Info("Cleared canary snapshot of removed nodeID from xDS server cache", "NodeID", nodeID)
+		}
+	}
+
+	return nil
+}
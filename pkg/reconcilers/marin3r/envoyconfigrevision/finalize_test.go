@@ -0,0 +1,106 @@
+package reconcilers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	xdss_v3 "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/v3"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestCleanupLogic(t *testing.T) {
+	tests := []struct {
+		name           string
+		deletionPolicy *marin3rv1alpha1.DeletionPolicy
+		wantSnapshot   bool
+		wantOrphans    int
+	}{
+		{
+			name:           "Clears the snapshot by default",
+			deletionPolicy: nil,
+			wantSnapshot:   false,
+			wantOrphans:    0,
+		},
+		{
+			name:           "Clears the snapshot with the Clear deletion policy",
+			deletionPolicy: pointer.New(marin3rv1alpha1.DeletionPolicyClear),
+			wantSnapshot:   false,
+			wantOrphans:    0,
+		},
+		{
+			name:           "Retains the snapshot with the Retain deletion policy",
+			deletionPolicy: pointer.New(marin3rv1alpha1.DeletionPolicyRetain),
+			wantSnapshot:   true,
+			wantOrphans:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := xdss_v3.NewCache()
+			if err := cache.SetSnapshot(context.TODO(), "node", xdss_v3.NewSnapshot()); err != nil {
+				t.Fatalf("Cache.SetSnapshot() error = %v", err)
+			}
+			dStats := stats.New()
+			orphans := xdss.NewOrphanedSnapshots(cache, dStats)
+			ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+				Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+					NodeID:         "node",
+					Version:        "xxxx",
+					DeletionPolicy: tt.deletionPolicy,
+					RetainTTL:      &metav1.Duration{Duration: time.Hour},
+				},
+				Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+					Conditions: []metav1.Condition{{Type: marin3rv1alpha1.RevisionPublishedCondition, Status: metav1.ConditionTrue}},
+				},
+			}
+
+			CleanupLogic(ecr, cache, dStats, orphans, ctrl.Log.WithName("test"))
+
+			if _, err := cache.GetSnapshot("node"); (err == nil) != tt.wantSnapshot {
+				t.Errorf("CleanupLogic() snapshot found = %v, want %v", err == nil, tt.wantSnapshot)
+			}
+			if got := orphans.List(); len(got) != tt.wantOrphans {
+				t.Errorf("CleanupLogic() orphaned snapshots = %v, want %v", got, tt.wantOrphans)
+			}
+		})
+	}
+}
+
+func TestClearRemovedNodeIDs(t *testing.T) {
+	cache := xdss_v3.NewCache()
+	snap := xdss_v3.NewSnapshot()
+	for _, nodeID := range []string{"node", "removed", "taken"} {
+		if err := cache.SetSnapshot(context.TODO(), nodeID, snap); err != nil {
+			t.Fatalf("Cache.SetSnapshot() error = %v", err)
+		}
+	}
+	// the snapshot of a nodeID taken over by another EnvoyConfig holds different resources
+	if err := cache.SetSnapshot(context.TODO(), "taken", xdss_v3.NewSnapshot().SetResources(envoy.Cluster, []envoy.Resource{&envoy_config_cluster_v3.Cluster{Name: "other"}})); err != nil {
+		t.Fatalf("Cache.SetSnapshot() error = %v", err)
+	}
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{NodeID: "node", Version: "xxxx"},
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			ProvidesVersions: versionTrackerFor(snap),
+			PublishedNodeIDs: []string{"removed", "taken"},
+		},
+	}
+
+	if err := ClearRemovedNodeIDs(context.TODO(), ecr, cache, stats.New(), ctrl.Log.WithName("test")); err != nil {
+		t.Fatalf("ClearRemovedNodeIDs() error = %v", err)
+	}
+
+	for nodeID, want := range map[string]bool{"node": true, "removed": false, "taken": true} {
+		if _, err := cache.GetSnapshot(nodeID); (err == nil) != want {
+			t.Errorf("ClearRemovedNodeIDs() snapshot for nodeID %q found = %v, want %v", nodeID, err == nil, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/envoy/admin"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// HealthAnalyzer analyzes the stats of the Envoy clients after a revision is published. The
+// value of each counter when first retrieved from an Envoy client is used as the baseline to
+// calculate its increase. Baselines are kept in memory, so they are retaken if the process
+// restarts during the analysis.
+type HealthAnalyzer struct {
+	client   *http.Client
+	analyses map[types.UID]*healthAnalysis
+	mu       sync.Mutex
+}
+
+// healthAnalysis holds the baselines of the analysis of a single publication of a revision
+type healthAnalysis struct {
+	publishedAt time.Time
+	// baselines holds, for each pod, the first value retrieved for each counter
+	baselines map[string]map[string]uint64
+}
+
+// NewHealthAnalyzer returns a HealthAnalyzer that retrieves
+// the stats of the Envoy clients with the given http client
+func NewHealthAnalyzer(client *http.Client) *HealthAnalyzer {
+	return &HealthAnalyzer{
+		client:   client,
+		analyses: map[types.UID]*healthAnalysis{},
+	}
+}
+
+// IsHealthAnalysisRequired returns true if the EnvoyConfigRevision is published, untainted
+// and the bake time of its health analysis has not elapsed yet. It also returns the time
+// at which the bake time elapses.
+func IsHealthAnalysisRequired(ecr *marin3rv1alpha1.EnvoyConfigRevision, now time.Time) (bool, time.Time) {
+	if ecr.Spec.HealthAnalysis == nil || ecr.Status.LastPublishedAt == nil || !ecr.Status.IsPublished() || ecr.Status.IsTainted() {
+		return false, time.Time{}
+	}
+	end := ecr.Status.LastPublishedAt.Add(ecr.Spec.HealthAnalysis.GetBakeTime())
+	return now.Before(end), end
+}
+
+// Analyze retrieves the stats of the Envoy clients listening at the given addresses, indexed by
+// pod name, and compares their increase since the start of the analysis with the thresholds of
+// the health analysis of the EnvoyConfigRevision. It returns a message describing the exceeded
+// thresholds, an empty string if none has been exceeded. Envoy clients whose stats can't be
+// retrieved are skipped, and an error is only returned if none of them can be reached.
+func (ha *HealthAnalyzer) Analyze(ctx context.Context, ecr *marin3rv1alpha1.EnvoyConfigRevision, addresses map[string]string) (string, error) {
+	thresholds := ecr.Spec.HealthAnalysis.Thresholds
+	matchers := make([]*regexp.Regexp, len(thresholds))
+	patterns := make([]string, len(thresholds))
+	for idx, threshold := range thresholds {
+		patterns[idx] = statPattern(threshold.Stat)
+		matchers[idx] = regexp.MustCompile("^" + patterns[idx] + "$")
+	}
+	filter := regexp.MustCompile("^(" + strings.Join(patterns, "|") + ")$")
+
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	analysis, ok := ha.analyses[ecr.GetUID()]
+	if !ok || !analysis.publishedAt.Equal(ecr.Status.LastPublishedAt.Time) {
+		analysis = &healthAnalysis{publishedAt: ecr.Status.LastPublishedAt.Time, baselines: map[string]map[string]uint64{}}
+		ha.analyses[ecr.GetUID()] = analysis
+	}
+
+	increases := make([]uint64, len(thresholds))
+	var lastErr error
+	reached := 0
+	for pod, address := range addresses {
+		counters, err := admin.GetCounters(ctx, ha.client, address, filter)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reached++
+
+		baselines, ok := analysis.baselines[pod]
+		if !ok {
+			baselines = map[string]uint64{}
+			analysis.baselines[pod] = baselines
+		}
+		for name, value := range counters {
+			baseline, ok := baselines[name]
+			if !ok {
+				baselines[name] = value
+				continue
+			}
+			// the counter has been reset, likely due to a restart of the Envoy client
+			if value < baseline {
+				baseline = 0
+				baselines[name] = 0
+			}
+			for idx, matcher := range matchers {
+				if matcher.MatchString(name) {
+					increases[idx] += value - baseline
+				}
+			}
+		}
+	}
+
+	if reached == 0 && lastErr != nil {
+		return "", fmt.Errorf("unable to retrieve stats from any of the Envoy clients: %w", lastErr)
+	}
+
+	failures := []string{}
+	for idx, threshold := range thresholds {
+		if increases[idx] > uint64(threshold.MaxIncrease) {
+			failures = append(failures, fmt.Sprintf("'%s' increased by %d, above the maximum of %d",
+				threshold.Stat, increases[idx], threshold.MaxIncrease))
+		}
+	}
+
+	return strings.Join(failures, ", "), nil
+}
+
+// Forget removes the baselines of the analysis of the EnvoyConfigRevision
+func (ha *HealthAnalyzer) Forget(ecr *marin3rv1alpha1.EnvoyConfigRevision) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	delete(ha.analyses, ecr.GetUID())
+}
+
+// statPattern returns the regular expression for a stat name where
+// the "*" wildcard matches any sequence of characters
+func statPattern(stat string) string {
+	parts := strings.Split(stat, "*")
+	for idx := range parts {
+		parts[idx] = regexp.QuoteMeta(parts[idx])
+	}
+	return strings.Join(parts, ".*")
+}
@@ -0,0 +1,134 @@
+package reconcilers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsHealthAnalysisRequired(t *testing.T) {
+	publishedAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	healthAnalysis := &marin3rv1alpha1.HealthAnalysis{
+		Thresholds: []marin3rv1alpha1.StatThreshold{{Stat: "cluster.*.upstream_rq_5xx", MaxIncrease: 10}},
+		BakeTime:   &metav1.Duration{Duration: time.Minute},
+	}
+
+	tests := []struct {
+		name           string
+		healthAnalysis *marin3rv1alpha1.HealthAnalysis
+		status         marin3rv1alpha1.EnvoyConfigRevisionStatus
+		now            time.Time
+		want           bool
+	}{
+		{
+			name:           "Required during the bake time",
+			healthAnalysis: healthAnalysis,
+			status:         marin3rv1alpha1.EnvoyConfigRevisionStatus{Published: pointer.New(true), LastPublishedAt: &metav1.Time{Time: publishedAt}},
+			now:            publishedAt.Add(30 * time.Second),
+			want:           true,
+		},
+		{
+			name:           "Not required after the bake time",
+			healthAnalysis: healthAnalysis,
+			status:         marin3rv1alpha1.EnvoyConfigRevisionStatus{Published: pointer.New(true), LastPublishedAt: &metav1.Time{Time: publishedAt}},
+			now:            publishedAt.Add(2 * time.Minute),
+			want:           false,
+		},
+		{
+			name:           "Not required without a health analysis",
+			healthAnalysis: nil,
+			status:         marin3rv1alpha1.EnvoyConfigRevisionStatus{Published: pointer.New(true), LastPublishedAt: &metav1.Time{Time: publishedAt}},
+			now:            publishedAt.Add(30 * time.Second),
+			want:           false,
+		},
+		{
+			name:           "Not required if the revision is not published",
+			healthAnalysis: healthAnalysis,
+			status:         marin3rv1alpha1.EnvoyConfigRevisionStatus{Published: pointer.New(false), LastPublishedAt: &metav1.Time{Time: publishedAt}},
+			now:            publishedAt.Add(30 * time.Second),
+			want:           false,
+		},
+		{
+			name:           "Not required if the revision is tainted",
+			healthAnalysis: healthAnalysis,
+			status: marin3rv1alpha1.EnvoyConfigRevisionStatus{Published: pointer.New(true), Tainted: pointer.New(true),
+				LastPublishedAt: &metav1.Time{Time: publishedAt}},
+			now:  publishedAt.Add(30 * time.Second),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+				Spec:   marin3rv1alpha1.EnvoyConfigRevisionSpec{HealthAnalysis: tt.healthAnalysis},
+				Status: tt.status,
+			}
+			if got, _ := IsHealthAnalysisRequired(ecr, tt.now); got != tt.want {
+				t.Errorf("IsHealthAnalysisRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthAnalyzer_Analyze(t *testing.T) {
+	var errors5xx uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "cluster.backend.upstream_rq_5xx: %d\ncluster.other.upstream_rq_5xx: %d\n", errors5xx, errors5xx)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "default", UID: "uid"},
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+			HealthAnalysis: &marin3rv1alpha1.HealthAnalysis{
+				Thresholds: []marin3rv1alpha1.StatThreshold{{Stat: "cluster.*.upstream_rq_5xx", MaxIncrease: 10}},
+			},
+		},
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			Published:       pointer.New(true),
+			LastPublishedAt: &metav1.Time{Time: time.Now()},
+		},
+	}
+	ha := NewHealthAnalyzer(server.Client())
+	addresses := map[string]string{"pod": u.Host}
+
+	steps := []struct {
+		name      string
+		errors5xx uint64
+		want      string
+	}{
+		{name: "Takes the baselines", errors5xx: 100, want: ""},
+		{name: "Increase below the threshold", errors5xx: 104, want: ""},
+		{name: "Increase above the threshold", errors5xx: 106, want: "'cluster.*.upstream_rq_5xx' increased by 12, above the maximum of 10"},
+		{name: "Counters reset", errors5xx: 2, want: ""},
+	}
+	for _, step := range steps {
+		errors5xx = step.errors5xx
+		got, err := ha.Analyze(context.TODO(), ecr, addresses)
+		if err != nil {
+			t.Fatalf("HealthAnalyzer.Analyze() %s: error = %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("HealthAnalyzer.Analyze() %s: got %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	ha.Forget(ecr)
+	errors5xx = 200
+	if got, _ := ha.Analyze(context.TODO(), ecr, addresses); got != "" {
+		t.Errorf("HealthAnalyzer.Analyze() after Forget: got %q, want baselines to be retaken", got)
+	}
+
+	if _, err := ha.Analyze(context.TODO(), ecr, map[string]string{"pod": "127.0.0.1:1"}); err == nil {
+		t.Errorf("HealthAnalyzer.Analyze() wants error when no Envoy client can be reached")
+	}
+}
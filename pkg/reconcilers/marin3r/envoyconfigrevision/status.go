@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
 	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
@@ -26,11 +30,44 @@ func IsStatusReconciled(ecr *marin3rv1alpha1.EnvoyConfigRevision, vt *marin3rv1a
 		ok = false
 	}
 
+	// Note: the list of NACKs is not cleared when no NACKs are found to avoid losing the
+	// information in the case of loss of statistics (i.e. a restart)
+	if vt != nil {
+		if nacks := calculateLastNACKs(ecr, ecr.Status.ProvidesVersions, dStats); len(nacks) > 0 && !reflect.DeepEqual(ecr.Status.LastNACKs, nacks) {
+			ecr.Status.LastNACKs = nacks
+			ok = false
+		}
+	}
+
+	// Keep track of the Envoy clients that have acknowledged the revision while it is being rolled out
+	if vt != nil && ecr.Status.Rollout != nil && !meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+		selected, inSync := calculateRolloutProgress(ecr, ecr.Status.ProvidesVersions, dStats)
+		if ecr.Status.Rollout.SelectedPods == nil || *ecr.Status.Rollout.SelectedPods != selected ||
+			ecr.Status.Rollout.PodsInSync == nil || *ecr.Status.Rollout.PodsInSync != inSync {
+			ecr.Status.Rollout.SelectedPods = pointer.New(selected)
+			ecr.Status.Rollout.PodsInSync = pointer.New(inSync)
+			ok = false
+		}
+	}
+
+	// Keep track of the additional nodeIDs the resources are written to while the revision is
+	// published or rolled out, so their snapshots can be cleared once removed from spec.nodeIDs
+	var publishedNodeIDs []string
+	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) || ecr.Status.Rollout != nil {
+		if additional := ecr.GetNodeIDs()[1:]; len(additional) > 0 {
+			publishedNodeIDs = additional
+		}
+	}
+	if !reflect.DeepEqual(ecr.Status.PublishedNodeIDs, publishedNodeIDs) {
+		ecr.Status.PublishedNodeIDs = publishedNodeIDs
+		ok = false
+	}
+
 	// Note: tainted condition is never automatically removed to avoid retrying a bad config in the case of
-	// loss of statistics (i.e. a restart)
+	// loss of statistics (i.e. a restart). It can only be cleared with the ClearTaintAnnotation (see ClearTaint).
 	var taintedCond *metav1.Condition
 	if vt != nil {
-		taintedCond = calculateRevisionTaintedCondition(ecr, ecr.Status.ProvidesVersions, dStats, 1)
+		taintedCond = calculateRevisionTaintedCondition(ecr, ecr.Status.ProvidesVersions, dStats)
 	}
 
 	if taintedCond != nil {
@@ -81,14 +118,16 @@ func calculateResourcesInSyncCondition(ecr *marin3rv1alpha1.EnvoyConfigRevision,
 
 	if meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
 		// Check what is currently written in the xds server cache
-		_, err := xdssCache.GetSnapshot(ecr.Spec.NodeID)
-		// OutOfSync if NodeID not found or resources version different that expected
-		if err != nil {
-			return &metav1.Condition{
-				Type:    marin3rv1alpha1.ResourcesInSyncCondition,
-				Reason:  "SnapshotDoesNotExist",
-				Status:  metav1.ConditionFalse,
-				Message: fmt.Sprintf("A snapshot for nodeID %q does not yet exist in the xDS server cache", ecr.Spec.NodeID),
+		for _, nodeID := range ecr.GetNodeIDs() {
+			_, err := xdssCache.GetSnapshot(nodeID)
+			// OutOfSync if NodeID not found or resources version different that expected
+			if err != nil {
+				return &metav1.Condition{
+					Type:    marin3rv1alpha1.ResourcesInSyncCondition,
+					Reason:  "SnapshotDoesNotExist",
+					Status:  metav1.ConditionFalse,
+					Message: fmt.Sprintf("A snapshot for nodeID %q does not yet exist in the xDS server cache", nodeID),
+				}
 			}
 		}
 
@@ -103,23 +142,223 @@ func calculateResourcesInSyncCondition(ecr *marin3rv1alpha1.EnvoyConfigRevision,
 	return nil
 }
 
-func calculateRevisionTaintedCondition(ecr *marin3rv1alpha1.EnvoyConfigRevision, vt *marin3rv1alpha1.VersionTracker, dStats *stats.Stats, threshold float64) *metav1.Condition {
+func calculateRevisionTaintedCondition(ecr *marin3rv1alpha1.EnvoyConfigRevision, vt *marin3rv1alpha1.VersionTracker, dStats *stats.Stats) *metav1.Condition {
+
+	// The failure policy determines when each Envoy client is considered
+	// to be failing and the ratio of clients that taints the revision
+	threshold := ecr.Spec.FailurePolicy.GetPodsRatio()
+	failureThreshold := stats.FailureThreshold{
+		NACKs:  ecr.Spec.FailurePolicy.GetNACKsPerPod(),
+		Window: ecr.Spec.FailurePolicy.GetEvaluationWindow(),
+	}
+
+	// While the revision is being rolled out, only the Envoy
+	// clients that are served the revision are taken into account
+	percentageFailing := func(nodeID, rType, version string) float64 {
+		return dStats.GetPercentageFailing(nodeID, rType, version, failureThreshold)
+	}
+	if ecr.Status.Rollout != nil && !meta.IsStatusConditionTrue(ecr.Status.Conditions, marin3rv1alpha1.RevisionPublishedCondition) {
+		percentageFailing = func(nodeID, rType, version string) float64 {
+			return dStats.GetPercentageFailingForPods(nodeID, rType, version,
+				canaryPods(dStats.GetSubscribedPods(nodeID, rType), ecr.Status.Rollout.Percentage), failureThreshold)
+		}
+	}
+
+	// The failure threshold is evaluated separately for the Envoy clients of each nodeID
+	failing := ""
+	nodeIDs := ecr.GetNodeIDs()
+loop:
+	for _, nodeID := range nodeIDs {
+		for _, v := range trackedVersions(vt) {
+			if percentageFailing(nodeID, envoy_resources.TypeURL(v.rType, ecr.GetEnvoyAPIVersion()), v.version) >= threshold {
+				failing = nodeID
+				break loop
+			}
+		}
+	}
+
+	if failing != "" {
+		msg := fmt.Sprintf("EnvoyConfigRevision resources are being rejected by more than %d%% of the Envoy clients", int(math.Round(threshold*100)))
+		if len(nodeIDs) > 1 {
+			msg = fmt.Sprintf("%s of nodeID %q", msg, failing)
+		}
+		if details := nackMessages(calculateLastNACKs(ecr, vt, dStats)); len(details) > 0 {
+			msg = fmt.Sprintf("%s: %s", msg, strings.Join(details, "; "))
+		}
+		msg = truncate(msg, maxConditionMessageLength)
 
-	if dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Endpoint, ecr.GetEnvoyAPIVersion()), vt.Endpoints) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Cluster, ecr.GetEnvoyAPIVersion()), vt.Clusters) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Route, ecr.GetEnvoyAPIVersion()), vt.Routes) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.ScopedRoute, ecr.GetEnvoyAPIVersion()), vt.ScopedRoutes) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Listener, ecr.GetEnvoyAPIVersion()), vt.Listeners) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Secret, ecr.GetEnvoyAPIVersion()), vt.Secrets) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.Runtime, ecr.GetEnvoyAPIVersion()), vt.Runtimes) == threshold ||
-		dStats.GetPercentageFailing(ecr.Spec.NodeID, envoy_resources.TypeURL(envoy.ExtensionConfig, ecr.GetEnvoyAPIVersion()), vt.ExtensionConfigs) == threshold {
 		return &metav1.Condition{
 			Type:    marin3rv1alpha1.RevisionTaintedCondition,
 			Reason:  "ResourcesFailing",
 			Status:  metav1.ConditionTrue,
-			Message: fmt.Sprintf("EnvoyConfigRevision resources are being rejected by more than %d%% of the Envoy clients", int(math.Round(threshold*100))),
+			Message: msg,
 		}
 	}
 
 	return nil
 }
+
+// maxConditionMessageLength is the maximum length of the message
+// of a metav1.Condition, as enforced by the API server
+const maxConditionMessageLength int = 32768
+
+// maxLastNACKs is the maximum number of NACKs reported in the status of a revision,
+// so a large fleet rejecting the resources doesn't exceed the size limit of the object
+const maxLastNACKs int = 20
+
+// maxNACKMessageLength is the maximum length of the
+// message of each one of the NACKs reported in the status
+const maxNACKMessageLength int = 1024
+
+// calculateLastNACKs returns the latest NACK reported by each Envoy client for each one of the
+// resource types of the revision, sorted by resource type, nodeID and pod name. Only the
+// maxLastNACKs most recent ones are returned, with their messages truncated to
+// maxNACKMessageLength. The nodeID of the Envoy clients is only reported when the revision
+// is published to more than one.
+func calculateLastNACKs(ecr *marin3rv1alpha1.EnvoyConfigRevision, vt *marin3rv1alpha1.VersionTracker, dStats *stats.Stats) []marin3rv1alpha1.NACKReport {
+
+	list := []marin3rv1alpha1.NACKReport{}
+	times := []time.Time{}
+	nodeIDs := ecr.GetNodeIDs()
+	for _, v := range trackedVersions(vt) {
+		if v.version == "" {
+			continue
+		}
+		for _, nodeID := range nodeIDs {
+			nacks := dStats.GetLastNACKs(nodeID, envoy_resources.TypeURL(v.rType, ecr.GetEnvoyAPIVersion()), v.version)
+			pods := make([]string, 0, len(nacks))
+			for pod := range nacks {
+				pods = append(pods, pod)
+			}
+			sort.Strings(pods)
+			for _, pod := range pods {
+				report := marin3rv1alpha1.NACKReport{
+					PodName:      pod,
+					ResourceType: v.rType,
+					Version:      v.version,
+					Message:      truncate(nacks[pod], maxNACKMessageLength),
+				}
+				if len(nodeIDs) > 1 {
+					report.NodeID = nodeID
+				}
+				list = append(list, report)
+				times = append(times, dStats.GetLastNACKTime(nodeID, envoy_resources.TypeURL(v.rType, ecr.GetEnvoyAPIVersion()), v.version, pod))
+			}
+		}
+	}
+
+	if len(list) <= maxLastNACKs {
+		return list
+	}
+
+	// keep the most recent ones, in the same order
+	idxs := make([]int, len(list))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	sort.SliceStable(idxs, func(i, j int) bool { return times[idxs[i]].After(times[idxs[j]]) })
+	idxs = idxs[:maxLastNACKs]
+	sort.Ints(idxs)
+
+	recent := make([]marin3rv1alpha1.NACKReport, 0, maxLastNACKs)
+	for _, idx := range idxs {
+		recent = append(recent, list[idx])
+	}
+	return recent
+}
+
+// truncate returns the string cut to a maximum of max bytes,
+// without splitting a multi-byte UTF-8 character
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// nackMessages returns the unique error messages in the list of NACKs, keeping
+// the order in which they appear
+func nackMessages(nacks []marin3rv1alpha1.NACKReport) []string {
+	seen := map[string]bool{}
+	msgs := []string{}
+	for _, nack := range nacks {
+		if !seen[nack.Message] {
+			seen[nack.Message] = true
+			msgs = append(msgs, nack.Message)
+		}
+	}
+	return msgs
+}
+
+type trackedVersion struct {
+	rType   envoy.Type
+	version string
+}
+
+// trackedVersions returns the version of each one of the resource types
+// in the VersionTracker, in a fixed order
+func trackedVersions(vt *marin3rv1alpha1.VersionTracker) []trackedVersion {
+	return []trackedVersion{
+		{envoy.Endpoint, vt.Endpoints},
+		{envoy.Cluster, vt.Clusters},
+		{envoy.Route, vt.Routes},
+		{envoy.ScopedRoute, vt.ScopedRoutes},
+		{envoy.Listener, vt.Listeners},
+		{envoy.Secret, vt.Secrets},
+		{envoy.Runtime, vt.Runtimes},
+		{envoy.ExtensionConfig, vt.ExtensionConfigs},
+	}
+}
+
+// canaryPods returns the pods that are served the canary snapshot
+// when it is served to the given percentage of the Envoy clients
+func canaryPods(pods map[string]int8, percentage int32) map[string]int8 {
+	m := map[string]int8{}
+	for pod := range pods {
+		if xdss.InCanary(pod, percentage) {
+			m[pod] = 1
+		}
+	}
+	return m
+}
+
+// calculateRolloutProgress returns the number of Envoy clients selected to receive the revision
+// in the current step of the rollout and how many of them have acknowledged all its resources
+func calculateRolloutProgress(ecr *marin3rv1alpha1.EnvoyConfigRevision, vt *marin3rv1alpha1.VersionTracker, dStats *stats.Stats) (int32, int32) {
+
+	var selected, inSync int32
+	for _, nodeID := range ecr.GetNodeIDs() {
+		for pod := range canaryPods(dStats.GetSubscribedPods(nodeID, ""), ecr.Status.Rollout.Percentage) {
+			selected++
+			if isPodInSync(ecr, nodeID, vt, pod, dStats) {
+				inSync++
+			}
+		}
+	}
+
+	return selected, inSync
+}
+
+// isPodInSync returns true if the Pod has acknowledged the version
+// of each one of the resource types it is subscribed to
+func isPodInSync(ecr *marin3rv1alpha1.EnvoyConfigRevision, nodeID string, vt *marin3rv1alpha1.VersionTracker, pod string, dStats *stats.Stats) bool {
+
+	for _, v := range trackedVersions(vt) {
+		if v.version == "" {
+			continue
+		}
+		rType := envoy_resources.TypeURL(v.rType, ecr.GetEnvoyAPIVersion())
+		if _, err := dStats.GetCounter(nodeID, rType, "*", pod, "request_counter"); err != nil {
+			// the pod is not subscribed to this resource type
+			continue
+		}
+		if acks, err := dStats.GetCounter(nodeID, rType, v.version, pod, "ack_counter"); err != nil || acks < 1 {
+			return false
+		}
+	}
+
+	return true
+}
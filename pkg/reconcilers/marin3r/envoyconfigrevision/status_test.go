@@ -2,8 +2,12 @@ package reconcilers
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
 	xdss "github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss"
@@ -378,11 +382,11 @@ func Test_calculateResourcesInSyncCondition(t *testing.T) {
 }
 
 func Test_calculateRevisionTaintedCondition(t *testing.T) {
+	testNow := time.Now()
 	type args struct {
-		ecr        *marin3rv1alpha1.EnvoyConfigRevision
-		vt         *marin3rv1alpha1.VersionTracker
-		dStats     *stats.Stats
-		thresshold float64
+		ecr    *marin3rv1alpha1.EnvoyConfigRevision
+		vt     *marin3rv1alpha1.VersionTracker
+		dStats *stats.Stats
 	}
 	tests := []struct {
 		name string
@@ -417,7 +421,26 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 					"node:" + resource_v3.EndpointType + ":xxxx:pod-cccc:nack_counter":          {Object: int64(10), Expiration: int64(0)},
 					"node:" + resource_v3.EndpointType + ":xxxx:pod-dddd:nack_counter":          {Object: int64(10), Expiration: int64(0)},
 				}, time.Now()),
-				thresshold: 1,
+			},
+			want: corev1.ConditionTrue,
+		},
+		{
+			name: "All endpoints of an additional nodeID fail, return taint",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						NodeIDs:  []string{"other"},
+						EnvoyAPI: pointer.New(envoy.APIv3),
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter:stream_1":  {Object: int64(2), Expiration: int64(0)},
+					"other:" + resource_v3.EndpointType + ":*:pod-bbbb:request_counter:stream_2": {Object: int64(5), Expiration: int64(0)},
+					"other:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:nack_counter":          {Object: int64(10), Expiration: int64(0)},
+				}, time.Now()),
 			},
 			want: corev1.ConditionTrue,
 		},
@@ -429,6 +452,9 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
 						NodeID:   "node",
 						EnvoyAPI: pointer.New(envoy.APIv3),
+						FailurePolicy: &marin3rv1alpha1.FailurePolicy{
+							PodsPercentage: pointer.New(int32(50)),
+						},
 					},
 				},
 				vt: &marin3rv1alpha1.VersionTracker{
@@ -447,7 +473,6 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_counter":          {Object: int64(5), Expiration: int64(0)},
 					"node:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:nack_counter":          {Object: int64(10), Expiration: int64(0)},
 				}, time.Now()),
-				thresshold: 0.5,
 			},
 			want: corev1.ConditionTrue,
 		},
@@ -459,6 +484,9 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
 						NodeID:   "node",
 						EnvoyAPI: pointer.New(envoy.APIv3),
+						FailurePolicy: &marin3rv1alpha1.FailurePolicy{
+							PodsPercentage: pointer.New(int32(50)),
+						},
 					},
 				},
 				vt: &marin3rv1alpha1.VersionTracker{
@@ -476,7 +504,77 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 					"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter:stream_1": {Object: int64(2), Expiration: int64(0)},
 					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_counter":          {Object: int64(1), Expiration: int64(0)},
 				}, time.Now()),
-				thresshold: 0.5,
+			},
+			want: corev1.ConditionFalse,
+		},
+		{
+			name: "All endpoints selected in the rollout fail, return taint",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						EnvoyAPI: pointer.New(envoy.APIv3),
+					},
+					Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+						// pod-bbbb and pod-dddd are selected
+						Rollout: &marin3rv1alpha1.RevisionRolloutStatus{Step: 0, Percentage: 50},
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{
+					Endpoints: "xxxx",
+				},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"node:" + resource_v3.EndpointType + ":*:pod-bbbb:request_counter:stream_2": {Object: int64(5), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":*:pod-cccc:request_counter:stream_3": {Object: int64(1), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":*:pod-dddd:request_counter:stream_4": {Object: int64(1), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter:stream_1": {Object: int64(2), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:nack_counter":          {Object: int64(10), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-dddd:nack_counter":          {Object: int64(10), Expiration: int64(0)},
+				}, time.Now()),
+			},
+			want: corev1.ConditionTrue,
+		},
+		{
+			name: "A single NACK fails the only endpoint, return taint",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:        "node",
+						EnvoyAPI:      pointer.New(envoy.APIv3),
+						FailurePolicy: &marin3rv1alpha1.FailurePolicy{NACKsPerPod: pointer.New(int32(1))},
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter:stream_1": {Object: int64(2), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_counter":          {Object: int64(1), Expiration: int64(0)},
+				}, time.Now()),
+			},
+			want: corev1.ConditionTrue,
+		},
+		{
+			name: "NACKs out of the evaluation window, return nil",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						EnvoyAPI: pointer.New(envoy.APIv3),
+						FailurePolicy: &marin3rv1alpha1.FailurePolicy{
+							NACKsPerPod:      pointer.New(int32(2)),
+							EvaluationWindow: &metav1.Duration{Duration: time.Minute},
+						},
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter:stream_1": {Object: int64(2), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_counter":          {Object: int64(10), Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_times": {
+						Object: []time.Time{testNow.Add(-time.Hour), testNow.Add(-10 * time.Second)}, Expiration: int64(0)},
+				}, testNow),
 			},
 			want: corev1.ConditionFalse,
 		},
@@ -490,15 +588,14 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 						EnvoyAPI: pointer.New(envoy.APIv3),
 					},
 				}, vt: &marin3rv1alpha1.VersionTracker{},
-				dStats:     stats.NewWithItems(map[string]cache.Item{}, time.Now()),
-				thresshold: 1,
+				dStats: stats.NewWithItems(map[string]cache.Item{}, time.Now()),
 			},
 			want: corev1.ConditionFalse,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := calculateRevisionTaintedCondition(tt.args.ecr, tt.args.vt, tt.args.dStats, tt.args.thresshold)
+			got := calculateRevisionTaintedCondition(tt.args.ecr, tt.args.vt, tt.args.dStats)
 			if tt.want == corev1.ConditionFalse && got != nil {
 				t.Errorf("calculateRevisionTaintedCondition() = %v, want %v", got, tt.want)
 				return
@@ -510,3 +607,194 @@ func Test_calculateRevisionTaintedCondition(t *testing.T) {
 		})
 	}
 }
+
+func Test_calculateLastNACKs(t *testing.T) {
+	type args struct {
+		ecr    *marin3rv1alpha1.EnvoyConfigRevision
+		vt     *marin3rv1alpha1.VersionTracker
+		dStats *stats.Stats
+	}
+	tests := []struct {
+		name string
+		args args
+		want []marin3rv1alpha1.NACKReport
+	}{
+		{
+			name: "Returns the NACKs of the revision versions",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						EnvoyAPI: pointer.New(envoy.APIv3),
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{
+					Endpoints: "xxxx",
+					Clusters:  "yyyy",
+				},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:last_nack": {Object: "endpoint error", Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:last_nack": {Object: "endpoint error", Expiration: int64(0)},
+					"node:" + resource_v3.ClusterType + ":yyyy:pod-aaaa:last_nack":  {Object: "cluster error", Expiration: int64(0)},
+					"node:" + resource_v3.ClusterType + ":zzzz:pod-aaaa:last_nack":  {Object: "old cluster error", Expiration: int64(0)},
+				}, time.Now()),
+			},
+			want: []marin3rv1alpha1.NACKReport{
+				{PodName: "pod-aaaa", ResourceType: envoy.Endpoint, Version: "xxxx", Message: "endpoint error"},
+				{PodName: "pod-bbbb", ResourceType: envoy.Endpoint, Version: "xxxx", Message: "endpoint error"},
+				{PodName: "pod-aaaa", ResourceType: envoy.Cluster, Version: "yyyy", Message: "cluster error"},
+			},
+		},
+		{
+			name: "Returns the NACKs of each nodeID",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						NodeIDs:  []string{"other"},
+						EnvoyAPI: pointer.New(envoy.APIv3),
+					},
+				},
+				vt: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				dStats: stats.NewWithItems(map[string]cache.Item{
+					"other:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:last_nack": {Object: "endpoint error", Expiration: int64(0)},
+					"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:last_nack":  {Object: "endpoint error", Expiration: int64(0)},
+				}, time.Now()),
+			},
+			want: []marin3rv1alpha1.NACKReport{
+				{PodName: "pod-aaaa", NodeID: "node", ResourceType: envoy.Endpoint, Version: "xxxx", Message: "endpoint error"},
+				{PodName: "pod-bbbb", NodeID: "other", ResourceType: envoy.Endpoint, Version: "xxxx", Message: "endpoint error"},
+			},
+		},
+		{
+			name: "No data, returns an empty list",
+			args: args{
+				ecr: &marin3rv1alpha1.EnvoyConfigRevision{
+					ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+					Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+						NodeID:   "node",
+						EnvoyAPI: pointer.New(envoy.APIv3),
+					},
+				},
+				vt:     &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				dStats: stats.NewWithItems(map[string]cache.Item{}, time.Now()),
+			},
+			want: []marin3rv1alpha1.NACKReport{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateLastNACKs(tt.args.ecr, tt.args.vt, tt.args.dStats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calculateLastNACKs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_calculateLastNACKs_Limits(t *testing.T) {
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+			NodeID:   "node",
+			EnvoyAPI: pointer.New(envoy.APIv3),
+		},
+	}
+	vt := &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"}
+
+	// pod-00 is the oldest NACK and pod-24 the most recent one
+	now := time.Now()
+	items := map[string]cache.Item{}
+	for i := 0; i < maxLastNACKs+5; i++ {
+		key := fmt.Sprintf("node:%s:xxxx:pod-%02d", resource_v3.EndpointType, i)
+		items[key+":last_nack"] = cache.Item{Object: strings.Repeat("é", maxNACKMessageLength), Expiration: int64(0)}
+		items[key+":nack_times"] = cache.Item{Object: []time.Time{now.Add(time.Duration(i) * time.Second)}, Expiration: int64(0)}
+	}
+
+	got := calculateLastNACKs(ecr, vt, stats.NewWithItems(items, now))
+	if len(got) != maxLastNACKs {
+		t.Fatalf("calculateLastNACKs() returned %d NACKs, want %d", len(got), maxLastNACKs)
+	}
+	if got[0].PodName != "pod-05" || got[maxLastNACKs-1].PodName != "pod-24" {
+		t.Errorf("calculateLastNACKs() = %s...%s, want the most recent NACKs pod-05...pod-24", got[0].PodName, got[maxLastNACKs-1].PodName)
+	}
+	if msg := got[0].Message; len(msg) > maxNACKMessageLength || !utf8.ValidString(msg) {
+		t.Errorf("calculateLastNACKs() message of %d bytes, valid UTF-8 %v", len(msg), utf8.ValidString(msg))
+	}
+}
+
+func Test_truncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"Shorter than max", "abc", 5, "abc"},
+		{"Longer than max", "abcdef", 3, "abc"},
+		{"Doesn't split multi-byte characters", "aéb", 2, "a"},
+		{"Keeps complete multi-byte characters", "aéb", 3, "aé"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.s, tt.max); got != tt.want {
+				t.Errorf("truncate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_calculateRolloutProgress(t *testing.T) {
+	// with a 50% rollout pod-bbbb and pod-dddd are
+	// selected and pod-aaaa and pod-cccc are not
+	ecr := &marin3rv1alpha1.EnvoyConfigRevision{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecr", Namespace: "test"},
+		Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+			NodeID:   "node",
+			EnvoyAPI: pointer.New(envoy.APIv3),
+		},
+		Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+			Rollout: &marin3rv1alpha1.RevisionRolloutStatus{Step: 0, Percentage: 50},
+		},
+	}
+	vt := &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx", Clusters: "yyyy"}
+
+	tests := []struct {
+		name         string
+		dStats       *stats.Stats
+		wantSelected int32
+		wantInSync   int32
+	}{
+		{
+			name: "Counts the selected pods that acknowledged all the subscribed types",
+			dStats: stats.NewWithItems(map[string]cache.Item{
+				"node:" + resource_v3.EndpointType + ":*:pod-aaaa:request_counter": {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.EndpointType + ":*:pod-bbbb:request_counter": {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.ClusterType + ":*:pod-bbbb:request_counter":  {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.EndpointType + ":*:pod-dddd:request_counter": {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.ClusterType + ":*:pod-dddd:request_counter":  {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:ack_counter":  {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.EndpointType + ":xxxx:pod-bbbb:ack_counter":  {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.ClusterType + ":yyyy:pod-bbbb:ack_counter":   {Object: int64(1), Expiration: int64(0)},
+				"node:" + resource_v3.EndpointType + ":xxxx:pod-dddd:ack_counter":  {Object: int64(1), Expiration: int64(0)},
+			}, time.Now()),
+			wantSelected: 2,
+			wantInSync:   1,
+		},
+		{
+			name:         "No data, returns zero",
+			dStats:       stats.NewWithItems(map[string]cache.Item{}, time.Now()),
+			wantSelected: 0,
+			wantInSync:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSelected, gotInSync := calculateRolloutProgress(ecr, vt, tt.dStats)
+			if gotSelected != tt.wantSelected || gotInSync != tt.wantInSync {
+				t.Errorf("calculateRolloutProgress() = %v, %v, want %v, %v", gotSelected, gotInSync, tt.wantSelected, tt.wantInSync)
+			}
+		})
+	}
+}
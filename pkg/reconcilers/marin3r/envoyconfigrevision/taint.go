@@ -0,0 +1,43 @@
+package reconcilers
+
+import (
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	envoy_resources "github.com/3scale-ops/marin3r/pkg/envoy/resources"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// IsTaintClearRequested returns true if the EnvoyConfigRevision has the ClearTaintAnnotation,
+// and whether the taint is being cleared by the retry policy of the EnvoyConfig
+func IsTaintClearRequested(ecr *marin3rv1alpha1.EnvoyConfigRevision) (bool, bool) {
+	value, ok := ecr.GetAnnotations()[marin3rv1alpha1.ClearTaintAnnotation]
+	return ok, value == marin3rv1alpha1.ClearTaintRetryValue
+}
+
+// ClearTaint removes the RevisionTainted condition of the EnvoyConfigRevision, along with the
+// NACKs received for its resources, so the revision does not get tainted again right away. The
+// status.taintRetries counter is incremented when retrying and reset when the taint is manually cleared.
+func ClearTaint(ecr *marin3rv1alpha1.EnvoyConfigRevision, dStats *stats.Stats, retry bool) {
+
+	if ecr.Status.ProvidesVersions != nil {
+		for _, v := range trackedVersions(ecr.Status.ProvidesVersions) {
+			if v.version == "" {
+				continue
+			}
+			for _, nodeID := range ecr.GetNodeIDs() {
+				dStats.ClearNACKs(nodeID, envoy_resources.TypeURL(v.rType, ecr.GetEnvoyAPIVersion()), v.version)
+			}
+		}
+	}
+
+	meta.RemoveStatusCondition(&ecr.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition)
+	ecr.Status.Tainted = pointer.New(false)
+	ecr.Status.LastNACKs = nil
+
+	if retry {
+		ecr.Status.TaintRetries++
+	} else {
+		ecr.Status.TaintRetries = 0
+	}
+}
@@ -0,0 +1,108 @@
+package reconcilers
+
+import (
+	"testing"
+	"time"
+
+	marin3rv1alpha1 "github.com/3scale-ops/marin3r/apis/marin3r/v1alpha1"
+	"github.com/3scale-ops/marin3r/pkg/discoveryservice/xdss/stats"
+	"github.com/3scale-ops/marin3r/pkg/envoy"
+	"github.com/3scale-ops/marin3r/pkg/util/pointer"
+	resource_v3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/patrickmn/go-cache"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsTaintClearRequested(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantClear   bool
+		wantRetry   bool
+	}{
+		{
+			name:        "Manual clear",
+			annotations: map[string]string{marin3rv1alpha1.ClearTaintAnnotation: ""},
+			wantClear:   true,
+			wantRetry:   false,
+		},
+		{
+			name:        "Retry",
+			annotations: map[string]string{marin3rv1alpha1.ClearTaintAnnotation: marin3rv1alpha1.ClearTaintRetryValue},
+			wantClear:   true,
+			wantRetry:   true,
+		},
+		{
+			name:        "Not requested",
+			annotations: nil,
+			wantClear:   false,
+			wantRetry:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecr := &marin3rv1alpha1.EnvoyConfigRevision{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			gotClear, gotRetry := IsTaintClearRequested(ecr)
+			if gotClear != tt.wantClear || gotRetry != tt.wantRetry {
+				t.Errorf("IsTaintClearRequested() = %v, %v, want %v, %v", gotClear, gotRetry, tt.wantClear, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestClearTaint(t *testing.T) {
+	ecr := func() *marin3rv1alpha1.EnvoyConfigRevision {
+		return &marin3rv1alpha1.EnvoyConfigRevision{
+			Spec: marin3rv1alpha1.EnvoyConfigRevisionSpec{
+				NodeID:   "node",
+				EnvoyAPI: pointer.New(envoy.APIv3),
+			},
+			Status: marin3rv1alpha1.EnvoyConfigRevisionStatus{
+				Conditions: []metav1.Condition{{
+					Type:   marin3rv1alpha1.RevisionTaintedCondition,
+					Status: metav1.ConditionTrue,
+				}},
+				Tainted:          pointer.New(true),
+				ProvidesVersions: &marin3rv1alpha1.VersionTracker{Endpoints: "xxxx"},
+				LastNACKs:        []marin3rv1alpha1.NACKReport{{PodName: "pod-aaaa"}},
+				TaintRetries:     2,
+			},
+		}
+	}
+	dStats := func() *stats.Stats {
+		return stats.NewWithItems(map[string]cache.Item{
+			"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:nack_counter": {Object: int64(10), Expiration: int64(0)},
+			"node:" + resource_v3.EndpointType + ":xxxx:pod-aaaa:last_nack":    {Object: "error", Expiration: int64(0)},
+		}, time.Now())
+	}
+
+	tests := []struct {
+		name        string
+		retry       bool
+		wantRetries int32
+	}{
+		{name: "Retry increments the attempts", retry: true, wantRetries: 3},
+		{name: "Manual clear resets the attempts", retry: false, wantRetries: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ecr()
+			s := dStats()
+			ClearTaint(got, s, tt.retry)
+
+			if meta.FindStatusCondition(got.Status.Conditions, marin3rv1alpha1.RevisionTaintedCondition) != nil || got.Status.IsTainted() {
+				t.Errorf("ClearTaint() revision is still tainted: %v", got.Status)
+			}
+			if got.Status.LastNACKs != nil {
+				t.Errorf("ClearTaint() lastNACKs = %v, want nil", got.Status.LastNACKs)
+			}
+			if got.Status.TaintRetries != tt.wantRetries {
+				t.Errorf("ClearTaint() taintRetries = %v, want %v", got.Status.TaintRetries, tt.wantRetries)
+			}
+			if s.IsPodFailing("node", resource_v3.EndpointType, "xxxx", "pod-aaaa", stats.FailureThreshold{NACKs: 1}) {
+				t.Errorf("ClearTaint() NACKs not cleared")
+			}
+		})
+	}
+}
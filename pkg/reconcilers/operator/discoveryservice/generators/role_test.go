@@ -73,6 +73,31 @@ func TestGeneratorOptions_Role(t *testing.T) {
 						Resources: []string{"endpointslices"},
 						Verbs:     []string{"get", "list", "watch"},
 					},
+					{
+						APIGroups: []string{corev1.SchemeGroupVersion.Group},
+						Resources: []string{"configmaps"},
+						Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+					},
+					{
+						APIGroups: []string{corev1.SchemeGroupVersion.Group},
+						Resources: []string{"secrets"},
+						Verbs:     []string{"create"},
+					},
+					{
+						APIGroups: []string{corev1.SchemeGroupVersion.Group},
+						Resources: []string{"events"},
+						Verbs:     []string{"create", "patch"},
+					},
+					{
+						APIGroups: []string{operatorv1alpha1.GroupVersion.Group},
+						Resources: []string{"discoveryservices"},
+						Verbs:     []string{"get", "list", "watch"},
+					},
+					{
+						APIGroups: []string{operatorv1alpha1.GroupVersion.Group},
+						Resources: []string{"discoveryservices/status"},
+						Verbs:     []string{"get", "update", "patch"},
+					},
 				},
 			},
 		},
@@ -3,3 +3,12 @@ package pointer
 func New[T any](t T) *T {
 	return &t
 }
+
+// Copy returns a pointer to a copy of the value the given pointer
+// points to, nil if the given pointer is nil
+func Copy[T any](t *T) *T {
+	if t == nil {
+		return nil
+	}
+	return New(*t)
+}
@@ -74,7 +74,8 @@ const (
 
 	// Annotations to allow configuration of the init manager for
 	// Envoy sidecards
-	paramInitMgrImage = "init-manager.image"
+	paramInitMgrImage     = "init-manager.image"
+	paramInitMgrXdssDelta = "init-manager.xdss-delta"
 )
 
 type envoySidecarConfig struct {
@@ -134,6 +135,7 @@ func (esc *envoySidecarConfig) PopulateFromAnnotations(ctx context.Context, clnt
 	esc.generator.ShutdownManagerDrainStrategy = getDrainStrategy(annotations)
 
 	esc.generator.InitManagerImage = getStringParam(paramInitMgrImage, annotations)
+	esc.generator.XdssDelta = isXdssDeltaEnabled(annotations)
 
 	xdssHost, xdssPort, err := getDiscoveryServiceAddress(ctx, clnt, namespace, annotations)
 	if err != nil {
@@ -190,6 +192,7 @@ func getStringParam(key string, annotations map[string]string) string {
 		paramEnvoyAdminBindAddress:   defaults.EnvoyAdminBindAddress,
 		paramEnvoyAdminAccessLogPath: defaults.EnvoyAdminAccessLogPath,
 		paramInitMgrImage:            defaults.InitMgrImage(),
+		paramInitMgrXdssDelta:        "false",
 	}
 
 	// return the value specified in the corresponding annotation, if any
@@ -405,6 +408,14 @@ func isShtdnMgrEnabled(annotations map[string]string) bool {
 	return b
 }
 
+func isXdssDeltaEnabled(annotations map[string]string) bool {
+	b, err := strconv.ParseBool(getStringParam(paramInitMgrXdssDelta, annotations))
+	if err != nil {
+		return false
+	}
+	return b
+}
+
 func (esc *envoySidecarConfig) containers() []corev1.Container {
 
 	return esc.generator.Containers()
@@ -748,6 +748,50 @@ func Test_isShtdnMgrEnabled(t *testing.T) {
 	}
 }
 
+func Test_isXdssDeltaEnabled(t *testing.T) {
+	type args struct {
+		annotations map[string]string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "Returns true (value: true)",
+			args: args{
+				annotations: map[string]string{
+					fmt.Sprintf("%s/%s", marin3rAnnotationsDomain, paramInitMgrXdssDelta): "true",
+				},
+			},
+			want: true,
+		},
+		{
+			name: "Returns false (unset)",
+			args: args{
+				annotations: map[string]string{},
+			},
+			want: false,
+		},
+		{
+			name: "Returns false (bad value)",
+			args: args{
+				annotations: map[string]string{
+					fmt.Sprintf("%s/%s", marin3rAnnotationsDomain, paramInitMgrXdssDelta): "bad_value",
+				},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isXdssDeltaEnabled(tt.args.annotations); got != tt.want {
+				t.Errorf("isXdssDeltaEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_getPortOrDefault(t *testing.T) {
 	type args struct {
 		key         string